@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/summary"
+)
+
+const usage = `usage: summarize [flags] url-or-file...
+
+Summarizes each web page URL or local HTML file and writes
+the summaries to standard output as JSON, one per line.
+
+flags:
+`
+
+func main() {
+	article := flag.Bool("article", false, "also extract each page's main article text")
+	iconSize := flag.Int("icon-size", summary.DefaultIconSize, "size in pixels the icon should best fit")
+	verifyIcon := flag.Bool("verify-icon", false, "check that the chosen icon is reachable")
+	base := flag.String("base", "", "URL that relative URLs in local files are resolved against")
+	providersFile := flag.String("providers", "", "JSON file of additional summary providers")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	providers := summary.NewProviderRegistry()
+	if len(*providersFile) > 0 {
+		if err := providers.LoadFile(*providersFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error loading providers: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	//the URLs come from whoever is running the command,
+	//so unlike the server, private addresses are allowed
+	fetcher := summary.NewHTTPFetcher(&http.Client{Timeout: summary.DefaultFetchTimeout})
+	s := summary.NewSummarizer(fetcher, providers)
+	opts := &summary.Options{
+		IconSize:   *iconSize,
+		VerifyIcon: *verifyIcon,
+		Article:    *article,
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	failed := false
+	for _, arg := range flag.Args() {
+		var sum *summary.Summary
+		var err error
+		if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+			sum, err = s.Summarize(context.Background(), arg, opts)
+		} else {
+			sum, err = summarizeFile(s, arg, *base, opts)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", arg, err)
+			failed = true
+			continue
+		}
+		encoder.Encode(sum)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+//summarizeFile summarizes the HTML file at `path`. Relative URLs are
+//resolved against `base` if it's set, or else against the file's own URL
+func summarizeFile(s *summary.Summarizer, path string, base string, opts *summary.Options) (*summary.Summary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pageURL *url.URL
+	if len(base) > 0 {
+		pageURL, err = url.Parse(base)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base URL: %v", err)
+		}
+	} else {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		pageURL = &url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}
+	}
+	return s.SummarizeReader(f, pageURL, opts)
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/audit"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//adminUsersPath is the path prefix for specific users in the admin API
+const adminUsersPath = "/v1/admin/users/"
+
+//adminUserUpdates are the changes admins and moderators can make to
+//an account. Fields that aren't set are left alone
+type adminUserUpdates struct {
+	Role     *users.Role `json:"role"`
+	Disabled *bool       `json:"disabled"`
+	Deleted  *bool       `json:"deleted"`
+	//TwoFactor can only be set to false, which turns off two-factor
+	//authentication for users who've lost their app and recovery codes
+	TwoFactor *bool `json:"twoFactor"`
+}
+
+//AdminUsersHandler lists every user, with the full record of each, for
+//moderators and admins. The list can be filtered by the `role`, `disabled`
+//and `deleted` query string parameters, and is paginated like the user list
+func (ctx *Context) AdminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+	filter := &users.Filter{}
+	q := r.URL.Query()
+	if role := q.Get("role"); len(role) > 0 {
+		filter.Role = users.Role(role)
+		if err := filter.Role.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for param, field := range map[string]**bool{"disabled": &filter.Disabled, "deleted": &filter.Deleted} {
+		if v := q.Get(param); len(v) > 0 {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, param+" must be true or false", http.StatusBadRequest)
+				return
+			}
+			*field = &b
+		}
+	}
+	var after interface{}
+	p, err := ctx.parsePage(r, &after)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	found, err := ctx.UserStore.List(filter, normalizeID(after), p.Limit+1)
+	if err != nil {
+		http.Error(w, "Error fetching users", http.StatusInternalServerError)
+		return
+	}
+	if len(found) > p.Limit {
+		found = found[:p.Limit]
+		if err := ctx.setNextPage(w, r, p, found[len(found)-1].ID); err != nil {
+			http.Error(w, "Error fetching users", http.StatusInternalServerError)
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, found)
+}
+
+//AdminUserHandler handles /v1/admin/users/{id}, which gets or updates the
+//role and disabled or deleted state of an account, and /v1/admin/users/{id}/sessions,
+//which signs the user out everywhere when deleted. Moderators can only
+//act on ordinary users and only admins can change roles. Nobody can act
+//on their own account, so that admins can't lock themselves out
+func (ctx *Context) AdminUserHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, adminUsersPath), "/")
+	if len(parts[0]) == 0 || len(parts) > 2 || len(parts) == 2 && parts[1] != "sessions" {
+		http.NotFound(w, r)
+		return
+	}
+	target, err := ctx.UserStore.GetByID(parts[0])
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	actor := sessionStateFrom(r).User
+	if r.Method != "GET" && !canModerate(actor, target) {
+		http.Error(w, "You are not allowed to do that", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && r.Method == "DELETE":
+		if err := ctx.endSessions(target); err != nil {
+			http.Error(w, "Error signing out user", http.StatusInternalServerError)
+			return
+		}
+		if !ctx.record(w, audit.NewEntry(audit.ActionSignOut, actor, target, nil)) {
+			return
+		}
+		w.Header().Add("Content-Type", contentTypeTextUTF8)
+		w.Write([]byte("User has been signed out"))
+	case len(parts) == 1 && r.Method == "GET":
+		respondJSON(w, http.StatusOK, target)
+	case len(parts) == 1 && r.Method == "PATCH":
+		ctx.updateAccount(w, r, actor, target)
+	default:
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+	}
+}
+
+//updateAccount changes the role, disabled or deleted state or
+//two-factor authentication of `target`. Moderators can only
+//disable and enable users, and the rest is left to admins
+func (ctx *Context) updateAccount(w http.ResponseWriter, r *http.Request, actor *users.User, target *users.User) {
+	updates := &adminUserUpdates{}
+	if err := json.NewDecoder(r.Body).Decode(updates); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if updates.Role != nil {
+		if err := updates.Role.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !actor.Role.AtLeast(users.RoleAdmin) {
+			http.Error(w, "Only admins can change roles", http.StatusForbidden)
+			return
+		}
+	}
+	if updates.Deleted != nil && !actor.Role.AtLeast(users.RoleAdmin) {
+		http.Error(w, "Only admins can delete or restore users", http.StatusForbidden)
+		return
+	}
+	if updates.TwoFactor != nil && !actor.Role.AtLeast(users.RoleAdmin) {
+		http.Error(w, "Only admins can reset two-factor authentication", http.StatusForbidden)
+		return
+	}
+	if updates.TwoFactor != nil && *updates.TwoFactor {
+		http.Error(w, "Only users can turn on two-factor authentication", http.StatusBadRequest)
+		return
+	}
+
+	if updates.Role != nil && *updates.Role != target.Role {
+		if err := ctx.UserStore.SetRole(target.ID, *updates.Role); err != nil {
+			http.Error(w, "Error changing role", http.StatusInternalServerError)
+			return
+		}
+		details := map[string]interface{}{"from": target.Role, "to": *updates.Role}
+		if !ctx.record(w, audit.NewEntry(audit.ActionSetRole, actor, target, details)) {
+			return
+		}
+	}
+	if updates.Disabled != nil && *updates.Disabled != target.Disabled {
+		if err := ctx.UserStore.SetDisabled(target.ID, *updates.Disabled); err != nil {
+			http.Error(w, "Error disabling user", http.StatusInternalServerError)
+			return
+		}
+		action := audit.ActionEnable
+		if *updates.Disabled {
+			action = audit.ActionDisable
+			//so that re-enabling the account doesn't bring back old sessions
+			if err := ctx.endSessions(target); err != nil {
+				http.Error(w, "Error signing out user", http.StatusInternalServerError)
+				return
+			}
+		}
+		if !ctx.record(w, audit.NewEntry(action, actor, target, nil)) {
+			return
+		}
+	}
+	if updates.Deleted != nil && *updates.Deleted != (target.DeletedAt != nil) {
+		action := audit.ActionRestore
+		if *updates.Deleted {
+			action = audit.ActionDelete
+			if err := ctx.UserStore.Delete(target.ID, time.Now()); err != nil {
+				http.Error(w, "Error deleting user", http.StatusInternalServerError)
+				return
+			}
+			if err := ctx.endSessions(target); err != nil {
+				http.Error(w, "Error signing out user", http.StatusInternalServerError)
+				return
+			}
+		} else if err := ctx.UserStore.Restore(target.ID); err != nil {
+			http.Error(w, "Error restoring user", http.StatusInternalServerError)
+			return
+		}
+		if !ctx.record(w, audit.NewEntry(action, actor, target, nil)) {
+			return
+		}
+	}
+
+	if updates.TwoFactor != nil && target.TwoFactor.Enabled {
+		if err := ctx.UserStore.SetTwoFactor(target.ID, "", false); err != nil {
+			http.Error(w, "Error resetting two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+		if err := ctx.UserStore.SetRecoveryCodes(target.ID, nil); err != nil {
+			http.Error(w, "Error resetting two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+		if !ctx.record(w, audit.NewEntry(audit.ActionResetTwoFactor, actor, target, nil)) {
+			return
+		}
+	}
+
+	updated, err := ctx.UserStore.GetByID(target.ID)
+	if err != nil {
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, updated)
+}
+
+//AdminAuditHandler lists the audit log for admins, newest first
+func (ctx *Context) AdminAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+	var before int64
+	p, err := ctx.parsePage(r, &before)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, err := ctx.AuditLog.List(before, p.Limit+1)
+	if err != nil {
+		http.Error(w, "Error fetching audit log", http.StatusInternalServerError)
+		return
+	}
+	if len(entries) > p.Limit {
+		entries = entries[:p.Limit]
+		if err := ctx.setNextPage(w, r, p, entries[len(entries)-1].ID); err != nil {
+			http.Error(w, "Error fetching audit log", http.StatusInternalServerError)
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, entries)
+}
+
+//canModerate reports whether `actor` may act on the account of `target`.
+//Admins can act on anyone else, and moderators on users below them
+func canModerate(actor *users.User, target *users.User) bool {
+	if actor.IsSelf(target) {
+		return false
+	}
+	return actor.Role.AtLeast(users.RoleAdmin) || !target.Role.AtLeast(actor.Role)
+}
+
+//record adds an entry to the audit log. If it can't be added, it
+//responds with an error and returns false, since the action has
+//already been taken but there's no record of it
+func (ctx *Context) record(w http.ResponseWriter, entry *audit.Entry) bool {
+	if err := ctx.AuditLog.Insert(entry); err != nil {
+		log.Printf("error recording %s of user %v by %v: %v", entry.Action, entry.TargetID, entry.ActorID, err)
+		http.Error(w, "Error recording action", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/middleware"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/apikeys"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/audit"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+func TestAdmin(t *testing.T) {
+	ctx := newMessagingContext()
+	ctx.AuditLog = audit.NewMemStore()
+	ctx.APIKeys = apikeys.NewMemStore()
+	admin := signUp(t, ctx, "ada")
+	mod := signUp(t, ctx, "moe")
+	alice := signUp(t, ctx, "alice")
+	bob := signUp(t, ctx, "bob")
+
+	userID := func(name string) users.UserID {
+		u, err := ctx.UserStore.GetByUserName(name)
+		if err != nil {
+			t.Fatalf("error getting %s: %v\n", name, err)
+		}
+		return u.ID
+	}
+	ctx.UserStore.SetRole(userID("ada"), users.RoleAdmin)
+	ctx.UserStore.SetRole(userID("moe"), users.RoleModerator)
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/admin/users", middleware.Adapt(http.HandlerFunc(ctx.AdminUsersHandler), ctx.RequireAuth(), ctx.RequireRole(users.RoleModerator)))
+	mux.Handle(adminUsersPath, middleware.Adapt(http.HandlerFunc(ctx.AdminUserHandler), ctx.RequireAuth(), ctx.RequireRole(users.RoleModerator)))
+	mux.Handle("/v1/admin/audit", middleware.Adapt(http.HandlerFunc(ctx.AdminAuditHandler), ctx.RequireAuth(), ctx.RequireRole(users.RoleAdmin)))
+	mux.Handle("/v1/channels", middleware.Adapt(http.HandlerFunc(ctx.ChannelsHandler), ctx.RequireAuth()))
+	userPath := func(name string) string {
+		return adminUsersPath + userID(name).(string)
+	}
+	role := func(r users.Role) *adminUserUpdates {
+		return &adminUserUpdates{Role: &r}
+	}
+	disable := func(d bool) *adminUserUpdates {
+		return &adminUserUpdates{Disabled: &d}
+	}
+	deleted := func(d bool) *adminUserUpdates {
+		return &adminUserUpdates{Deleted: &d}
+	}
+	resetTwoFactor := false
+
+	cases := []struct {
+		method string
+		path   string
+		auth   string
+		body   interface{}
+		status int
+	}{
+		{"GET", "/v1/admin/users", "", nil, http.StatusUnauthorized},
+		{"GET", "/v1/admin/users", alice, nil, http.StatusForbidden},
+		{"GET", "/v1/admin/users", mod, nil, http.StatusOK},
+		{"GET", "/v1/admin/users?role=superuser", mod, nil, http.StatusBadRequest},
+		{"GET", "/v1/admin/audit", mod, nil, http.StatusForbidden},
+		//moderators can't change roles or act on other moderators and admins
+		{"PATCH", userPath("alice"), mod, role(users.RoleModerator), http.StatusForbidden},
+		{"PATCH", userPath("ada"), mod, disable(true), http.StatusForbidden},
+		{"PATCH", userPath("moe"), mod, disable(true), http.StatusForbidden},
+		//or delete users or reset their two-factor authentication
+		{"PATCH", userPath("bob"), mod, deleted(true), http.StatusForbidden},
+		{"PATCH", userPath("bob"), mod, &adminUserUpdates{TwoFactor: &resetTwoFactor}, http.StatusForbidden},
+		//admins can't lock themselves out
+		{"PATCH", userPath("ada"), admin, role(users.RoleUser), http.StatusForbidden},
+		{"PATCH", userPath("alice"), admin, role("superuser"), http.StatusBadRequest},
+		{"PATCH", adminUsersPath + "nobody", admin, disable(true), http.StatusNotFound},
+		{"PATCH", userPath("alice"), admin, role(users.RoleModerator), http.StatusOK},
+		{"PATCH", userPath("bob"), mod, disable(true), http.StatusOK},
+	}
+	for _, c := range cases {
+		if resRec := do(mux, c.method, c.path, c.auth, c.body); resRec.Code != c.status {
+			t.Errorf("%s %s: expected status %d but got %d: %s\n", c.method, c.path, c.status, resRec.Code, resRec.Body.String())
+		}
+	}
+
+	//role changes take effect on the existing session
+	if resRec := do(mux, "GET", "/v1/admin/users", alice, nil); resRec.Code != http.StatusOK {
+		t.Errorf("promoted user: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+
+	//disabled users' sessions are ended, and they can't sign back in
+	if resRec := do(mux, "GET", "/v1/channels", bob, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("disabled user: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	signIn := &users.Credentials{Email: "bob@test.com", Password: "password"}
+	if resRec := do(http.HandlerFunc(ctx.SessionsHandler), "POST", "/v1/sessions", "", signIn); resRec.Code != http.StatusForbidden {
+		t.Errorf("disabled user signing in: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+	disabled := []*users.User{}
+	resRec := do(mux, "GET", "/v1/admin/users?disabled=true", mod, nil)
+	if err := json.NewDecoder(resRec.Body).Decode(&disabled); err != nil || len(disabled) != 1 || disabled[0].UserName != "bob" {
+		t.Errorf("incorrect disabled users: %v %v\n", disabled, err)
+	}
+
+	//re-enabled users can sign in again, but their old sessions stay ended
+	if resRec := do(mux, "PATCH", userPath("bob"), admin, disable(false)); resRec.Code != http.StatusOK {
+		t.Fatalf("re-enabling: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if resRec := do(mux, "GET", "/v1/channels", bob, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("old session: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	resRec = do(http.HandlerFunc(ctx.SessionsHandler), "POST", "/v1/sessions", "", signIn)
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("signing in: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	bob = resRec.Header().Get("Authorization")
+	if resRec := do(mux, "GET", "/v1/channels", bob, nil); resRec.Code != http.StatusOK {
+		t.Errorf("new session: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+
+	//forced sign-out ends every session and revokes API keys
+	key, raw, _ := (&apikeys.NewAPIKey{Name: "bob's", Scopes: []string{apikeys.ScopeRead}}).ToAPIKey(userID("bob"))
+	ctx.APIKeys.Insert(key)
+	if resRec := do(mux, "GET", "/v1/channels", "ApiKey "+raw, nil); resRec.Code != http.StatusOK {
+		t.Fatalf("using an API key: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if resRec := do(mux, "DELETE", userPath("bob")+"/sessions", admin, nil); resRec.Code != http.StatusOK {
+		t.Fatalf("signing out: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if resRec := do(mux, "GET", "/v1/channels", bob, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("signed out session: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	if resRec := do(mux, "GET", "/v1/channels", "ApiKey "+raw, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("API key after signing out: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+
+	//admins can delete accounts, and restore them until they're purged
+	for _, d := range []bool{true, false} {
+		resRec := do(mux, "PATCH", userPath("bob"), admin, deleted(d))
+		restored := &users.User{}
+		if err := json.NewDecoder(resRec.Body).Decode(restored); err != nil || (restored.DeletedAt != nil) != d {
+			t.Errorf("deleted %t: incorrect user %v %v\n", d, restored, err)
+		}
+	}
+
+	//every action was recorded
+	resRec = do(mux, "GET", "/v1/admin/audit", admin, nil)
+	entries := []*audit.Entry{}
+	if err := json.NewDecoder(resRec.Body).Decode(&entries); err != nil {
+		t.Fatalf("error decoding audit log: %v\n", err)
+	}
+	expected := []audit.Action{audit.ActionRestore, audit.ActionDelete, audit.ActionSignOut, audit.ActionEnable, audit.ActionDisable, audit.ActionSetRole}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d audit entries but got %d\n", len(expected), len(entries))
+	}
+	for i, e := range entries {
+		if e.Action != expected[i] {
+			t.Errorf("audit entry %d: expected %s but got %s\n", i, expected[i], e.Action)
+		}
+	}
+	if entries[5].Details["to"] != string(users.RoleModerator) {
+		t.Errorf("role change details were not recorded: %v\n", entries[5].Details)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/apikeys"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//apiKeysPath is where UsersMeAPIKeysHandler is served
+const apiKeysPath = "/v1/users/me/apikeys"
+
+//maxAPIKeys is the most API keys a user can have at once
+const maxAPIKeys = 25
+
+//createdAPIKey is the response to creating an API key,
+//which is the only time the key itself is sent
+type createdAPIKey struct {
+	*apikeys.APIKey
+	Key string `json:"key"`
+}
+
+//UsersMeAPIKeysHandler lists the signed-in user's API keys at the
+//apiKeysPath, and creates a new one when posted a name and scopes,
+//responding with the key. Deleting /v1/users/me/apikeys/{prefix}
+//revokes a key. API keys can't be used to manage API keys
+func (ctx *Context) UsersMeAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := ctx.sessionViewer(r)
+	if user == nil {
+		http.Error(w, "You must be signed in", http.StatusUnauthorized)
+		return
+	}
+	prefix := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, apiKeysPath), "/")
+
+	switch {
+	case len(prefix) == 0 && r.Method == "GET":
+		found, err := ctx.APIKeys.ListByUser(user.ID)
+		if err != nil {
+			http.Error(w, "Error fetching API keys", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusOK, found)
+	case len(prefix) == 0 && r.Method == "POST":
+		nk := &apikeys.NewAPIKey{}
+		if err := json.NewDecoder(r.Body).Decode(nk); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := nk.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		//the admin scope would do nothing for anyone else
+		for _, scope := range nk.Scopes {
+			if scope == apikeys.ScopeAdmin && !user.Role.AtLeast(users.RoleModerator) {
+				http.Error(w, "Only moderators and admins can create admin API keys", http.StatusForbidden)
+				return
+			}
+		}
+		found, err := ctx.APIKeys.ListByUser(user.ID)
+		if err != nil {
+			http.Error(w, "Error creating API key", http.StatusInternalServerError)
+			return
+		}
+		if len(found) >= maxAPIKeys {
+			http.Error(w, fmt.Sprintf("You can have at most %d API keys", maxAPIKeys), http.StatusConflict)
+			return
+		}
+		key, raw, err := nk.ToAPIKey(user.ID)
+		if err != nil {
+			http.Error(w, "Error creating API key", http.StatusInternalServerError)
+			return
+		}
+		if err := ctx.APIKeys.Insert(key); err != nil {
+			http.Error(w, "Error creating API key", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusCreated, &createdAPIKey{APIKey: key, Key: raw})
+	case len(prefix) > 0 && !strings.Contains(prefix, "/") && r.Method == "DELETE":
+		key, err := ctx.APIKeys.Get(prefix)
+		if err != nil || fmt.Sprint(key.UserID) != fmt.Sprint(user.ID) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		if err := ctx.APIKeys.Delete(key.Prefix); err != nil {
+			http.Error(w, "Error revoking API key", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-Type", contentTypeTextUTF8)
+		w.Write([]byte("API key has been revoked"))
+	default:
+		http.Error(w, "Error with request", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/middleware"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/apikeys"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := newMessagingContext()
+	ctx.APIKeys = apikeys.NewMemStore()
+	keys := http.HandlerFunc(ctx.UsersMeAPIKeysHandler)
+	channels := middleware.Adapt(http.HandlerFunc(ctx.ChannelsHandler), ctx.RequireAuth())
+	admin := middleware.Adapt(http.HandlerFunc(ctx.AdminUsersHandler), ctx.RequireAuth(), ctx.RequireRole(users.RoleModerator))
+	alice := signUp(t, ctx, "alice")
+	create := func(auth string, nk *apikeys.NewAPIKey) *createdAPIKey {
+		resRec := do(keys, "POST", "/v1/users/me/apikeys", auth, nk)
+		if resRec.Code != http.StatusCreated {
+			t.Fatalf("creating %s: expected status %d but got %d: %s\n", nk.Name, http.StatusCreated, resRec.Code, resRec.Body.String())
+		}
+		created := &createdAPIKey{}
+		json.NewDecoder(resRec.Body).Decode(created)
+		return created
+	}
+
+	if resRec := do(keys, "POST", "/v1/users/me/apikeys", alice, &apikeys.NewAPIKey{Name: "bad"}); resRec.Code != http.StatusBadRequest {
+		t.Errorf("creating a key without scopes: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+	if resRec := do(keys, "POST", "/v1/users/me/apikeys", alice, &apikeys.NewAPIKey{Name: "admin", Scopes: []string{apikeys.ScopeAdmin}}); resRec.Code != http.StatusForbidden {
+		t.Errorf("creating an admin key as a user: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+	reader := create(alice, &apikeys.NewAPIKey{Name: "reader", Scopes: []string{apikeys.ScopeRead}})
+	writer := create(alice, &apikeys.NewAPIKey{Name: "writer", Scopes: []string{apikeys.ScopeRead, apikeys.ScopeWrite}})
+	if len(reader.Key) == 0 || reader.APIKey == nil || reader.Prefix == "" {
+		t.Fatalf("the new key should be in the response: %+v\n", reader)
+	}
+
+	//keys are used with the ApiKey scheme, within their scopes
+	readAuth := "ApiKey " + reader.Key
+	writeAuth := "ApiKey " + writer.Key
+	if resRec := do(channels, "GET", "/v1/channels", readAuth, nil); resRec.Code != http.StatusOK {
+		t.Errorf("reading with a read key: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if resRec := do(channels, "POST", "/v1/channels", readAuth, map[string]string{"name": "general"}); resRec.Code != http.StatusForbidden {
+		t.Errorf("writing with a read key: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+	if resRec := do(channels, "POST", "/v1/channels", writeAuth, map[string]string{"name": "general"}); resRec.Code != http.StatusCreated {
+		t.Errorf("writing with a write key: expected status %d but got %d: %s\n", http.StatusCreated, resRec.Code, resRec.Body.String())
+	}
+	if resRec := do(channels, "GET", "/v1/channels", "ApiKey "+reader.Prefix+".wrong", nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("using a wrong secret: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	if resRec := do(http.HandlerFunc(ctx.UsersMeHandler), "DELETE", "/v1/users/me", writeAuth, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("deleting an account with a key: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	if resRec := do(keys, "POST", "/v1/users/me/apikeys", writeAuth, &apikeys.NewAPIKey{Name: "more", Scopes: []string{apikeys.ScopeRead}}); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("creating a key with a key: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+
+	//admin endpoints need the admin scope as well as the role
+	user, _ := ctx.UserStore.GetByEmail("alice@test.com")
+	ctx.UserStore.SetRole(user.ID, users.RoleAdmin)
+	adminKey := create(alice, &apikeys.NewAPIKey{Name: "admin", Scopes: []string{apikeys.ScopeRead, apikeys.ScopeAdmin}})
+	if resRec := do(admin, "GET", "/v1/admin/users", readAuth, nil); resRec.Code != http.StatusForbidden {
+		t.Errorf("using the admin API without the admin scope: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+	if resRec := do(admin, "GET", "/v1/admin/users", "ApiKey "+adminKey.Key, nil); resRec.Code != http.StatusOK {
+		t.Errorf("using the admin API with the admin scope: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+
+	//listing shows when keys were last used, but never the keys
+	resRec := do(keys, "GET", "/v1/users/me/apikeys", alice, nil)
+	found := []*apikeys.APIKey{}
+	json.NewDecoder(resRec.Body).Decode(&found)
+	if len(found) != 3 || found[0].Prefix != reader.Prefix || found[0].LastUsedAt == nil || found[1].LastUsedAt == nil {
+		t.Fatalf("expected 3 keys, 2 of them used, but got %s\n", resRec.Body.String())
+	}
+
+	//revoked keys stop working, and other users can't revoke them
+	bob := signUp(t, ctx, "bob")
+	if resRec := do(keys, "DELETE", "/v1/users/me/apikeys/"+reader.Prefix, bob, nil); resRec.Code != http.StatusNotFound {
+		t.Errorf("revoking another user's key: expected status %d but got %d\n", http.StatusNotFound, resRec.Code)
+	}
+	if resRec := do(keys, "DELETE", "/v1/users/me/apikeys/"+reader.Prefix, alice, nil); resRec.Code != http.StatusOK {
+		t.Errorf("revoking a key: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if resRec := do(channels, "GET", "/v1/channels", readAuth, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("using a revoked key: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+
+	//keys stop working when their user is disabled
+	ctx.UserStore.SetDisabled(user.ID, true)
+	if resRec := do(channels, "GET", "/v1/channels", writeAuth, nil); resRec.Code != http.StatusForbidden {
+		t.Errorf("using a disabled user's key: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+}
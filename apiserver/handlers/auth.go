@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	"github.com/info344-s17/challenges-leedann/apiserver/notification"
 	"github.com/info344-s17/challenges-leedann/apiserver/sessions"
 )
 
@@ -15,7 +18,13 @@ const (
 	contentTypeTextUTF8 = "text/plain; " + charsetUTF8
 )
 
-//UserHandler allows users to sign up or gets all users
+//fieldErrors is the response to a sign-up with invalid fields
+type fieldErrors struct {
+	Errors users.FieldErrors `json:"errors"`
+}
+
+//UserHandler allows users to sign up or gets all users. Sign-ups with
+//invalid fields are responded to with what's wrong with each field
 func (ctx *Context) UserHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
@@ -25,9 +34,13 @@ func (ctx *Context) UserHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
-		err := newuser.Validate()
+		err := newuser.ValidateWith(ctx.passwordPolicy())
+		if errs, ok := err.(users.FieldErrors); ok {
+			respondJSON(w, http.StatusBadRequest, &fieldErrors{Errors: errs})
+			return
+		}
 		if err != nil {
-			http.Error(w, "User not valid", http.StatusBadRequest)
+			http.Error(w, "Error validating user", http.StatusInternalServerError)
 			return
 		}
 		usr, _ := ctx.UserStore.GetByEmail(newuser.Email)
@@ -36,29 +49,65 @@ func (ctx *Context) UserHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		usr, _ = ctx.UserStore.GetByUserName(newuser.UserName)
-		if usr != nil {
+		//names that look like one that's taken are taken too
+		if taken, _ := ctx.UserStore.UserNameTaken(newuser.UserName); taken {
 			http.Error(w, "Username Already Exists", http.StatusBadRequest)
 			return
 		}
+		newuser.Hasher = ctx.passwordHasher()
 		user, err := ctx.UserStore.Insert(newuser)
-		state := &SessionState{}
-		_, err = sessions.BeginSession(ctx.SessionKey, ctx.SessionStore, state, w)
+		if err == users.ErrUserNameTaken {
+			http.Error(w, "Username Already Exists", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error inserting user", http.StatusInternalServerError)
+			return
+		}
+		if err := ctx.beginSession(w, r, user); err != nil {
+			http.Error(w, "Error beginning session", http.StatusInternalServerError)
+			return
+		}
+		//the user can ask for another link if this one doesn't arrive
+		if err := ctx.sendVerification(r, user); err != nil {
+			log.Printf("error sending verification link to user %v: %v", user.ID, err)
+		}
+		//everyone is told about new users, so they only get the public view
+		ctx.notify(notification.EventUserNew, user.Public())
 		w.Header().Add("Content-Type", contentTypeJSONUTF8)
 		encoder := json.NewEncoder(w)
 		encoder.Encode(user)
 	case "GET":
-		users, err := ctx.UserStore.GetAll()
+		var after interface{}
+		p, err := ctx.parsePage(r, &after)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		//fetch one extra user to find out if there's another page,
+		//leaving out deleted users
+		deleted := false
+		found, err := ctx.UserStore.List(&users.Filter{Deleted: &deleted}, normalizeID(after), p.Limit+1)
 		if err != nil {
 			http.Error(w, "Error fetching users", http.StatusInternalServerError)
+			return
+		}
+		if len(found) > p.Limit {
+			found = found[:p.Limit]
+			if err := ctx.setNextPage(w, r, p, found[len(found)-1].ID); err != nil {
+				http.Error(w, "Error fetching users", http.StatusInternalServerError)
+				return
+			}
 		}
 		w.Header().Add("Content-Type", contentTypeJSONUTF8)
 		encoder := json.NewEncoder(w)
-		encoder.Encode(users)
+		encoder.Encode(userViews(ctx.viewer(r), found))
 	}
 }
 
-//SessionsHandler allows existing users to sign in
+//SessionsHandler allows existing users to sign in. Users with two-factor
+//authentication are given a partial session, and must finish signing in
+//with SessionsTwoFactorHandler
 func (ctx *Context) SessionsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" {
 		decoder := json.NewDecoder(r.Body)
@@ -68,17 +117,34 @@ func (ctx *Context) SessionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		u, err := ctx.UserStore.GetByEmail(creds.Email)
-		if err != nil {
+		//deleted accounts are as good as gone
+		if err != nil || u.DeletedAt != nil {
 			http.Error(w, "Email not found", http.StatusUnauthorized)
 			return
 		}
-		err = u.Authenticate(creds.Password)
+		err = ctx.checkPassword(u, creds.Password)
 		if err != nil {
 			http.Error(w, "Error authenticating user", http.StatusUnauthorized)
 			return
 		}
-		state := &SessionState{}
-		_, err = sessions.BeginSession(ctx.SessionKey, ctx.SessionStore, state, w)
+		if u.Disabled {
+			http.Error(w, errAccountDisabled.Error(), http.StatusForbidden)
+			return
+		}
+		//users with two-factor authentication get a partial session
+		//until they give their second factor
+		if u.TwoFactor.Enabled {
+			if err := ctx.beginPartialSession(w, r, u); err != nil {
+				http.Error(w, "Error beginning session", http.StatusInternalServerError)
+				return
+			}
+			respondJSON(w, http.StatusAccepted, &twoFactorChallenge{TwoFactorRequired: true})
+			return
+		}
+		if err := ctx.beginSession(w, r, u); err != nil {
+			http.Error(w, "Error beginning session", http.StatusInternalServerError)
+			return
+		}
 		w.Header().Add("Content-Type", contentTypeJSONUTF8)
 		encoder := json.NewEncoder(w)
 		encoder.Encode(u)
@@ -88,13 +154,51 @@ func (ctx *Context) SessionsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+//checkPassword authenticates `user` with `password`. Hashes made by
+//another hasher, or with outdated parameters, are replaced with a new
+//hash once the password is known to be right
+func (ctx *Context) checkPassword(user *users.User, password string) error {
+	if err := user.Authenticate(password); err != nil {
+		return err
+	}
+	hasher := ctx.passwordHasher()
+	if !hasher.NeedsRehash(user.PassHash) {
+		return nil
+	}
+	//the user can still sign in if the new hash isn't saved,
+	//and it'll be tried again next time. The user isn't changed,
+	//since users can be shared
+	passHash, err := hasher.Hash(password)
+	if err == nil {
+		err = ctx.UserStore.SetPassHash(user.ID, passHash)
+	}
+	if err != nil {
+		log.Printf("error saving rehashed password of user %v: %v", user.ID, err)
+	}
+	return nil
+}
+
 //SessionsMineHandler allows authenticated users to sign out
 func (ctx *Context) SessionsMineHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "DELETE" {
-		s := sessions.SessionID(ctx.SessionKey)
-		err := ctx.SessionStore.Delete(s)
+		//stateless sessions are ended by revoking their tokens
+		if ctx.Tokens != nil && sessions.HasAccessToken(r) {
+			if _, err := ctx.Tokens.EndSession(r); err != nil {
+				http.Error(w, "You must be signed in", http.StatusUnauthorized)
+				return
+			}
+			w.Header().Add("Content-Type", contentTypeTextUTF8)
+			w.Write([]byte("User has been signed out"))
+			return
+		}
+		sid, err := sessions.GetSessionID(r, ctx.SessionKey)
 		if err != nil {
+			http.Error(w, "You must be signed in", http.StatusUnauthorized)
+			return
+		}
+		if err := ctx.SessionStore.Delete(sid); err != nil {
 			http.Error(w, "Error ending session", http.StatusInternalServerError)
+			return
 		}
 		w.Header().Add("Content-Type", contentTypeTextUTF8)
 		w.Write([]byte("User has been signed out"))
@@ -104,18 +208,88 @@ func (ctx *Context) SessionsMineHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-//UsersMeHandler Get the session state
-func (ctx *Context) UsersMeHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == "GET" {
-		state := &SessionState{}
-		s := sessions.SessionID(ctx.SessionKey)
-		err := ctx.SessionStore.Get(s, state)
+//refreshRequest is posted to SessionsRefreshHandler
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+//SessionsRefreshHandler exchanges a refresh token for a new access token
+//and refresh token, when sessions are stateless. Each refresh token can
+//only be used once, and using one again ends the session it belongs to
+func (ctx *Context) SessionsRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+	if ctx.Tokens == nil {
+		http.Error(w, "Sessions can't be refreshed", http.StatusNotFound)
+		return
+	}
+	req := &refreshRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	pair, err := ctx.Tokens.Refresh(req.RefreshToken, func(subject string, authTime time.Time) (string, error) {
+		user, err := ctx.UserStore.GetByID(subject)
 		if err != nil {
-			http.Error(w, "Error getting sessionID", http.StatusInternalServerError)
+			return "", err
+		}
+		if err := checkSession(user, authTime); err != nil {
+			return "", err
 		}
+		return string(user.Role), nil
+	})
+	switch {
+	case err == errAccountDisabled:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err == sessions.ErrInvalidToken, err == sessions.ErrTokenExpired, err == sessions.ErrTokenRevoked,
+		err == sessions.ErrTokenReused, err == errSessionRevoked, err == users.ErrUserNotFound:
+		http.Error(w, "You must sign in again", http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, "Error refreshing session", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Authorization", "Bearer "+pair.AccessToken)
+	w.Header().Set(sessions.HeaderRefreshToken, pair.RefreshToken)
+	respondJSON(w, http.StatusOK, pair)
+}
+
+//UsersMeHandler gets the full record of the signed-in user, or deletes
+//their account. Deleted accounts can't be signed in to, and every session
+//they have is ended, but they are kept until they're purged after a grace
+//period, so that an admin can restore them until then
+func (ctx *Context) UsersMeHandler(w http.ResponseWriter, r *http.Request) {
+	//authenticate reloads the user, so this is their current record
+	user := ctx.viewer(r)
+	if user == nil {
+		http.Error(w, "You must be signed in", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		w.Header().Add("Content-Type", contentTypeJSONUTF8)
 		encoder := json.NewEncoder(w)
-		encoder.Encode(state.User)
-	} else {
+		encoder.Encode(user)
+	case "DELETE":
+		//API keys can't be used to delete accounts
+		if ctx.sessionViewer(r) == nil {
+			http.Error(w, "You must be signed in", http.StatusUnauthorized)
+			return
+		}
+		if err := ctx.UserStore.Delete(user.ID, time.Now()); err != nil {
+			http.Error(w, "Error deleting account", http.StatusInternalServerError)
+			return
+		}
+		if err := ctx.endSessions(user); err != nil {
+			http.Error(w, "Error ending sessions", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-Type", contentTypeTextUTF8)
+		w.Write([]byte("Your account has been deleted"))
+	default:
 		http.Error(w, "Error with request", http.StatusBadRequest)
 		return
 	}
@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"bytes"
 
 	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	"github.com/info344-s17/challenges-leedann/apiserver/notification"
 	"github.com/info344-s17/challenges-leedann/apiserver/sessions"
 	_ "github.com/lib/pq"
 )
@@ -108,12 +110,10 @@ func testSession(t *testing.T, ctx *Context) {
 //signing out
 func testSessionsMine(t *testing.T, ctx *Context) {
 	handler := http.HandlerFunc(ctx.SessionsMineHandler)
-	resRec := httptest.NewRecorder()
-	req, err := http.NewRequest("DELETE", SESSME, nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-	handler.ServeHTTP(resRec, req)
+	resRec := do(http.HandlerFunc(ctx.SessionsHandler), "POST", SESS, "", &users.Credentials{Email: "test@test.com", Password: "password"})
+	auth := resRec.Header().Get("Authorization")
+
+	resRec = do(handler, "DELETE", SESSME, auth, nil)
 	if resRec.Code != http.StatusOK {
 		t.Errorf("handler returned wrong status code: expected `%d` but got `%d`\n", http.StatusOK, resRec.Code)
 	}
@@ -122,6 +122,13 @@ func testSessionsMine(t *testing.T, ctx *Context) {
 	if contentType != expectedContentType {
 		t.Errorf("incorrect Content-Type response header: expected %s; got %s", expectedContentType, contentType)
 	}
+	//the caller's own session is the one that's ended
+	if resRec := do(http.HandlerFunc(ctx.UsersMeHandler), "GET", USRME, auth, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("using a signed out session: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	if resRec := do(handler, "DELETE", SESSME, "", nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("signing out without a session: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
 }
 
 //getting user
@@ -133,8 +140,9 @@ func testUsersMe(t *testing.T, ctx *Context) {
 		t.Fatal(err)
 	}
 	handler.ServeHTTP(resRec, req)
-	if resRec.Code != http.StatusInternalServerError {
-		t.Errorf("handler returned wrong status code: expected `%d` but got `%d`\n", http.StatusInternalServerError, resRec.Code)
+	//there's no session, so the user isn't signed in
+	if resRec.Code != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: expected `%d` but got `%d`\n", http.StatusUnauthorized, resRec.Code)
 	}
 	contentType := resRec.Header().Get("Content-Type")
 	expectedContentType := "text/plain; charset=utf-8"
@@ -143,3 +151,179 @@ func testUsersMe(t *testing.T, ctx *Context) {
 	}
 
 }
+
+func TestStatelessSessions(t *testing.T) {
+	ctx := newMessagingContext()
+	tokens, err := sessions.NewTokenIssuer(&sessions.TokenConfig{
+		Method:     sessions.SigningHS256,
+		Key:        []byte("0123456789abcdef0123456789abcdef"),
+		SigningKey: ctx.SessionKey,
+	}, ctx.SessionStore.(sessions.ClaimStore), sessions.NewMemDenylist())
+	if err != nil {
+		t.Fatalf("error creating token issuer: %v\n", err)
+	}
+	ctx.Tokens = tokens
+	me := http.HandlerFunc(ctx.UsersMeHandler)
+	refresh := http.HandlerFunc(ctx.SessionsRefreshHandler)
+
+	resRec := do(http.HandlerFunc(ctx.UserHandler), "POST", "/v1/users", "", &users.NewUser{
+		Email:        "alice@test.com",
+		Password:     "password",
+		PasswordConf: "password",
+		UserName:     "alice",
+	})
+	alice := resRec.Header().Get("Authorization")
+	refreshToken := resRec.Header().Get(sessions.HeaderRefreshToken)
+	if strings.Count(alice, ".") != 2 || len(refreshToken) == 0 {
+		t.Fatalf("expected an access token and refresh token but got %q and %q\n", alice, refreshToken)
+	}
+	if resRec := do(me, "GET", "/v1/users/me", alice, nil); resRec.Code != http.StatusOK {
+		t.Errorf("using the access token: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+
+	//refresh tokens can only be used once
+	resRec = do(refresh, "POST", "/v1/sessions/refresh", "", &refreshRequest{RefreshToken: refreshToken})
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("refreshing: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	pair := &sessions.TokenPair{}
+	json.NewDecoder(resRec.Body).Decode(pair)
+	if resRec.Header().Get("Authorization") != "Bearer "+pair.AccessToken {
+		t.Errorf("the new access token should be in the Authorization header\n")
+	}
+	if resRec := do(me, "GET", "/v1/users/me", "Bearer "+pair.AccessToken, nil); resRec.Code != http.StatusOK {
+		t.Errorf("using the refreshed access token: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if resRec := do(refresh, "POST", "/v1/sessions/refresh", "", &refreshRequest{RefreshToken: refreshToken}); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("reusing a refresh token: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	if resRec := do(me, "GET", "/v1/users/me", "Bearer "+pair.AccessToken, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("reusing a refresh token should revoke the session: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+
+	//signing out revokes the access token
+	resRec = do(http.HandlerFunc(ctx.SessionsHandler), "POST", "/v1/sessions", "", &users.Credentials{Email: "alice@test.com", Password: "password"})
+	alice = resRec.Header().Get("Authorization")
+	if resRec := do(http.HandlerFunc(ctx.SessionsMineHandler), "DELETE", "/v1/sessions/mine", alice, nil); resRec.Code != http.StatusOK {
+		t.Errorf("signing out: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if resRec := do(me, "GET", "/v1/users/me", alice, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("using a signed out access token: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+
+	//signing out everywhere ends sessions with tokens too
+	resRec = do(http.HandlerFunc(ctx.SessionsHandler), "POST", "/v1/sessions", "", &users.Credentials{Email: "alice@test.com", Password: "password"})
+	alice = resRec.Header().Get("Authorization")
+	refreshToken = resRec.Header().Get(sessions.HeaderRefreshToken)
+	user, _ := ctx.UserStore.GetByEmail("alice@test.com")
+	if err := ctx.endSessions(user); err != nil {
+		t.Fatalf("error ending sessions: %v\n", err)
+	}
+	if resRec := do(me, "GET", "/v1/users/me", alice, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("using an access token after signing out everywhere: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	if resRec := do(refresh, "POST", "/v1/sessions/refresh", "", &refreshRequest{RefreshToken: refreshToken}); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("refreshing after signing out everywhere: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+}
+
+func TestShareDenylist(t *testing.T) {
+	shared := sessions.NewMemDenylist()
+	shared.Deny("before", time.Now().Add(time.Minute))
+	events := notification.NewLocalBus()
+	a := sessions.NewCachedDenylist(shared)
+	b := sessions.NewCachedDenylist(shared)
+	for _, dl := range []*sessions.CachedDenylist{a, b} {
+		if err := ShareDenylist(dl, events); err != nil {
+			t.Fatalf("error sharing the denylist: %v\n", err)
+		}
+	}
+	if denied, _ := b.Denied("before"); !denied {
+		t.Errorf("tokens denied before starting should be denied\n")
+	}
+	if err := a.Deny("after", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("error denying: %v\n", err)
+	}
+	if denied, _ := b.Denied("after"); !denied {
+		t.Errorf("tokens denied by another instance should be denied\n")
+	}
+}
+
+//countingStore counts the users looked up by ID
+type countingStore struct {
+	users.Store
+	gets int
+}
+
+func (cs *countingStore) GetByID(id users.UserID) (*users.User, error) {
+	cs.gets++
+	return cs.Store.GetByID(id)
+}
+
+func TestTokenAuthorizesFromClaims(t *testing.T) {
+	ctx := newMessagingContext()
+	store := &countingStore{Store: ctx.UserStore}
+	ctx.UserStore = store
+	ctx.Tokens, _ = sessions.NewTokenIssuer(&sessions.TokenConfig{
+		Method:     sessions.SigningHS256,
+		Key:        []byte("0123456789abcdef0123456789abcdef"),
+		SigningKey: ctx.SessionKey,
+	}, ctx.SessionStore.(sessions.ClaimStore), sessions.NewMemDenylist())
+	alice := signUp(t, ctx, "alice")
+	me := http.HandlerFunc(ctx.UsersMeHandler)
+	admin := ctx.RequireAuth()(ctx.RequireRole(users.RoleAdmin)(me))
+
+	//the user is only loaded once while it's cached
+	store.gets = 0
+	for i := 0; i < 3; i++ {
+		if resRec := do(me, "GET", "/v1/users/me", alice, nil); resRec.Code != http.StatusOK {
+			t.Fatalf("using the access token: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+		}
+	}
+	if store.gets != 1 {
+		t.Errorf("expected the user to be loaded once but it was loaded %d times\n", store.gets)
+	}
+
+	//the role comes from the token, not the store
+	user, _ := ctx.UserStore.GetByUserName("alice")
+	ctx.UserStore.SetRole(user.ID, users.RoleAdmin)
+	if resRec := do(admin, "GET", "/v1/users/me", alice, nil); resRec.Code != http.StatusForbidden {
+		t.Errorf("using a token issued before a promotion: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+
+	//signing out everywhere forgets the cached user
+	if err := ctx.endSessions(user); err != nil {
+		t.Fatalf("error ending sessions: %v\n", err)
+	}
+	if resRec := do(me, "GET", "/v1/users/me", alice, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("using an access token after signing out everywhere: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+}
+
+func TestSignInRehashesPassword(t *testing.T) {
+	ctx := newMessagingContext()
+	signUp(t, ctx, "alice")
+
+	//the hasher changes after alice signed up
+	ctx.PasswordHasher = &users.Argon2Hasher{Time: 1, Memory: 64, Threads: 1}
+	signIn := &users.Credentials{Email: "alice@test.com", Password: "password"}
+	if resRec := do(http.HandlerFunc(ctx.SessionsHandler), "POST", "/v1/sessions", "", signIn); resRec.Code != http.StatusOK {
+		t.Fatalf("signing in: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	u, err := ctx.UserStore.GetByEmail("alice@test.com")
+	if err != nil {
+		t.Fatalf("error getting user: %v\n", err)
+	}
+	if !strings.HasPrefix(string(u.PassHash), "$argon2id$") {
+		t.Errorf("signing in should have saved an Argon2id hash but got %s\n", u.PassHash)
+	}
+	if resRec := do(http.HandlerFunc(ctx.SessionsHandler), "POST", "/v1/sessions", "", signIn); resRec.Code != http.StatusOK {
+		t.Errorf("signing in with the new hash: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+
+	//new users' passwords are hashed with the Context's hasher too
+	signUp(t, ctx, "bob")
+	if bob, _ := ctx.UserStore.GetByEmail("bob@test.com"); bob == nil || !strings.HasPrefix(string(bob.PassHash), "$argon2id$") {
+		t.Errorf("signing up should have saved an Argon2id hash\n")
+	}
+}
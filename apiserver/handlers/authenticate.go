@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/middleware"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/apikeys"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	"github.com/info344-s17/challenges-leedann/apiserver/notification"
+	"github.com/info344-s17/challenges-leedann/apiserver/sessions"
+	"github.com/patrickmn/go-cache"
+)
+
+//contextKey is the type of the keys handlers add to request contexts
+type contextKey string
+
+//stateKey is the request context key for the authenticated SessionState
+const stateKey = contextKey("sessionState")
+
+//DefaultTokenUserTTL is how long the users of access tokens are cached
+//for by default. It's well under the life of an access token
+const DefaultTokenUserTTL = 30 * time.Second
+
+//errAccountDisabled is returned when a disabled user tries to sign in
+//or use a session
+var errAccountDisabled = errors.New("this account has been disabled")
+
+//errSessionRevoked is returned for sessions that began before
+//the user was signed out everywhere
+var errSessionRevoked = errors.New("your session has been ended")
+
+//errAPIKeyScope is returned when an API key is used for
+//something its scopes don't allow
+var errAPIKeyScope = errors.New("this API key doesn't have the scope to do that")
+
+//RequireAuth returns an adapter that only lets through requests with a
+//valid session for a signed-in user, or an API key, responding 401 to all
+//others, or 403 if the account has been disabled, if the API key's scopes
+//don't allow the request or, with RequireVerifiedEmail, if the user hasn't
+//verified their email address yet. The session state is added to
+//the request context for sessionStateFrom
+func (ctx *Context) RequireAuth() middleware.Adapter {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state, err := ctx.authenticate(r)
+			if err == errAccountDisabled {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, "You must be signed in", http.StatusUnauthorized)
+				return
+			}
+			if err := ctx.checkVerified(state.User); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if state.APIKey != nil && !state.APIKey.Allows(r.Method) {
+				http.Error(w, errAPIKeyScope.Error(), http.StatusForbidden)
+				return
+			}
+			handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), stateKey, state)))
+		})
+	}
+}
+
+//RequireRole returns an adapter that only lets through users with at
+//least the role `role`, responding 403 to all others, and to API keys
+//without the admin scope. It must be used after RequireAuth, which it
+//gets the signed-in user from
+func (ctx *Context) RequireRole(role users.Role) middleware.Adapter {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state := sessionStateFrom(r)
+			if state == nil {
+				http.Error(w, "You must be signed in", http.StatusUnauthorized)
+				return
+			}
+			if !state.User.Role.AtLeast(role) {
+				http.Error(w, "You are not allowed to do that", http.StatusForbidden)
+				return
+			}
+			if state.APIKey != nil && !state.APIKey.HasScope(apikeys.ScopeAdmin) {
+				http.Error(w, errAPIKeyScope.Error(), http.StatusForbidden)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+//authenticate returns the state of the request's session. The session
+//has the user as they were when they signed in, so the user is reloaded
+//from the store, both so that changes to their role take effect and so
+//that disabled users and revoked sessions are turned away
+func (ctx *Context) authenticate(r *http.Request) (*SessionState, error) {
+	if ctx.APIKeys != nil && sessions.HasAPIKey(r) {
+		return ctx.authenticateAPIKey(r)
+	}
+	//partial sessions are opaque even when sessions are stateless
+	if ctx.Tokens != nil && sessions.HasAccessToken(r) {
+		return ctx.authenticateToken(r)
+	}
+	state := &SessionState{}
+	sid, err := sessions.GetState(r, ctx.SessionKey, ctx.SessionStore, state)
+	if err != nil {
+		return nil, err
+	}
+	if state.User == nil {
+		return nil, sessions.ErrStateNotFound
+	}
+	if state.SecondFactorPending {
+		return nil, errSecondFactorRequired
+	}
+	normalizeUserID(state)
+	user, err := ctx.UserStore.GetByID(state.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSession(user, state.BeganAt); err != nil {
+		if err == errSessionRevoked {
+			ctx.SessionStore.Delete(sid)
+		}
+		return nil, err
+	}
+	state.User = user
+	return state, nil
+}
+
+//authenticateToken returns the state of the session whose access token
+//is in the request. The user is authorized from the token's signed
+//claims, so their role is the one they had when the token was issued.
+//The rest of the user, which handlers need, is cached for TokenUserTTL
+//rather than loaded for every request. The trade-off is that disabling
+//a user, deleting them or signing them out everywhere can take up to
+//TokenUserTTL to reach the other instances, though it takes effect on
+//this one at once, and a role change waits for the next refresh. Both
+//are bounded by the short life of access tokens, and signing out puts
+//the token on the denylist, a copy of which is checked for every request
+func (ctx *Context) authenticateToken(r *http.Request) (*SessionState, error) {
+	claims, err := ctx.Tokens.GetClaims(r)
+	if err != nil {
+		return nil, err
+	}
+	var user *users.User
+	if cached, found := ctx.tokenUserCache().Get(claims.Subject); found {
+		user = cached.(*users.User)
+	} else {
+		if user, err = ctx.UserStore.GetByID(claims.Subject); err != nil {
+			return nil, err
+		}
+		ctx.tokenUserCache().Set(claims.Subject, user, cache.DefaultExpiration)
+	}
+	if err := checkSession(user, claims.AuthenticatedAt()); err != nil {
+		return nil, err
+	}
+	//the cached user is shared, so the role is set on a copy
+	viewer := *user
+	viewer.Role = users.Role(claims.Role)
+	return &SessionState{
+		BeganAt:    claims.AuthenticatedAt(),
+		ClientAddr: r.RemoteAddr,
+		User:       &viewer,
+	}, nil
+}
+
+//deniedToken is the payload of EventTokenDenied
+type deniedToken struct {
+	ID    string    `json:"id"`
+	Until time.Time `json:"until"`
+}
+
+//ShareDenylist keeps the in-process copy of `denylist` in step with the
+//other instances by announcing denials on `events` and adding the ones
+//they announce. It then loads the denials made before this instance
+//started, after subscribing so that none made in between are missed
+func ShareDenylist(denylist *sessions.CachedDenylist, events notification.Bus) error {
+	denylist.Announce = func(jti string, until time.Time) error {
+		event, err := notification.NewEvent(notification.EventTokenDenied, &deniedToken{ID: jti, Until: until})
+		if err != nil {
+			return err
+		}
+		return events.Publish(event)
+	}
+	events.Subscribe(func(event *notification.Event) {
+		if event.Type != notification.EventTokenDenied {
+			return
+		}
+		denied := &deniedToken{}
+		if err := json.Unmarshal(event.Payload, denied); err != nil {
+			log.Printf("ignoring invalid denied token: %v", err)
+			return
+		}
+		denylist.Add(denied.ID, denied.Until)
+	})
+	return denylist.Load()
+}
+
+//authenticateAPIKey returns the state for a request authenticated with
+//an API key. API keys aren't sessions, but ending a user's sessions
+//revokes them too, and they stop working when their user is disabled or deleted
+func (ctx *Context) authenticateAPIKey(r *http.Request) (*SessionState, error) {
+	raw, err := sessions.GetAPIKey(r)
+	if err != nil {
+		return nil, err
+	}
+	prefix, secret, err := apikeys.ParseKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ctx.APIKeys.Get(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if !key.Matches(secret) {
+		return nil, apikeys.ErrInvalidKey
+	}
+	user, err := ctx.UserStore.GetByID(key.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, errAccountDisabled
+	}
+	if user.DeletedAt != nil {
+		return nil, errSessionRevoked
+	}
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apikeys.LastUsedResolution {
+		if err := ctx.APIKeys.Touch(key.Prefix, now); err != nil {
+			log.Printf("error recording use of API key %s: %v", key.Prefix, err)
+		}
+	}
+	return &SessionState{
+		BeganAt:    key.CreatedAt,
+		ClientAddr: r.RemoteAddr,
+		User:       user,
+		APIKey:     key,
+	}, nil
+}
+
+//checkSession returns errAccountDisabled if the user has been disabled, or
+//errSessionRevoked if a session they began at `beganAt` has been revoked
+func checkSession(user *users.User, beganAt time.Time) error {
+	if user.Disabled {
+		return errAccountDisabled
+	}
+	//deleting an account revokes its sessions, but check
+	//anyway in case they couldn't all be revoked
+	if user.DeletedAt != nil || beganAt.Before(user.SessionsRevokedAt) {
+		return errSessionRevoked
+	}
+	return nil
+}
+
+//checkVerified returns errEmailNotVerified if the Context requires
+//verified email addresses and the user hasn't verified theirs
+func (ctx *Context) checkVerified(user *users.User) error {
+	if ctx.RequireVerifiedEmail && !user.EmailVerified {
+		return errEmailNotVerified
+	}
+	return nil
+}
+
+//sessionStateFrom returns the SessionState added by RequireAuth
+func sessionStateFrom(r *http.Request) *SessionState {
+	state, _ := r.Context().Value(stateKey).(*SessionState)
+	return state
+}
+
+//normalizeUserID undoes what JSON does to numeric user IDs. The session
+//stores encode the state as JSON, so an integer ID from the database comes
+//back as a float64, which wouldn't equal the ID of the same user elsewhere
+func normalizeUserID(state *SessionState) {
+	state.User.ID = normalizeID(state.User.ID)
+}
+
+//normalizeID converts IDs decoded from JSON numbers back to integers
+func normalizeID(id interface{}) interface{} {
+	if f, ok := id.(float64); ok && f == math.Trunc(f) {
+		return int64(f)
+	}
+	return id
+}
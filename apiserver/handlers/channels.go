@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/messages"
+	"github.com/info344-s17/challenges-leedann/apiserver/notification"
+	"github.com/info344-s17/challenges-leedann/apiserver/unfurl"
+)
+
+const (
+	//channelsPath is the path prefix for specific channels
+	channelsPath = "/v1/channels/"
+	//messagesPath is the path prefix for specific messages
+	messagesPath = "/v1/messages/"
+	//maxMessages is the most messages returned for a channel at once
+	maxMessages = 100
+)
+
+//messageResponse is a message as sent to clients, with the
+//previews of any links in its body
+type messageResponse struct {
+	*messages.Message
+	Previews []*unfurl.Preview `json:"previews,omitempty"`
+}
+
+//messageOwner returns the key the previews of a message are stored under
+func messageOwner(id messages.MessageID) string {
+	return fmt.Sprintf("message:%v", id)
+}
+
+//respondJSON writes `value` to the response as JSON with the given status
+func respondJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Add("Content-Type", contentTypeJSONUTF8)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+//messageResponse adds the message's saved link previews, if any, sending
+//clients to the image proxy at `base` for the preview images
+func (ctx *Context) messageResponse(base string, m *messages.Message) *messageResponse {
+	res := &messageResponse{Message: m}
+	if ctx.Unfurler == nil {
+		return res
+	}
+	previews, err := ctx.Unfurler.Previews(messageOwner(m.ID))
+	if err != nil {
+		//the message is still worth sending without its previews
+		return res
+	}
+	return ctx.withPreviews(base, m, previews)
+}
+
+//withPreviews returns the message with the previews `previews`,
+//sending clients to the image proxy at `base` for the preview images
+func (ctx *Context) withPreviews(base string, m *messages.Message, previews []*unfurl.Preview) *messageResponse {
+	res := &messageResponse{Message: m}
+	for _, p := range previews {
+		sum := p.Summary
+		if ctx.ImageProxy != nil {
+			//the stored summary may be shared, so rewrite a copy
+			sum = sum.Clone()
+			ctx.ImageProxy.rewriteSummary(base, sum)
+		}
+		res.Previews = append(res.Previews, &unfurl.Preview{URL: p.URL, Summary: sum})
+	}
+	return res
+}
+
+//PreviewsUnfurled tells the members of a message's channel about the
+//previews of its links, once they've been saved. It's the Unfurler's
+//OnUnfurled. Since there's no request to take the API's address from,
+//the preview images point to the PublicURL, or are relative without one
+func (ctx *Context) PreviewsUnfurled(owner string, previews []*unfurl.Preview) {
+	id := strings.TrimPrefix(owner, messageOwner(""))
+	if id == owner {
+		return
+	}
+	m, err := ctx.MessageStore.GetMessageByID(id)
+	if err != nil {
+		//the message was deleted before its links were unfurled
+		return
+	}
+	c, err := ctx.MessageStore.GetChannelByID(m.ChannelID)
+	if err != nil {
+		log.Printf("error fetching channel of message %v: %v", m.ID, err)
+		return
+	}
+	ctx.notifyChannel(c, notification.EventMessageUpdate, ctx.withPreviews(strings.TrimSuffix(ctx.PublicURL, "/"), m, previews))
+}
+
+//unfurl queues the links in the message body to be previewed
+func (ctx *Context) unfurl(m *messages.Message) {
+	if ctx.Unfurler != nil {
+		//previews are optional, so a full queue doesn't fail the request
+		ctx.Unfurler.Unfurl(messageOwner(m.ID), m.Body)
+	}
+}
+
+//ChannelsHandler lists all channels, or creates a new channel
+//created by the signed-in user
+func (ctx *Context) ChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	state := sessionStateFrom(r)
+	switch r.Method {
+	case "GET":
+		channels, err := ctx.MessageStore.GetChannels(state.User.ID)
+		if err != nil {
+			http.Error(w, "Error fetching channels", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusOK, channels)
+	case "POST":
+		newChannel := &messages.NewChannel{}
+		if err := json.NewDecoder(r.Body).Decode(newChannel); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := newChannel.Validate(); err != nil {
+			http.Error(w, "Channel not valid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if c, _ := ctx.MessageStore.GetChannelByName(newChannel.Name); c != nil {
+			http.Error(w, "Channel Name Already Exists", http.StatusBadRequest)
+			return
+		}
+		c, err := ctx.MessageStore.InsertChannel(newChannel, state.User)
+		if err != nil {
+			http.Error(w, "Error inserting channel", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusCreated, c)
+	default:
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+	}
+}
+
+//SpecificChannelHandler handles /v1/channels/{id}, which gets the channel,
+///v1/channels/{id}/messages, which lists the channel's most recent messages
+//or posts a new message to it, and /v1/channels/{id}/members, which lists
+//and adds members, and /v1/channels/{id}/members/{userID}, which removes one.
+//Private channels look like they don't exist to users who aren't members
+func (ctx *Context) SpecificChannelHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, channelsPath), "/")
+	if len(parts[0]) == 0 || len(parts) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+	c, err := ctx.MessageStore.GetChannelByID(parts[0])
+	if err != nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	member, err := ctx.MessageStore.GetMember(c.ID, sessionStateFrom(r).User.ID)
+	if err != nil && err != messages.ErrNotMember {
+		http.Error(w, "Error fetching membership", http.StatusInternalServerError)
+		return
+	}
+	if c.Private && member == nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		if r.Method != "GET" {
+			http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+			return
+		}
+		respondJSON(w, http.StatusOK, c)
+	case len(parts) == 2 && parts[1] == "messages":
+		ctx.channelMessagesHandler(w, r, c)
+	case parts[1] == "members":
+		userID := ""
+		if len(parts) == 3 {
+			userID = parts[2]
+		}
+		ctx.channelMembersHandler(w, r, c, member, userID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+//channelMessagesHandler lists the channel's most recent messages,
+//or posts a new message to it
+func (ctx *Context) channelMessagesHandler(w http.ResponseWriter, r *http.Request, c *messages.Channel) {
+	user := sessionStateFrom(r).User
+	switch r.Method {
+	case "GET":
+		msgs, err := ctx.MessageStore.GetMessages(c.ID, user.ID, maxMessages)
+		if err == messages.ErrNotMember {
+			http.Error(w, "You are not a member of this channel", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching messages", http.StatusInternalServerError)
+			return
+		}
+		res := make([]*messageResponse, len(msgs))
+		for i, m := range msgs {
+			res[i] = ctx.messageResponse(ctx.baseURL(r), m)
+		}
+		respondJSON(w, http.StatusOK, res)
+	case "POST":
+		newMessage := &messages.NewMessage{}
+		if err := json.NewDecoder(r.Body).Decode(newMessage); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		//the channel in the path is the one posted to
+		newMessage.ChannelID = c.ID
+		if err := newMessage.Validate(); err != nil {
+			http.Error(w, "Message not valid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		m, err := ctx.MessageStore.InsertMessage(newMessage, user)
+		if err == messages.ErrNotMember {
+			http.Error(w, "You are not a member of this channel", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error inserting message", http.StatusInternalServerError)
+			return
+		}
+		ctx.unfurl(m)
+		res := ctx.messageResponse(ctx.baseURL(r), m)
+		ctx.notifyChannel(c, notification.EventMessageNew, res)
+		respondJSON(w, http.StatusCreated, res)
+	default:
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+	}
+}
+
+//addMemberRequest is the body of a POST to a channel's members
+type addMemberRequest struct {
+	UserID interface{}   `json:"userID"`
+	Role   messages.Role `json:"role"`
+}
+
+//channelMembersHandler lists the channel's members, adds a member, or
+//removes the member with `userID`. `actor` is the signed-in user's
+//membership, or nil if they aren't a member of this public channel.
+//Admins can add and remove members, and only the owner can add and
+//remove admins. Anyone but the owner can remove themselves
+func (ctx *Context) channelMembersHandler(w http.ResponseWriter, r *http.Request, c *messages.Channel, actor *messages.Member, userID string) {
+	switch {
+	case r.Method == "GET" && len(userID) == 0:
+		members, err := ctx.MessageStore.GetMembers(c.ID)
+		if err != nil {
+			http.Error(w, "Error fetching members", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusOK, members)
+	case r.Method == "POST" && len(userID) == 0:
+		req := &addMemberRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if len(req.Role) == 0 {
+			req.Role = messages.RoleMember
+		}
+		if err := req.Role.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, err := ctx.UserStore.GetByID(normalizeID(req.UserID))
+		if err != nil || user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		existing, _ := ctx.MessageStore.GetMember(c.ID, user.ID)
+		if actor == nil || !actor.Role.CanManage(req.Role) || (existing != nil && !actor.Role.CanManage(existing.Role)) {
+			http.Error(w, "You can't add members with that role", http.StatusForbidden)
+			return
+		}
+		member, err := ctx.MessageStore.AddMember(c.ID, user.ID, req.Role)
+		if err != nil {
+			http.Error(w, "Error adding member", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusCreated, member)
+	case r.Method == "DELETE" && len(userID) > 0:
+		user, err := ctx.UserStore.GetByID(userID)
+		if err != nil || user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		target, err := ctx.MessageStore.GetMember(c.ID, user.ID)
+		if err != nil {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		leaving := actor != nil && actor.UserID == target.UserID && target.Role != messages.RoleOwner
+		if !leaving && (actor == nil || !actor.Role.CanManage(target.Role)) {
+			http.Error(w, "You can't remove that member", http.StatusForbidden)
+			return
+		}
+		if err := ctx.MessageStore.RemoveMember(c.ID, target.UserID); err != nil {
+			http.Error(w, "Error removing member", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-Type", contentTypeTextUTF8)
+		w.Write([]byte("Member has been removed"))
+	default:
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+	}
+}
+
+//notifyChannel sends an event about the channel, which only goes
+//to the channel's members if the channel is private
+func (ctx *Context) notifyChannel(c *messages.Channel, eventType string, payload interface{}) {
+	var recipients []interface{}
+	if c.Private {
+		members, err := ctx.MessageStore.GetMembers(c.ID)
+		if err != nil {
+			log.Printf("error fetching members to notify: %v", err)
+			return
+		}
+		for _, m := range members {
+			recipients = append(recipients, m.UserID)
+		}
+	}
+	ctx.notify(eventType, payload, recipients...)
+}
+
+//SpecificMessageHandler handles /v1/messages/{id}, allowing the
+//user who posted the message to edit or delete it
+func (ctx *Context) SpecificMessageHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, messagesPath)
+	if len(id) == 0 || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	m, err := ctx.MessageStore.GetMessageByID(id)
+	if err != nil {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if m.CreatorID != sessionStateFrom(r).User.ID {
+		http.Error(w, "You can only change your own messages", http.StatusForbidden)
+		return
+	}
+	c, err := ctx.MessageStore.GetChannelByID(m.ChannelID)
+	if err != nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	if c.Private {
+		if _, err := ctx.MessageStore.GetMember(c.ID, m.CreatorID); err != nil {
+			http.Error(w, "You are not a member of this channel", http.StatusForbidden)
+			return
+		}
+	}
+
+	switch r.Method {
+	case "PATCH":
+		updates := &messages.MessageUpdates{}
+		if err := json.NewDecoder(r.Body).Decode(updates); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := updates.Validate(); err != nil {
+			http.Error(w, "Message not valid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := ctx.MessageStore.UpdateMessage(updates, m); err != nil {
+			http.Error(w, "Error updating message", http.StatusInternalServerError)
+			return
+		}
+		ctx.unfurl(m)
+		res := ctx.messageResponse(ctx.baseURL(r), m)
+		ctx.notifyChannel(c, notification.EventMessageUpdate, res)
+		respondJSON(w, http.StatusOK, res)
+	case "DELETE":
+		if err := ctx.MessageStore.DeleteMessage(m.ID); err != nil {
+			http.Error(w, "Error deleting message", http.StatusInternalServerError)
+			return
+		}
+		if ctx.Unfurler != nil {
+			ctx.Unfurler.Forget(messageOwner(m.ID))
+		}
+		ctx.notifyChannel(c, notification.EventMessageDelete, m)
+		w.Header().Add("Content-Type", contentTypeTextUTF8)
+		w.Write([]byte("Message has been deleted"))
+	default:
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+	}
+}
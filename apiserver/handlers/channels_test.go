@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/middleware"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/messages"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	"github.com/info344-s17/challenges-leedann/apiserver/notification"
+	"github.com/info344-s17/challenges-leedann/apiserver/sessions"
+	"github.com/info344-s17/challenges-leedann/apiserver/summary"
+	"github.com/info344-s17/challenges-leedann/apiserver/unfurl"
+)
+
+//newMessagingContext returns a Context backed by in-memory stores
+func newMessagingContext() *Context {
+	return &Context{
+		SessionKey:   "8675309",
+		SessionStore: sessions.NewMemStore(time.Hour),
+		UserStore:    users.NewMemStore(),
+		MessageStore: messages.NewMemStore(),
+	}
+}
+
+//signUp creates a new user and returns the Authorization header for their session
+func signUp(t *testing.T, ctx *Context, userName string) string {
+	nu := &users.NewUser{
+		Email:        userName + "@test.com",
+		Password:     "password",
+		PasswordConf: "password",
+		UserName:     userName,
+	}
+	body, _ := json.Marshal(nu)
+	resRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/users", bytes.NewBuffer(body))
+	ctx.UserHandler(resRec, req)
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("error signing up %s: %d %s", userName, resRec.Code, resRec.Body.String())
+	}
+	return resRec.Header().Get("Authorization")
+}
+
+//do sends a request to the handler, authenticated with `auth` if it's set
+func do(handler http.Handler, method string, path string, auth string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &buf)
+	if len(auth) > 0 {
+		req.Header.Set("Authorization", auth)
+	}
+	resRec := httptest.NewRecorder()
+	handler.ServeHTTP(resRec, req)
+	return resRec
+}
+
+func TestChannelsAndMessages(t *testing.T) {
+	ctx := newMessagingContext()
+	alice := signUp(t, ctx, "alice")
+	bob := signUp(t, ctx, "bob")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/channels", ctx.ChannelsHandler)
+	mux.HandleFunc(channelsPath, ctx.SpecificChannelHandler)
+	mux.HandleFunc(messagesPath, ctx.SpecificMessageHandler)
+	handler := middleware.Adapt(mux, ctx.RequireAuth())
+
+	if resRec := do(handler, "GET", "/v1/channels", "", nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+
+	resRec := do(handler, "POST", "/v1/channels", alice, &messages.NewChannel{Name: "general"})
+	if resRec.Code != http.StatusCreated {
+		t.Fatalf("creating channel: expected status %d but got %d: %s\n", http.StatusCreated, resRec.Code, resRec.Body.String())
+	}
+	c := &messages.Channel{}
+	json.NewDecoder(resRec.Body).Decode(c)
+	if resRec = do(handler, "POST", "/v1/channels", bob, &messages.NewChannel{Name: "general"}); resRec.Code != http.StatusBadRequest {
+		t.Errorf("duplicate channel name: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+	resRec = do(handler, "GET", "/v1/channels", bob, nil)
+	var channels []*messages.Channel
+	json.NewDecoder(resRec.Body).Decode(&channels)
+	if len(channels) != 1 || channels[0].Name != "general" {
+		t.Errorf("incorrect channels listed: %v\n", channels)
+	}
+
+	messagesURL := channelsPath + c.ID.(string) + "/messages"
+	resRec = do(handler, "POST", messagesURL, alice, &messages.NewMessage{Body: "hello"})
+	if resRec.Code != http.StatusCreated {
+		t.Fatalf("posting message: expected status %d but got %d: %s\n", http.StatusCreated, resRec.Code, resRec.Body.String())
+	}
+	m := &messages.Message{}
+	json.NewDecoder(resRec.Body).Decode(m)
+	aliceUser, _ := ctx.UserStore.GetByUserName("alice")
+	if m.CreatorID != aliceUser.ID {
+		t.Errorf("incorrect message creator: expected %v but got %v\n", aliceUser.ID, m.CreatorID)
+	}
+	if resRec = do(handler, "POST", channelsPath+"missing/messages", alice, &messages.NewMessage{Body: "hello"}); resRec.Code != http.StatusNotFound {
+		t.Errorf("posting to a missing channel: expected status %d but got %d\n", http.StatusNotFound, resRec.Code)
+	}
+
+	messageURL := messagesPath + m.ID.(string)
+	if resRec = do(handler, "PATCH", messageURL, bob, &messages.MessageUpdates{Body: "hijacked"}); resRec.Code != http.StatusForbidden {
+		t.Errorf("editing someone else's message: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+	if resRec = do(handler, "PATCH", messageURL, alice, &messages.MessageUpdates{Body: "hello, edited"}); resRec.Code != http.StatusOK {
+		t.Errorf("editing message: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+
+	resRec = do(handler, "GET", messagesURL, bob, nil)
+	var msgs []*messages.Message
+	json.NewDecoder(resRec.Body).Decode(&msgs)
+	if len(msgs) != 1 || msgs[0].Body != "hello, edited" || msgs[0].EditedAt == nil {
+		t.Errorf("incorrect messages listed: %v\n", msgs)
+	}
+
+	if resRec = do(handler, "DELETE", messageURL, bob, nil); resRec.Code != http.StatusForbidden {
+		t.Errorf("deleting someone else's message: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+	if resRec = do(handler, "DELETE", messageURL, alice, nil); resRec.Code != http.StatusOK {
+		t.Errorf("deleting message: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if resRec = do(handler, "DELETE", messageURL, alice, nil); resRec.Code != http.StatusNotFound {
+		t.Errorf("deleting a deleted message: expected status %d but got %d\n", http.StatusNotFound, resRec.Code)
+	}
+}
+
+func TestMessagePreviews(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>Linked Page</title>
+			<meta property="og:image" content="/cover.png"></head></html>`))
+	}))
+	defer server.Close()
+
+	ctx := newMessagingContext()
+	ctx.ImageProxy = NewImageProxy("test key")
+	s := summary.NewSummarizer(summary.NewHTTPFetcher(server.Client()), nil)
+	ctx.Unfurler = unfurl.NewService(s, unfurl.NewMemStore(), 1, 10)
+	defer ctx.Unfurler.Close()
+	unfurled := make(chan string, 1)
+	ctx.Unfurler.OnUnfurled = func(owner string, previews []*unfurl.Preview) {
+		unfurled <- owner
+	}
+	alice := signUp(t, ctx, "alice")
+	handler := middleware.Adapt(http.HandlerFunc(ctx.SpecificChannelHandler), ctx.RequireAuth())
+	c, _ := ctx.MessageStore.InsertChannel(&messages.NewChannel{Name: "links"}, &users.User{ID: "someone"})
+	messagesURL := channelsPath + c.ID.(string) + "/messages"
+
+	resRec := do(handler, "POST", messagesURL, alice, &messages.NewMessage{Body: "read this: " + server.URL + "/page"})
+	if resRec.Code != http.StatusCreated {
+		t.Fatalf("posting message: expected status %d but got %d\n", http.StatusCreated, resRec.Code)
+	}
+	select {
+	case <-unfurled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the link to be unfurled\n")
+	}
+
+	//list twice, so we know rewriting the images didn't change the stored previews
+	for i := 0; i < 2; i++ {
+		resRec = do(handler, "GET", messagesURL, alice, nil)
+		var msgs []*messageResponse
+		if err := json.NewDecoder(resRec.Body).Decode(&msgs); err != nil {
+			t.Fatalf("error decoding messages: %v\n", err)
+		}
+		if len(msgs) != 1 || len(msgs[0].Previews) != 1 {
+			t.Fatalf("expected one message with one preview but got %v\n", msgs)
+		}
+		props := msgs[0].Previews[0].Summary.Props
+		if props["title"] != "Linked Page" {
+			t.Errorf("incorrect preview title: %s\n", props["title"])
+		}
+		proxied, _ := url.Parse(props["image"])
+		if proxied == nil || proxied.Path != imagesPath || proxied.Query().Get("url") != server.URL+"/cover.png" {
+			t.Errorf("preview image was not sent through the image proxy: %s\n", props["image"])
+		}
+	}
+}
+
+func TestPrivateChannels(t *testing.T) {
+	ctx := newMessagingContext()
+	owner := signUp(t, ctx, "owner")
+	admin := signUp(t, ctx, "ada")
+	member := signUp(t, ctx, "member")
+	outsider := signUp(t, ctx, "outsider")
+	userID := func(name string) interface{} {
+		u, _ := ctx.UserStore.GetByUserName(name)
+		return u.ID
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/channels", ctx.ChannelsHandler)
+	mux.HandleFunc(channelsPath, ctx.SpecificChannelHandler)
+	handler := middleware.Adapt(mux, ctx.RequireAuth())
+
+	resRec := do(handler, "POST", "/v1/channels", owner, &messages.NewChannel{Name: "secret", Private: true})
+	c := &messages.Channel{}
+	json.NewDecoder(resRec.Body).Decode(c)
+	channelURL := channelsPath + c.ID.(string)
+	membersURL := channelURL + "/members"
+
+	var channels []*messages.Channel
+	json.NewDecoder(do(handler, "GET", "/v1/channels", outsider, nil).Body).Decode(&channels)
+	if len(channels) != 0 {
+		t.Errorf("outsider can see the private channel\n")
+	}
+	for _, path := range []string{channelURL, channelURL + "/messages", membersURL} {
+		if resRec = do(handler, "GET", path, outsider, nil); resRec.Code != http.StatusNotFound {
+			t.Errorf("outsider getting %s: expected status %d but got %d\n", path, http.StatusNotFound, resRec.Code)
+		}
+	}
+	if resRec = do(handler, "POST", channelURL+"/messages", outsider, &messages.NewMessage{Body: "let me in"}); resRec.Code != http.StatusNotFound {
+		t.Errorf("outsider posting: expected status %d but got %d\n", http.StatusNotFound, resRec.Code)
+	}
+
+	cases := []struct {
+		desc   string
+		auth   string
+		body   *addMemberRequest
+		status int
+	}{
+		{"owner adds admin", owner, &addMemberRequest{UserID: userID("ada"), Role: messages.RoleAdmin}, http.StatusCreated},
+		{"admin adds admin", admin, &addMemberRequest{UserID: userID("member"), Role: messages.RoleAdmin}, http.StatusForbidden},
+		{"admin adds member", admin, &addMemberRequest{UserID: userID("member")}, http.StatusCreated},
+		{"member adds member", member, &addMemberRequest{UserID: userID("outsider")}, http.StatusForbidden},
+		{"admin demotes owner", admin, &addMemberRequest{UserID: userID("owner"), Role: messages.RoleMember}, http.StatusForbidden},
+		{"owner adds owner", owner, &addMemberRequest{UserID: userID("member"), Role: messages.RoleOwner}, http.StatusBadRequest},
+		{"missing user", owner, &addMemberRequest{UserID: "nobody"}, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		if resRec = do(handler, "POST", membersURL, c.auth, c.body); resRec.Code != c.status {
+			t.Errorf("%s: expected status %d but got %d\n", c.desc, c.status, resRec.Code)
+		}
+	}
+
+	if resRec = do(handler, "POST", channelURL+"/messages", member, &messages.NewMessage{Body: "hi all"}); resRec.Code != http.StatusCreated {
+		t.Errorf("member posting: expected status %d but got %d\n", http.StatusCreated, resRec.Code)
+	}
+	var members []*messages.Member
+	json.NewDecoder(do(handler, "GET", membersURL, member, nil).Body).Decode(&members)
+	if len(members) != 3 {
+		t.Errorf("expected 3 members but got %d\n", len(members))
+	}
+
+	removals := []struct {
+		desc   string
+		auth   string
+		user   string
+		status int
+	}{
+		{"member removes admin", member, "ada", http.StatusForbidden},
+		{"admin removes owner", admin, "owner", http.StatusForbidden},
+		{"owner leaves", owner, "owner", http.StatusForbidden},
+		{"admin removes member", admin, "member", http.StatusOK},
+		{"admin leaves", admin, "ada", http.StatusOK},
+		{"owner removes non-member", owner, "outsider", http.StatusNotFound},
+	}
+	for _, c := range removals {
+		if resRec = do(handler, "DELETE", membersURL+"/"+userID(c.user).(string), c.auth, nil); resRec.Code != c.status {
+			t.Errorf("%s: expected status %d but got %d\n", c.desc, c.status, resRec.Code)
+		}
+	}
+	if resRec = do(handler, "GET", channelURL+"/messages", member, nil); resRec.Code != http.StatusNotFound {
+		t.Errorf("removed member reading: expected status %d but got %d\n", http.StatusNotFound, resRec.Code)
+	}
+}
+
+func TestPreviewsUnfurled(t *testing.T) {
+	ctx := newMessagingContext()
+	ctx.PublicURL = "https://api.example.com"
+	ctx.ImageProxy = NewImageProxy("test key")
+	ctx.Unfurler = unfurl.NewService(summary.NewSummarizer(summary.NewHTTPFetcher(http.DefaultClient), nil), unfurl.NewMemStore(), 0, 1)
+	defer ctx.Unfurler.Close()
+	bus := notification.NewLocalBus()
+	ctx.Events = bus
+	events := make(chan *notification.Event, 1)
+	bus.Subscribe(func(event *notification.Event) { events <- event })
+
+	c, _ := ctx.MessageStore.InsertChannel(&messages.NewChannel{Name: "links"}, &users.User{ID: "someone"})
+	m, _ := ctx.MessageStore.InsertMessage(&messages.NewMessage{ChannelID: c.ID, Body: "http://example.com/page"}, &users.User{ID: "someone"})
+	previews := []*unfurl.Preview{{URL: "http://example.com/page", Summary: &summary.Summary{Props: summary.Props{"image": "http://example.com/cover.png"}}}}
+	ctx.PreviewsUnfurled(messageOwner(m.ID), previews)
+
+	select {
+	case event := <-events:
+		if event.Type != notification.EventMessageUpdate || !strings.Contains(string(event.Payload), "https://api.example.com"+imagesPath) {
+			t.Errorf("expected a message update with the proxied previews but got %s %s\n", event.Type, event.Payload)
+		}
+	default:
+		t.Errorf("expected the channel to be told about the previews\n")
+	}
+}
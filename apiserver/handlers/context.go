@@ -1,13 +1,132 @@
 package handlers
 
 import (
+	"sync"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/mailer"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/apikeys"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/audit"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/identities"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/messages"
 	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	"github.com/info344-s17/challenges-leedann/apiserver/notification"
+	"github.com/info344-s17/challenges-leedann/apiserver/oidc"
 	"github.com/info344-s17/challenges-leedann/apiserver/sessions"
+	"github.com/info344-s17/challenges-leedann/apiserver/summary"
+	"github.com/info344-s17/challenges-leedann/apiserver/unfurl"
+	"github.com/patrickmn/go-cache"
 )
 
+//defaultSummarizer is used when the Context has no Summarizer.
+//It only fetches from public addresses and has no providers
+var defaultSummarizer = summary.NewSummarizer(summary.NewSafeFetcher(summary.DefaultFetchTimeout), nil)
+
 //Context struct provides context to the session context
 type Context struct {
 	SessionKey   string
 	SessionStore sessions.Store
+	//Tokens, if set, makes sessions stateless: users are given a
+	//short-lived access token and a refresh token instead of a session
+	//ID. Partial sessions are still kept in the SessionStore
+	Tokens *sessions.TokenIssuer
+	//TokenUserTTL is how long the users of access tokens are cached
+	//for, and defaults to DefaultTokenUserTTL. See authenticateToken
+	TokenUserTTL time.Duration
 	UserStore    users.Store
+	MessageStore messages.Store
+	//AuditLog records the actions taken through the admin API
+	AuditLog audit.Store
+	//ImageProxy, if set, is used to rewrite the image URLs in summaries
+	ImageProxy *ImageProxy
+	//PublicURL is the scheme and host clients reach the API at, such as
+	//https://api.example.com, and is used for the links the API gives out.
+	//It defaults to the scheme and host of each request
+	PublicURL string
+	//TrustProxy honors the X-Forwarded-Proto and X-Forwarded-Host headers
+	//when there's no PublicURL. Only set it behind a proxy that sets them
+	TrustProxy bool
+	//Summarizer summarizes the pages requested by clients
+	Summarizer *summary.Summarizer
+	//Unfurler, if set, attaches link previews to user-submitted text
+	Unfurler *unfurl.Service
+	//Notifier, if set, sends events to clients connected over WebSockets
+	Notifier *notification.Notifier
+	//Events, if set, is the bus events are published to, so that they
+	//reach the clients connected to every instance. Otherwise events
+	//are sent straight to the Notifier's clients
+	Events notification.Bus
+	//Mailer, if set, sends new users links to verify their email addresses
+	Mailer mailer.Mailer
+	//VerificationURL is where verification links point, with the token
+	//added as the `token` parameter. It defaults to VerifyEmailHandler
+	//at the API's base URL
+	VerificationURL string
+	//VerificationTTL is how long verification links can be used for,
+	//and defaults to DefaultVerificationTTL
+	VerificationTTL time.Duration
+	//RequireVerifiedEmail turns away users who haven't verified their
+	//email address, except from the endpoints that let them verify it
+	RequireVerifiedEmail bool
+	//TOTPIssuer names the service in users' authenticator apps,
+	//and defaults to the host of the request to enroll
+	TOTPIssuer string
+	//IdentityProviders are the identity providers users can
+	//sign in with, by name
+	IdentityProviders map[string]*oidc.Provider
+	//Identities links users to their identities with the IdentityProviders
+	Identities identities.Store
+	//IdentityRedirectURL, if set, is where users are sent back to once
+	//they've signed in with or linked an identity. Otherwise the
+	//callback from the provider responds with JSON
+	IdentityRedirectURL string
+	//APIKeys, if set, lets users create personal API keys
+	//and call the API with them instead of a session
+	APIKeys apikeys.Store
+	//PasswordPolicy decides which passwords users can sign up with,
+	//and defaults to users.DefaultPasswordPolicy
+	PasswordPolicy *users.PasswordPolicy
+	//PasswordHasher hashes new passwords, and defaults to bcrypt. Hashes
+	//made by other hashers, or with other parameters, are replaced when
+	//their users next sign in
+	PasswordHasher users.PasswordHasher
+
+	tokenUsersOnce sync.Once
+	tokenUsers     *cache.Cache
+}
+
+//summarizer returns the Context's Summarizer, or the default one if it has none
+func (ctx *Context) summarizer() *summary.Summarizer {
+	if ctx.Summarizer != nil {
+		return ctx.Summarizer
+	}
+	return defaultSummarizer
+}
+
+//passwordHasher returns the Context's PasswordHasher, or bcrypt if it has none
+func (ctx *Context) passwordHasher() users.PasswordHasher {
+	if ctx.PasswordHasher != nil {
+		return ctx.PasswordHasher
+	}
+	return &users.BcryptHasher{}
+}
+
+//passwordPolicy returns the Context's PasswordPolicy, or the default one if it has none
+func (ctx *Context) passwordPolicy() *users.PasswordPolicy {
+	if ctx.PasswordPolicy != nil {
+		return ctx.PasswordPolicy
+	}
+	return users.DefaultPasswordPolicy
+}
+
+//tokenUserCache returns the cache of the users of access tokens
+func (ctx *Context) tokenUserCache() *cache.Cache {
+	ctx.tokenUsersOnce.Do(func() {
+		ttl := ctx.TokenUserTTL
+		if ttl <= 0 {
+			ttl = DefaultTokenUserTTL
+		}
+		ctx.tokenUsers = cache.New(ttl, time.Minute)
+	})
+	return ctx.tokenUsers
 }
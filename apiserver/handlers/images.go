@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	//registers the GIF decoder with image.Decode
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/summary"
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	//imageCacheDuration is how long proxied images are kept in the cache
+	imageCacheDuration = time.Hour
+	//maxCachedImages is the most images kept in the cache at once
+	maxCachedImages = 1000
+	//maxImagePixels is the largest image (width * height) we will decode,
+	//so that a small file with huge dimensions can't exhaust our memory
+	maxImagePixels = 25000000
+	//jpegQuality is the quality used when encoding JPEG thumbnails
+	jpegQuality = 85
+)
+
+//imagesPath is the path the image proxy is served at
+const imagesPath = "/v1/images"
+
+//the headers a trusted proxy uses to say how the request was sent to it
+const (
+	headerForwardedProto = "X-Forwarded-Proto"
+	headerForwardedHost  = "X-Forwarded-Host"
+)
+
+//thumbnailSizes are the sizes clients can request. Thumbnails fit within
+//a square of the requested size, and a size of 0 returns the original image
+var thumbnailSizes = map[int]bool{
+	0:    true,
+	64:   true,
+	128:  true,
+	256:  true,
+	512:  true,
+	1024: true,
+}
+
+//imageTypes are the image content types the proxy will serve
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+//ImageProxy fetches remote images on behalf of clients, so that clients
+//never connect to the third-party sites directly. Only URLs signed with
+//the proxy's signing key are fetched, so it can't be used as an open proxy
+type ImageProxy struct {
+	signingKey []byte
+	fetcher    summary.Fetcher
+	cache      *cache.Cache
+}
+
+//proxiedImage is an image held in the cache
+type proxiedImage struct {
+	contentType string
+	data        []byte
+}
+
+//NewImageProxy constructs a new ImageProxy that signs URLs with `signingKey`
+func NewImageProxy(signingKey string) *ImageProxy {
+	return &ImageProxy{
+		signingKey: []byte(signingKey),
+		fetcher:    summary.NewSafeFetcher(summary.DefaultFetchTimeout),
+		cache:      cache.New(imageCacheDuration, time.Minute),
+	}
+}
+
+//sign returns the signature for `imageURL`
+func (ip *ImageProxy) sign(imageURL string) string {
+	h := hmac.New(sha256.New, ip.signingKey)
+	h.Write([]byte(imageURL))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+//validSignature reports whether `sig` is the signature of `imageURL`
+func (ip *ImageProxy) validSignature(imageURL string, sig string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	h := hmac.New(sha256.New, ip.signingKey)
+	h.Write([]byte(imageURL))
+	return hmac.Equal(decoded, h.Sum(nil))
+}
+
+//ProxyURL returns the signed URL of `imageURL` on this proxy. `base` is
+//the scheme and host the proxy is served from, such as https://api.example.com
+func (ip *ImageProxy) ProxyURL(base string, imageURL string) string {
+	q := url.Values{}
+	q.Set("url", imageURL)
+	q.Set("sig", ip.sign(imageURL))
+	return base + imagesPath + "?" + q.Encode()
+}
+
+//rewriteSummary replaces the image URLs in the summary with signed proxy
+//URLs on `base`, the scheme and host the proxy is served from
+func (ip *ImageProxy) rewriteSummary(base string, sum *summary.Summary) {
+	for _, prop := range []string{"image", "icon"} {
+		if u, ok := sum.Props[prop]; ok {
+			sum.Props[prop] = ip.ProxyURL(base, u)
+		}
+	}
+	for _, ic := range sum.Icons {
+		ic.URL = ip.ProxyURL(base, ic.URL)
+	}
+}
+
+//baseURL returns the scheme and host clients reach the API at. It's the
+//PublicURL if the Context has one. Otherwise it's the scheme and host the
+//request was sent to, which are only taken from the X-Forwarded-Proto and
+//X-Forwarded-Host headers when the proxy that sets them is trusted
+func (ctx *Context) baseURL(r *http.Request) string {
+	if len(ctx.PublicURL) > 0 {
+		return strings.TrimSuffix(ctx.PublicURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if ctx.TrustProxy {
+		if proto := r.Header.Get(headerForwardedProto); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if fwdHost := r.Header.Get(headerForwardedHost); len(fwdHost) > 0 {
+			host = fwdHost
+		}
+	}
+	return scheme + "://" + host
+}
+
+//ImagesHandler serves the image at the signed `url` query string parameter,
+//resized to fit the optional `size` parameter
+func (ip *ImageProxy) ImagesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	imageURL := r.FormValue("url")
+	if len(imageURL) == 0 {
+		http.Error(w, "bad response no URL", http.StatusBadRequest)
+		return
+	}
+	if !ip.validSignature(imageURL, r.FormValue("sig")) {
+		http.Error(w, "invalid image signature", http.StatusForbidden)
+		return
+	}
+	size := 0
+	if s := r.FormValue("size"); len(s) > 0 {
+		var err error
+		size, err = strconv.Atoi(s)
+		if err != nil || !thumbnailSizes[size] {
+			http.Error(w, "unsupported image size", http.StatusBadRequest)
+			return
+		}
+	}
+
+	img, err := ip.getImage(r, imageURL, size)
+	if err != nil {
+		//the error can describe the remote server, which clients needn't know
+		log.Printf("error getting image %s: %v", imageURL, err)
+		http.Error(w, "Error getting image", http.StatusBadGateway)
+		return
+	}
+	w.Header().Add("Content-Type", img.contentType)
+	w.Header().Add("Content-Length", strconv.Itoa(len(img.data)))
+	w.Header().Add("Cache-Control", "public, max-age=86400")
+	//the content type was sniffed, so browsers must not sniff their own
+	w.Header().Add("X-Content-Type-Options", "nosniff")
+	w.Write(img.data)
+}
+
+//getImage returns the image at `imageURL` resized to `size`,
+//from the cache if we have it, or else by fetching it
+func (ip *ImageProxy) getImage(r *http.Request, imageURL string, size int) (*proxiedImage, error) {
+	key := strconv.Itoa(size) + " " + imageURL
+	if cached, found := ip.cache.Get(key); found {
+		return cached.(*proxiedImage), nil
+	}
+
+	resp, err := ip.fetcher.Fetch(r.Context(), "GET", imageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("response status was %s", resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	//never trust the Content-Type the remote server sent
+	contentType := http.DetectContentType(data)
+	if !imageTypes[contentType] {
+		return nil, fmt.Errorf("content type was %s and not a supported image", contentType)
+	}
+	img := &proxiedImage{
+		contentType: contentType,
+		data:        data,
+	}
+	if size > 0 {
+		img, err = resizeImage(data, size)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ip.cache.ItemCount() < maxCachedImages {
+		ip.cache.Set(key, img, cache.DefaultExpiration)
+	}
+	return img, nil
+}
+
+//resizeImage decodes the image and scales it down to fit within a square of
+//`size` pixels. JPEGs are re-encoded as JPEG; PNGs and GIFs (only the first
+//frame) are encoded as PNG so they keep their transparency
+func resizeImage(data []byte, size int) (*proxiedImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("image is too large (%dx%d)", config.Width, config.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	thumb := thumbnail(src, size)
+	buf := &bytes.Buffer{}
+	if format == "jpeg" {
+		err = jpeg.Encode(buf, thumb, &jpeg.Options{Quality: jpegQuality})
+		return &proxiedImage{contentType: "image/jpeg", data: buf.Bytes()}, err
+	}
+	err = png.Encode(buf, thumb)
+	return &proxiedImage{contentType: "image/png", data: buf.Bytes()}, err
+}
+
+//thumbnail scales `src` down to fit within a square of `size` pixels,
+//keeping its aspect ratio. Each destination pixel is the average of the
+//source pixels it covers, which avoids the aliasing you get from just
+//sampling one source pixel. Images that already fit are returned as-is
+func thumbnail(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	tw, th := size, size
+	if w > h {
+		th = h * size / w
+	} else {
+		tw = w * size / h
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		sy0 := bounds.Min.Y + y*h/th
+		sy1 := bounds.Min.Y + (y+1)*h/th
+		for x := 0; x < tw; x++ {
+			sx0 := bounds.Min.X + x*w/tw
+			sx1 := bounds.Min.X + (x+1)*w/tw
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+			//RGBA() returns 16-bit premultiplied values
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/summary"
+)
+
+func TestImageProxy(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			src.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	pngBuf := &bytes.Buffer{}
+	if err := png.Encode(pngBuf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/notimage" {
+			//claims to be an image, but isn't
+			w.Header().Add("Content-Type", "image/png")
+			w.Write([]byte("<html><script>alert(1)</script></html>"))
+			return
+		}
+		w.Write(pngBuf.Bytes())
+	}))
+	defer server.Close()
+
+	ip := NewImageProxy("test key")
+	ip.fetcher = summary.NewHTTPFetcher(server.Client())
+	imageURL := server.URL + "/red.png"
+
+	proxied, err := url.Parse(ip.ProxyURL("https://api.example.com", imageURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxied.Host != "api.example.com" || proxied.Path != imagesPath {
+		t.Errorf("incorrect proxy URL: %s\n", proxied)
+	}
+	q := proxied.Query()
+
+	get := func(query url.Values) *httptest.ResponseRecorder {
+		resRec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", imagesPath+"?"+query.Encode(), nil)
+		ip.ImagesHandler(resRec, req)
+		return resRec
+	}
+
+	resRec := get(q)
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	if !bytes.Equal(resRec.Body.Bytes(), pngBuf.Bytes()) {
+		t.Errorf("original image was not returned as-is\n")
+	}
+
+	q.Set("size", "64")
+	resRec = get(q)
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	if ct := resRec.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("incorrect Content-Type: expected image/png but got %s\n", ct)
+	}
+	thumb, err := png.Decode(resRec.Body)
+	if err != nil {
+		t.Fatalf("error decoding thumbnail: %v\n", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 64 || b.Dy() != 32 {
+		t.Errorf("incorrect thumbnail size: expected 64x32 but got %dx%d\n", b.Dx(), b.Dy())
+	}
+	if r, _, _, _ := thumb.At(10, 10).RGBA(); r>>8 != 255 {
+		t.Errorf("thumbnail lost its color: got red of %d\n", r>>8)
+	}
+
+	//the same thumbnail again should come from the cache
+	before := hits
+	get(q)
+	if hits != before {
+		t.Errorf("cached thumbnail was fetched again\n")
+	}
+
+	q.Set("size", "65")
+	if resRec = get(q); resRec.Code != http.StatusBadRequest {
+		t.Errorf("unsupported size: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+
+	q.Del("size")
+	q.Set("url", server.URL+"/other.png")
+	if resRec = get(q); resRec.Code != http.StatusForbidden {
+		t.Errorf("bad signature: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+
+	notImage := server.URL + "/notimage"
+	q.Set("url", notImage)
+	q.Set("sig", ip.sign(notImage))
+	if resRec = get(q); resRec.Code != http.StatusBadGateway {
+		t.Errorf("non-image: expected status %d but got %d\n", http.StatusBadGateway, resRec.Code)
+	}
+}
+
+func TestRewriteSummary(t *testing.T) {
+	ip := NewImageProxy("test key")
+	sum := &summary.Summary{
+		Props: summary.Props{
+			"title": "Title",
+			"image": "http://example.com/image.png",
+		},
+		Icons: []*summary.Icon{{URL: "http://example.com/favicon.ico", Rel: "default"}},
+	}
+	ip.rewriteSummary("https://api.example.com", sum)
+
+	if sum.Props["title"] != "Title" {
+		t.Errorf("title should not have been rewritten: got %s\n", sum.Props["title"])
+	}
+	for _, u := range []string{sum.Props["image"], sum.Icons[0].URL} {
+		if !strings.HasPrefix(u, "https://api.example.com"+imagesPath+"?") {
+			t.Errorf("image URL was not rewritten to the proxy: got %s\n", u)
+		}
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/v1/summary", nil)
+	req.Host = "internal:4000"
+	req.Header.Set(headerForwardedProto, "https")
+	req.Header.Set(headerForwardedHost, "api.example.com")
+
+	cases := []struct {
+		ctx      *Context
+		expected string
+	}{
+		{&Context{}, "http://internal:4000"},
+		{&Context{TrustProxy: true}, "https://api.example.com"},
+		{&Context{PublicURL: "https://chat.example.com/", TrustProxy: true}, "https://chat.example.com"},
+	}
+	for _, c := range cases {
+		if base := c.ctx.baseURL(req); base != c.expected {
+			t.Errorf("expected %s but got %s\n", c.expected, base)
+		}
+	}
+}
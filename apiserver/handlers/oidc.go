@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/identities"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	"github.com/info344-s17/challenges-leedann/apiserver/notification"
+	"github.com/info344-s17/challenges-leedann/apiserver/oidc"
+	"github.com/info344-s17/challenges-leedann/apiserver/sessions"
+)
+
+const (
+	//oidcPath is the path prefix for signing in with identity providers
+	oidcPath = "/v1/oidc/"
+	//identitiesPath is the path prefix for the signed-in user's identities
+	identitiesPath = "/v1/users/me/identities/"
+	//oidcFlowTTL is how long users have to sign in with their provider
+	oidcFlowTTL = 10 * time.Minute
+	//oidcFlowCookie is the cookie that ties a flow to the browser that
+	//began it, so a `state` and `code` can't be used in another browser
+	oidcFlowCookie = "oidc_flow"
+	//maxUserNameAttempts is how many numbered user names are tried for
+	//users signing up with a provider whose preferred name is taken
+	maxUserNameAttempts = 100
+)
+
+//errEmailTaken is returned when a user signs up with an identity
+//that has the email address of another account
+var errEmailTaken = errors.New("an account with this email address already exists, so sign in to it and link this identity instead")
+
+//errEmailUnverified is returned when a user signs up with an identity
+//the provider doesn't vouch for the email address of
+var errEmailUnverified = errors.New("your identity provider didn't give a verified email address")
+
+//userNameInvalid matches the characters left out of user names
+//made from identity providers' preferred user names
+var userNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+//oidcFlow is kept in the session store while a user signs in with an
+//identity provider. Its session ID is the `state` the provider sends
+//back, and only the browser with the flow's oidcFlowCookie can finish
+//it, so a callback can't be replayed in someone else's browser to sign
+//them in as the attacker, or to link the attacker's identity to them
+type oidcFlow struct {
+	Provider string
+	Nonce    string
+	Verifier string
+	//BindingHash is the SHA-256 hash of the flow's oidcFlowCookie
+	BindingHash string
+	//LinkUserID is set when a signed-in user is linking an identity
+	LinkUserID users.UserID
+	BeganAt    time.Time
+}
+
+//authURL is the response to starting to link an identity
+type authURL struct {
+	URL string `json:"url"`
+}
+
+//beginOIDCFlow saves a new flow with the provider in the session store,
+//sets the cookie that ties it to the browser, and returns the address
+//to send the user to
+func (ctx *Context) beginOIDCFlow(w http.ResponseWriter, r *http.Request, p *oidc.Provider, linkUserID users.UserID) (string, error) {
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return "", err
+	}
+	binding, err := oidc.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	sid, err := sessions.NewSessionID(ctx.SessionKey)
+	if err != nil {
+		return "", err
+	}
+	flow := &oidcFlow{
+		Provider:    p.Name(),
+		Nonce:       nonce,
+		Verifier:    verifier,
+		BindingHash: hashBinding(binding),
+		LinkUserID:  linkUserID,
+		BeganAt:     time.Now(),
+	}
+	if err := ctx.SessionStore.Save(sid, flow); err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    binding,
+		Path:     oidcPath,
+		MaxAge:   int(oidcFlowTTL / time.Second),
+		Secure:   strings.HasPrefix(ctx.baseURL(r), "https:"),
+		HttpOnly: true,
+		//Lax cookies are still sent when the provider redirects back
+		SameSite: http.SameSiteLaxMode,
+	})
+	return p.AuthCodeURL(sid.String(), nonce, oidc.Challenge(verifier)), nil
+}
+
+//hashBinding returns the hash of a flow's oidcFlowCookie
+func hashBinding(binding string) string {
+	sum := sha256.Sum256([]byte(binding))
+	return hex.EncodeToString(sum[:])
+}
+
+//OIDCHandler signs users in with identity providers. Users are sent to
+//the provider from /v1/oidc/{provider}, and it sends them back to the
+//callback at /v1/oidc/{provider}/callback. Users who haven't signed in
+//with the identity before are signed up, unless another account has
+//its email address, in which case they must sign in to that account
+//and link the identity to it
+func (ctx *Context) OIDCHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, oidcPath), "/")
+	p := ctx.IdentityProviders[parts[0]]
+	if p == nil || len(parts) > 2 || len(parts) == 2 && parts[1] != "callback" {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 1 {
+		u, err := ctx.beginOIDCFlow(w, r, p, nil)
+		if err != nil {
+			http.Error(w, "Error beginning sign-in", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, u, http.StatusFound)
+		return
+	}
+
+	flow, claims, status, err := ctx.finishOIDCFlow(w, r, p)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if flow.LinkUserID != nil {
+		ctx.linkIdentity(w, r, p, normalizeID(flow.LinkUserID), claims)
+		return
+	}
+	ctx.signInWithIdentity(w, r, p, claims)
+}
+
+//finishOIDCFlow ends the flow the callback request belongs to, trading
+//its code for an ID token and returning the claims the token makes.
+//The request must come from the browser that began the flow.
+//If it fails, the error is for the user, along with the status to send
+func (ctx *Context) finishOIDCFlow(w http.ResponseWriter, r *http.Request, p *oidc.Provider) (*oidcFlow, *oidc.Claims, int, error) {
+	q := r.URL.Query()
+	if e := q.Get("error"); len(e) > 0 {
+		return nil, nil, http.StatusBadRequest, fmt.Errorf("sign-in failed: %s", e)
+	}
+	sid, err := sessions.ValidateID(q.Get("state"), ctx.SessionKey)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, errors.New("invalid sign-in state")
+	}
+	flow := &oidcFlow{}
+	if err := ctx.SessionStore.Get(sid, flow); err != nil {
+		return nil, nil, http.StatusBadRequest, errors.New("invalid sign-in state")
+	}
+	//flows can only be finished once
+	ctx.SessionStore.Delete(sid)
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Path: oidcPath, MaxAge: -1, HttpOnly: true})
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(hashBinding(cookie.Value)), []byte(flow.BindingHash)) != 1 {
+		return nil, nil, http.StatusBadRequest, errors.New("this sign-in was begun in another browser, so please try again")
+	}
+	if flow.Provider != p.Name() || time.Since(flow.BeganAt) > oidcFlowTTL {
+		return nil, nil, http.StatusBadRequest, errors.New("your sign-in has expired, so please try again")
+	}
+	token, err := p.Exchange(q.Get("code"), flow.Verifier)
+	if err != nil {
+		log.Printf("error exchanging code with %s: %v", p.Name(), err)
+		return nil, nil, http.StatusBadGateway, errors.New("error signing in with " + p.Name())
+	}
+	claims, err := p.VerifyIDToken(token.IDToken, flow.Nonce)
+	if err != nil {
+		log.Printf("error verifying ID token from %s: %v", p.Name(), err)
+		return nil, nil, http.StatusUnauthorized, errors.New("invalid ID token from " + p.Name())
+	}
+	return flow, claims, 0, nil
+}
+
+//signInWithIdentity signs in the user linked to the identity the claims
+//are about, signing them up first if nobody is linked to it yet
+func (ctx *Context) signInWithIdentity(w http.ResponseWriter, r *http.Request, p *oidc.Provider, claims *oidc.Claims) {
+	var user *users.User
+	id, err := ctx.Identities.Get(p.Name(), claims.Subject)
+	switch err {
+	case nil:
+		user, err = ctx.UserStore.GetByID(id.UserID)
+	case identities.ErrNotFound:
+		user, err = ctx.signUpWithIdentity(r, p, claims)
+	}
+	switch {
+	case err == errEmailTaken:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err == errEmailUnverified:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, "Error signing in", http.StatusInternalServerError)
+		return
+	case user.DeletedAt != nil:
+		http.Error(w, "This account has been deleted", http.StatusUnauthorized)
+		return
+	case user.Disabled:
+		http.Error(w, errAccountDisabled.Error(), http.StatusForbidden)
+		return
+	}
+
+	//the provider is the first factor, so two-factor authentication still applies
+	if user.TwoFactor.Enabled {
+		if err := ctx.beginPartialSession(w, r, user); err != nil {
+			http.Error(w, "Error beginning session", http.StatusInternalServerError)
+			return
+		}
+		fragment := sessionFragment(w)
+		fragment.Set("twoFactorRequired", "true")
+		ctx.finishIdentityFlow(w, r, http.StatusAccepted, &twoFactorChallenge{TwoFactorRequired: true}, fragment)
+		return
+	}
+	if err := ctx.beginSession(w, r, user); err != nil {
+		http.Error(w, "Error beginning session", http.StatusInternalServerError)
+		return
+	}
+	ctx.finishIdentityFlow(w, r, http.StatusOK, user, sessionFragment(w))
+}
+
+//sessionFragment returns the credentials of the session begun in the
+//response, which are put in the fragment of the redirect to the client
+func sessionFragment(w http.ResponseWriter) url.Values {
+	fragment := url.Values{"authorization": {w.Header().Get("Authorization")}}
+	if refresh := w.Header().Get(sessions.HeaderRefreshToken); len(refresh) > 0 {
+		fragment.Set("refreshToken", refresh)
+	}
+	return fragment
+}
+
+//signUpWithIdentity creates a user for the identity the claims are
+//about, and links the identity to them. The new user has a random
+//password, so they can only sign in with the identity
+func (ctx *Context) signUpWithIdentity(r *http.Request, p *oidc.Provider, claims *oidc.Claims) (*users.User, error) {
+	if len(claims.Email) == 0 || !claims.EmailVerified {
+		return nil, errEmailUnverified
+	}
+	//linking identities to existing accounts by their email address
+	//would let anyone who controls a provider take over those accounts
+	if _, err := ctx.UserStore.GetByEmail(claims.Email); err == nil {
+		return nil, errEmailTaken
+	}
+	userName, err := ctx.identityUserName(claims)
+	if err != nil {
+		return nil, err
+	}
+	password, err := oidc.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	user, err := ctx.UserStore.Insert(&users.NewUser{
+		Email:        claims.Email,
+		Password:     password,
+		PasswordConf: password,
+		UserName:     userName,
+		FirstName:    claims.GivenName,
+		LastName:     claims.FamilyName,
+		Hasher:       ctx.passwordHasher(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	//the provider has already verified the address
+	if err := ctx.UserStore.VerifyEmail(user.ID); err != nil {
+		return nil, err
+	}
+	user.EmailVerified = true
+	err = ctx.Identities.Insert(&identities.Identity{
+		Provider: p.Name(),
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Email:    claims.Email,
+		SignedUp: true,
+		LinkedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx.notify(notification.EventUserNew, user.Public())
+	return user, nil
+}
+
+//identityUserName returns an unused user name for a user signing up with
+//an identity, based on the provider's preferred user name for them or
+//their email address, with a number added if it's already taken or reserved
+func (ctx *Context) identityUserName(claims *oidc.Claims) (string, error) {
+	base := claims.UserName
+	if len(base) == 0 {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = userNameInvalid.ReplaceAllString(base, "")
+	if len(base) == 0 {
+		base = "user"
+	}
+	for i := 0; i < maxUserNameAttempts; i++ {
+		name := base
+		if i > 0 {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+		if len(users.CheckUserName(name)) > 0 {
+			continue
+		}
+		taken, err := ctx.UserStore.UserNameTaken(name)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return name, nil
+		}
+	}
+	return "", errors.New("no user name is available")
+}
+
+//linkIdentity links the identity the claims are about to the user with
+//the ID `userID`, who began linking it while they were signed in
+func (ctx *Context) linkIdentity(w http.ResponseWriter, r *http.Request, p *oidc.Provider, userID users.UserID, claims *oidc.Claims) {
+	user, err := ctx.UserStore.GetByID(userID)
+	if err != nil || user.Disabled || user.DeletedAt != nil {
+		http.Error(w, "You must be signed in", http.StatusUnauthorized)
+		return
+	}
+	id := &identities.Identity{
+		Provider: p.Name(),
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Email:    claims.Email,
+		LinkedAt: time.Now(),
+	}
+	if err := ctx.Identities.Insert(id); err != nil {
+		if err != identities.ErrAlreadyLinked {
+			http.Error(w, "Error linking identity", http.StatusInternalServerError)
+			return
+		}
+		existing, err := ctx.Identities.Get(id.Provider, id.Subject)
+		if err != nil || fmt.Sprint(existing.UserID) != fmt.Sprint(user.ID) {
+			http.Error(w, "This identity is linked to another account", http.StatusConflict)
+			return
+		}
+		id = existing
+	}
+	ctx.finishIdentityFlow(w, r, http.StatusOK, id, url.Values{"linked": {p.Name()}})
+}
+
+//finishIdentityFlow responds to the end of a flow with an identity provider.
+//If there's an IdentityRedirectURL, the user's browser is sent there with
+//the `fragment` values in the URL fragment, where they aren't sent to any
+//server. Otherwise the response is `value` encoded as JSON
+func (ctx *Context) finishIdentityFlow(w http.ResponseWriter, r *http.Request, status int, value interface{}, fragment url.Values) {
+	if len(ctx.IdentityRedirectURL) == 0 {
+		respondJSON(w, status, value)
+		return
+	}
+	http.Redirect(w, r, ctx.IdentityRedirectURL+"#"+fragment.Encode(), http.StatusSeeOther)
+}
+
+//UsersMeIdentitiesHandler lists the identities linked to the signed-in
+//user at /v1/users/me/identities. Posting to /v1/users/me/identities/{provider}
+//begins linking an identity, responding with the address to send the user
+//to, and deleting /v1/users/me/identities/{provider}/{subject} unlinks one
+func (ctx *Context) UsersMeIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	user := ctx.sessionViewer(r)
+	if user == nil {
+		http.Error(w, "You must be signed in", http.StatusUnauthorized)
+		return
+	}
+	var parts []string
+	if rest := strings.TrimPrefix(r.URL.EscapedPath(), identitiesPath); rest != r.URL.EscapedPath() && len(rest) > 0 {
+		for _, part := range strings.Split(rest, "/") {
+			unescaped, err := url.PathUnescape(part)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			parts = append(parts, unescaped)
+		}
+	}
+
+	switch {
+	case len(parts) == 0 && r.Method == "GET":
+		found, err := ctx.Identities.ListByUser(user.ID)
+		if err != nil {
+			http.Error(w, "Error fetching identities", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusOK, found)
+	case len(parts) == 1 && r.Method == "POST":
+		p := ctx.IdentityProviders[parts[0]]
+		if p == nil {
+			http.Error(w, "Identity provider not found", http.StatusNotFound)
+			return
+		}
+		u, err := ctx.beginOIDCFlow(w, r, p, user.ID)
+		if err != nil {
+			http.Error(w, "Error beginning to link identity", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusOK, &authURL{URL: u})
+	case len(parts) == 2 && r.Method == "DELETE":
+		id, err := ctx.Identities.Get(parts[0], parts[1])
+		if err != nil || fmt.Sprint(id.UserID) != fmt.Sprint(user.ID) {
+			http.Error(w, "Identity not found", http.StatusNotFound)
+			return
+		}
+		if id.SignedUp {
+			http.Error(w, "You signed up with this identity, so it can't be unlinked", http.StatusConflict)
+			return
+		}
+		if err := ctx.Identities.Delete(id.Provider, id.Subject); err != nil {
+			http.Error(w, "Error unlinking identity", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-Type", contentTypeTextUTF8)
+		w.Write([]byte("Identity has been unlinked"))
+	default:
+		http.Error(w, "Error with request", http.StatusBadRequest)
+	}
+}
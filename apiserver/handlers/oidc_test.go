@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/identities"
+	"github.com/info344-s17/challenges-leedann/apiserver/oidc"
+	"github.com/info344-s17/challenges-leedann/apiserver/oidc/oidctest"
+)
+
+//newOIDCContext returns a messaging Context with the mock provider
+//`server` set up as the identity provider "mock"
+func newOIDCContext(t *testing.T, server *oidctest.Server) *Context {
+	p, err := oidc.NewProvider(&oidc.Config{
+		Name:         "mock",
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		RedirectURL:  "http://localhost/v1/oidc/mock/callback",
+	}, nil)
+	if err != nil {
+		t.Fatalf("error creating provider: %v\n", err)
+	}
+	ctx := newMessagingContext()
+	ctx.IdentityProviders = map[string]*oidc.Provider{"mock": p}
+	ctx.Identities = identities.NewMemStore()
+	return ctx
+}
+
+//authorize follows an authorization URL through the mock provider,
+//returning the path and query of the callback it sends the user to
+func authorize(t *testing.T, server *oidctest.Server, authURL string) string {
+	callback, err := server.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("error authorizing: %v\n", err)
+	}
+	return callback.RequestURI()
+}
+
+//doWithCookies is like do, but sends `cookies` with the request,
+//like the browser that began a flow would
+func doWithCookies(handler http.Handler, method string, path string, auth string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	if len(auth) > 0 {
+		req.Header.Set("Authorization", auth)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resRec := httptest.NewRecorder()
+	handler.ServeHTTP(resRec, req)
+	return resRec
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	server, err := oidctest.NewServer("client", "secret")
+	if err != nil {
+		t.Fatalf("error starting mock provider: %v\n", err)
+	}
+	defer server.Close()
+	ctx := newOIDCContext(t, server)
+	handler := http.HandlerFunc(ctx.OIDCHandler)
+	//signIn returns the callback the provider sends the user to,
+	//and the cookies of the browser that began signing in
+	signIn := func() (string, []*http.Cookie) {
+		resRec := do(handler, "GET", "/v1/oidc/mock", "", nil)
+		if resRec.Code != http.StatusFound {
+			t.Fatalf("beginning sign-in: expected status %d but got %d\n", http.StatusFound, resRec.Code)
+		}
+		return authorize(t, server, resRec.Header().Get("Location")), resRec.Result().Cookies()
+	}
+	callback := func(path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		return doWithCookies(handler, "GET", path, "", cookies)
+	}
+
+	if resRec := do(handler, "GET", "/v1/oidc/nobody", "", nil); resRec.Code != http.StatusNotFound {
+		t.Errorf("unknown provider: expected status %d but got %d\n", http.StatusNotFound, resRec.Code)
+	}
+
+	//new identities sign up
+	server.SetUser("subject-1", "alice@test.com", map[string]interface{}{"given_name": "Alice"})
+	path, cookies := signIn()
+	resRec := callback(path, cookies)
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("signing up: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	alice := resRec.Header().Get("Authorization")
+	u, err := ctx.UserStore.GetByEmail("alice@test.com")
+	if err != nil {
+		t.Fatalf("user was not signed up: %v\n", err)
+	}
+	if u.UserName != "alice" || u.FirstName != "Alice" || !u.EmailVerified {
+		t.Errorf("incorrect new user: %+v\n", u)
+	}
+	if resRec := do(http.HandlerFunc(ctx.UsersMeHandler), "GET", "/v1/users/me", alice, nil); resRec.Code != http.StatusOK {
+		t.Errorf("using the new session: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	//each flow can only be finished once
+	if resRec := callback(path, cookies); resRec.Code != http.StatusBadRequest {
+		t.Errorf("replaying a callback: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+	//only the browser that began a flow can finish it
+	path, _ = signIn()
+	if resRec := callback(path, nil); resRec.Code != http.StatusBadRequest {
+		t.Errorf("a callback without the flow's cookie: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+	path, _ = signIn()
+	if resRec := callback(path, cookies); resRec.Code != http.StatusBadRequest {
+		t.Errorf("a callback with another flow's cookie: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+	if resRec := do(handler, "GET", "/v1/oidc/mock/callback?code=x&state=forged", "", nil); resRec.Code != http.StatusBadRequest {
+		t.Errorf("forged state: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+
+	//known identities sign in to the same user
+	if resRec := callback(signIn()); resRec.Code != http.StatusOK || !strings.Contains(resRec.Body.String(), `"userName":"alice"`) {
+		t.Errorf("signing in again: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	if all, _ := ctx.UserStore.GetAll(); len(all) != 1 {
+		t.Errorf("expected 1 user but got %d\n", len(all))
+	}
+
+	//identities with the email address of another account can't sign up,
+	//and neither can ones without a verified address
+	signUp(t, ctx, "bob")
+	server.SetUser("subject-2", "bob@test.com", nil)
+	if resRec := callback(signIn()); resRec.Code != http.StatusConflict {
+		t.Errorf("signing up with a taken email address: expected status %d but got %d\n", http.StatusConflict, resRec.Code)
+	}
+	server.SetUser("subject-3", "carol@test.com", map[string]interface{}{"email_verified": false})
+	if resRec := callback(signIn()); resRec.Code != http.StatusForbidden {
+		t.Errorf("signing up with an unverified email address: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+
+	//the user name is made unique
+	server.SetUser("subject-4", "alice@example.com", nil)
+	if resRec := callback(signIn()); !strings.Contains(resRec.Body.String(), `"userName":"alice1"`) {
+		t.Errorf("expected the user name alice1 but got %s\n", resRec.Body.String())
+	}
+
+	//with a redirect URL, browsers are sent back to the client with the session
+	ctx.IdentityRedirectURL = "https://chat.example.com/signed-in"
+	server.SetUser("subject-1", "alice@test.com", nil)
+	resRec = callback(signIn())
+	location, _ := url.Parse(resRec.Header().Get("Location"))
+	if resRec.Code != http.StatusSeeOther || location == nil || !strings.HasPrefix(location.String(), ctx.IdentityRedirectURL+"#") {
+		t.Fatalf("expected a redirect to the client but got %d %s\n", resRec.Code, resRec.Header().Get("Location"))
+	}
+	fragment, _ := url.ParseQuery(location.Fragment)
+	if auth := fragment.Get("authorization"); len(auth) == 0 || auth != resRec.Header().Get("Authorization") {
+		t.Errorf("the fragment should have the session's authorization: %s\n", location.Fragment)
+	}
+}
+
+func TestOIDCLinking(t *testing.T) {
+	server, err := oidctest.NewServer("client", "secret")
+	if err != nil {
+		t.Fatalf("error starting mock provider: %v\n", err)
+	}
+	defer server.Close()
+	ctx := newOIDCContext(t, server)
+	handler := http.HandlerFunc(ctx.OIDCHandler)
+	ids := http.HandlerFunc(ctx.UsersMeIdentitiesHandler)
+	bob := signUp(t, ctx, "bob")
+	//link returns the callback the provider sends the user to,
+	//and the cookies of the browser that began linking
+	link := func(auth string) (string, []*http.Cookie) {
+		resRec := do(ids, "POST", "/v1/users/me/identities/mock", auth, nil)
+		if resRec.Code != http.StatusOK {
+			t.Fatalf("beginning to link: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+		}
+		u := &authURL{}
+		json.NewDecoder(resRec.Body).Decode(u)
+		return authorize(t, server, u.URL), resRec.Result().Cookies()
+	}
+	callback := func(path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		return doWithCookies(handler, "GET", path, "", cookies)
+	}
+	signIn := func() *httptest.ResponseRecorder {
+		resRec := do(handler, "GET", "/v1/oidc/mock", "", nil)
+		return callback(authorize(t, server, resRec.Header().Get("Location")), resRec.Result().Cookies())
+	}
+
+	if resRec := do(ids, "POST", "/v1/users/me/identities/mock", "", nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("linking while signed out: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	if resRec := do(ids, "POST", "/v1/users/me/identities/nobody", bob, nil); resRec.Code != http.StatusNotFound {
+		t.Errorf("linking with an unknown provider: expected status %d but got %d\n", http.StatusNotFound, resRec.Code)
+	}
+
+	//a callback can't link an identity in a browser that didn't begin linking
+	server.SetUser("bob|1", "bobby@example.com", nil)
+	path, _ := link(bob)
+	if resRec := callback(path, nil); resRec.Code != http.StatusBadRequest {
+		t.Errorf("linking without the flow's cookie: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+	if found, _ := ctx.Identities.Get("mock", "bob|1"); found != nil {
+		t.Errorf("the identity should not have been linked\n")
+	}
+
+	//a different email address is fine when linking
+	resRec := callback(link(bob))
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("linking: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	resRec = signIn()
+	if resRec.Code != http.StatusOK || !strings.Contains(resRec.Body.String(), `"userName":"bob"`) {
+		t.Errorf("signing in with a linked identity: expected bob but got %d %s\n", resRec.Code, resRec.Body.String())
+	}
+
+	//an identity can only be linked to one user
+	server.SetUser("carol|1", "carol@example.com", nil)
+	carol := signIn().Header().Get("Authorization")
+	server.SetUser("bob|1", "bobby@example.com", nil)
+	if resRec := callback(link(carol)); resRec.Code != http.StatusConflict {
+		t.Errorf("linking another user's identity: expected status %d but got %d\n", http.StatusConflict, resRec.Code)
+	}
+
+	resRec = do(ids, "GET", "/v1/users/me/identities", bob, nil)
+	found := []*identities.Identity{}
+	json.NewDecoder(resRec.Body).Decode(&found)
+	if len(found) != 1 || found[0].Subject != "bob|1" {
+		t.Fatalf("expected bob's identity but got %v\n", found)
+	}
+
+	//identities are unlinked by provider and subject, but users
+	//can't unlink the identity they signed up with
+	if resRec := do(ids, "DELETE", "/v1/users/me/identities/mock/bob%7C1", carol, nil); resRec.Code != http.StatusNotFound {
+		t.Errorf("unlinking another user's identity: expected status %d but got %d\n", http.StatusNotFound, resRec.Code)
+	}
+	if resRec := do(ids, "DELETE", "/v1/users/me/identities/mock/carol%7C1", carol, nil); resRec.Code != http.StatusConflict {
+		t.Errorf("unlinking the identity signed up with: expected status %d but got %d\n", http.StatusConflict, resRec.Code)
+	}
+	if resRec := do(ids, "DELETE", "/v1/users/me/identities/mock/bob%7C1", bob, nil); resRec.Code != http.StatusOK {
+		t.Errorf("unlinking: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	if found, _ := ctx.Identities.ListByUser(found[0].UserID); len(found) != 0 {
+		t.Errorf("identity was not unlinked\n")
+	}
+}
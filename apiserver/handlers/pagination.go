@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	//defaultPageSize is the page size used when no `limit` is given
+	defaultPageSize = 25
+	//maxPageSize is the largest page a client can ask for. Larger
+	//limits are clamped to this rather than rejected
+	maxPageSize = 100
+
+	headerLink       = "Link"
+	headerNextCursor = "X-Next-Cursor"
+)
+
+//errInvalidCursor is returned for cursors that weren't
+//issued by us or that have been tampered with
+var errInvalidCursor = errors.New("invalid cursor")
+
+//page is a parsed `limit` from a request
+type page struct {
+	//Limit is the number of items to return
+	Limit int
+}
+
+//parsePage reads the `limit` and `cursor` query string parameters. If
+//there's a cursor, the position it holds is decoded into `after`, which
+//is left alone for the first page
+func (ctx *Context) parsePage(r *http.Request, after interface{}) (*page, error) {
+	p := &page{Limit: defaultPageSize}
+	q := r.URL.Query()
+	if limit := q.Get("limit"); len(limit) > 0 {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid limit %q", limit)
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		p.Limit = n
+	}
+	if c := q.Get("cursor"); len(c) > 0 {
+		if err := ctx.decodeCursor(c, after); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+//cursorPurpose is the purpose cursors are signed for
+const cursorPurpose = "cursor"
+
+//encodeCursor encodes and signs a cursor holding the position `after`.
+//Clients only ever see the result as an opaque string
+func (ctx *Context) encodeCursor(after interface{}) (string, error) {
+	return ctx.signToken(cursorPurpose, after)
+}
+
+//decodeCursor verifies a cursor and decodes the position it holds into `after`
+func (ctx *Context) decodeCursor(c string, after interface{}) error {
+	if err := ctx.verifyToken(cursorPurpose, c, after); err != nil {
+		return errInvalidCursor
+	}
+	return nil
+}
+
+//setNextPage adds the Link and X-Next-Cursor headers pointing
+//to the page that starts after the position `after`
+func (ctx *Context) setNextPage(w http.ResponseWriter, r *http.Request, p *page, after interface{}) error {
+	next, err := ctx.encodeCursor(after)
+	if err != nil {
+		return err
+	}
+	q := r.URL.Query()
+	q.Set("cursor", next)
+	q.Set("limit", strconv.Itoa(p.Limit))
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	w.Header().Set(headerLink, fmt.Sprintf(`<%s%s>; rel="next"`, ctx.baseURL(r), u.String()))
+	w.Header().Set(headerNextCursor, next)
+	return nil
+}
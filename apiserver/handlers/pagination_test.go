@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+func TestUsersPagination(t *testing.T) {
+	ctx := newMessagingContext()
+	for i := 0; i < 7; i++ {
+		signUp(t, ctx, fmt.Sprintf("user%d", i))
+	}
+	handler := http.HandlerFunc(ctx.UserHandler)
+
+	seen := make(map[string]bool)
+	path := "/v1/users?limit=3"
+	pages := 0
+	for len(path) > 0 {
+		resRec := do(handler, "GET", path, "", nil)
+		if resRec.Code != http.StatusOK {
+			t.Fatalf("expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+		}
+		page := []*users.User{}
+		if err := json.NewDecoder(resRec.Body).Decode(&page); err != nil {
+			t.Fatalf("error decoding page: %v\n", err)
+		}
+		pages++
+		for _, u := range page {
+			if seen[u.UserName] {
+				t.Errorf("user %s was listed twice\n", u.UserName)
+			}
+			seen[u.UserName] = true
+		}
+
+		path = ""
+		if next := resRec.Header().Get(headerNextCursor); len(next) > 0 {
+			if resRec.Header().Get(headerLink) == "" {
+				t.Errorf("next cursor was set without a Link header\n")
+			}
+			path = "/v1/users?limit=3&cursor=" + url.QueryEscape(next)
+		}
+	}
+	if len(seen) != 7 || pages != 3 {
+		t.Errorf("expected 7 users in 3 pages but got %d in %d\n", len(seen), pages)
+	}
+
+	//limits beyond the maximum are clamped rather than rejected
+	if resRec := do(handler, "GET", "/v1/users?limit=1000", "", nil); resRec.Code != http.StatusOK {
+		t.Errorf("large limit: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+
+	cursor, err := ctx.encodeCursor("some user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered, _ := (&Context{SessionKey: "other key"}).encodeCursor("some user")
+	cases := []string{
+		"/v1/users?limit=0",
+		"/v1/users?limit=abc",
+		"/v1/users?cursor=garbage",
+		"/v1/users?cursor=" + url.QueryEscape(cursor+"x"),
+		"/v1/users?cursor=" + url.QueryEscape(tampered),
+	}
+	for _, c := range cases {
+		if resRec := do(handler, "GET", c, "", nil); resRec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d but got %d\n", c, http.StatusBadRequest, resRec.Code)
+		}
+	}
+}
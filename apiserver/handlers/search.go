@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//maxSearchLength is the longest search prefix we accept
+const maxSearchLength = 100
+
+//UsersSearchHandler finds users whose user name, first name or last name
+//starts with the `q` query string parameter. Results are ranked with
+//user name matches first, and are paginated like the user list. Anyone
+//signed in can search for anyone, so results only have public views
+func (ctx *Context) UsersSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len(q) == 0 {
+		http.Error(w, "Missing search query", http.StatusBadRequest)
+		return
+	}
+	if len(q) > maxSearchLength {
+		http.Error(w, "Search query is too long", http.StatusBadRequest)
+		return
+	}
+	var after *users.SearchPosition
+	p, err := ctx.parsePage(r, &after)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	//fetch one extra result to find out if there's another page
+	found, err := ctx.UserStore.Search(q, after, p.Limit+1)
+	if err != nil {
+		http.Error(w, "Error searching users", http.StatusInternalServerError)
+		return
+	}
+	if len(found) > p.Limit {
+		found = found[:p.Limit]
+		if err := ctx.setNextPage(w, r, p, found[len(found)-1].Position()); err != nil {
+			http.Error(w, "Error searching users", http.StatusInternalServerError)
+			return
+		}
+	}
+	results := make([]*users.PublicUser, len(found))
+	for i, f := range found {
+		results[i] = f.User.Public()
+	}
+	respondJSON(w, http.StatusOK, results)
+}
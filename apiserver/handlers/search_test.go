@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/middleware"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+func TestUsersSearchHandler(t *testing.T) {
+	ctx := newMessagingContext()
+	alice := signUp(t, ctx, "alice")
+	for _, name := range []string{"alan", "albert", "bob", "alfred"} {
+		signUp(t, ctx, name)
+	}
+	handler := middleware.Adapt(http.HandlerFunc(ctx.UsersSearchHandler), ctx.RequireAuth())
+
+	if resRec := do(handler, "GET", "/v1/users/search?q=al", "", nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("signed out: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	for _, c := range []string{"/v1/users/search", "/v1/users/search?q=++", "/v1/users/search?q=al&cursor=bad"} {
+		if resRec := do(handler, "GET", c, alice, nil); resRec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d but got %d\n", c, http.StatusBadRequest, resRec.Code)
+		}
+	}
+
+	found := []string{}
+	path := "/v1/users/search?q=AL&limit=3"
+	for len(path) > 0 {
+		resRec := do(handler, "GET", path, alice, nil)
+		if resRec.Code != http.StatusOK {
+			t.Fatalf("expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+		}
+		if strings.Contains(resRec.Body.String(), "@test.com") {
+			t.Errorf("search results should not include emails: %s\n", resRec.Body.String())
+		}
+		results := []*users.PublicUser{}
+		if err := json.NewDecoder(resRec.Body).Decode(&results); err != nil {
+			t.Fatalf("error decoding results: %v\n", err)
+		}
+		for _, r := range results {
+			found = append(found, r.UserName)
+		}
+		path = ""
+		if next := resRec.Header().Get(headerNextCursor); len(next) > 0 {
+			path = "/v1/users/search?q=AL&limit=3&cursor=" + url.QueryEscape(next)
+		}
+	}
+	if got := strings.Join(found, ","); got != "alan,albert,alfred,alice" {
+		t.Errorf("incorrect search results: got %s\n", got)
+	}
+}
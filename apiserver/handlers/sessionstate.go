@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"fmt"
+	"log"
+	"net/http"
 	"time"
 
+	"github.com/info344-s17/challenges-leedann/apiserver/models/apikeys"
 	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	"github.com/info344-s17/challenges-leedann/apiserver/sessions"
 )
 
 //SessionState represents a structure with the user, client's host address that began the session and the time when the session began
@@ -11,4 +16,67 @@ type SessionState struct {
 	BeganAt    time.Time
 	ClientAddr string
 	User       *users.User
+	//SecondFactorPending is set for the partial sessions of users who
+	//have given their password, but not their second factor yet
+	SecondFactorPending bool
+	//APIKey is set when the request was authenticated with an
+	//API key instead of a session, and limits what it can do
+	APIKey *apikeys.APIKey `json:"-"`
+}
+
+//newSessionState returns the state for a session the user is beginning with the request
+func newSessionState(r *http.Request, user *users.User) *SessionState {
+	return &SessionState{
+		BeganAt:    time.Now(),
+		ClientAddr: r.RemoteAddr,
+		User:       user,
+	}
+}
+
+//beginSession begins a new session for the user, adding its ID to the
+//response, or its access and refresh tokens if the Context has Tokens.
+//If the session store can keep track of whose sessions are whose, the
+//session is added to the user's so endSessions can end it
+func (ctx *Context) beginSession(w http.ResponseWriter, r *http.Request, user *users.User) error {
+	if ctx.Tokens != nil {
+		_, err := ctx.Tokens.BeginSession(sessionOwner(user.ID), string(user.Role), time.Now(), w)
+		return err
+	}
+	sid, err := sessions.BeginSession(ctx.SessionKey, ctx.SessionStore, newSessionState(r, user), w)
+	if err != nil {
+		return err
+	}
+	if owners, ok := ctx.SessionStore.(sessions.OwnerStore); ok {
+		return owners.AddOwner(sid, sessionOwner(user.ID))
+	}
+	return nil
+}
+
+//endSessions ends every session the user has. Sessions are revoked in the
+//user store, which authenticate checks, so this works with any session
+//store, and their state is also deleted if the session store can find it.
+//Their API keys are revoked and their WebSocket connections closed too
+func (ctx *Context) endSessions(user *users.User) error {
+	if err := ctx.UserStore.RevokeSessions(user.ID, time.Now()); err != nil {
+		return err
+	}
+	if ctx.APIKeys != nil {
+		if err := ctx.APIKeys.DeleteByUser(user.ID); err != nil {
+			return err
+		}
+	}
+	ctx.tokenUserCache().Delete(sessionOwner(user.ID))
+	ctx.disconnect(user)
+	if owners, ok := ctx.SessionStore.(sessions.OwnerStore); ok {
+		//the sessions have already been revoked, so this is only cleanup
+		if err := owners.DeleteOwner(sessionOwner(user.ID)); err != nil {
+			log.Printf("error deleting sessions of user %v: %v", user.ID, err)
+		}
+	}
+	return nil
+}
+
+//sessionOwner returns the session store owner for a user ID
+func sessionOwner(userID users.UserID) string {
+	return fmt.Sprint(userID)
 }
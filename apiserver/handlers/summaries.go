@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/summary"
+)
+
+const contentTypeNDJSON = "application/x-ndjson"
+
+//batchRequest is the body of a POST to the summaries endpoint
+type batchRequest struct {
+	URLs []string `json:"urls"`
+}
+
+//batchResponse is the JSON response sent for a batch of URLs
+type batchResponse struct {
+	Results []*summary.Result `json:"results"`
+}
+
+//SummariesHandler summarizes a batch of URLs posted as {"urls": [...]}.
+//The URLs are fetched concurrently by a bounded pool of workers, and
+//URLs requested more than once are only fetched once. The results are
+//sent as one JSON object in the order the URLs were posted, or, if the
+//client accepts application/x-ndjson, streamed as one JSON object per
+//line as each URL completes
+func (ctx *Context) SummariesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	if r.Method != "POST" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	batch := &batchRequest{}
+	if err := json.NewDecoder(r.Body).Decode(batch); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(batch.URLs) == 0 {
+		http.Error(w, "bad request no URLs", http.StatusBadRequest)
+		return
+	}
+	if len(batch.URLs) > summary.MaxBatchURLs {
+		http.Error(w, "too many URLs in batch", http.StatusBadRequest)
+		return
+	}
+
+	opts := summaryOptionsFrom(r)
+	base := ctx.baseURL(r)
+	rewrite := func(res *summary.Result) {
+		if ctx.ImageProxy != nil && res.Summary != nil {
+			ctx.ImageProxy.rewriteSummary(base, res.Summary)
+		}
+	}
+	stream := strings.Contains(r.Header.Get("Accept"), contentTypeNDJSON)
+	if !stream {
+		results := ctx.summarizer().SummarizeBatch(r.Context(), batch.URLs, opts, nil)
+		//duplicate URLs share a summary, so only rewrite each one once
+		rewritten := make(map[*summary.Summary]bool)
+		for _, res := range results {
+			if res.Summary != nil && !rewritten[res.Summary] {
+				rewrite(res)
+				rewritten[res.Summary] = true
+			}
+		}
+		w.Header().Add("Content-Type", contentTypeJSONUTF8)
+		json.NewEncoder(w).Encode(&batchResponse{Results: results})
+		return
+	}
+
+	w.Header().Add("Content-Type", contentTypeNDJSON)
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	ctx.summarizer().SummarizeBatch(r.Context(), batch.URLs, opts, func(res *summary.Result) {
+		rewrite(res)
+		encoder.Encode(res)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/summary"
+)
+
+func TestSummariesHandler(t *testing.T) {
+	ctx := &Context{}
+	cases := []struct {
+		method string
+		body   string
+		status int
+	}{
+		{"GET", "", http.StatusMethodNotAllowed},
+		{"POST", "not json", http.StatusBadRequest},
+		{"POST", `{"urls": []}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		resRec := httptest.NewRecorder()
+		req, _ := http.NewRequest(c.method, "/v1/summaries", bytes.NewBufferString(c.body))
+		ctx.SummariesHandler(resRec, req)
+		if resRec.Code != c.status {
+			t.Errorf("%s %q: expected status %d but got %d\n", c.method, c.body, c.status, resRec.Code)
+		}
+	}
+
+	//non-public and invalid URLs fail without any network access
+	body, _ := json.Marshal(&batchRequest{URLs: []string{"http://127.0.0.1/", "javascript:alert(1)"}})
+	resRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/summaries", bytes.NewBuffer(body))
+	req.Header.Set("Accept", contentTypeNDJSON)
+	ctx.SummariesHandler(resRec, req)
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if ct := resRec.Header().Get("Content-Type"); ct != contentTypeNDJSON {
+		t.Errorf("incorrect Content-Type: expected %s but got %s\n", contentTypeNDJSON, ct)
+	}
+	lines := 0
+	scanner := bufio.NewScanner(resRec.Body)
+	for scanner.Scan() {
+		res := &summary.Result{}
+		if err := json.Unmarshal(scanner.Bytes(), res); err != nil {
+			t.Errorf("error decoding streamed result: %v\n", err)
+		}
+		if len(res.Error) == 0 {
+			t.Errorf("expected an error for %s\n", res.URL)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("incorrect number of streamed results: expected 2 but got %d\n", lines)
+	}
+}
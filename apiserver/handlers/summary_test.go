@@ -17,7 +17,8 @@ type summaryTestCase struct {
 
 func testSummaryCase(t *testing.T, c *summaryTestCase, wg *sync.WaitGroup) {
 	defer wg.Done()
-	handler := http.HandlerFunc(SummaryHandler)
+	ctx := &Context{}
+	handler := http.HandlerFunc(ctx.SummaryHandler)
 	resRec := httptest.NewRecorder()
 	req, err := http.NewRequest("GET", "/summary?url="+c.url, nil)
 	if nil != err {
@@ -39,7 +40,7 @@ func testSummaryCase(t *testing.T, c *summaryTestCase, wg *sync.WaitGroup) {
 		t.Errorf("handler returned empty response body")
 	}
 
-	actual := make(map[string]string)
+	actual := make(map[string]interface{})
 	decoder := json.NewDecoder(resRec.Body)
 	err = decoder.Decode(&actual)
 	if nil != err {
@@ -88,7 +89,8 @@ func TestSummary(t *testing.T) {
 }
 
 func TestNoURL(t *testing.T) {
-	handler := http.HandlerFunc(SummaryHandler)
+	ctx := &Context{}
+	handler := http.HandlerFunc(ctx.SummaryHandler)
 	resRec := httptest.NewRecorder()
 	req, err := http.NewRequest("GET", "/summary", nil)
 	if nil != err {
@@ -104,7 +106,8 @@ func TestNoURL(t *testing.T) {
 }
 
 func TestBadURL(t *testing.T) {
-	handler := http.HandlerFunc(SummaryHandler)
+	ctx := &Context{}
+	handler := http.HandlerFunc(ctx.SummaryHandler)
 	resRec := httptest.NewRecorder()
 	req, err := http.NewRequest("GET", "/summary?url=http://www.example.com/invalidpath", nil)
 	if nil != err {
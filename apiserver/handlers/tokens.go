@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+//errInvalidToken is returned for tokens that weren't issued by us,
+//were issued for another purpose, or have been tampered with
+var errInvalidToken = errors.New("invalid token")
+
+//signToken encodes `v` as JSON and signs it with the session key for
+//`purpose`, so that a token issued for one purpose, like a page cursor,
+//can't be used for another, like verifying an email address. The
+//result is URL-safe, but anyone can decode the JSON it holds, so
+//tokens mustn't hold anything secret
+func (ctx *Context) signToken(purpose string, v interface{}) (string, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(buf)
+	return payload + "." + ctx.tokenSignature(purpose, payload), nil
+}
+
+//verifyToken verifies a token signed for `purpose` and decodes
+//the value it holds into `v`
+func (ctx *Context) verifyToken(purpose string, token string, v interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return errInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return errInvalidToken
+	}
+	expected, _ := base64.RawURLEncoding.DecodeString(ctx.tokenSignature(purpose, parts[0]))
+	if !hmac.Equal(sig, expected) {
+		return errInvalidToken
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return errInvalidToken
+	}
+	if err := json.Unmarshal(buf, v); err != nil {
+		return errInvalidToken
+	}
+	return nil
+}
+
+//tokenSignature signs an encoded payload with the session key for `purpose`
+func (ctx *Context) tokenSignature(purpose string, payload string) string {
+	h := hmac.New(sha256.New, []byte(purpose+":"+ctx.SessionKey))
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	"github.com/info344-s17/challenges-leedann/apiserver/sessions"
+)
+
+const (
+	//partialSessionTTL is how long users have to give their second
+	//factor after signing in with their password
+	partialSessionTTL = 5 * time.Minute
+	//maxSecondFactorAttempts is how many codes a user can give in each
+	//secondFactorLockout before they're locked out, so that codes can't be
+	//guessed. Attempts are counted per user, so signing in again doesn't
+	//give more of them, and every request that takes a code counts them
+	maxSecondFactorAttempts = 5
+	//secondFactorLockout is how long attempts are counted for
+	secondFactorLockout = 15 * time.Minute
+)
+
+//errInvalidCode is returned for TOTP and recovery codes that
+//are wrong or have already been used
+var errInvalidCode = errors.New("invalid code")
+
+//errTooManyCodes is returned when a user has given too many codes
+//and has to wait for the lockout to end
+var errTooManyCodes = errors.New("too many wrong codes, try again later")
+
+//errSecondFactorRequired is returned for partial sessions, which
+//can't be used for anything but giving the second factor
+var errSecondFactorRequired = errors.New("you must give your second factor to sign in")
+
+//twoFactorRequest is the body of the requests that need a code
+//from the user's app, or one of their recovery codes
+type twoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+//twoFactorChallenge is the response to signing in with the password
+//of a user who has two-factor authentication enabled
+type twoFactorChallenge struct {
+	TwoFactorRequired bool `json:"twoFactorRequired"`
+}
+
+//twoFactorEnrollment is what users need to set up their app
+type twoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+//recoveryCodes are shown to users when they're generated,
+//and can't be seen again after that
+type recoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+//beginPartialSession begins a session for a user who has given their
+//password but not their second factor yet. The partial session only
+//lets them finish signing in with SessionsTwoFactorHandler
+func (ctx *Context) beginPartialSession(w http.ResponseWriter, r *http.Request, user *users.User) error {
+	state := newSessionState(r, user)
+	state.SecondFactorPending = true
+	_, err := sessions.BeginSession(ctx.SessionKey, ctx.SessionStore, state, w)
+	return err
+}
+
+//checkSecondFactor uses up `code` if it's the user's current TOTP code or
+//one of their recovery codes, and returns errInvalidCode if it's neither.
+//It returns errTooManyCodes once the user has given too many codes
+func (ctx *Context) checkSecondFactor(user *users.User, code string) error {
+	//the attempt is counted before the code is checked,
+	//so codes given at once can't get past the limit
+	attempts, err := ctx.UserStore.AddSecondFactorAttempt(user.ID, time.Now().Add(-secondFactorLockout))
+	if err != nil {
+		return err
+	}
+	if attempts > maxSecondFactorAttempts {
+		return errTooManyCodes
+	}
+	if step, ok := users.MatchTOTP(user.TwoFactor.Secret, code, time.Now()); ok {
+		err = ctx.UserStore.UseTOTPStep(user.ID, step)
+	} else {
+		err = ctx.UserStore.UseRecoveryCode(user.ID, users.HashRecoveryCode(code))
+	}
+	if err == users.ErrCodeUsed {
+		return errInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctx.UserStore.ResetSecondFactorAttempts(user.ID); err != nil {
+		log.Printf("error resetting second factor attempts of user %v: %v", user.ID, err)
+	}
+	return nil
+}
+
+//newRecoveryCodes replaces the user's recovery codes, returning the new ones
+func (ctx *Context) newRecoveryCodes(user *users.User) (*recoveryCodes, error) {
+	codes, hashes, err := users.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.UserStore.SetRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, err
+	}
+	return &recoveryCodes{RecoveryCodes: codes}, nil
+}
+
+//SessionsTwoFactorHandler finishes signing in a user with two-factor
+//authentication. It must be sent the partial session SessionsHandler
+//began, with a code from the user's app or one of their recovery codes,
+//and replaces the partial session with a full one
+func (ctx *Context) SessionsTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+	state := &SessionState{}
+	sid, err := sessions.GetState(r, ctx.SessionKey, ctx.SessionStore, state)
+	if err != nil || state.User == nil || !state.SecondFactorPending {
+		http.Error(w, "You must sign in with your password first", http.StatusUnauthorized)
+		return
+	}
+	if time.Since(state.BeganAt) > partialSessionTTL {
+		ctx.SessionStore.Delete(sid)
+		http.Error(w, "Your sign-in has expired", http.StatusUnauthorized)
+		return
+	}
+	normalizeUserID(state)
+	user, err := ctx.UserStore.GetByID(state.User.ID)
+	if err != nil || user.Disabled || user.DeletedAt != nil || !user.TwoFactor.Enabled {
+		ctx.SessionStore.Delete(sid)
+		http.Error(w, "You must sign in with your password first", http.StatusUnauthorized)
+		return
+	}
+	req := &twoFactorRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	switch err := ctx.checkSecondFactor(user, req.Code); err {
+	case nil:
+	case errTooManyCodes:
+		ctx.SessionStore.Delete(sid)
+		http.Error(w, "Too many wrong codes, try again later", http.StatusTooManyRequests)
+		return
+	case errInvalidCode:
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	default:
+		http.Error(w, "Error checking code", http.StatusInternalServerError)
+		return
+	}
+	ctx.SessionStore.Delete(sid)
+	if err := ctx.beginSession(w, r, user); err != nil {
+		http.Error(w, "Error beginning session", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, user)
+}
+
+//UsersMeTwoFactorHandler starts enrolling the signed-in user in two-factor
+//authentication when posted to, responding with a new TOTP secret and
+//its otpauth URI, or turns two-factor authentication off when deleted,
+//which needs the user's password and a code
+func (ctx *Context) UsersMeTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := ctx.sessionViewer(r)
+	if user == nil {
+		http.Error(w, "You must be signed in", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case "POST":
+		if user.TwoFactor.Enabled {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		//starting again replaces the secret of an unfinished enrollment
+		secret, err := users.NewTOTPSecret()
+		if err != nil {
+			http.Error(w, "Error generating secret", http.StatusInternalServerError)
+			return
+		}
+		if err := ctx.UserStore.SetTwoFactor(user.ID, secret, false); err != nil {
+			http.Error(w, "Error saving secret", http.StatusInternalServerError)
+			return
+		}
+		issuer := ctx.TOTPIssuer
+		if len(issuer) == 0 {
+			issuer = r.Host
+		}
+		respondJSON(w, http.StatusOK, &twoFactorEnrollment{
+			Secret: secret,
+			URI:    users.TOTPURI(issuer, user.Email, secret),
+		})
+	case "DELETE":
+		if !user.TwoFactor.Enabled {
+			http.Error(w, "Two-factor authentication isn't enabled", http.StatusBadRequest)
+			return
+		}
+		req := &twoFactorRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := ctx.checkPassword(user, req.Password); err != nil {
+			http.Error(w, "Incorrect password", http.StatusForbidden)
+			return
+		}
+		if !ctx.requireSecondFactor(w, user, req.Code) {
+			return
+		}
+		if err := ctx.UserStore.SetTwoFactor(user.ID, "", false); err != nil {
+			http.Error(w, "Error turning off two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+		if err := ctx.UserStore.SetRecoveryCodes(user.ID, nil); err != nil {
+			http.Error(w, "Error deleting recovery codes", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-Type", contentTypeTextUTF8)
+		w.Write([]byte("Two-factor authentication has been turned off"))
+	default:
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+	}
+}
+
+//UsersMeTwoFactorConfirmHandler finishes enrolling the signed-in user in
+//two-factor authentication once they've given a code from their app,
+//which shows that it has been set up. It responds with their recovery codes
+func (ctx *Context) UsersMeTwoFactorConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+	user := ctx.sessionViewer(r)
+	if user == nil {
+		http.Error(w, "You must be signed in", http.StatusUnauthorized)
+		return
+	}
+	if user.TwoFactor.Enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if len(user.TwoFactor.Secret) == 0 {
+		http.Error(w, "You must start enrolling first", http.StatusBadRequest)
+		return
+	}
+	req := &twoFactorRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	step, ok := users.MatchTOTP(user.TwoFactor.Secret, req.Code, time.Now())
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+	if err := ctx.UserStore.SetTwoFactor(user.ID, user.TwoFactor.Secret, true); err != nil {
+		http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	//the code used to confirm can't be used again to sign in
+	if err := ctx.UserStore.UseTOTPStep(user.ID, step); err != nil {
+		http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	codes, err := ctx.newRecoveryCodes(user)
+	if err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, codes)
+}
+
+//UsersMeRecoveryCodesHandler replaces the signed-in user's recovery codes
+//with new ones, for when they've used or lost them. It needs a code
+func (ctx *Context) UsersMeRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+	user := ctx.sessionViewer(r)
+	if user == nil {
+		http.Error(w, "You must be signed in", http.StatusUnauthorized)
+		return
+	}
+	if !user.TwoFactor.Enabled {
+		http.Error(w, "Two-factor authentication isn't enabled", http.StatusBadRequest)
+		return
+	}
+	req := &twoFactorRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !ctx.requireSecondFactor(w, user, req.Code) {
+		return
+	}
+	codes, err := ctx.newRecoveryCodes(user)
+	if err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, codes)
+}
+
+//requireSecondFactor checks `code` with checkSecondFactor, responding
+//with an error and returning false if it isn't valid
+func (ctx *Context) requireSecondFactor(w http.ResponseWriter, user *users.User, code string) bool {
+	err := ctx.checkSecondFactor(user, code)
+	if err == errInvalidCode {
+		http.Error(w, "Invalid code", http.StatusForbidden)
+		return false
+	}
+	if err == errTooManyCodes {
+		http.Error(w, "Too many wrong codes, try again later", http.StatusTooManyRequests)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Error checking code", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
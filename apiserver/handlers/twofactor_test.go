@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/audit"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+func TestTwoFactor(t *testing.T) {
+	ctx := newMessagingContext()
+	ctx.TOTPIssuer = "Chat"
+	alice := signUp(t, ctx, "alice")
+	tfa := http.HandlerFunc(ctx.UsersMeTwoFactorHandler)
+	confirm := http.HandlerFunc(ctx.UsersMeTwoFactorConfirmHandler)
+	signIn := http.HandlerFunc(ctx.SessionsHandler)
+	secondStep := http.HandlerFunc(ctx.SessionsTwoFactorHandler)
+	me := http.HandlerFunc(ctx.UsersMeHandler)
+	creds := &users.Credentials{Email: "alice@test.com", Password: "password"}
+	//code returns the code `offset` periods from now
+	code := func(secret string, offset int64) *twoFactorRequest {
+		c, err := users.TOTPCode(secret, users.TOTPStep(time.Now())+offset)
+		if err != nil {
+			t.Fatalf("error generating code: %v\n", err)
+		}
+		return &twoFactorRequest{Password: "password", Code: c}
+	}
+
+	if resRec := do(confirm, "POST", "/v1/users/me/2fa/confirm", alice, &twoFactorRequest{Code: "123456"}); resRec.Code != http.StatusBadRequest {
+		t.Errorf("confirming before enrolling: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+	resRec := do(tfa, "POST", "/v1/users/me/2fa", alice, nil)
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("enrolling: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	enrollment := &twoFactorEnrollment{}
+	json.NewDecoder(resRec.Body).Decode(enrollment)
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/Chat:alice@test.com?") {
+		t.Errorf("incorrect otpauth URI: %s\n", enrollment.URI)
+	}
+	//two-factor authentication isn't on until it's confirmed
+	if resRec := do(signIn, "POST", "/v1/sessions", "", creds); resRec.Code != http.StatusOK {
+		t.Errorf("signing in before confirming: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if resRec := do(confirm, "POST", "/v1/users/me/2fa/confirm", alice, code(enrollment.Secret, 5)); resRec.Code != http.StatusBadRequest {
+		t.Errorf("confirming with a wrong code: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+	resRec = do(confirm, "POST", "/v1/users/me/2fa/confirm", alice, code(enrollment.Secret, 0))
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("confirming: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	codes := &recoveryCodes{}
+	json.NewDecoder(resRec.Body).Decode(codes)
+	if len(codes.RecoveryCodes) != users.RecoveryCodeCount {
+		t.Fatalf("expected %d recovery codes but got %d\n", users.RecoveryCodeCount, len(codes.RecoveryCodes))
+	}
+	if resRec := do(me, "GET", "/v1/users/me", alice, nil); strings.Contains(resRec.Body.String(), enrollment.Secret) {
+		t.Errorf("the TOTP secret should never be sent to clients\n")
+	}
+
+	//signing in with the password only begins a partial session
+	resRec = do(signIn, "POST", "/v1/sessions", "", creds)
+	if resRec.Code != http.StatusAccepted {
+		t.Fatalf("signing in: expected status %d but got %d\n", http.StatusAccepted, resRec.Code)
+	}
+	partial := resRec.Header().Get("Authorization")
+	if resRec := do(me, "GET", "/v1/users/me", partial, nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("using a partial session: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	//the code used to confirm can't be used again
+	if resRec := do(secondStep, "POST", "/v1/sessions/2fa", partial, code(enrollment.Secret, 0)); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("reusing a code: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	resRec = do(secondStep, "POST", "/v1/sessions/2fa", partial, code(enrollment.Secret, 1))
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("giving the second factor: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	full := resRec.Header().Get("Authorization")
+	if full == partial {
+		t.Errorf("the partial session should be replaced with a new one\n")
+	}
+	if resRec := do(me, "GET", "/v1/users/me", full, nil); resRec.Code != http.StatusOK {
+		t.Errorf("using the full session: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if resRec := do(secondStep, "POST", "/v1/sessions/2fa", partial, code(enrollment.Secret, 1)); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("reusing a partial session: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+
+	//recovery codes can be used once each
+	partial = do(signIn, "POST", "/v1/sessions", "", creds).Header().Get("Authorization")
+	recovery := &twoFactorRequest{Code: strings.ToUpper(codes.RecoveryCodes[0])}
+	if resRec := do(secondStep, "POST", "/v1/sessions/2fa", partial, recovery); resRec.Code != http.StatusOK {
+		t.Errorf("using a recovery code: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	partial = do(signIn, "POST", "/v1/sessions", "", creds).Header().Get("Authorization")
+	if resRec := do(secondStep, "POST", "/v1/sessions/2fa", partial, recovery); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("reusing a recovery code: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+
+	//new recovery codes replace the old ones
+	resRec = do(http.HandlerFunc(ctx.UsersMeRecoveryCodesHandler), "POST", "/v1/users/me/2fa/recovery-codes", alice, &twoFactorRequest{Code: codes.RecoveryCodes[1]})
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("resetting recovery codes: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	newCodes := &recoveryCodes{}
+	json.NewDecoder(resRec.Body).Decode(newCodes)
+	partial = do(signIn, "POST", "/v1/sessions", "", creds).Header().Get("Authorization")
+	if resRec := do(secondStep, "POST", "/v1/sessions/2fa", partial, &twoFactorRequest{Code: codes.RecoveryCodes[2]}); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("using an old recovery code: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+
+	//turning it off needs the password and a code
+	if resRec := do(tfa, "DELETE", "/v1/users/me/2fa", alice, &twoFactorRequest{Password: "wrong", Code: newCodes.RecoveryCodes[0]}); resRec.Code != http.StatusForbidden {
+		t.Errorf("turning off with the wrong password: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+	if resRec := do(tfa, "DELETE", "/v1/users/me/2fa", alice, &twoFactorRequest{Password: "password", Code: newCodes.RecoveryCodes[0]}); resRec.Code != http.StatusOK {
+		t.Fatalf("turning off: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	if resRec := do(signIn, "POST", "/v1/sessions", "", creds); resRec.Code != http.StatusOK {
+		t.Errorf("signing in after turning off: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+}
+
+func TestSecondFactorLockout(t *testing.T) {
+	ctx := newMessagingContext()
+	signUp(t, ctx, "alice")
+	alice, _ := ctx.UserStore.GetByUserName("alice")
+	secret, _ := users.NewTOTPSecret()
+	ctx.UserStore.SetTwoFactor(alice.ID, secret, true)
+	signIn := http.HandlerFunc(ctx.SessionsHandler)
+	secondStep := http.HandlerFunc(ctx.SessionsTwoFactorHandler)
+	creds := &users.Credentials{Email: "alice@test.com", Password: "password"}
+	wrong := &twoFactorRequest{Code: "000000"}
+	if c, _ := users.TOTPCode(secret, users.TOTPStep(time.Now())); c == wrong.Code {
+		wrong.Code = "000001"
+	}
+
+	partial := do(signIn, "POST", "/v1/sessions", "", creds).Header().Get("Authorization")
+	for i := 0; i < maxSecondFactorAttempts; i++ {
+		if resRec := do(secondStep, "POST", "/v1/sessions/2fa", partial, wrong); resRec.Code != http.StatusUnauthorized {
+			t.Fatalf("giving a wrong code: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+		}
+	}
+	if resRec := do(secondStep, "POST", "/v1/sessions/2fa", partial, wrong); resRec.Code != http.StatusTooManyRequests {
+		t.Errorf("giving too many codes: expected status %d but got %d\n", http.StatusTooManyRequests, resRec.Code)
+	}
+
+	//signing in again doesn't reset the count, even for the right code
+	partial = do(signIn, "POST", "/v1/sessions", "", creds).Header().Get("Authorization")
+	c, _ := users.TOTPCode(secret, users.TOTPStep(time.Now()))
+	if resRec := do(secondStep, "POST", "/v1/sessions/2fa", partial, &twoFactorRequest{Code: c}); resRec.Code != http.StatusTooManyRequests {
+		t.Errorf("signing in again while locked out: expected status %d but got %d\n", http.StatusTooManyRequests, resRec.Code)
+	}
+
+	//attempts made before the lockout are forgotten
+	if _, err := ctx.UserStore.AddSecondFactorAttempt(alice.ID, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("error adding attempt: %v\n", err)
+	}
+	partial = do(signIn, "POST", "/v1/sessions", "", creds).Header().Get("Authorization")
+	if resRec := do(secondStep, "POST", "/v1/sessions/2fa", partial, &twoFactorRequest{Code: c}); resRec.Code != http.StatusOK {
+		t.Errorf("signing in after the lockout: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+}
+
+func TestSecondFactorLockoutCoversSettings(t *testing.T) {
+	ctx := newMessagingContext()
+	alice := signUp(t, ctx, "alice")
+	user, _ := ctx.UserStore.GetByUserName("alice")
+	secret, _ := users.NewTOTPSecret()
+	ctx.UserStore.SetTwoFactor(user.ID, secret, true)
+	regenerate := http.HandlerFunc(ctx.UsersMeRecoveryCodesHandler)
+	tfa := http.HandlerFunc(ctx.UsersMeTwoFactorHandler)
+	wrong := &twoFactorRequest{Password: "password", Code: "000000"}
+	if c, _ := users.TOTPCode(secret, users.TOTPStep(time.Now())); c == wrong.Code {
+		wrong.Code = "000001"
+	}
+
+	for i := 0; i < maxSecondFactorAttempts; i++ {
+		if resRec := do(regenerate, "POST", "/v1/users/me/2fa/recovery-codes", alice, wrong); resRec.Code != http.StatusForbidden {
+			t.Fatalf("giving a wrong code: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+		}
+	}
+	c, _ := users.TOTPCode(secret, users.TOTPStep(time.Now()))
+	right := &twoFactorRequest{Password: "password", Code: c}
+	if resRec := do(regenerate, "POST", "/v1/users/me/2fa/recovery-codes", alice, right); resRec.Code != http.StatusTooManyRequests {
+		t.Errorf("regenerating recovery codes while locked out: expected status %d but got %d\n", http.StatusTooManyRequests, resRec.Code)
+	}
+	if resRec := do(tfa, "DELETE", "/v1/users/me/2fa", alice, right); resRec.Code != http.StatusTooManyRequests {
+		t.Errorf("turning off while locked out: expected status %d but got %d\n", http.StatusTooManyRequests, resRec.Code)
+	}
+	if !user.TwoFactor.Enabled {
+		t.Errorf("two-factor authentication shouldn't have been turned off\n")
+	}
+}
+
+func TestAdminResetTwoFactor(t *testing.T) {
+	ctx := newMessagingContext()
+	ctx.AuditLog = audit.NewMemStore()
+	admin := signUp(t, ctx, "ada")
+	signUp(t, ctx, "bob")
+	a, _ := ctx.UserStore.GetByUserName("ada")
+	bob, _ := ctx.UserStore.GetByUserName("bob")
+	ctx.UserStore.SetRole(a.ID, users.RoleAdmin)
+	secret, _ := users.NewTOTPSecret()
+	ctx.UserStore.SetTwoFactor(bob.ID, secret, true)
+
+	handler := ctx.RequireAuth()(http.HandlerFunc(ctx.AdminUserHandler))
+	path := adminUsersPath + bob.ID.(string)
+	if resRec := do(handler, "PATCH", path, admin, map[string]bool{"twoFactor": true}); resRec.Code != http.StatusBadRequest {
+		t.Errorf("turning on for a user: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+	if resRec := do(handler, "PATCH", path, admin, map[string]bool{"twoFactor": false}); resRec.Code != http.StatusOK {
+		t.Fatalf("resetting: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	if bob.TwoFactor.Enabled {
+		t.Errorf("two-factor authentication should have been turned off\n")
+	}
+	entries, _ := ctx.AuditLog.List(0, 10)
+	if len(entries) != 1 || entries[0].Action != audit.ActionResetTwoFactor {
+		t.Errorf("expected a %s audit entry but got %v\n", audit.ActionResetTwoFactor, entries)
+	}
+}
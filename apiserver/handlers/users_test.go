@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/audit"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	ctx := newMessagingContext()
+	ctx.AuditLog = audit.NewMemStore()
+	alice := signUp(t, ctx, "alice")
+	signIn := &users.Credentials{Email: "alice@test.com", Password: "password"}
+	resRec := do(http.HandlerFunc(ctx.SessionsHandler), "POST", "/v1/sessions", "", signIn)
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("signing in: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	otherSession := resRec.Header().Get("Authorization")
+	me := http.HandlerFunc(ctx.UsersMeHandler)
+
+	if resRec := do(me, "DELETE", "/v1/users/me", "", nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("signed out: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	if resRec := do(me, "DELETE", "/v1/users/me", alice, nil); resRec.Code != http.StatusOK {
+		t.Fatalf("deleting: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+
+	//every session is ended, and the account can't be signed in to
+	for _, auth := range []string{alice, otherSession} {
+		if resRec := do(me, "GET", "/v1/users/me", auth, nil); resRec.Code != http.StatusUnauthorized {
+			t.Errorf("deleted user's session: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+		}
+	}
+	if resRec := do(http.HandlerFunc(ctx.SessionsHandler), "POST", "/v1/sessions", "", signIn); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("signing in to a deleted account: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	if resRec := do(http.HandlerFunc(ctx.UserHandler), "GET", "/v1/users", "", nil); resRec.Body.String() != "[]\n" {
+		t.Errorf("deleted users should not be listed: got %s\n", resRec.Body.String())
+	}
+
+	//the account is kept for the grace period, and purged after it
+	u, err := ctx.UserStore.GetByEmail("alice@test.com")
+	if err != nil || u.DeletedAt == nil {
+		t.Fatalf("deleted account should be kept until it's purged: %v\n", err)
+	}
+	if n, _ := ctx.UserStore.Purge(time.Now()); n != 1 {
+		t.Errorf("expected 1 account to be purged but got %d\n", n)
+	}
+}
+
+func TestSignUpFieldErrors(t *testing.T) {
+	ctx := newMessagingContext()
+	ctx.PasswordPolicy = &users.PasswordPolicy{MinLength: 10, MinClasses: 2}
+	resRec := do(http.HandlerFunc(ctx.UserHandler), "POST", "/v1/users", "", &users.NewUser{
+		Email:        "alice@test.com",
+		Password:     "alicealice",
+		PasswordConf: "alicealice",
+		UserName:     "alice",
+	})
+	if resRec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+	res := &fieldErrors{}
+	if err := json.NewDecoder(resRec.Body).Decode(res); err != nil {
+		t.Fatalf("error decoding field errors: %v\n", err)
+	}
+	if len(res.Errors["password"]) != 3 || len(res.Errors) != 1 {
+		t.Errorf("expected 3 problems with the password but got %v\n", res.Errors)
+	}
+}
+
+func TestSignUpNormalized(t *testing.T) {
+	ctx := newMessagingContext()
+	signUp(t, ctx, "bob")
+	signUpAs := func(email string, userName string) int {
+		return do(http.HandlerFunc(ctx.UserHandler), "POST", "/v1/users", "", &users.NewUser{
+			Email:        email,
+			Password:     "password",
+			PasswordConf: "password",
+			UserName:     userName,
+		}).Code
+	}
+
+	//emails that differ in case, and names that look alike, are taken
+	cases := []struct {
+		email    string
+		userName string
+	}{
+		{"BOB@Test.com", "robert"},
+		{"robert@test.com", "Bob"},
+		{"robert@test.com", "bоb"},
+		{"robert@test.com", "admin"},
+	}
+	for _, c := range cases {
+		if code := signUpAs(c.email, c.userName); code != http.StatusBadRequest {
+			t.Errorf("%s %s: expected status %d but got %d\n", c.email, c.userName, http.StatusBadRequest, code)
+		}
+	}
+
+	signIn := &users.Credentials{Email: "Bob@TEST.com", Password: "password"}
+	if resRec := do(http.HandlerFunc(ctx.SessionsHandler), "POST", "/v1/sessions", "", signIn); resRec.Code != http.StatusOK {
+		t.Errorf("signing in with a differently cased email: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/mailer"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+const (
+	//DefaultVerificationTTL is how long links to verify
+	//an email address can be used for
+	DefaultVerificationTTL = 24 * time.Hour
+	//verificationResendInterval is how long users must wait
+	//before they can be sent another verification link
+	verificationResendInterval = time.Minute
+
+	verificationPurpose = "verify-email"
+	verifyPath          = "/v1/users/verify"
+)
+
+//errEmailNotVerified is returned when an unverified user tries to use
+//an account that must have a verified email address
+var errEmailNotVerified = errors.New("you must verify your email address first")
+
+//verificationToken is what's held by the signed token in a verification
+//link. The link is only good for the address it was sent to, so changing
+//the address makes the links sent to the old one useless
+type verificationToken struct {
+	UserID  users.UserID `json:"uid"`
+	Email   string       `json:"email"`
+	Expires int64        `json:"exp"`
+}
+
+//sendVerification sends the user a link to verify their email address.
+//Without a Mailer there's no way to verify addresses, so this does
+//nothing, and RequireVerifiedEmail shouldn't be set
+func (ctx *Context) sendVerification(r *http.Request, user *users.User) error {
+	if ctx.Mailer == nil {
+		return nil
+	}
+	ttl := ctx.VerificationTTL
+	if ttl <= 0 {
+		ttl = DefaultVerificationTTL
+	}
+	now := time.Now()
+	token, err := ctx.signToken(verificationPurpose, &verificationToken{
+		UserID:  user.ID,
+		Email:   user.Email,
+		Expires: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	link := ctx.VerificationURL
+	if len(link) == 0 {
+		link = ctx.baseURL(r) + verifyPath
+	}
+	sep := "?"
+	if strings.Contains(link, "?") {
+		sep = "&"
+	}
+	link += sep + "token=" + url.QueryEscape(token)
+	err = ctx.Mailer.Send(&mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease verify your email address by opening this link:\n\n%s\n\nThe link expires in %s. If you didn't sign up, you can ignore this email.\n",
+			user.UserName, link, ttl),
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.UserStore.MarkVerificationSent(user.ID, now)
+}
+
+//VerifyEmailHandler verifies the email address a verification link was
+//sent to. The token from the link is read from the `token` query string
+//or form parameter, so the link can be opened straight from the email,
+//and users don't have to be signed in to use it
+func (ctx *Context) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+	token := &verificationToken{}
+	if err := ctx.verifyToken(verificationPurpose, r.FormValue("token"), token); err != nil {
+		http.Error(w, "Invalid verification link", http.StatusBadRequest)
+		return
+	}
+	if time.Now().Unix() > token.Expires {
+		http.Error(w, "This verification link has expired", http.StatusBadRequest)
+		return
+	}
+	user, err := ctx.UserStore.GetByID(normalizeID(token.UserID))
+	if err != nil || user.DeletedAt != nil || user.Email != token.Email {
+		http.Error(w, "Invalid verification link", http.StatusBadRequest)
+		return
+	}
+	if !user.EmailVerified {
+		if err := ctx.UserStore.VerifyEmail(user.ID); err != nil {
+			http.Error(w, "Error verifying email address", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Add("Content-Type", contentTypeTextUTF8)
+	w.Write([]byte("Your email address has been verified"))
+}
+
+//UsersMeVerificationHandler sends the signed-in user another link to
+//verify their email address. Users can't be sent links more often than
+//once every verificationResendInterval
+func (ctx *Context) UsersMeVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Error with request", http.StatusMethodNotAllowed)
+		return
+	}
+	//this is reachable by unverified users even with RequireVerifiedEmail
+	user := ctx.viewer(r)
+	if user == nil {
+		http.Error(w, "You must be signed in", http.StatusUnauthorized)
+		return
+	}
+	if user.EmailVerified {
+		http.Error(w, "Your email address is already verified", http.StatusBadRequest)
+		return
+	}
+	if ctx.Mailer == nil {
+		http.Error(w, "Email addresses can't be verified", http.StatusServiceUnavailable)
+		return
+	}
+	if wait := verificationResendInterval - time.Since(user.VerificationSentAt); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+		http.Error(w, "A verification link was sent recently", http.StatusTooManyRequests)
+		return
+	}
+	if err := ctx.sendVerification(r, user); err != nil {
+		http.Error(w, "Error sending verification link", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", contentTypeTextUTF8)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("A verification link has been sent to " + user.Email))
+}
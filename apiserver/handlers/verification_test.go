@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/mailer"
+)
+
+//fakeMailer keeps the messages it's asked to send
+type fakeMailer struct {
+	sent []*mailer.Message
+	mx   sync.Mutex
+}
+
+func (m *fakeMailer) Send(msg *mailer.Message) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+//lastToken returns the token in the link of the last message sent
+func (m *fakeMailer) lastToken(t *testing.T) string {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if len(m.sent) == 0 {
+		t.Fatalf("no email was sent\n")
+	}
+	body := m.sent[len(m.sent)-1].Body
+	i := strings.Index(body, "http://")
+	if i < 0 {
+		t.Fatalf("no link in email: %s\n", body)
+	}
+	link, err := url.Parse(strings.Fields(body[i:])[0])
+	if err != nil {
+		t.Fatalf("error parsing link: %v\n", err)
+	}
+	if link.Path != verifyPath {
+		t.Errorf("link should point to %s but points to %s\n", verifyPath, link.Path)
+	}
+	return link.Query().Get("token")
+}
+
+func TestEmailVerification(t *testing.T) {
+	ctx := newMessagingContext()
+	mail := &fakeMailer{}
+	ctx.Mailer = mail
+	ctx.RequireVerifiedEmail = true
+	alice := signUp(t, ctx, "alice")
+	if len(mail.sent) != 1 || mail.sent[0].To != "alice@test.com" {
+		t.Fatalf("expected a verification email to alice but got %v\n", mail.sent)
+	}
+	token := mail.lastToken(t)
+
+	//unverified users can only see themselves and ask for another link
+	protected := ctx.RequireAuth()(http.HandlerFunc(ctx.ChannelsHandler))
+	if resRec := do(protected, "GET", "/v1/channels", alice, nil); resRec.Code != http.StatusForbidden {
+		t.Errorf("unverified user: expected status %d but got %d\n", http.StatusForbidden, resRec.Code)
+	}
+	if resRec := do(http.HandlerFunc(ctx.UsersMeHandler), "GET", "/v1/users/me", alice, nil); resRec.Code != http.StatusOK {
+		t.Errorf("unverified user's own record: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+
+	//links can't be sent again right away
+	resend := http.HandlerFunc(ctx.UsersMeVerificationHandler)
+	resRec := do(resend, "POST", "/v1/users/me/verification", alice, nil)
+	if resRec.Code != http.StatusTooManyRequests || len(resRec.Header().Get("Retry-After")) == 0 {
+		t.Errorf("resending right away: expected status %d with Retry-After but got %d\n", http.StatusTooManyRequests, resRec.Code)
+	}
+	u, _ := ctx.UserStore.GetByEmail("alice@test.com")
+	ctx.UserStore.MarkVerificationSent(u.ID, time.Now().Add(-verificationResendInterval))
+	if resRec := do(resend, "POST", "/v1/users/me/verification", alice, nil); resRec.Code != http.StatusAccepted {
+		t.Fatalf("resending: expected status %d but got %d\n", http.StatusAccepted, resRec.Code)
+	}
+	if len(mail.sent) != 2 {
+		t.Errorf("expected 2 emails to have been sent but got %d\n", len(mail.sent))
+	}
+
+	verify := http.HandlerFunc(ctx.VerifyEmailHandler)
+	invalid := []string{
+		"",
+		"garbage",
+		token + "x",
+		//cursors are signed with the same key, but for another purpose
+		mustSign(t, ctx, cursorPurpose, &verificationToken{UserID: u.ID, Email: u.Email, Expires: time.Now().Add(time.Hour).Unix()}),
+		//links sent to an old address can't verify the new one
+		mustSign(t, ctx, verificationPurpose, &verificationToken{UserID: u.ID, Email: "old@test.com", Expires: time.Now().Add(time.Hour).Unix()}),
+	}
+	for _, tok := range invalid {
+		if resRec := do(verify, "GET", "/v1/users/verify?token="+url.QueryEscape(tok), "", nil); resRec.Code != http.StatusBadRequest {
+			t.Errorf("token %q: expected status %d but got %d\n", tok, http.StatusBadRequest, resRec.Code)
+		}
+	}
+	expired := mustSign(t, ctx, verificationPurpose, &verificationToken{UserID: u.ID, Email: u.Email, Expires: time.Now().Add(-time.Minute).Unix()})
+	resRec = do(verify, "GET", "/v1/users/verify?token="+url.QueryEscape(expired), "", nil)
+	if resRec.Code != http.StatusBadRequest || !strings.Contains(resRec.Body.String(), "expired") {
+		t.Errorf("expired token: expected status %d but got %d: %s\n", http.StatusBadRequest, resRec.Code, resRec.Body.String())
+	}
+
+	//links can be opened without signing in
+	if resRec := do(verify, "GET", "/v1/users/verify?token="+url.QueryEscape(mail.lastToken(t)), "", nil); resRec.Code != http.StatusOK {
+		t.Fatalf("verifying: expected status %d but got %d: %s\n", http.StatusOK, resRec.Code, resRec.Body.String())
+	}
+	if resRec := do(protected, "GET", "/v1/channels", alice, nil); resRec.Code != http.StatusOK {
+		t.Errorf("verified user: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	if resRec := do(resend, "POST", "/v1/users/me/verification", alice, nil); resRec.Code != http.StatusBadRequest {
+		t.Errorf("resending once verified: expected status %d but got %d\n", http.StatusBadRequest, resRec.Code)
+	}
+}
+
+func mustSign(t *testing.T, ctx *Context, purpose string, v interface{}) string {
+	token, err := ctx.signToken(purpose, v)
+	if err != nil {
+		t.Fatalf("error signing token: %v\n", err)
+	}
+	return token
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//viewer returns the signed-in user making the request, or nil if the
+//request isn't from a signed-in user, or is made with an API key whose
+//scopes don't allow it
+func (ctx *Context) viewer(r *http.Request) *users.User {
+	state := ctx.viewerState(r)
+	if state == nil || state.APIKey != nil && !state.APIKey.Allows(r.Method) {
+		return nil
+	}
+	return state.User
+}
+
+//sessionViewer is like viewer, but doesn't accept API keys, so that
+//they can't be used to change how the user signs in or to create more
+//keys, whatever their scopes
+func (ctx *Context) sessionViewer(r *http.Request) *users.User {
+	state := ctx.viewerState(r)
+	if state == nil || state.APIKey != nil {
+		return nil
+	}
+	return state.User
+}
+
+//viewerState returns the state added by RequireAuth, or
+//authenticates the request if it didn't go through RequireAuth
+func (ctx *Context) viewerState(r *http.Request) *SessionState {
+	if state := sessionStateFrom(r); state != nil {
+		return state
+	}
+	state, err := ctx.authenticate(r)
+	if err != nil {
+		return nil
+	}
+	return state
+}
+
+//userView returns the view of `u` that `viewer` is allowed to see:
+//the full record for the user themselves and for admins, and the public
+//view for everyone else, including callers that aren't signed in
+func userView(viewer *users.User, u *users.User) interface{} {
+	if viewer.IsSelf(u) || viewer != nil && viewer.Role.AtLeast(users.RoleAdmin) {
+		return u
+	}
+	return u.Public()
+}
+
+//userViews returns the views of `all` that `viewer` is allowed to see
+func userViews(viewer *users.User, all []*users.User) []interface{} {
+	views := make([]interface{}, len(all))
+	for i, u := range all {
+		views[i] = userView(viewer, u)
+	}
+	return views
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestUserViews(t *testing.T) {
+	ctx := newMessagingContext()
+	alice := signUp(t, ctx, "alice")
+	signUp(t, ctx, "bob")
+	list := http.HandlerFunc(ctx.UserHandler)
+	me := http.HandlerFunc(ctx.UsersMeHandler)
+
+	//emails by user name, as seen by `auth`
+	emails := func(auth string) map[string]string {
+		resRec := do(list, "GET", "/v1/users", auth, nil)
+		if resRec.Code != http.StatusOK {
+			t.Fatalf("expected status %d but got %d\n", http.StatusOK, resRec.Code)
+		}
+		all := []map[string]interface{}{}
+		if err := json.NewDecoder(resRec.Body).Decode(&all); err != nil {
+			t.Fatalf("error decoding users: %v\n", err)
+		}
+		found := map[string]string{}
+		for _, u := range all {
+			email, _ := u["email"].(string)
+			found[u["userName"].(string)] = email
+		}
+		return found
+	}
+
+	if found := emails(""); found["alice"] != "" || found["bob"] != "" {
+		t.Errorf("signed out callers should not see emails: %v\n", found)
+	}
+	if found := emails(alice); found["alice"] != "alice@test.com" || found["bob"] != "" {
+		t.Errorf("users should only see their own email: %v\n", found)
+	}
+
+	if resRec := do(me, "GET", "/v1/users/me", "", nil); resRec.Code != http.StatusUnauthorized {
+		t.Errorf("signed out: expected status %d but got %d\n", http.StatusUnauthorized, resRec.Code)
+	}
+	resRec := do(me, "GET", "/v1/users/me", alice, nil)
+	if resRec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	self := map[string]interface{}{}
+	if err := json.NewDecoder(resRec.Body).Decode(&self); err != nil {
+		t.Fatalf("error decoding user: %v\n", err)
+	}
+	if self["email"] != "alice@test.com" {
+		t.Errorf("users/me should return the full record: got %v\n", self)
+	}
+	if _, ok := self["passHash"]; ok {
+		t.Errorf("the password hash should never be returned\n")
+	}
+}
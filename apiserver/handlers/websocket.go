@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	"github.com/info344-s17/challenges-leedann/apiserver/notification"
+)
+
+//upgrader upgrades HTTP connections to WebSockets. Like the rest of the
+//API, the endpoint can be used from any origin, and clients must still
+//present a valid session
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+//WebSocketUpgradeHandler upgrades signed-in clients to a WebSocket
+//connection over which they are sent notifications of new users and
+//messages. Browsers can't add an Authorization header to WebSocket
+//requests, so the header's value can be sent in the `auth` query
+//string parameter instead
+func (ctx *Context) WebSocketUpgradeHandler(w http.ResponseWriter, r *http.Request) {
+	if len(r.Header.Get("Authorization")) == 0 {
+		if auth := r.FormValue("auth"); len(auth) > 0 {
+			r.Header.Set("Authorization", auth)
+		}
+	}
+	state, err := ctx.authenticate(r)
+	if err != nil {
+		http.Error(w, "You must be signed in", http.StatusUnauthorized)
+		return
+	}
+	if err := ctx.checkVerified(state.User); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if state.APIKey != nil && !state.APIKey.Allows(r.Method) {
+		http.Error(w, errAPIKeyScope.Error(), http.StatusForbidden)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		//Upgrade has already responded to the client
+		return
+	}
+	ctx.Notifier.AddClient(conn, state.User.ID)
+}
+
+//disconnect closes the user's WebSocket connections on every instance,
+//so they stop getting events once they've lost access
+func (ctx *Context) disconnect(user *users.User) {
+	if ctx.Events != nil {
+		event := &notification.Event{Type: notification.EventDisconnect}
+		event.AddRecipient(user.ID)
+		if err := ctx.Events.Publish(event); err != nil {
+			log.Printf("error disconnecting user %v: %v", user.ID, err)
+		}
+	} else if ctx.Notifier != nil {
+		ctx.Notifier.Disconnect(user.ID)
+	}
+}
+
+//notify publishes an event to the Events bus, or sends it to the
+//Notifier's clients if there is no bus. If there are `recipients`,
+//the event is only sent to those users
+func (ctx *Context) notify(eventType string, payload interface{}, recipients ...interface{}) {
+	if ctx.Events == nil && ctx.Notifier == nil {
+		return
+	}
+	event, err := notification.NewEvent(eventType, payload)
+	if err == nil {
+		for _, userID := range recipients {
+			event.AddRecipient(userID)
+		}
+		if ctx.Events != nil {
+			err = ctx.Events.Publish(event)
+		} else {
+			err = ctx.Notifier.Notify(event)
+		}
+	}
+	if err != nil {
+		log.Printf("error sending %s event: %v", eventType, err)
+	}
+}
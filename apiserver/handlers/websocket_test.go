@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/info344-s17/challenges-leedann/apiserver/middleware"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/messages"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	"github.com/info344-s17/challenges-leedann/apiserver/notification"
+)
+
+func TestWebSocketNotifications(t *testing.T) {
+	ctx := newMessagingContext()
+	ctx.Notifier = notification.NewNotifier()
+	alice := signUp(t, ctx, "alice")
+	server := httptest.NewServer(http.HandlerFunc(ctx.WebSocketUpgradeHandler))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated upgrade should fail with status %d\n", http.StatusUnauthorized)
+	}
+
+	//browsers send the session in the query string
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?auth="+url.QueryEscape(alice), nil)
+	if err != nil {
+		t.Fatalf("error dialing: %v\n", err)
+	}
+	defer conn.Close()
+	for ctx.Notifier.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	expect := func(eventType string) *notification.Event {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		event := &notification.Event{}
+		if err := conn.ReadJSON(event); err != nil {
+			t.Fatalf("error reading %s event: %v\n", eventType, err)
+		}
+		if event.Type != eventType {
+			t.Fatalf("expected a %s event but got %s\n", eventType, event.Type)
+		}
+		return event
+	}
+
+	signUp(t, ctx, "bob")
+	if event := expect(notification.EventUserNew); !strings.Contains(string(event.Payload), `"userName":"bob"`) || strings.Contains(string(event.Payload), "@test.com") {
+		t.Errorf("incorrect new user payload: %s\n", event.Payload)
+	}
+
+	c, _ := ctx.MessageStore.InsertChannel(&messages.NewChannel{Name: "general"}, &users.User{ID: "someone"})
+	handler := middleware.Adapt(http.HandlerFunc(ctx.SpecificChannelHandler), ctx.RequireAuth())
+	do(handler, "POST", channelsPath+c.ID.(string)+"/messages", alice, &messages.NewMessage{Body: "hello"})
+	if event := expect(notification.EventMessageNew); !strings.Contains(string(event.Payload), `"body":"hello"`) {
+		t.Errorf("incorrect new message payload: %s\n", event.Payload)
+	}
+
+	//alice isn't a member of this private channel, so she isn't told about its
+	//messages, and the next event she gets is about the public channel
+	bob, _ := ctx.UserStore.GetByUserName("bob")
+	private, _ := ctx.MessageStore.InsertChannel(&messages.NewChannel{Name: "private", Private: true}, bob)
+	ctx.notifyChannel(private, notification.EventMessageNew, map[string]string{"body": "secret"})
+	do(handler, "POST", channelsPath+c.ID.(string)+"/messages", alice, &messages.NewMessage{Body: "public"})
+	if event := expect(notification.EventMessageNew); !strings.Contains(string(event.Payload), `"body":"public"`) {
+		t.Errorf("expected only the public message but got: %s\n", event.Payload)
+	}
+}
+
+func TestWebSocketDisconnectedOnDelete(t *testing.T) {
+	ctx := newMessagingContext()
+	ctx.Notifier = notification.NewNotifier()
+	alice := signUp(t, ctx, "alice")
+	server := httptest.NewServer(http.HandlerFunc(ctx.WebSocketUpgradeHandler))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?auth="+url.QueryEscape(alice), nil)
+	if err != nil {
+		t.Fatalf("error dialing: %v\n", err)
+	}
+	defer conn.Close()
+	for ctx.Notifier.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if resRec := do(http.HandlerFunc(ctx.UsersMeHandler), "DELETE", "/v1/users/me", alice, nil); resRec.Code != http.StatusOK {
+		t.Fatalf("deleting: expected status %d but got %d\n", http.StatusOK, resRec.Code)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNoStatusReceived, websocket.CloseNormalClosure) {
+		t.Errorf("expected the deleted user's connection to be closed but got %v\n", err)
+	}
+	if ctx.Notifier.ClientCount() != 0 {
+		t.Errorf("expected no clients but have %d\n", ctx.Notifier.ClientCount())
+	}
+}
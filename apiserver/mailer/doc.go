@@ -0,0 +1,9 @@
+/*
+Package mailer sends email, such as the messages that verify the email
+addresses of new users.
+
+There are two implementations of Mailer: SMTPMailer, which sends through
+an SMTP server, and FileMailer, which writes each message to a file in a
+directory instead of sending it, for development and testing.
+*/
+package mailer
@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//FileMailer is a Mailer that writes each message to a new file in a
+//directory instead of sending it. The files are in the same format as
+//sent messages, so they can be opened with most email clients
+type FileMailer struct {
+	//Dir is the directory the messages are written to
+	Dir string
+	//From is the address messages are from
+	From string
+}
+
+//NewFileMailer constructs a new FileMailer writing messages from
+//`from` to `dir`, creating the directory if it doesn't exist
+func NewFileMailer(dir string, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileMailer{Dir: dir, From: from}, nil
+}
+
+//Send writes the message to a new .eml file named for when it was sent
+func (m *FileMailer) Send(msg *Message) error {
+	env, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return ioutil.WriteFile(filepath.Join(m.Dir, name), env.Data, 0600)
+}
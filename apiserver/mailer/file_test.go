@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mailer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := NewFileMailer(filepath.Join(dir, "outbox"), "noreply@example.com")
+	if err != nil {
+		t.Fatalf("error creating mailer: %v\n", err)
+	}
+	for _, to := range []string{"alice@example.com", "bob@example.com"} {
+		if err := m.Send(&Message{To: to, Subject: "Hello", Body: "Hi " + to}); err != nil {
+			t.Fatalf("error sending message: %v\n", err)
+		}
+	}
+	//header values can't add headers of their own
+	if err := m.Send(&Message{To: "eve@example.com", Subject: "Hi\r\nBcc: mallory@example.com"}); err != nil {
+		t.Fatalf("error sending message: %v\n", err)
+	}
+
+	files, err := ioutil.ReadDir(m.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected 3 message files but got %d\n", len(files))
+	}
+	for i, f := range files {
+		data, err := ioutil.ReadFile(filepath.Join(m.Dir, f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, err := readMessage(strings.Replace(string(data), "\r\n", "\n", -1))
+		if err != nil {
+			t.Fatalf("error parsing %s: %v\n", f.Name(), err)
+		}
+		if len(header.Get("Bcc")) > 0 {
+			t.Errorf("a header was injected through the subject\n")
+		}
+		if i < 2 && !strings.Contains(string(data), "\r\n\r\nHi "+strings.Trim(header.Get("To"), "<>")) {
+			t.Errorf("incorrect body in %s: %q\n", f.Name(), data)
+		}
+	}
+
+	if err := m.Send(&Message{To: "invalid"}); err == nil {
+		t.Errorf("expected an error for an invalid recipient\n")
+	}
+}
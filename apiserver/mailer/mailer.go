@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+//Message is a plain text email message
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+//Mailer sends email messages
+type Mailer interface {
+	//Send sends the message from the mailer's address
+	Send(msg *Message) error
+}
+
+//envelope is a message formatted to be sent, along
+//with the bare addresses it's being sent from and to
+type envelope struct {
+	From string
+	To   string
+	Data []byte
+}
+
+//format formats the message from `from` as it's sent,
+//with headers and CRLF line endings
+func format(from string, msg *Message) (*envelope, error) {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %v", msg.To, err)
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %v", from, err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := sender.Address[strings.LastIndex(sender.Address, "@")+1:]
+
+	buf := &bytes.Buffer{}
+	//header values can't contain line breaks, which could add headers
+	header := func(name, value string) {
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		fmt.Fprintf(buf, "%s: %s\r\n", name, value)
+	}
+	header("From", sender.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+	body := strings.Replace(msg.Body, "\r\n", "\n", -1)
+	buf.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	if !strings.HasSuffix(body, "\n") {
+		buf.WriteString("\r\n")
+	}
+	return &envelope{From: sender.Address, To: to.Address, Data: buf.Bytes()}, nil
+}
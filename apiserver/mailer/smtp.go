@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+//DefaultSMTPTimeout is how long an SMTPMailer waits to send a message
+const DefaultSMTPTimeout = 30 * time.Second
+
+//SMTPMailer is a Mailer that sends messages through an SMTP server
+type SMTPMailer struct {
+	//Addr is the host:port of the SMTP server
+	Addr string
+	//From is the address messages are sent from
+	From string
+	//Auth, if set, authenticates with the server. net/smtp only sends
+	//credentials over TLS, or to servers on localhost
+	Auth smtp.Auth
+	//Timeout limits how long sending each message can take,
+	//and defaults to DefaultSMTPTimeout
+	Timeout time.Duration
+}
+
+//NewSMTPMailer constructs a new SMTPMailer sending through the server at
+//`addr` from the address `from`. If `username` is set, it authenticates
+//with the server using PLAIN authentication
+func NewSMTPMailer(addr string, from string, username string, password string) *SMTPMailer {
+	m := &SMTPMailer{
+		Addr:    addr,
+		From:    from,
+		Timeout: DefaultSMTPTimeout,
+	}
+	if len(username) > 0 {
+		host, _, _ := net.SplitHostPort(addr)
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+//Send sends the message through the SMTP server, upgrading
+//the connection to TLS if the server supports it
+func (m *SMTPMailer) Send(msg *Message) error {
+	env, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSMTPTimeout
+	}
+	conn, err := net.DialTimeout("tcp", m.Addr, timeout)
+	if err != nil {
+		return err
+	}
+	//net/smtp has no timeouts of its own
+	conn.SetDeadline(time.Now().Add(timeout))
+	host, _, _ := net.SplitHostPort(m.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.Auth != nil {
+		if err := c.Auth(m.Auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(env.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(env.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(env.Data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,148 @@
+package mailer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"mime"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+//fakeSMTPServer is just enough of an SMTP server to receive messages
+type fakeSMTPServer struct {
+	listener net.Listener
+	//received are the messages the server has received
+	received chan *receivedMessage
+}
+
+//receivedMessage is a message received by the fakeSMTPServer
+type receivedMessage struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+//newFakeSMTPServer starts a fake SMTP server on a local port
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: l, received: make(chan *receivedMessage, 10)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTPServer) Close() {
+	s.listener.Close()
+}
+
+//serve handles one client connection
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	msg := &receivedMessage{}
+	tp.PrintfLine("220 localhost fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO":
+			tp.PrintfLine("250-localhost")
+			tp.PrintfLine("250-8BITMIME")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			parts := strings.Fields(line)
+			decoded, _ := base64.StdEncoding.DecodeString(parts[len(parts)-1])
+			msg.auth = string(decoded)
+			tp.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			//the address can be followed by parameters, like BODY=8BITMIME
+			msg.from = strings.Trim(strings.Fields(line[len("MAIL FROM:"):])[0], "<>")
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			msg.data = strings.Join(lines, "\n")
+			tp.PrintfLine("250 OK")
+			s.received <- msg
+			msg = &receivedMessage{}
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	defer server.Close()
+
+	m := NewSMTPMailer(server.listener.Addr().String(), "Chat <noreply@example.com>", "user", "secret")
+	err := m.Send(&Message{
+		To:      "Alice <alice@example.com>",
+		Subject: "Héllo",
+		Body:    "line one\nline two\n.starts with a dot",
+	})
+	if err != nil {
+		t.Fatalf("error sending message: %v\n", err)
+	}
+	msg := <-server.received
+	if msg.from != "noreply@example.com" {
+		t.Errorf("incorrect sender: %s\n", msg.from)
+	}
+	if len(msg.to) != 1 || msg.to[0] != "alice@example.com" {
+		t.Errorf("incorrect recipients: %v\n", msg.to)
+	}
+	if msg.auth != "\x00user\x00secret" {
+		t.Errorf("incorrect credentials: %q\n", msg.auth)
+	}
+
+	parsed, err := readMessage(msg.data)
+	if err != nil {
+		t.Fatalf("error parsing message: %v\n", err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Get("Subject")); subject != "Héllo" {
+		t.Errorf("incorrect subject: %s\n", subject)
+	}
+	if !strings.Contains(msg.data, "line two\n.starts with a dot") {
+		t.Errorf("body was not sent intact: %q\n", msg.data)
+	}
+}
+
+func TestSMTPMailerErrors(t *testing.T) {
+	m := NewSMTPMailer("127.0.0.1:1", "noreply@example.com", "", "")
+	if err := m.Send(&Message{To: "not an address"}); err == nil {
+		t.Errorf("expected an error for an invalid recipient\n")
+	}
+	if err := m.Send(&Message{To: "alice@example.com"}); err == nil {
+		t.Errorf("expected an error when the server can't be reached\n")
+	}
+}
+
+//readMessage reads the headers of a received message
+func readMessage(data string) (textproto.MIMEHeader, error) {
+	return textproto.NewReader(bufio.NewReader(strings.NewReader(data + "\n"))).ReadMIMEHeader()
+}
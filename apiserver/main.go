@@ -2,31 +2,65 @@ package main
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	redis "gopkg.in/redis.v5"
 
 	"github.com/info344-s17/challenges-leedann/apiserver/handlers"
+	"github.com/info344-s17/challenges-leedann/apiserver/mailer"
 	"github.com/info344-s17/challenges-leedann/apiserver/middleware"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/apikeys"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/audit"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/identities"
+	"github.com/info344-s17/challenges-leedann/apiserver/models/messages"
 	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	"github.com/info344-s17/challenges-leedann/apiserver/notification"
+	"github.com/info344-s17/challenges-leedann/apiserver/oidc"
 	"github.com/info344-s17/challenges-leedann/apiserver/sessions"
+	"github.com/info344-s17/challenges-leedann/apiserver/summary"
+	"github.com/info344-s17/challenges-leedann/apiserver/unfurl"
 	_ "github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const defaultPort = "443"
 
 const (
-	apiRoot    = "/v1/"
-	apiSummary = apiRoot + "summary"
-	pgPort     = 5432
-	usr        = "users"
-	sess       = "sessions"
-	sessme     = "sessions/mine"
-	usrme      = "users/me"
+	apiRoot      = "/v1/"
+	apiSummary   = apiRoot + "summary"
+	apiSummaries = apiRoot + "summaries"
+	apiImages    = apiRoot + "images"
+	pgPort       = 5432
+	usr          = "users"
+	sess         = "sessions"
+	sessme       = "sessions/mine"
+	usrme        = "users/me"
+	usrsearch    = "users/search"
+	usrverify    = "users/verify"
+	usrmeverify  = "users/me/verification"
+	usrme2fa     = "users/me/2fa"
+	usrme2facfm  = "users/me/2fa/confirm"
+	usrmecodes   = "users/me/2fa/recovery-codes"
+	sess2fa      = "sessions/2fa"
+	sessrefresh  = "sessions/refresh"
+	usrmeids     = "users/me/identities"
+	usrmeid      = "users/me/identities/"
+	usrmekeys    = "users/me/apikeys"
+	usrmekey     = "users/me/apikeys/"
+	oidcroot     = "oidc/"
+	channels     = "channels"
+	channel      = "channels/"
+	message      = "messages/"
+	websocket    = "websocket"
+	adminusrs    = "admin/users"
+	adminusr     = "admin/users/"
+	adminaudit   = "admin/audit"
 )
 
 //main is the main entry point for this program
@@ -48,6 +82,85 @@ func main() {
 	SESSIONKEY := os.Getenv("SESSIONKEY")
 	REDISADDR := os.Getenv("REDISADDR")
 	DBADDR := os.Getenv("DBADDR")
+	//PROVIDERSFILE is an optional JSON file of extra summary providers
+	PROVIDERSFILE := os.Getenv("PROVIDERSFILE")
+	//IMAGEKEY signs image proxy URLs, and defaults to the session key
+	IMAGEKEY := os.Getenv("IMAGEKEY")
+	if len(IMAGEKEY) == 0 {
+		IMAGEKEY = SESSIONKEY
+	}
+
+	//SMTPADDR is the SMTP server email is sent through. Without it,
+	//email is written to files in MAILDIR instead, if that's set
+	SMTPADDR := os.Getenv("SMTPADDR")
+	SMTPUSER := os.Getenv("SMTPUSER")
+	SMTPPASS := os.Getenv("SMTPPASS")
+	MAILDIR := os.Getenv("MAILDIR")
+	MAILFROM := os.Getenv("MAILFROM")
+	if len(MAILFROM) == 0 {
+		MAILFROM = "noreply@localhost"
+		if len(HOST) > 0 {
+			MAILFROM = "noreply@" + HOST
+		}
+	}
+	//PUBLICURL is the scheme and host clients reach the API at, such as
+	//https://api.example.com, which is needed behind a proxy that ends TLS.
+	//Otherwise TRUSTPROXY honors the proxy's X-Forwarded-Proto and Host headers
+	PUBLICURL := os.Getenv("PUBLICURL")
+	TRUSTPROXY := os.Getenv("TRUSTPROXY") == "true"
+	//VERIFYURL optionally overrides where verification links point
+	VERIFYURL := os.Getenv("VERIFYURL")
+	//REQUIREVERIFIEDEMAIL turns away users until they verify their email address
+	REQUIREVERIFIEDEMAIL := os.Getenv("REQUIREVERIFIEDEMAIL") == "true"
+	//TOTPISSUER names this service in users' authenticator apps
+	TOTPISSUER := os.Getenv("TOTPISSUER")
+	//IDPROVIDERSFILE is an optional JSON file of OpenID Connect
+	//identity providers users can sign in with
+	IDPROVIDERSFILE := os.Getenv("IDPROVIDERSFILE")
+	//IDREDIRECTURL is where users are sent back to once they've
+	//signed in with an identity provider, usually the web client
+	IDREDIRECTURL := os.Getenv("IDREDIRECTURL")
+	//SESSIONMODE is "jwt" for stateless sessions with access and
+	//refresh tokens, and opaque session IDs otherwise
+	SESSIONMODE := os.Getenv("SESSIONMODE")
+	//JWTALG is HS256 (the default) or EdDSA. JWTKEY is the HS256
+	//secret, or the base64-encoded Ed25519 seed for EdDSA
+	JWTALG := os.Getenv("JWTALG")
+	if len(JWTALG) == 0 {
+		JWTALG = sessions.SigningHS256
+	}
+	JWTKEY := os.Getenv("JWTKEY")
+	//PASSWORDMINLENGTH, PASSWORDMAXLENGTH, PASSWORDMINCLASSES and
+	//PASSWORDMINENTROPY configure the password policy, and BREACHEDPASSWORDS
+	//is an optional file of the SHA-1 hashes of breached passwords to turn
+	//away. PASSWORDMAXLENGTH is in bytes, and is capped at 72 with bcrypt
+	PASSWORDMINLENGTH := os.Getenv("PASSWORDMINLENGTH")
+	PASSWORDMAXLENGTH := os.Getenv("PASSWORDMAXLENGTH")
+	PASSWORDMINCLASSES := os.Getenv("PASSWORDMINCLASSES")
+	PASSWORDMINENTROPY := os.Getenv("PASSWORDMINENTROPY")
+	BREACHEDPASSWORDS := os.Getenv("BREACHEDPASSWORDS")
+	//PASSWORDHASHER is bcrypt (the default) or argon2id. BCRYPTCOST, and
+	//ARGON2TIME, ARGON2MEMORY (in KiB) and ARGON2THREADS, tune the hasher.
+	//Existing hashes are replaced when their users next sign in
+	PASSWORDHASHER := os.Getenv("PASSWORDHASHER")
+	BCRYPTCOST := os.Getenv("BCRYPTCOST")
+	ARGON2TIME := os.Getenv("ARGON2TIME")
+	ARGON2MEMORY := os.Getenv("ARGON2MEMORY")
+	ARGON2THREADS := os.Getenv("ARGON2THREADS")
+
+	var mail mailer.Mailer
+	switch {
+	case len(SMTPADDR) > 0:
+		mail = mailer.NewSMTPMailer(SMTPADDR, MAILFROM, SMTPUSER, SMTPPASS)
+	case len(MAILDIR) > 0:
+		fileMailer, err := mailer.NewFileMailer(MAILDIR, MAILFROM)
+		if err != nil {
+			log.Fatalf("error creating mail directory: %v", err)
+		}
+		mail = fileMailer
+	case REQUIREVERIFIEDEMAIL:
+		log.Fatal("REQUIREVERIFIEDEMAIL needs SMTPADDR or MAILDIR to send verification links")
+	}
 
 	client := redis.NewClient(&redis.Options{
 		Addr:     REDISADDR,
@@ -63,6 +176,9 @@ func main() {
 	store := &users.PGStore{
 		DB: pgstore,
 	}
+	//deleted accounts are purged once their grace period is over
+	purger := users.NewPurger(store, users.DefaultGracePeriod, users.DefaultPurgeInterval)
+	defer purger.Close()
 	//Pings the DB-- establishes a connection to the db
 	err = pgstore.Ping()
 	if err != nil {
@@ -70,17 +186,197 @@ func main() {
 	}
 	redisStore := sessions.NewRedisStore(client, time.Hour*3600)
 
+	//events from every instance reach this instance through redis
+	events := notification.NewRedisBus(client, notification.DefaultRedisChannel)
+
+	var tokens *sessions.TokenIssuer
+	if SESSIONMODE == "jwt" {
+		denylist := sessions.NewCachedDenylist(sessions.NewRedisDenylist(client))
+		key := []byte(JWTKEY)
+		if JWTALG == sessions.SigningEdDSA {
+			key, err = base64.StdEncoding.DecodeString(JWTKEY)
+			if err != nil {
+				log.Fatalf("error decoding JWTKEY: %v", err)
+			}
+		}
+		tokens, err = sessions.NewTokenIssuer(&sessions.TokenConfig{
+			Method:     JWTALG,
+			Key:        key,
+			SigningKey: SESSIONKEY,
+		}, redisStore, denylist)
+		if err != nil {
+			log.Fatalf("error setting up tokens: %v", err)
+		}
+		//each instance checks its own copy of the denylist, which the
+		//others keep up to date through the events bus
+		if err := handlers.ShareDenylist(denylist, events); err != nil {
+			log.Fatalf("error loading the denylist: %v", err)
+		}
+	}
+
+	policy := &users.PasswordPolicy{MinLength: users.DefaultPasswordPolicy.MinLength}
+	if len(PASSWORDMINLENGTH) > 0 {
+		if policy.MinLength, err = strconv.Atoi(PASSWORDMINLENGTH); err != nil {
+			log.Fatalf("error parsing PASSWORDMINLENGTH: %v", err)
+		}
+	}
+	if len(PASSWORDMAXLENGTH) > 0 {
+		if policy.MaxLength, err = strconv.Atoi(PASSWORDMAXLENGTH); err != nil {
+			log.Fatalf("error parsing PASSWORDMAXLENGTH: %v", err)
+		}
+	}
+	if len(PASSWORDMINCLASSES) > 0 {
+		if policy.MinClasses, err = strconv.Atoi(PASSWORDMINCLASSES); err != nil {
+			log.Fatalf("error parsing PASSWORDMINCLASSES: %v", err)
+		}
+	}
+	if len(PASSWORDMINENTROPY) > 0 {
+		if policy.MinEntropy, err = strconv.ParseFloat(PASSWORDMINENTROPY, 64); err != nil {
+			log.Fatalf("error parsing PASSWORDMINENTROPY: %v", err)
+		}
+	}
+	if len(BREACHEDPASSWORDS) > 0 {
+		breached, err := users.LoadBreachList(BREACHEDPASSWORDS)
+		if err != nil {
+			log.Fatalf("error loading breached passwords: %v", err)
+		}
+		policy.Breached = breached
+	}
+
+	var hasher users.PasswordHasher
+	switch PASSWORDHASHER {
+	case "", "bcrypt":
+		bh := &users.BcryptHasher{Cost: users.DefaultBcryptCost}
+		if len(BCRYPTCOST) > 0 {
+			if bh.Cost, err = strconv.Atoi(BCRYPTCOST); err != nil {
+				log.Fatalf("error parsing BCRYPTCOST: %v", err)
+			}
+		}
+		if bh.Cost < bcrypt.MinCost || bh.Cost > bcrypt.MaxCost {
+			log.Fatalf("BCRYPTCOST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		//bcrypt can't hash longer passwords
+		if policy.MaxLength > users.MaxPasswordBytes {
+			log.Printf("PASSWORDMAXLENGTH is capped at %d bytes with bcrypt", users.MaxPasswordBytes)
+			policy.MaxLength = users.MaxPasswordBytes
+		}
+		hasher = bh
+	case "argon2id":
+		ah := &users.Argon2Hasher{}
+		if len(ARGON2TIME) > 0 {
+			n, err := strconv.ParseUint(ARGON2TIME, 10, 32)
+			if err != nil {
+				log.Fatalf("error parsing ARGON2TIME: %v", err)
+			}
+			ah.Time = uint32(n)
+		}
+		if len(ARGON2MEMORY) > 0 {
+			n, err := strconv.ParseUint(ARGON2MEMORY, 10, 32)
+			if err != nil {
+				log.Fatalf("error parsing ARGON2MEMORY: %v", err)
+			}
+			ah.Memory = uint32(n)
+		}
+		if len(ARGON2THREADS) > 0 {
+			n, err := strconv.ParseUint(ARGON2THREADS, 10, 8)
+			if err != nil {
+				log.Fatalf("error parsing ARGON2THREADS: %v", err)
+			}
+			ah.Threads = uint8(n)
+		}
+		hasher = ah
+	default:
+		log.Fatalf("PASSWORDHASHER must be bcrypt or argon2id")
+	}
+
+	providers := summary.NewProviderRegistry()
+	if len(PROVIDERSFILE) > 0 {
+		if err := providers.LoadFile(PROVIDERSFILE); err != nil {
+			log.Fatalf("error loading summary providers: %v", err)
+		}
+	}
+
+	idProviders := map[string]*oidc.Provider{}
+	if len(IDPROVIDERSFILE) > 0 {
+		configs, err := oidc.LoadConfigs(IDPROVIDERSFILE)
+		if err != nil {
+			log.Fatalf("error loading identity providers: %v", err)
+		}
+		for _, config := range configs {
+			p, err := oidc.NewProvider(config, nil)
+			if err != nil {
+				log.Fatalf("error setting up identity provider: %v", err)
+			}
+			idProviders[p.Name()] = p
+		}
+	}
+
+	summarizer := summary.NewSummarizer(summary.NewSafeFetcher(summary.DefaultFetchTimeout), providers)
+	unfurler := unfurl.NewService(summarizer, &unfurl.PGStore{DB: pgstore}, unfurl.DefaultWorkers, unfurl.DefaultQueueSize)
+
+	notifier := notification.NewNotifier()
+	events.Subscribe(func(event *notification.Event) {
+		if err := notifier.Notify(event); err != nil {
+			log.Printf("error notifying clients: %v", err)
+		}
+	})
+
 	ctx := &handlers.Context{
 		SessionKey:   SESSIONKEY,
 		SessionStore: redisStore,
+		Tokens:       tokens,
 		UserStore:    store,
+		MessageStore: &messages.PGStore{DB: pgstore},
+		AuditLog:     &audit.PGStore{DB: pgstore},
+		ImageProxy:   handlers.NewImageProxy(IMAGEKEY),
+		PublicURL:    PUBLICURL,
+		TrustProxy:   TRUSTPROXY,
+		Summarizer:   summarizer,
+		Unfurler:     unfurler,
+		Notifier:     notifier,
+		Events:       events,
+
+		Mailer:               mail,
+		VerificationURL:      VERIFYURL,
+		RequireVerifiedEmail: REQUIREVERIFIEDEMAIL,
+		TOTPIssuer:           TOTPISSUER,
+		IdentityProviders:    idProviders,
+		Identities:           &identities.PGStore{DB: pgstore},
+		IdentityRedirectURL:  IDREDIRECTURL,
+		APIKeys:              &apikeys.PGStore{DB: pgstore},
+		PasswordPolicy:       policy,
+		PasswordHasher:       hasher,
 	}
+	//clients are told about previews that are ready after the message was sent
+	unfurler.OnUnfurled = ctx.PreviewsUnfurled
 	mux := http.NewServeMux()
 	mux.HandleFunc(apiRoot+usr, ctx.UserHandler)
 	mux.HandleFunc(apiRoot+sess, ctx.SessionsHandler)
 	mux.HandleFunc(apiRoot+sessme, ctx.SessionsMineHandler)
+	mux.HandleFunc(apiRoot+sess2fa, ctx.SessionsTwoFactorHandler)
+	mux.HandleFunc(apiRoot+sessrefresh, ctx.SessionsRefreshHandler)
 	mux.HandleFunc(apiRoot+usrme, ctx.UsersMeHandler)
-	mux.HandleFunc(apiSummary, handlers.SummaryHandler)
+	mux.HandleFunc(apiRoot+usrverify, ctx.VerifyEmailHandler)
+	mux.HandleFunc(apiRoot+usrmeverify, ctx.UsersMeVerificationHandler)
+	mux.HandleFunc(apiRoot+usrme2fa, ctx.UsersMeTwoFactorHandler)
+	mux.HandleFunc(apiRoot+usrme2facfm, ctx.UsersMeTwoFactorConfirmHandler)
+	mux.HandleFunc(apiRoot+usrmecodes, ctx.UsersMeRecoveryCodesHandler)
+	mux.HandleFunc(apiRoot+usrmeids, ctx.UsersMeIdentitiesHandler)
+	mux.HandleFunc(apiRoot+usrmeid, ctx.UsersMeIdentitiesHandler)
+	mux.HandleFunc(apiRoot+usrmekeys, ctx.UsersMeAPIKeysHandler)
+	mux.HandleFunc(apiRoot+usrmekey, ctx.UsersMeAPIKeysHandler)
+	mux.HandleFunc(apiRoot+oidcroot, ctx.OIDCHandler)
+	mux.Handle(apiRoot+usrsearch, middleware.Adapt(http.HandlerFunc(ctx.UsersSearchHandler), ctx.RequireAuth()))
+	mux.HandleFunc(apiSummary, ctx.SummaryHandler)
+	mux.HandleFunc(apiSummaries, ctx.SummariesHandler)
+	mux.HandleFunc(apiImages, ctx.ImageProxy.ImagesHandler)
+	mux.Handle(apiRoot+channels, middleware.Adapt(http.HandlerFunc(ctx.ChannelsHandler), ctx.RequireAuth()))
+	mux.Handle(apiRoot+channel, middleware.Adapt(http.HandlerFunc(ctx.SpecificChannelHandler), ctx.RequireAuth()))
+	mux.Handle(apiRoot+message, middleware.Adapt(http.HandlerFunc(ctx.SpecificMessageHandler), ctx.RequireAuth()))
+	mux.HandleFunc(apiRoot+websocket, ctx.WebSocketUpgradeHandler)
+	mux.Handle(apiRoot+adminusrs, middleware.Adapt(http.HandlerFunc(ctx.AdminUsersHandler), ctx.RequireAuth(), ctx.RequireRole(users.RoleModerator)))
+	mux.Handle(apiRoot+adminusr, middleware.Adapt(http.HandlerFunc(ctx.AdminUserHandler), ctx.RequireAuth(), ctx.RequireRole(users.RoleModerator)))
+	mux.Handle(apiRoot+adminaudit, middleware.Adapt(http.HandlerFunc(ctx.AdminAuditHandler), ctx.RequireAuth(), ctx.RequireRole(users.RoleAdmin)))
 	mux.Handle(apiRoot, middleware.Adapt(mux, middleware.CORS("", "", "", "")))
 
 	//add your handlers.SummaryHandler function as a handler
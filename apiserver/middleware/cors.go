@@ -10,7 +10,7 @@ const (
 	//DefaultCORSAllowHeaders are the default allowed request headers
 	DefaultCORSAllowHeaders = "Content-Type, Authorization"
 	//DefaultCORSExposeHeaders are the default exposed response headers
-	DefaultCORSExposeHeaders = "Authorization"
+	DefaultCORSExposeHeaders = "Authorization, Link, X-Next-Cursor, X-Refresh-Token"
 )
 
 //constants for CORS header names
@@ -0,0 +1,145 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//scopes API keys can have
+const (
+	//ScopeRead lets a key make GET requests
+	ScopeRead = "read"
+	//ScopeWrite lets a key make requests that change things
+	ScopeWrite = "write"
+	//ScopeAdmin lets a key use the admin API, if its user is allowed to
+	ScopeAdmin = "admin"
+)
+
+//MaxNameLength is the longest a key's name can be
+const MaxNameLength = 100
+
+//prefixSize and secretSize are the number of random bytes
+//in the prefix and the secret of a key
+const (
+	prefixSize = 8
+	secretSize = 32
+)
+
+//ErrInvalidKey is returned for strings that can't be API keys
+var ErrInvalidKey = errors.New("invalid API key")
+
+//APIKey is a key a user can call the API with instead of a session.
+//The key itself is only known when it's created, and only its hash is
+//kept, along with a prefix that's used to look it up
+type APIKey struct {
+	//Prefix identifies the key, and is the part of it before the dot
+	Prefix string       `json:"prefix"`
+	UserID users.UserID `json:"userID"`
+	Name   string       `json:"name"`
+	Scopes []string     `json:"scopes"`
+	//Hash is the hex SHA-256 hash of the key's secret
+	Hash      string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	//LastUsedAt is when the key was last used, which
+	//is only updated once per LastUsedResolution
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+//LastUsedResolution is how often LastUsedAt is updated for
+//a key that's in use, so that not every request writes to the store
+const LastUsedResolution = time.Minute
+
+//NewAPIKey is a key a user is creating
+type NewAPIKey struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+//Validate validates the new key
+func (nk *NewAPIKey) Validate() error {
+	if len(strings.TrimSpace(nk.Name)) == 0 {
+		return fmt.Errorf("API keys need a name")
+	}
+	if len(nk.Name) > MaxNameLength {
+		return fmt.Errorf("API key names can be at most %d characters", MaxNameLength)
+	}
+	if len(nk.Scopes) == 0 {
+		return fmt.Errorf("API keys need at least one scope")
+	}
+	for _, scope := range nk.Scopes {
+		if scope != ScopeRead && scope != ScopeWrite && scope != ScopeAdmin {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+//ToAPIKey generates a key for the user with the ID `userID`, returning
+//it along with the key itself, which can't be recovered after this
+func (nk *NewAPIKey) ToAPIKey(userID users.UserID) (*APIKey, string, error) {
+	buf := make([]byte, prefixSize+secretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	prefix := hex.EncodeToString(buf[:prefixSize])
+	secret := base64.RawURLEncoding.EncodeToString(buf[prefixSize:])
+	key := &APIKey{
+		Prefix:    prefix,
+		UserID:    userID,
+		Name:      strings.TrimSpace(nk.Name),
+		Scopes:    nk.Scopes,
+		Hash:      hashSecret(secret),
+		CreatedAt: time.Now(),
+	}
+	return key, prefix + "." + secret, nil
+}
+
+//ParseKey splits a key into its prefix and secret
+func ParseKey(key string) (string, string, error) {
+	parts := strings.Split(key, ".")
+	if len(parts) != 2 || len(parts[0]) != 2*prefixSize || len(parts[1]) == 0 {
+		return "", "", ErrInvalidKey
+	}
+	return parts[0], parts[1], nil
+}
+
+//Matches reports whether `secret` is the key's secret
+func (k *APIKey) Matches(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(k.Hash)) == 1
+}
+
+//HasScope reports whether the key has the scope `scope`
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+//Allows reports whether the key's scopes allow requests with the
+//method `method`. Reading needs ScopeRead and anything else ScopeWrite
+func (k *APIKey) Allows(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return k.HasScope(ScopeRead)
+	}
+	return k.HasScope(ScopeWrite)
+}
+
+//hashSecret returns the hex SHA-256 hash of a key's secret. The secrets
+//are long and random, so they don't need a slow hash like passwords do
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,52 @@
+package apikeys
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	invalid := []*NewAPIKey{
+		{Name: " ", Scopes: []string{ScopeRead}},
+		{Name: strings.Repeat("x", MaxNameLength+1), Scopes: []string{ScopeRead}},
+		{Name: "deploys"},
+		{Name: "deploys", Scopes: []string{ScopeRead, "everything"}},
+	}
+	for _, nk := range invalid {
+		if err := nk.Validate(); err == nil {
+			t.Errorf("expected an error validating %+v\n", nk)
+		}
+	}
+
+	nk := &NewAPIKey{Name: " deploys ", Scopes: []string{ScopeRead}}
+	if err := nk.Validate(); err != nil {
+		t.Fatalf("unexpected error validating: %v\n", err)
+	}
+	key, raw, err := nk.ToAPIKey("alice")
+	if err != nil {
+		t.Fatalf("error generating key: %v\n", err)
+	}
+	if key.Name != "deploys" || key.UserID != "alice" || strings.Contains(key.Hash, raw) {
+		t.Errorf("incorrect key: %+v\n", key)
+	}
+	prefix, secret, err := ParseKey(raw)
+	if err != nil {
+		t.Fatalf("error parsing key: %v\n", err)
+	}
+	if prefix != key.Prefix || !key.Matches(secret) || key.Matches(secret+"x") {
+		t.Errorf("key %s doesn't match %+v\n", raw, key)
+	}
+	for _, bad := range []string{"", "nodot", prefix + ".", "short." + secret, raw + ".more"} {
+		if _, _, err := ParseKey(bad); err != ErrInvalidKey {
+			t.Errorf("%q: expected ErrInvalidKey but got %v\n", bad, err)
+		}
+	}
+
+	if !key.Allows("GET") || key.Allows("POST") || key.Allows("DELETE") {
+		t.Errorf("read keys should only allow reading\n")
+	}
+	key.Scopes = []string{ScopeWrite}
+	if key.Allows("GET") || !key.Allows("PATCH") {
+		t.Errorf("write keys should only allow writing\n")
+	}
+}
@@ -0,0 +1,3 @@
+//Package apikeys stores the personal API keys users create, so that
+//scripts and integrations can call the API without signing in
+package apikeys
@@ -0,0 +1,111 @@
+package apikeys
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//MemStore is an implementation of Store backed by
+//an in-memory slice. This should only be used for
+//automated testing
+type MemStore struct {
+	entries []*APIKey
+	mx      sync.RWMutex
+}
+
+//NewMemStore returns a new MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		entries: []*APIKey{},
+	}
+}
+
+//Insert inserts a new key
+func (ms *MemStore) Insert(key *APIKey) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if ms.find(key.Prefix) >= 0 {
+		return fmt.Errorf("API key %s already exists", key.Prefix)
+	}
+	ms.entries = append(ms.entries, key)
+	return nil
+}
+
+//Get returns the key with the prefix `prefix`
+func (ms *MemStore) Get(prefix string) (*APIKey, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	i := ms.find(prefix)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	//copy the key, so that Touch doesn't race with callers reading it
+	key := *ms.entries[i]
+	return &key, nil
+}
+
+//ListByUser returns the keys of the user with the ID `userID`
+func (ms *MemStore) ListByUser(userID users.UserID) ([]*APIKey, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	found := []*APIKey{}
+	for _, key := range ms.entries {
+		if fmt.Sprint(key.UserID) == fmt.Sprint(userID) {
+			k := *key
+			found = append(found, &k)
+		}
+	}
+	return found, nil
+}
+
+//Touch records that the key with the prefix `prefix` was used at `at`
+func (ms *MemStore) Touch(prefix string, at time.Time) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	i := ms.find(prefix)
+	if i < 0 {
+		return ErrNotFound
+	}
+	ms.entries[i].LastUsedAt = &at
+	return nil
+}
+
+//Delete revokes the key with the prefix `prefix`
+func (ms *MemStore) Delete(prefix string) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	i := ms.find(prefix)
+	if i < 0 {
+		return ErrNotFound
+	}
+	ms.entries = append(ms.entries[:i], ms.entries[i+1:]...)
+	return nil
+}
+
+//DeleteByUser revokes every key of the user with the ID `userID`
+func (ms *MemStore) DeleteByUser(userID users.UserID) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	kept := []*APIKey{}
+	for _, key := range ms.entries {
+		if fmt.Sprint(key.UserID) != fmt.Sprint(userID) {
+			kept = append(kept, key)
+		}
+	}
+	ms.entries = kept
+	return nil
+}
+
+//find returns the index of the key with the prefix `prefix`,
+//or -1 if there isn't one. The caller must hold the lock
+func (ms *MemStore) find(prefix string) int {
+	for i, key := range ms.entries {
+		if key.Prefix == prefix {
+			return i
+		}
+	}
+	return -1
+}
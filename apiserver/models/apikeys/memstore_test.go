@@ -0,0 +1,63 @@
+package apikeys
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore()
+	first, _, _ := (&NewAPIKey{Name: "first", Scopes: []string{ScopeRead}}).ToAPIKey("alice")
+	second, _, _ := (&NewAPIKey{Name: "second", Scopes: []string{ScopeWrite}}).ToAPIKey("alice")
+	for _, key := range []*APIKey{first, second} {
+		if err := store.Insert(key); err != nil {
+			t.Fatalf("error inserting key: %v\n", err)
+		}
+	}
+	if err := store.Insert(first); err == nil {
+		t.Errorf("expected an error inserting a key twice\n")
+	}
+
+	if key, err := store.Get(first.Prefix); err != nil || key.Name != "first" {
+		t.Errorf("incorrect key: %v %v\n", key, err)
+	}
+	if _, err := store.Get("nothing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound but got %v\n", err)
+	}
+	if found, _ := store.ListByUser("alice"); len(found) != 2 || found[0].Prefix != first.Prefix {
+		t.Errorf("expected alice's 2 keys but got %v\n", found)
+	}
+	if found, _ := store.ListByUser("bob"); len(found) != 0 {
+		t.Errorf("expected no keys for bob but got %v\n", found)
+	}
+
+	now := time.Now()
+	if err := store.Touch(first.Prefix, now); err != nil {
+		t.Fatalf("error touching key: %v\n", err)
+	}
+	if key, _ := store.Get(first.Prefix); key.LastUsedAt == nil || !key.LastUsedAt.Equal(now) {
+		t.Errorf("last used time was not recorded: %v\n", key.LastUsedAt)
+	}
+
+	if err := store.Delete(first.Prefix); err != nil {
+		t.Fatalf("error deleting key: %v\n", err)
+	}
+	if err := store.Delete(first.Prefix); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound but got %v\n", err)
+	}
+	if err := store.Touch(first.Prefix, now); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound but got %v\n", err)
+	}
+
+	bobs, _, _ := (&NewAPIKey{Name: "bob's", Scopes: []string{ScopeRead}}).ToAPIKey("bob")
+	store.Insert(bobs)
+	if err := store.DeleteByUser("alice"); err != nil {
+		t.Fatalf("error deleting alice's keys: %v\n", err)
+	}
+	if found, _ := store.ListByUser("alice"); len(found) != 0 {
+		t.Errorf("expected alice's keys to be deleted but got %v\n", found)
+	}
+	if _, err := store.Get(bobs.Prefix); err != nil {
+		t.Errorf("bob's key shouldn't have been deleted: %v\n", err)
+	}
+}
@@ -0,0 +1,106 @@
+package apikeys
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//keyColumns are the columns scanKey scans, in order
+const keyColumns = `Prefix, UserID, Name, Scopes, Hash, CreatedAt, LastUsedAt`
+
+//PGStore store structure
+type PGStore struct {
+	DB *sql.DB
+}
+
+//scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+//scanKey scans a row of keyColumns. The scopes are
+//stored space-separated, like OAuth scopes
+func scanKey(row scanner) (*APIKey, error) {
+	key := &APIKey{}
+	var scopes string
+	var lastUsed *time.Time
+	if err := row.Scan(&key.Prefix, &key.UserID, &key.Name, &scopes, &key.Hash, &key.CreatedAt, &lastUsed); err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.LastUsedAt = lastUsed
+	return key, nil
+}
+
+//Insert inserts a new key
+func (ps *PGStore) Insert(key *APIKey) error {
+	_, err := ps.DB.Exec(`INSERT INTO apikeys (`+keyColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		key.Prefix, key.UserID, key.Name, strings.Join(key.Scopes, " "), key.Hash, key.CreatedAt, key.LastUsedAt)
+	return err
+}
+
+//Get returns the key with the prefix `prefix`
+func (ps *PGStore) Get(prefix string) (*APIKey, error) {
+	key, err := scanKey(ps.DB.QueryRow(`SELECT `+keyColumns+` FROM apikeys WHERE Prefix = $1`, prefix))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+//ListByUser returns the keys of the user with the ID `userID`
+func (ps *PGStore) ListByUser(userID users.UserID) ([]*APIKey, error) {
+	rows, err := ps.DB.Query(`SELECT `+keyColumns+` FROM apikeys WHERE UserID = $1 ORDER BY CreatedAt`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := []*APIKey{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, key)
+	}
+	return found, rows.Err()
+}
+
+//Touch records that the key with the prefix `prefix` was used at `at`
+func (ps *PGStore) Touch(prefix string, at time.Time) error {
+	return ps.exec(`UPDATE apikeys SET LastUsedAt = $2 WHERE Prefix = $1`, prefix, at)
+}
+
+//Delete revokes the key with the prefix `prefix`
+func (ps *PGStore) Delete(prefix string) error {
+	return ps.exec(`DELETE FROM apikeys WHERE Prefix = $1`, prefix)
+}
+
+//DeleteByUser revokes every key of the user with the ID `userID`
+func (ps *PGStore) DeleteByUser(userID users.UserID) error {
+	_, err := ps.DB.Exec(`DELETE FROM apikeys WHERE UserID = $1`, userID)
+	return err
+}
+
+//exec runs a statement that should affect a key,
+//returning ErrNotFound if it doesn't
+func (ps *PGStore) exec(query string, args ...interface{}) error {
+	res, err := ps.DB.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package apikeys
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	_ "github.com/lib/pq"
+)
+
+//TestPostgresStore tests the dockerized PGStore
+func TestPostgresStore(t *testing.T) {
+	psdb, err := sql.Open("postgres", "user=pgstest dbname=pgstest sslmode=disable")
+	if err != nil {
+		t.Fatalf("error starting db: %v", err)
+	}
+	if err := psdb.Ping(); err != nil {
+		t.Fatalf("error pinging db %v", err)
+	}
+	if _, err := psdb.Exec("DELETE FROM apikeys"); err != nil {
+		t.Fatalf("could not delete API keys: %v\n", err)
+	}
+
+	userStore := &users.PGStore{DB: psdb}
+	user, err := userStore.GetByEmail("apikeys@test.com")
+	if err != nil {
+		user, err = userStore.Insert(&users.NewUser{
+			Email:        "apikeys@test.com",
+			Password:     "password",
+			PasswordConf: "password",
+			UserName:     "automated",
+		})
+		if err != nil {
+			t.Fatalf("error inserting user: %v\n", err)
+		}
+	}
+
+	store := &PGStore{DB: psdb}
+	key, raw, err := (&NewAPIKey{Name: "deploys", Scopes: []string{ScopeRead, ScopeWrite}}).ToAPIKey(user.ID)
+	if err != nil {
+		t.Fatalf("error generating key: %v\n", err)
+	}
+	if err := store.Insert(key); err != nil {
+		t.Fatalf("error inserting key: %v\n", err)
+	}
+	found, err := store.Get(key.Prefix)
+	if err != nil {
+		t.Fatalf("error getting key: %v\n", err)
+	}
+	_, secret, _ := ParseKey(raw)
+	if found.UserID != user.ID || len(found.Scopes) != 2 || !found.Matches(secret) || found.LastUsedAt != nil {
+		t.Errorf("incorrect key: %+v\n", found)
+	}
+	if err := store.Touch(key.Prefix, time.Now()); err != nil {
+		t.Errorf("error touching key: %v\n", err)
+	}
+	if all, err := store.ListByUser(user.ID); err != nil || len(all) != 1 || all[0].LastUsedAt == nil {
+		t.Errorf("expected 1 used key but got %v: %v\n", all, err)
+	}
+	if err := store.Delete(key.Prefix); err != nil {
+		t.Errorf("error deleting key: %v\n", err)
+	}
+	if _, err := store.Get(key.Prefix); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound but got %v\n", err)
+	}
+	store.Insert(key)
+	if err := store.DeleteByUser(user.ID); err != nil {
+		t.Errorf("error deleting the user's keys: %v\n", err)
+	}
+	if all, err := store.ListByUser(user.ID); err != nil || len(all) != 0 {
+		t.Errorf("expected no keys but got %v: %v\n", all, err)
+	}
+}
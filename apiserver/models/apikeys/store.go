@@ -0,0 +1,33 @@
+package apikeys
+
+import (
+	"errors"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//ErrNotFound is returned when the requested key doesn't exist
+var ErrNotFound = errors.New("API key not found")
+
+//Store keeps the API keys users have created
+type Store interface {
+	//Insert inserts a new key
+	Insert(key *APIKey) error
+
+	//Get returns the key with the prefix `prefix`
+	Get(prefix string) (*APIKey, error)
+
+	//ListByUser returns the keys of the user with the
+	//ID `userID`, in the order they were created
+	ListByUser(userID users.UserID) ([]*APIKey, error)
+
+	//Touch records that the key with the prefix `prefix` was used at `at`
+	Touch(prefix string, at time.Time) error
+
+	//Delete revokes the key with the prefix `prefix`
+	Delete(prefix string) error
+
+	//DeleteByUser revokes every key of the user with the ID `userID`
+	DeleteByUser(userID users.UserID) error
+}
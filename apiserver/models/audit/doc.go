@@ -0,0 +1,3 @@
+//Package audit records the actions admins and moderators take on
+//accounts, so that there's a trail of who did what, and when
+package audit
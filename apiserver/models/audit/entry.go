@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//Action is something an admin or moderator did to an account
+type Action string
+
+//actions that are recorded in the audit log
+const (
+	//ActionSetRole is recorded when a user's role is changed
+	ActionSetRole Action = "set-role"
+	//ActionDisable is recorded when an account is disabled
+	ActionDisable Action = "disable"
+	//ActionEnable is recorded when a disabled account is re-enabled
+	ActionEnable Action = "enable"
+	//ActionSignOut is recorded when a user is signed out everywhere
+	ActionSignOut Action = "sign-out"
+	//ActionDelete is recorded when an account is deleted for its user
+	ActionDelete Action = "delete"
+	//ActionRestore is recorded when a deleted account is restored
+	ActionRestore Action = "restore"
+	//ActionResetTwoFactor is recorded when a user's
+	//two-factor authentication is turned off for them
+	ActionResetTwoFactor Action = "reset-two-factor"
+)
+
+//Entry is a record of one action taken on an account
+type Entry struct {
+	ID        int64                  `json:"id"`
+	Action    Action                 `json:"action"`
+	ActorID   users.UserID           `json:"actorID"`
+	TargetID  users.UserID           `json:"targetID"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+//NewEntry returns an entry for the action `action` that `actor`
+//took on `target`, with optional details about what was done
+func NewEntry(action Action, actor *users.User, target *users.User, details map[string]interface{}) *Entry {
+	return &Entry{
+		Action:    action,
+		ActorID:   actor.ID,
+		TargetID:  target.ID,
+		Details:   details,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,43 @@
+package audit
+
+import "sync"
+
+//MemStore is an implementation of Store backed by
+//an in-memory slice. This should only be used for
+//automated testing
+type MemStore struct {
+	entries []*Entry
+	mx      sync.RWMutex
+}
+
+//NewMemStore returns a new MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		entries: []*Entry{},
+	}
+}
+
+//Insert adds an entry to the log, assigning its ID
+func (ms *MemStore) Insert(entry *Entry) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	entry.ID = int64(len(ms.entries) + 1)
+	ms.entries = append(ms.entries, entry)
+	return nil
+}
+
+//List returns up to `limit` entries older than `before`, newest first
+func (ms *MemStore) List(before int64, limit int) ([]*Entry, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	//IDs are positions in the slice, starting from 1
+	end := len(ms.entries)
+	if before > 0 && before <= int64(end) {
+		end = int(before) - 1
+	}
+	entries := []*Entry{}
+	for i := end - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, ms.entries[i])
+	}
+	return entries, nil
+}
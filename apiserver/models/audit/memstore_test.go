@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore()
+	admin := &users.User{ID: "admin"}
+	target := &users.User{ID: "target"}
+	actions := []Action{ActionDisable, ActionEnable, ActionSetRole, ActionSignOut, ActionDisable}
+	for _, a := range actions {
+		if err := store.Insert(NewEntry(a, admin, target, nil)); err != nil {
+			t.Fatalf("error inserting entry: %v\n", err)
+		}
+	}
+
+	//pages through the log, newest first
+	var before int64
+	got := []Action{}
+	for {
+		page, err := store.List(before, 2)
+		if err != nil {
+			t.Fatalf("error listing entries: %v\n", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, e := range page {
+			got = append(got, e.Action)
+			if e.ActorID != admin.ID || e.TargetID != target.ID {
+				t.Errorf("incorrect actor or target: %v\n", e)
+			}
+		}
+		before = page[len(page)-1].ID
+	}
+	if len(got) != len(actions) {
+		t.Fatalf("expected %d entries but got %d\n", len(actions), len(got))
+	}
+	for i, a := range got {
+		if expected := actions[len(actions)-1-i]; a != expected {
+			t.Errorf("entry %d: expected %s but got %s\n", i, expected, a)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+//PGStore store structure
+type PGStore struct {
+	DB *sql.DB
+}
+
+//Insert adds an entry to the log, assigning its ID
+func (ps *PGStore) Insert(entry *Entry) error {
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return err
+	}
+	sql := `INSERT INTO audit_log (Action, ActorID, TargetID, Details, CreatedAt) VALUES ($1, $2, $3, $4, $5) RETURNING ID`
+	return ps.DB.QueryRow(sql, string(entry.Action), entry.ActorID, entry.TargetID, details, entry.CreatedAt).Scan(&entry.ID)
+}
+
+//List returns up to `limit` entries older than `before`, newest first
+func (ps *PGStore) List(before int64, limit int) ([]*Entry, error) {
+	var rows *sql.Rows
+	var err error
+	if before > 0 {
+		rows, err = ps.DB.Query(`SELECT ID, Action, ActorID, TargetID, Details, CreatedAt FROM audit_log WHERE ID < $1 ORDER BY ID DESC LIMIT $2`, before, limit)
+	} else {
+		rows, err = ps.DB.Query(`SELECT ID, Action, ActorID, TargetID, Details, CreatedAt FROM audit_log ORDER BY ID DESC LIMIT $1`, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []*Entry{}
+	for rows.Next() {
+		e := &Entry{}
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.Action, &e.ActorID, &e.TargetID, &details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(details, &e.Details); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
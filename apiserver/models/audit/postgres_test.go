@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	_ "github.com/lib/pq"
+)
+
+//TestPostgresStore tests the dockerized PGStore
+func TestPostgresStore(t *testing.T) {
+	psdb, err := sql.Open("postgres", "user=pgstest dbname=pgstest sslmode=disable")
+	if err != nil {
+		t.Fatalf("error starting db: %v", err)
+	}
+	if err := psdb.Ping(); err != nil {
+		t.Fatalf("error pinging db %v", err)
+	}
+	if _, err := psdb.Exec("DELETE FROM audit_log"); err != nil {
+		t.Fatalf("could not delete audit log: %v\n", err)
+	}
+
+	userStore := &users.PGStore{DB: psdb}
+	actor, err := userStore.GetByEmail("audit@test.com")
+	if err != nil {
+		actor, err = userStore.Insert(&users.NewUser{
+			Email:        "audit@test.com",
+			Password:     "password",
+			PasswordConf: "password",
+			UserName:     "auditor",
+		})
+		if err != nil {
+			t.Fatalf("error inserting user: %v\n", err)
+		}
+	}
+
+	store := &PGStore{DB: psdb}
+	first := NewEntry(ActionSetRole, actor, actor, map[string]interface{}{"to": "admin"})
+	if err := store.Insert(first); err != nil {
+		t.Fatalf("error inserting entry: %v\n", err)
+	}
+	second := NewEntry(ActionSignOut, actor, actor, nil)
+	if err := store.Insert(second); err != nil {
+		t.Fatalf("error inserting entry: %v\n", err)
+	}
+
+	entries, err := store.List(0, 10)
+	if err != nil {
+		t.Fatalf("error listing entries: %v\n", err)
+	}
+	if len(entries) != 2 || entries[0].ID != second.ID || entries[1].ID != first.ID {
+		t.Fatalf("entries were not listed newest first: %v\n", entries)
+	}
+	if entries[1].Details["to"] != "admin" {
+		t.Errorf("details were not saved: %v\n", entries[1].Details)
+	}
+	if entries, _ := store.List(second.ID, 10); len(entries) != 1 || entries[0].ID != first.ID {
+		t.Errorf("incorrect entries before %d: %v\n", second.ID, entries)
+	}
+}
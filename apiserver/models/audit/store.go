@@ -0,0 +1,12 @@
+package audit
+
+//Store is an append-only log of audit entries
+type Store interface {
+	//Insert adds an entry to the log, assigning its ID
+	Insert(entry *Entry) error
+
+	//List returns up to `limit` entries, newest first, starting with
+	//the entries older than the entry with the ID `before`, or from
+	//the newest entry if `before` is 0
+	List(before int64, limit int) ([]*Entry, error)
+}
@@ -4,8 +4,115 @@ create table users (
 	Email varchar(255),
 	PassHash varchar(255),
 	UserName varchar(100),
+    --UserNameKey is what user names are compared by, so names that look alike can't both be used
+    UserNameKey varchar(255) not null,
     FirstName varchar(50),
     LastName varchar(50),
     PhotoURL varchar(100),
-    MobilePhone varchar(12)
-);
\ No newline at end of file
+    MobilePhone varchar(12),
+    Role varchar(20) not null default 'user',
+    Disabled boolean not null default false,
+    EmailVerified boolean not null default false,
+    VerificationSentAt timestamptz not null default 'epoch',
+    TOTPSecret varchar(64) not null default '',
+    TwoFactorEnabled boolean not null default false,
+    TOTPLastStep bigint not null default 0,
+    --the attempts to give a second factor since SecondFactorAttemptsSince, so codes can't be guessed
+    SecondFactorAttempts int not null default 0,
+    SecondFactorAttemptsSince timestamptz not null default 'epoch',
+    SessionsRevokedAt timestamptz not null default 'epoch',
+    DeletedAt timestamptz
+);
+
+--emails are stored normalized, user names are looked up by their normalized
+--form, and only one user can have each user name key
+create unique index users_email on users (Email);
+create unique index users_username on users (UserName);
+create unique index users_username_key on users (UserNameKey);
+
+--prefix indexes for user search, which matches case-insensitively
+create index users_username_prefix on users (lower(UserName) text_pattern_ops);
+create index users_firstname_prefix on users (lower(FirstName) text_pattern_ops);
+create index users_lastname_prefix on users (lower(LastName) text_pattern_ops);
+create index users_role on users (Role);
+
+--the hashes of the unused two-factor recovery codes of each user
+create table recovery_codes (
+    UserID int not null references users(ID) on delete cascade,
+    Hash char(64) not null,
+    primary key (UserID, Hash)
+);
+
+--the accounts with external identity providers that users can sign in with
+create table identities (
+    Provider varchar(50) not null,
+    Subject varchar(255) not null,
+    UserID int not null references users(ID) on delete cascade,
+    Email varchar(255) not null default '',
+    SignedUp boolean not null default false,
+    LinkedAt timestamptz not null,
+    primary key (Provider, Subject)
+);
+
+create index identities_user on identities (UserID);
+
+--only the hash of each API key's secret is kept, and keys are
+--looked up by their prefix, which is the part before the dot
+create table apikeys (
+    Prefix char(16) primary key,
+    UserID int not null references users(ID) on delete cascade,
+    Name varchar(100) not null,
+    Scopes varchar(100) not null,
+    Hash char(64) not null,
+    CreatedAt timestamptz not null,
+    LastUsedAt timestamptz
+);
+
+create index apikeys_user on apikeys (UserID);
+
+create table previews (
+    Owner varchar(255) not null,
+    Position int not null,
+    URL text not null,
+    Summary jsonb not null,
+    primary key (Owner, Position)
+);
+
+create table channels (
+    ID serial primary key,
+    Name varchar(100) not null unique,
+    Description text not null default '',
+    Private boolean not null default false,
+    CreatedAt timestamptz not null,
+    CreatorID int references users(ID) on delete set null
+);
+
+create table channel_members (
+    ChannelID int not null references channels(ID) on delete cascade,
+    UserID int not null references users(ID) on delete cascade,
+    Role varchar(10) not null,
+    AddedAt timestamptz not null,
+    primary key (ChannelID, UserID)
+);
+
+create index channel_members_user on channel_members (UserID);
+
+create table messages (
+    ID serial primary key,
+    ChannelID int not null references channels(ID) on delete cascade,
+    Body text not null,
+    CreatedAt timestamptz not null,
+    CreatorID int not null references users(ID) on delete cascade,
+    EditedAt timestamptz
+);
+
+create index messages_channel_created on messages (ChannelID, CreatedAt);
+
+create table audit_log (
+    ID bigserial primary key,
+    Action varchar(20) not null,
+    ActorID int not null,
+    TargetID int not null,
+    Details jsonb not null default 'null',
+    CreatedAt timestamptz not null
+);
@@ -0,0 +1,3 @@
+//Package identities links users to the accounts they have with external
+//identity providers, so that they can sign in with those accounts
+package identities
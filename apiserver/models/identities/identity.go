@@ -0,0 +1,23 @@
+package identities
+
+import (
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//Identity is an account with an identity provider that's linked
+//to a user. Each account can only be linked to one user
+type Identity struct {
+	//Provider is the name of the identity provider
+	Provider string `json:"provider"`
+	//Subject is the provider's ID for the account, which never changes
+	Subject string       `json:"subject"`
+	UserID  users.UserID `json:"userID"`
+	//Email is the account's email address when it was linked
+	Email string `json:"email"`
+	//SignedUp is set for the identity the user signed up with. It can't
+	//be unlinked, since the user may have no other way to sign in
+	SignedUp bool      `json:"signedUp"`
+	LinkedAt time.Time `json:"linkedAt"`
+}
@@ -0,0 +1,81 @@
+package identities
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//MemStore is an implementation of Store backed by
+//an in-memory slice. This should only be used for
+//automated testing
+type MemStore struct {
+	entries []*Identity
+	mx      sync.RWMutex
+}
+
+//NewMemStore returns a new MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		entries: []*Identity{},
+	}
+}
+
+//Insert links an identity to its user
+func (ms *MemStore) Insert(identity *Identity) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if ms.find(identity.Provider, identity.Subject) >= 0 {
+		return ErrAlreadyLinked
+	}
+	ms.entries = append(ms.entries, identity)
+	return nil
+}
+
+//Get returns the identity with the subject `subject` at `provider`
+func (ms *MemStore) Get(provider string, subject string) (*Identity, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	i := ms.find(provider, subject)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	return ms.entries[i], nil
+}
+
+//ListByUser returns the identities linked to the user with the ID `userID`
+func (ms *MemStore) ListByUser(userID users.UserID) ([]*Identity, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	found := []*Identity{}
+	for _, id := range ms.entries {
+		if fmt.Sprint(id.UserID) == fmt.Sprint(userID) {
+			found = append(found, id)
+		}
+	}
+	return found, nil
+}
+
+//Delete unlinks the identity with the subject `subject` at `provider`
+func (ms *MemStore) Delete(provider string, subject string) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	i := ms.find(provider, subject)
+	if i < 0 {
+		return ErrNotFound
+	}
+	ms.entries = append(ms.entries[:i], ms.entries[i+1:]...)
+	return nil
+}
+
+//find returns the index of the identity with the subject `subject`
+//at `provider`, or -1 if there isn't one. The caller must hold the lock
+func (ms *MemStore) find(provider string, subject string) int {
+	for i, id := range ms.entries {
+		if id.Provider == provider && id.Subject == subject {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,40 @@
+package identities
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore()
+	first := &Identity{Provider: "google", Subject: "1", UserID: "alice", LinkedAt: time.Now()}
+	second := &Identity{Provider: "github", Subject: "1", UserID: "alice", LinkedAt: time.Now()}
+	for _, id := range []*Identity{first, second} {
+		if err := store.Insert(id); err != nil {
+			t.Fatalf("error linking identity: %v\n", err)
+		}
+	}
+	if err := store.Insert(&Identity{Provider: "google", Subject: "1", UserID: "bob"}); err != ErrAlreadyLinked {
+		t.Errorf("expected ErrAlreadyLinked but got %v\n", err)
+	}
+
+	if id, err := store.Get("google", "1"); err != nil || id != first {
+		t.Errorf("incorrect identity: %v %v\n", id, err)
+	}
+	if _, err := store.Get("google", "2"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound but got %v\n", err)
+	}
+	if found, _ := store.ListByUser("alice"); len(found) != 2 || found[0] != first {
+		t.Errorf("expected alice's 2 identities but got %v\n", found)
+	}
+
+	if err := store.Delete("google", "1"); err != nil {
+		t.Fatalf("error unlinking identity: %v\n", err)
+	}
+	if err := store.Delete("google", "1"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound but got %v\n", err)
+	}
+	if found, _ := store.ListByUser("alice"); len(found) != 1 || found[0] != second {
+		t.Errorf("expected alice's remaining identity but got %v\n", found)
+	}
+}
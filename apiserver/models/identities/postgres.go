@@ -0,0 +1,78 @@
+package identities
+
+import (
+	"database/sql"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//PGStore store structure
+type PGStore struct {
+	DB *sql.DB
+}
+
+//Insert links an identity to its user
+func (ps *PGStore) Insert(identity *Identity) error {
+	res, err := ps.DB.Exec(`INSERT INTO identities (Provider, Subject, UserID, Email, SignedUp, LinkedAt) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (Provider, Subject) DO NOTHING`,
+		identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.SignedUp, identity.LinkedAt)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAlreadyLinked
+	}
+	return nil
+}
+
+//Get returns the identity with the subject `subject` at `provider`
+func (ps *PGStore) Get(provider string, subject string) (*Identity, error) {
+	id := &Identity{}
+	err := ps.DB.QueryRow(`SELECT Provider, Subject, UserID, Email, SignedUp, LinkedAt FROM identities WHERE Provider = $1 AND Subject = $2`, provider, subject).
+		Scan(&id.Provider, &id.Subject, &id.UserID, &id.Email, &id.SignedUp, &id.LinkedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+//ListByUser returns the identities linked to the user with the ID `userID`
+func (ps *PGStore) ListByUser(userID users.UserID) ([]*Identity, error) {
+	rows, err := ps.DB.Query(`SELECT Provider, Subject, UserID, Email, SignedUp, LinkedAt FROM identities WHERE UserID = $1 ORDER BY LinkedAt`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := []*Identity{}
+	for rows.Next() {
+		id := &Identity{}
+		if err := rows.Scan(&id.Provider, &id.Subject, &id.UserID, &id.Email, &id.SignedUp, &id.LinkedAt); err != nil {
+			return nil, err
+		}
+		found = append(found, id)
+	}
+	return found, rows.Err()
+}
+
+//Delete unlinks the identity with the subject `subject` at `provider`
+func (ps *PGStore) Delete(provider string, subject string) error {
+	res, err := ps.DB.Exec(`DELETE FROM identities WHERE Provider = $1 AND Subject = $2`, provider, subject)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
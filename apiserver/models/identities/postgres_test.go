@@ -0,0 +1,63 @@
+package identities
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	_ "github.com/lib/pq"
+)
+
+//TestPostgresStore tests the dockerized PGStore
+func TestPostgresStore(t *testing.T) {
+	psdb, err := sql.Open("postgres", "user=pgstest dbname=pgstest sslmode=disable")
+	if err != nil {
+		t.Fatalf("error starting db: %v", err)
+	}
+	if err := psdb.Ping(); err != nil {
+		t.Fatalf("error pinging db %v", err)
+	}
+	if _, err := psdb.Exec("DELETE FROM identities"); err != nil {
+		t.Fatalf("could not delete identities: %v\n", err)
+	}
+
+	userStore := &users.PGStore{DB: psdb}
+	user, err := userStore.GetByEmail("identities@test.com")
+	if err != nil {
+		user, err = userStore.Insert(&users.NewUser{
+			Email:        "identities@test.com",
+			Password:     "password",
+			PasswordConf: "password",
+			UserName:     "linked",
+		})
+		if err != nil {
+			t.Fatalf("error inserting user: %v\n", err)
+		}
+	}
+
+	store := &PGStore{DB: psdb}
+	id := &Identity{Provider: "google", Subject: "1", UserID: user.ID, Email: user.Email, SignedUp: true, LinkedAt: time.Now()}
+	if err := store.Insert(id); err != nil {
+		t.Fatalf("error linking identity: %v\n", err)
+	}
+	if err := store.Insert(id); err != ErrAlreadyLinked {
+		t.Errorf("expected ErrAlreadyLinked but got %v\n", err)
+	}
+	found, err := store.Get("google", "1")
+	if err != nil {
+		t.Fatalf("error getting identity: %v\n", err)
+	}
+	if found.UserID != user.ID || !found.SignedUp {
+		t.Errorf("incorrect identity: %v\n", found)
+	}
+	if all, err := store.ListByUser(user.ID); err != nil || len(all) != 1 {
+		t.Errorf("expected 1 identity but got %d: %v\n", len(all), err)
+	}
+	if err := store.Delete("google", "1"); err != nil {
+		t.Errorf("error unlinking identity: %v\n", err)
+	}
+	if _, err := store.Get("google", "1"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound but got %v\n", err)
+	}
+}
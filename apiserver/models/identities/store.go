@@ -0,0 +1,31 @@
+package identities
+
+import (
+	"errors"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//ErrNotFound is returned when the requested identity isn't linked to anyone
+var ErrNotFound = errors.New("identity not found")
+
+//ErrAlreadyLinked is returned when linking an identity
+//that's already linked to a user
+var ErrAlreadyLinked = errors.New("identity is already linked to a user")
+
+//Store keeps track of the identities linked to users
+type Store interface {
+	//Insert links an identity to its user,
+	//returning ErrAlreadyLinked if it's already linked
+	Insert(identity *Identity) error
+
+	//Get returns the identity with the subject `subject` at `provider`
+	Get(provider string, subject string) (*Identity, error)
+
+	//ListByUser returns the identities linked to the user
+	//with the ID `userID`, in the order they were linked
+	ListByUser(userID users.UserID) ([]*Identity, error)
+
+	//Delete unlinks the identity with the subject `subject` at `provider`
+	Delete(provider string, subject string) error
+}
@@ -0,0 +1,64 @@
+package messages
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+const (
+	//maxChannelNameLength is the longest a channel name can be
+	maxChannelNameLength = 100
+	//maxDescriptionLength is the longest a channel description can be
+	maxDescriptionLength = 1000
+)
+
+//ChannelID defines the type for channel IDs
+type ChannelID interface{}
+
+//Channel represents a channel messages are posted to
+type Channel struct {
+	ID          ChannelID    `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	CreatorID   users.UserID `json:"creatorID"`
+	//Private channels can only be read and posted to by their members
+	Private bool `json:"private"`
+}
+
+//NewChannel represents a new channel being created
+type NewChannel struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Private     bool   `json:"private"`
+}
+
+//Validate validates the new channel
+func (nc *NewChannel) Validate() error {
+	nc.Name = strings.TrimSpace(nc.Name)
+	if len(nc.Name) == 0 {
+		return fmt.Errorf("missing channel name")
+	}
+	if len(nc.Name) > maxChannelNameLength {
+		return fmt.Errorf("channel name must be at most %d characters", maxChannelNameLength)
+	}
+	if len(nc.Description) > maxDescriptionLength {
+		return fmt.Errorf("channel description must be at most %d characters", maxDescriptionLength)
+	}
+	return nil
+}
+
+//ToChannel converts the NewChannel to a Channel created by `creator`.
+//The ID is assigned by the Store
+func (nc *NewChannel) ToChannel(creator *users.User) *Channel {
+	return &Channel{
+		Name:        nc.Name,
+		Description: nc.Description,
+		Private:     nc.Private,
+		CreatedAt:   time.Now(),
+		CreatorID:   creator.ID,
+	}
+}
@@ -0,0 +1,59 @@
+package messages
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//Role is a member's role in a channel
+type Role string
+
+//Channel roles
+const (
+	//RoleOwner is the role of the user who created the channel. The owner
+	//can add and remove admins and members, and can't be removed
+	RoleOwner Role = "owner"
+	//RoleAdmin can add and remove members
+	RoleAdmin Role = "admin"
+	//RoleMember can read and post to the channel
+	RoleMember Role = "member"
+)
+
+//Member is a user's membership in a channel
+type Member struct {
+	ChannelID ChannelID    `json:"channelID"`
+	UserID    users.UserID `json:"userID"`
+	Role      Role         `json:"role"`
+	AddedAt   time.Time    `json:"addedAt"`
+}
+
+//Validate ensures the role is one members can be given. There is only
+//ever one owner, so users can only be added as admins or members
+func (r Role) Validate() error {
+	if r != RoleAdmin && r != RoleMember {
+		return fmt.Errorf("role must be %s or %s", RoleAdmin, RoleMember)
+	}
+	return nil
+}
+
+//CanManage reports whether a member with this role can add or remove
+//a member with the `other` role. The owner can manage everyone else, and
+//admins can manage members
+func (r Role) CanManage(other Role) bool {
+	switch r {
+	case RoleOwner:
+		return other != RoleOwner
+	case RoleAdmin:
+		return other == RoleMember
+	}
+	return false
+}
+
+//canRead reports whether the user with the given membership can read
+//and post to the channel. Anyone can use a public channel, but only
+//members can use a private one. `member` is nil if they aren't a member
+func canRead(c *Channel, member *Member) bool {
+	return !c.Private || member != nil
+}
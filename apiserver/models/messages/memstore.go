@@ -0,0 +1,265 @@
+package messages
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//MemStore is an implementation of Store backed by in-memory
+//slices. This should only be used for automated testing
+type MemStore struct {
+	channels []*Channel
+	messages []*Message
+	members  []*Member
+	mx       sync.RWMutex
+}
+
+//NewMemStore returns a new MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		channels: []*Channel{},
+		messages: []*Message{},
+		members:  []*Member{},
+	}
+}
+
+//GetChannels returns the public channels and
+//the private channels the user is a member of
+func (ms *MemStore) GetChannels(userID users.UserID) ([]*Channel, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	channels := []*Channel{}
+	for _, c := range ms.channels {
+		if canRead(c, ms.member(c.ID, userID)) {
+			channels = append(channels, c)
+		}
+	}
+	return channels, nil
+}
+
+//GetChannelByID returns the Channel with the given ID
+func (ms *MemStore) GetChannelByID(id ChannelID) (*Channel, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	return ms.channelByID(id)
+}
+
+//channelByID returns the channel with the given ID.
+//The caller must hold the lock
+func (ms *MemStore) channelByID(id ChannelID) (*Channel, error) {
+	for _, c := range ms.channels {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return nil, ErrChannelNotFound
+}
+
+//GetChannelByName returns the Channel with the given name
+func (ms *MemStore) GetChannelByName(name string) (*Channel, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	for _, c := range ms.channels {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, ErrChannelNotFound
+}
+
+//InsertChannel inserts a new NewChannel into the store
+//and returns a Channel with a newly-assigned ID
+func (ms *MemStore) InsertChannel(newChannel *NewChannel, creator *users.User) (*Channel, error) {
+	c := newChannel.ToChannel(creator)
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	c.ID = id
+	ms.mx.Lock()
+	ms.channels = append(ms.channels, c)
+	ms.members = append(ms.members, &Member{
+		ChannelID: c.ID,
+		UserID:    creator.ID,
+		Role:      RoleOwner,
+		AddedAt:   c.CreatedAt,
+	})
+	ms.mx.Unlock()
+	return c, nil
+}
+
+//GetMessages returns the most recent `n` messages
+//posted to the channel, oldest first
+func (ms *MemStore) GetMessages(channelID ChannelID, userID users.UserID, n int) ([]*Message, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	c, err := ms.channelByID(channelID)
+	if err != nil {
+		return nil, err
+	}
+	if !canRead(c, ms.member(c.ID, userID)) {
+		return nil, ErrNotMember
+	}
+	msgs := []*Message{}
+	for _, m := range ms.messages {
+		if m.ChannelID == channelID {
+			msgs = append(msgs, m)
+		}
+	}
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+	})
+	if len(msgs) > n {
+		msgs = msgs[len(msgs)-n:]
+	}
+	return msgs, nil
+}
+
+//GetMessageByID returns the Message with the given ID
+func (ms *MemStore) GetMessageByID(id MessageID) (*Message, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	for _, m := range ms.messages {
+		if m.ID == id {
+			return m, nil
+		}
+	}
+	return nil, ErrMessageNotFound
+}
+
+//InsertMessage inserts a new NewMessage into the store
+//and returns a Message with a newly-assigned ID
+func (ms *MemStore) InsertMessage(newMessage *NewMessage, creator *users.User) (*Message, error) {
+	m := newMessage.ToMessage(creator)
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	m.ID = id
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	c, err := ms.channelByID(m.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	if !canRead(c, ms.member(c.ID, creator.ID)) {
+		return nil, ErrNotMember
+	}
+	ms.messages = append(ms.messages, m)
+	return m, nil
+}
+
+//UpdateMessage applies MessageUpdates to the current message
+func (ms *MemStore) UpdateMessage(updates *MessageUpdates, current *Message) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	now := time.Now()
+	for _, m := range ms.messages {
+		if m.ID == current.ID {
+			m.Body = updates.Body
+			m.EditedAt = &now
+			current.Body = updates.Body
+			current.EditedAt = &now
+			return nil
+		}
+	}
+	return ErrMessageNotFound
+}
+
+//DeleteMessage deletes the message with the given ID
+func (ms *MemStore) DeleteMessage(id MessageID) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	for i, m := range ms.messages {
+		if m.ID == id {
+			ms.messages = append(ms.messages[:i], ms.messages[i+1:]...)
+			return nil
+		}
+	}
+	return ErrMessageNotFound
+}
+
+//member returns the user's membership in the channel, or nil if
+//they aren't a member. The caller must hold the lock
+func (ms *MemStore) member(channelID ChannelID, userID users.UserID) *Member {
+	for _, m := range ms.members {
+		if m.ChannelID == channelID && m.UserID == userID {
+			return m
+		}
+	}
+	return nil
+}
+
+//GetMember returns the user's membership in the channel
+func (ms *MemStore) GetMember(channelID ChannelID, userID users.UserID) (*Member, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	if m := ms.member(channelID, userID); m != nil {
+		return m, nil
+	}
+	return nil, ErrNotMember
+}
+
+//GetMembers returns the members of the channel
+func (ms *MemStore) GetMembers(channelID ChannelID) ([]*Member, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	if _, err := ms.channelByID(channelID); err != nil {
+		return nil, err
+	}
+	members := []*Member{}
+	for _, m := range ms.members {
+		if m.ChannelID == channelID {
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
+//AddMember adds the user to the channel with the given role
+func (ms *MemStore) AddMember(channelID ChannelID, userID users.UserID, role Role) (*Member, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if _, err := ms.channelByID(channelID); err != nil {
+		return nil, err
+	}
+	if m := ms.member(channelID, userID); m != nil {
+		m.Role = role
+		return m, nil
+	}
+	m := &Member{
+		ChannelID: channelID,
+		UserID:    userID,
+		Role:      role,
+		AddedAt:   time.Now(),
+	}
+	ms.members = append(ms.members, m)
+	return m, nil
+}
+
+//RemoveMember removes the user from the channel
+func (ms *MemStore) RemoveMember(channelID ChannelID, userID users.UserID) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	for i, m := range ms.members {
+		if m.ChannelID == channelID && m.UserID == userID {
+			ms.members = append(ms.members[:i], ms.members[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotMember
+}
+
+//newID returns a new random hex-encoded ID
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); nil != err {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,163 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore()
+	creator := &users.User{ID: "creator"}
+
+	c, err := store.InsertChannel(&NewChannel{Name: "general", Description: "chit chat"}, creator)
+	if err != nil {
+		t.Fatalf("error inserting channel: %v\n", err)
+	}
+	if _, ok := c.ID.(string); !ok || len(c.ID.(string)) == 0 {
+		t.Fatalf("new channel ID is not a non-empty string: %v\n", c.ID)
+	}
+	if c.CreatorID != creator.ID {
+		t.Errorf("incorrect channel creator: expected %v but got %v\n", creator.ID, c.CreatorID)
+	}
+	if c2, err := store.GetChannelByName("general"); err != nil || c2.ID != c.ID {
+		t.Errorf("error getting channel by name: %v\n", err)
+	}
+	if _, err := store.GetChannelByID("nope"); err != ErrChannelNotFound {
+		t.Errorf("expected ErrChannelNotFound but got %v\n", err)
+	}
+
+	var posted []*Message
+	for _, body := range []string{"one", "two", "three"} {
+		m, err := store.InsertMessage(&NewMessage{ChannelID: c.ID, Body: body}, creator)
+		if err != nil {
+			t.Fatalf("error inserting message: %v\n", err)
+		}
+		posted = append(posted, m)
+		//keep the creation times distinct
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := store.InsertMessage(&NewMessage{ChannelID: "nope", Body: "lost"}, creator); err != ErrChannelNotFound {
+		t.Errorf("posting to a missing channel: expected ErrChannelNotFound but got %v\n", err)
+	}
+
+	msgs, err := store.GetMessages(c.ID, creator.ID, 2)
+	if err != nil {
+		t.Fatalf("error getting messages: %v\n", err)
+	}
+	if len(msgs) != 2 || msgs[0].Body != "two" || msgs[1].Body != "three" {
+		t.Errorf("expected the two most recent messages oldest first but got %v\n", msgs)
+	}
+
+	if err := store.UpdateMessage(&MessageUpdates{Body: "uno"}, posted[0]); err != nil {
+		t.Fatalf("error updating message: %v\n", err)
+	}
+	m, err := store.GetMessageByID(posted[0].ID)
+	if err != nil {
+		t.Fatalf("error getting message: %v\n", err)
+	}
+	if m.Body != "uno" || m.EditedAt == nil {
+		t.Errorf("message was not updated: %v\n", m)
+	}
+
+	if err := store.DeleteMessage(posted[0].ID); err != nil {
+		t.Fatalf("error deleting message: %v\n", err)
+	}
+	if _, err := store.GetMessageByID(posted[0].ID); err != ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound after delete but got %v\n", err)
+	}
+	if err := store.DeleteMessage(posted[0].ID); err != ErrMessageNotFound {
+		t.Errorf("deleting twice: expected ErrMessageNotFound but got %v\n", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (&NewChannel{Name: "  "}).Validate(); err == nil {
+		t.Errorf("expected an error for a blank channel name\n")
+	}
+	nc := &NewChannel{Name: " general "}
+	if err := nc.Validate(); err != nil || nc.Name != "general" {
+		t.Errorf("expected a valid, trimmed channel name but got %q: %v\n", nc.Name, err)
+	}
+	if err := (&NewMessage{Body: "hi"}).Validate(); err == nil {
+		t.Errorf("expected an error for a message without a channel\n")
+	}
+	if err := (&NewMessage{ChannelID: "c", Body: " \n "}).Validate(); err == nil {
+		t.Errorf("expected an error for a blank message\n")
+	}
+	if err := (&MessageUpdates{Body: string(make([]byte, maxBodyLength+1))}).Validate(); err == nil {
+		t.Errorf("expected an error for a message that is too long\n")
+	}
+}
+
+func TestPrivateChannels(t *testing.T) {
+	store := NewMemStore()
+	owner := &users.User{ID: "owner"}
+	outsider := &users.User{ID: "outsider"}
+
+	public, _ := store.InsertChannel(&NewChannel{Name: "public"}, owner)
+	private, err := store.InsertChannel(&NewChannel{Name: "private", Private: true}, owner)
+	if err != nil {
+		t.Fatalf("error inserting channel: %v\n", err)
+	}
+	if m, err := store.GetMember(private.ID, owner.ID); err != nil || m.Role != RoleOwner {
+		t.Errorf("creator should be the owner: %v %v\n", m, err)
+	}
+
+	channels, _ := store.GetChannels(outsider.ID)
+	if len(channels) != 1 || channels[0].ID != public.ID {
+		t.Errorf("outsider should only see the public channel but saw %v\n", channels)
+	}
+	if _, err := store.GetMessages(private.ID, outsider.ID, 10); err != ErrNotMember {
+		t.Errorf("outsider reading: expected ErrNotMember but got %v\n", err)
+	}
+	if _, err := store.InsertMessage(&NewMessage{ChannelID: private.ID, Body: "hi"}, outsider); err != ErrNotMember {
+		t.Errorf("outsider posting: expected ErrNotMember but got %v\n", err)
+	}
+
+	if _, err := store.AddMember(private.ID, outsider.ID, RoleMember); err != nil {
+		t.Fatalf("error adding member: %v\n", err)
+	}
+	if channels, _ := store.GetChannels(outsider.ID); len(channels) != 2 {
+		t.Errorf("member should see both channels but saw %d\n", len(channels))
+	}
+	if _, err := store.InsertMessage(&NewMessage{ChannelID: private.ID, Body: "hi"}, outsider); err != nil {
+		t.Errorf("member posting: %v\n", err)
+	}
+	if members, _ := store.GetMembers(private.ID); len(members) != 2 {
+		t.Errorf("expected 2 members but got %d\n", len(members))
+	}
+
+	if err := store.RemoveMember(private.ID, outsider.ID); err != nil {
+		t.Fatalf("error removing member: %v\n", err)
+	}
+	if _, err := store.GetMessages(private.ID, outsider.ID, 10); err != ErrNotMember {
+		t.Errorf("removed member reading: expected ErrNotMember but got %v\n", err)
+	}
+	if err := store.RemoveMember(private.ID, outsider.ID); err != ErrNotMember {
+		t.Errorf("removing twice: expected ErrNotMember but got %v\n", err)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	cases := []struct {
+		role, other Role
+		expected    bool
+	}{
+		{RoleOwner, RoleAdmin, true},
+		{RoleOwner, RoleMember, true},
+		{RoleOwner, RoleOwner, false},
+		{RoleAdmin, RoleMember, true},
+		{RoleAdmin, RoleAdmin, false},
+		{RoleMember, RoleMember, false},
+	}
+	for _, c := range cases {
+		if c.role.CanManage(c.other) != c.expected {
+			t.Errorf("%s managing %s: expected %v\n", c.role, c.other, c.expected)
+		}
+	}
+	if err := RoleOwner.Validate(); err == nil {
+		t.Errorf("users should not be able to be added as owners\n")
+	}
+}
@@ -0,0 +1,72 @@
+package messages
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//maxBodyLength is the longest a message body can be
+const maxBodyLength = 4000
+
+//MessageID defines the type for message IDs
+type MessageID interface{}
+
+//Message represents a message posted to a channel
+type Message struct {
+	ID        MessageID    `json:"id"`
+	ChannelID ChannelID    `json:"channelID"`
+	Body      string       `json:"body"`
+	CreatedAt time.Time    `json:"createdAt"`
+	CreatorID users.UserID `json:"creatorID"`
+	//EditedAt is when the message was last edited, or nil if it never was
+	EditedAt *time.Time `json:"editedAt,omitempty"`
+}
+
+//NewMessage represents a new message being posted to a channel
+type NewMessage struct {
+	ChannelID ChannelID `json:"channelID"`
+	Body      string    `json:"body"`
+}
+
+//MessageUpdates represents updates one can make to a message
+type MessageUpdates struct {
+	Body string `json:"body"`
+}
+
+//validateBody ensures a message body isn't empty or too long
+func validateBody(body string) error {
+	if len(strings.TrimSpace(body)) == 0 {
+		return fmt.Errorf("missing message body")
+	}
+	if len(body) > maxBodyLength {
+		return fmt.Errorf("message body must be at most %d characters", maxBodyLength)
+	}
+	return nil
+}
+
+//Validate validates the new message
+func (nm *NewMessage) Validate() error {
+	if nm.ChannelID == nil {
+		return fmt.Errorf("missing channel ID")
+	}
+	return validateBody(nm.Body)
+}
+
+//Validate validates the message updates
+func (mu *MessageUpdates) Validate() error {
+	return validateBody(mu.Body)
+}
+
+//ToMessage converts the NewMessage to a Message posted by `creator`.
+//The ID is assigned by the Store
+func (nm *NewMessage) ToMessage(creator *users.User) *Message {
+	return &Message{
+		ChannelID: nm.ChannelID,
+		Body:      nm.Body,
+		CreatedAt: time.Now(),
+		CreatorID: creator.ID,
+	}
+}
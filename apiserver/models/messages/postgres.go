@@ -0,0 +1,265 @@
+package messages
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//PGStore store structure
+type PGStore struct {
+	DB *sql.DB
+}
+
+const channelColumns = `ID, Name, Description, Private, CreatedAt, CreatorID`
+const memberColumns = `ChannelID, UserID, Role, AddedAt`
+const messageColumns = `ID, ChannelID, Body, CreatedAt, CreatorID, EditedAt`
+
+//scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+//scanChannel scans the channelColumns of one row into a new Channel
+func scanChannel(row scanner) (*Channel, error) {
+	c := &Channel{}
+	if err := row.Scan(&c.ID, &c.Name, &c.Description, &c.Private, &c.CreatedAt, &c.CreatorID); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//scanMessage scans the messageColumns of one row into a new Message
+func scanMessage(row scanner) (*Message, error) {
+	m := &Message{}
+	if err := row.Scan(&m.ID, &m.ChannelID, &m.Body, &m.CreatedAt, &m.CreatorID, &m.EditedAt); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+//scanMember scans the memberColumns of one row into a new Member
+func scanMember(row scanner) (*Member, error) {
+	m := &Member{}
+	if err := row.Scan(&m.ChannelID, &m.UserID, &m.Role, &m.AddedAt); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+//GetChannels returns the public channels and
+//the private channels the user is a member of
+func (ps *PGStore) GetChannels(userID users.UserID) ([]*Channel, error) {
+	rows, err := ps.DB.Query(`SELECT `+channelColumns+` FROM channels
+		WHERE NOT Private OR ID IN (SELECT ChannelID FROM channel_members WHERE UserID = $1)
+		ORDER BY ID`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	channels := []*Channel{}
+	for rows.Next() {
+		c, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+//GetChannelByID returns the Channel with the given ID
+func (ps *PGStore) GetChannelByID(id ChannelID) (*Channel, error) {
+	c, err := scanChannel(ps.DB.QueryRow(`SELECT `+channelColumns+` FROM channels WHERE ID = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrChannelNotFound
+	}
+	return c, err
+}
+
+//GetChannelByName returns the Channel with the given name
+func (ps *PGStore) GetChannelByName(name string) (*Channel, error) {
+	c, err := scanChannel(ps.DB.QueryRow(`SELECT `+channelColumns+` FROM channels WHERE Name = $1`, name))
+	if err == sql.ErrNoRows {
+		return nil, ErrChannelNotFound
+	}
+	return c, err
+}
+
+//InsertChannel inserts a new NewChannel into the store
+//and returns a Channel with a newly-assigned ID
+func (ps *PGStore) InsertChannel(newChannel *NewChannel, creator *users.User) (*Channel, error) {
+	c := newChannel.ToChannel(creator)
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	sql := `INSERT INTO channels (Name, Description, Private, CreatedAt, CreatorID) VALUES ($1, $2, $3, $4, $5) RETURNING ID`
+	if err := tx.QueryRow(sql, c.Name, c.Description, c.Private, c.CreatedAt, c.CreatorID).Scan(&c.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	sql = `INSERT INTO channel_members (ChannelID, UserID, Role, AddedAt) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(sql, c.ID, c.CreatorID, RoleOwner, c.CreatedAt); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return c, tx.Commit()
+}
+
+//GetMessages returns the most recent `n` messages
+//posted to the channel, oldest first
+func (ps *PGStore) GetMessages(channelID ChannelID, userID users.UserID, n int) ([]*Message, error) {
+	if err := ps.checkAccess(channelID, userID); err != nil {
+		return nil, err
+	}
+	//select the newest n, then put them back in the order they were posted
+	rows, err := ps.DB.Query(`SELECT `+messageColumns+` FROM (
+		SELECT `+messageColumns+` FROM messages WHERE ChannelID = $1 ORDER BY CreatedAt DESC, ID DESC LIMIT $2
+	) AS recent ORDER BY CreatedAt, ID`, channelID, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	msgs := []*Message{}
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+//GetMessageByID returns the Message with the given ID
+func (ps *PGStore) GetMessageByID(id MessageID) (*Message, error) {
+	m, err := scanMessage(ps.DB.QueryRow(`SELECT `+messageColumns+` FROM messages WHERE ID = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	return m, err
+}
+
+//InsertMessage inserts a new NewMessage into the store
+//and returns a Message with a newly-assigned ID
+func (ps *PGStore) InsertMessage(newMessage *NewMessage, creator *users.User) (*Message, error) {
+	if err := ps.checkAccess(newMessage.ChannelID, creator.ID); err != nil {
+		return nil, err
+	}
+	m := newMessage.ToMessage(creator)
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	sql := `INSERT INTO messages (ChannelID, Body, CreatedAt, CreatorID) VALUES ($1, $2, $3, $4) RETURNING ID, ChannelID`
+	if err := tx.QueryRow(sql, m.ChannelID, m.Body, m.CreatedAt, m.CreatorID).Scan(&m.ID, &m.ChannelID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return m, tx.Commit()
+}
+
+//UpdateMessage applies MessageUpdates to the current message
+func (ps *PGStore) UpdateMessage(updates *MessageUpdates, current *Message) error {
+	now := time.Now()
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`UPDATE messages SET Body = $1, EditedAt = $2 WHERE ID = $3`, updates.Body, now, current.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return ErrMessageNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	current.Body = updates.Body
+	current.EditedAt = &now
+	return nil
+}
+
+//DeleteMessage deletes the message with the given ID
+func (ps *PGStore) DeleteMessage(id MessageID) error {
+	res, err := ps.DB.Exec(`DELETE FROM messages WHERE ID = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+//checkAccess returns ErrChannelNotFound if the channel doesn't exist, or
+//ErrNotMember if it's private and the user isn't a member
+func (ps *PGStore) checkAccess(channelID ChannelID, userID users.UserID) error {
+	c, err := ps.GetChannelByID(channelID)
+	if err != nil {
+		return err
+	}
+	if !c.Private {
+		return nil
+	}
+	_, err = ps.GetMember(c.ID, userID)
+	return err
+}
+
+//GetMember returns the user's membership in the channel
+func (ps *PGStore) GetMember(channelID ChannelID, userID users.UserID) (*Member, error) {
+	m, err := scanMember(ps.DB.QueryRow(`SELECT `+memberColumns+` FROM channel_members WHERE ChannelID = $1 AND UserID = $2`, channelID, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotMember
+	}
+	return m, err
+}
+
+//GetMembers returns the members of the channel
+func (ps *PGStore) GetMembers(channelID ChannelID) ([]*Member, error) {
+	if _, err := ps.GetChannelByID(channelID); err != nil {
+		return nil, err
+	}
+	rows, err := ps.DB.Query(`SELECT `+memberColumns+` FROM channel_members WHERE ChannelID = $1 ORDER BY AddedAt`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := []*Member{}
+	for rows.Next() {
+		m, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+//AddMember adds the user to the channel with the given role
+func (ps *PGStore) AddMember(channelID ChannelID, userID users.UserID, role Role) (*Member, error) {
+	if _, err := ps.GetChannelByID(channelID); err != nil {
+		return nil, err
+	}
+	sql := `INSERT INTO channel_members (ChannelID, UserID, Role, AddedAt) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (ChannelID, UserID) DO UPDATE SET Role = EXCLUDED.Role
+		RETURNING ` + memberColumns
+	return scanMember(ps.DB.QueryRow(sql, channelID, userID, role, time.Now()))
+}
+
+//RemoveMember removes the user from the channel
+func (ps *PGStore) RemoveMember(channelID ChannelID, userID users.UserID) error {
+	res, err := ps.DB.Exec(`DELETE FROM channel_members WHERE ChannelID = $1 AND UserID = $2`, channelID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package messages
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+	_ "github.com/lib/pq"
+)
+
+//TestPostgresStore tests the dockerized PGStore
+func TestPostgresStore(t *testing.T) {
+	psdb, err := sql.Open("postgres", "user=pgstest dbname=pgstest sslmode=disable")
+	if err != nil {
+		t.Fatalf("error starting db: %v", err)
+	}
+	if err := psdb.Ping(); err != nil {
+		t.Fatalf("error pinging db %v", err)
+	}
+	//clears previous test channels and messages in the DB
+	if _, err := psdb.Exec("DELETE FROM channels"); err != nil {
+		t.Fatalf("could not delete channels: %v\n", err)
+	}
+
+	userStore := &users.PGStore{DB: psdb}
+	creator, err := userStore.GetByEmail("channels@test.com")
+	if err != nil {
+		creator, err = userStore.Insert(&users.NewUser{
+			Email:        "channels@test.com",
+			Password:     "password",
+			PasswordConf: "password",
+			UserName:     "channeltester",
+		})
+		if err != nil {
+			t.Fatalf("error inserting user: %v\n", err)
+		}
+	}
+
+	store := &PGStore{DB: psdb}
+	c, err := store.InsertChannel(&NewChannel{Name: "general"}, creator)
+	if err != nil {
+		t.Fatalf("error inserting channel: %v\n", err)
+	}
+	c2, err := store.GetChannelByID(c.ID)
+	if err != nil {
+		t.Fatalf("error getting channel by ID: %v\n", err)
+	}
+	if c2.Name != c.Name {
+		t.Errorf("incorrect channel name: expected %s but got %s\n", c.Name, c2.Name)
+	}
+
+	m, err := store.InsertMessage(&NewMessage{ChannelID: c.ID, Body: "hello"}, creator)
+	if err != nil {
+		t.Fatalf("error inserting message: %v\n", err)
+	}
+	if err := store.UpdateMessage(&MessageUpdates{Body: "hello again"}, m); err != nil {
+		t.Errorf("error updating message: %v\n", err)
+	}
+	msgs, err := store.GetMessages(c.ID, creator.ID, 10)
+	if err != nil {
+		t.Fatalf("error getting messages: %v\n", err)
+	}
+	if len(msgs) != 1 || msgs[0].Body != "hello again" || msgs[0].EditedAt == nil {
+		t.Errorf("incorrect messages: %v\n", msgs)
+	}
+	if err := store.DeleteMessage(m.ID); err != nil {
+		t.Errorf("error deleting message: %v\n", err)
+	}
+	if _, err := store.GetMessageByID(m.ID); err != ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound after delete but got %v\n", err)
+	}
+}
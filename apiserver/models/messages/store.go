@@ -0,0 +1,73 @@
+package messages
+
+import (
+	"errors"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/models/users"
+)
+
+//ErrChannelNotFound is returned when the requested channel is not found in the store
+var ErrChannelNotFound = errors.New("channel not found")
+
+//ErrMessageNotFound is returned when the requested message is not found in the store
+var ErrMessageNotFound = errors.New("message not found")
+
+//ErrNotMember is returned when the user is not a member of the channel,
+//including when they try to read or post to a private channel
+var ErrNotMember = errors.New("user is not a member of the channel")
+
+//Store represents an abstract store for Channel and Message objects.
+//This interface is used by the HTTP handlers to create channels, and
+//to post, get, edit and delete messages. Like users.Store, it can be
+//implemented for any persistent database
+type Store interface {
+	//GetChannels returns all the channels the user can see: every
+	//public channel, and the private channels they are a member of
+	GetChannels(userID users.UserID) ([]*Channel, error)
+
+	//GetChannelByID returns the Channel with the given ID
+	GetChannelByID(id ChannelID) (*Channel, error)
+
+	//GetChannelByName returns the Channel with the given name
+	GetChannelByName(name string) (*Channel, error)
+
+	//InsertChannel inserts a new NewChannel created by `creator`
+	//into the store and returns a Channel with a newly-assigned ID.
+	//The creator is added as the channel's owner
+	InsertChannel(newChannel *NewChannel, creator *users.User) (*Channel, error)
+
+	//GetMessages returns the most recent `n` messages posted to the
+	//channel, oldest first. It returns ErrNotMember if the channel is
+	//private and the user is not a member
+	GetMessages(channelID ChannelID, userID users.UserID, n int) ([]*Message, error)
+
+	//GetMessageByID returns the Message with the given ID
+	GetMessageByID(id MessageID) (*Message, error)
+
+	//InsertMessage inserts a new NewMessage posted by `creator`
+	//into the store and returns a Message with a newly-assigned ID.
+	//It returns ErrNotMember if the channel is private and the
+	//creator is not a member
+	InsertMessage(newMessage *NewMessage, creator *users.User) (*Message, error)
+
+	//UpdateMessage applies MessageUpdates to the current message,
+	//updating both the store and `current`
+	UpdateMessage(updates *MessageUpdates, current *Message) error
+
+	//DeleteMessage deletes the message with the given ID
+	DeleteMessage(id MessageID) error
+
+	//GetMember returns the user's membership in the channel,
+	//or ErrNotMember if they aren't a member
+	GetMember(channelID ChannelID, userID users.UserID) (*Member, error)
+
+	//GetMembers returns the members of the channel
+	GetMembers(channelID ChannelID) ([]*Member, error)
+
+	//AddMember adds the user to the channel with the given role,
+	//or changes their role if they are already a member
+	AddMember(channelID ChannelID, userID users.UserID, role Role) (*Member, error)
+
+	//RemoveMember removes the user from the channel
+	RemoveMember(channelID ChannelID, userID users.UserID) error
+}
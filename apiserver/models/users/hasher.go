@@ -0,0 +1,228 @@
+package users
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//DefaultBcryptCost is the bcrypt cost used when none is configured
+const DefaultBcryptCost = 10
+
+//argon2idPrefix begins every hash made by an Argon2Hasher
+const argon2idPrefix = "$argon2id$"
+
+//The defaults for Argon2Hasher's parameters, as recommended by RFC 9106
+//for systems that can't spare 2 GiB of memory for each password
+const (
+	DefaultArgon2Time    = 3
+	DefaultArgon2Memory  = 64 * 1024
+	DefaultArgon2Threads = 4
+	DefaultArgon2KeyLen  = 32
+	DefaultArgon2SaltLen = 16
+)
+
+//ErrPasswordMismatch is returned when a password doesn't match its hash
+var ErrPasswordMismatch = errors.New("password does not match")
+
+//ErrUnknownHashFormat is returned when no hasher recognizes a password hash
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+//PasswordHasher hashes passwords and checks them against their hashes
+type PasswordHasher interface {
+	//Hash hashes `password` with a new random salt
+	Hash(password string) ([]byte, error)
+	//Compare returns ErrPasswordMismatch if `password`
+	//doesn't match `hash`, or nil if it does
+	Compare(hash []byte, password string) error
+	//Handles reports whether `hash` is in this hasher's format
+	Handles(hash []byte) bool
+	//NeedsRehash reports whether `hash` wasn't made by this hasher
+	//with its current parameters, and should be replaced
+	NeedsRehash(hash []byte) bool
+}
+
+//knownHashers can check passwords against hashes made with any
+//parameters, since the parameters are kept in the hashes
+var knownHashers = []PasswordHasher{&BcryptHasher{}, &Argon2Hasher{}}
+
+//hasherFor returns the hasher that can check `hash`
+func hasherFor(hash []byte) (PasswordHasher, error) {
+	for _, h := range knownHashers {
+		if h.Handles(hash) {
+			return h, nil
+		}
+	}
+	return nil, ErrUnknownHashFormat
+}
+
+//BcryptHasher hashes passwords with bcrypt
+type BcryptHasher struct {
+	//Cost is the bcrypt cost, and defaults to DefaultBcryptCost
+	Cost int
+}
+
+//cost returns the hasher's cost, or the default if it has none
+func (bh *BcryptHasher) cost() int {
+	if bh.Cost == 0 {
+		return DefaultBcryptCost
+	}
+	return bh.Cost
+}
+
+//Hash hashes `password` with bcrypt
+func (bh *BcryptHasher) Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bh.cost())
+}
+
+//Compare checks `password` against the bcrypt hash `hash`
+func (bh *BcryptHasher) Compare(hash []byte, password string) error {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+//Handles reports whether `hash` is a bcrypt hash
+func (bh *BcryptHasher) Handles(hash []byte) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if bytes.HasPrefix(hash, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+//NeedsRehash reports whether `hash` isn't a bcrypt hash with the hasher's cost
+func (bh *BcryptHasher) NeedsRehash(hash []byte) bool {
+	if !bh.Handles(hash) {
+		return true
+	}
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost != bh.cost()
+}
+
+//Argon2Hasher hashes passwords with Argon2id, encoding hashes
+//in the PHC string format, like $argon2id$v=19$m=65536,t=3,p=4$salt$key.
+//Parameters that are zero take their defaults
+type Argon2Hasher struct {
+	//Time is the number of passes over the memory
+	Time uint32
+	//Memory is the memory used, in KiB
+	Memory uint32
+	//Threads is the number of threads used
+	Threads uint8
+	//KeyLen is the length of the key, in bytes
+	KeyLen uint32
+	//SaltLen is the length of the random salt, in bytes
+	SaltLen int
+}
+
+//argon2Params are the parameters a hash was made with
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+//params returns the hasher's parameters, filling in the defaults
+func (ah *Argon2Hasher) params() *Argon2Hasher {
+	p := *ah
+	if p.Time == 0 {
+		p.Time = DefaultArgon2Time
+	}
+	if p.Memory == 0 {
+		p.Memory = DefaultArgon2Memory
+	}
+	if p.Threads == 0 {
+		p.Threads = DefaultArgon2Threads
+	}
+	if p.KeyLen == 0 {
+		p.KeyLen = DefaultArgon2KeyLen
+	}
+	if p.SaltLen == 0 {
+		p.SaltLen = DefaultArgon2SaltLen
+	}
+	return &p
+}
+
+//Hash hashes `password` with Argon2id
+func (ah *Argon2Hasher) Hash(password string) ([]byte, error) {
+	p := ah.params()
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	enc := base64.RawStdEncoding
+	return []byte(fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		p.Memory, p.Time, p.Threads, enc.EncodeToString(salt), enc.EncodeToString(key))), nil
+}
+
+//Compare checks `password` against the Argon2id hash `hash`,
+//using the parameters the hash was made with
+func (ah *Argon2Hasher) Compare(hash []byte, password string) error {
+	hp, err := parseArgon2(hash)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(password), hp.salt, hp.time, hp.memory, hp.threads, uint32(len(hp.key)))
+	if subtle.ConstantTimeCompare(key, hp.key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+//Handles reports whether `hash` is an Argon2id hash
+func (ah *Argon2Hasher) Handles(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte(argon2idPrefix))
+}
+
+//NeedsRehash reports whether `hash` isn't an Argon2id
+//hash made with the hasher's parameters
+func (ah *Argon2Hasher) NeedsRehash(hash []byte) bool {
+	hp, err := parseArgon2(hash)
+	if err != nil {
+		return true
+	}
+	p := ah.params()
+	return hp.time != p.Time || hp.memory != p.Memory || hp.threads != p.Threads ||
+		len(hp.key) != int(p.KeyLen) || len(hp.salt) != p.SaltLen
+}
+
+//parseArgon2 parses an Argon2id hash in the PHC string format
+func parseArgon2(hash []byte) (*argon2Params, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || "$"+parts[1]+"$" != argon2idPrefix {
+		return nil, ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnknownHashFormat
+	}
+	hp := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hp.memory, &hp.time, &hp.threads); err != nil {
+		return nil, ErrUnknownHashFormat
+	}
+	var err error
+	if hp.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnknownHashFormat
+	}
+	if hp.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(hp.key) == 0 {
+		return nil, ErrUnknownHashFormat
+	}
+	if hp.time == 0 || hp.threads == 0 {
+		return nil, ErrUnknownHashFormat
+	}
+	return hp, nil
+}
@@ -0,0 +1,96 @@
+package users
+
+import (
+	"strings"
+	"testing"
+)
+
+//fastArgon2 keeps the tests quick
+var fastArgon2 = &Argon2Hasher{Time: 1, Memory: 64, Threads: 1}
+
+func TestHashers(t *testing.T) {
+	for _, h := range []PasswordHasher{&BcryptHasher{Cost: 4}, fastArgon2} {
+		hash, err := h.Hash("password")
+		if err != nil {
+			t.Fatalf("%T: error hashing: %v\n", h, err)
+		}
+		if !h.Handles(hash) || h.NeedsRehash(hash) {
+			t.Errorf("%T: should handle its own hash without rehashing: %s\n", h, hash)
+		}
+		if err := h.Compare(hash, "password"); err != nil {
+			t.Errorf("%T: error comparing the right password: %v\n", h, err)
+		}
+		if err := h.Compare(hash, "incorrect"); err != ErrPasswordMismatch {
+			t.Errorf("%T: expected ErrPasswordMismatch but got %v\n", h, err)
+		}
+		if other, _ := h.Hash("password"); string(other) == string(hash) {
+			t.Errorf("%T: hashes of the same password should be salted differently\n", h)
+		}
+	}
+
+	//each hasher only handles its own format
+	bcryptHash, _ := (&BcryptHasher{Cost: 4}).Hash("password")
+	argon2Hash, _ := fastArgon2.Hash("password")
+	if fastArgon2.Handles(bcryptHash) || (&BcryptHasher{}).Handles(argon2Hash) {
+		t.Errorf("hashers should not handle each other's hashes\n")
+	}
+	if !strings.HasPrefix(string(argon2Hash), "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("unexpected Argon2id hash format: %s\n", argon2Hash)
+	}
+
+	//hashes made with other parameters need rehashing
+	if !(&BcryptHasher{Cost: 5}).NeedsRehash(bcryptHash) {
+		t.Errorf("a hash with a lower cost should need rehashing\n")
+	}
+	if !(&Argon2Hasher{Time: 2, Memory: 64, Threads: 1}).NeedsRehash(argon2Hash) {
+		t.Errorf("a hash with fewer passes should need rehashing\n")
+	}
+	if err := fastArgon2.Compare([]byte("$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5"), "password"); err != ErrUnknownHashFormat {
+		t.Errorf("expected ErrUnknownHashFormat for invalid parameters but got %v\n", err)
+	}
+}
+
+func TestRehash(t *testing.T) {
+	u := &User{}
+	if err := u.SetPassword(&BcryptHasher{Cost: 4}, "password"); err != nil {
+		t.Fatalf("error setting password: %v\n", err)
+	}
+
+	//switching hashers still lets users sign in, and gives them a new hash
+	if !fastArgon2.NeedsRehash(u.PassHash) {
+		t.Errorf("a bcrypt hash should need rehashing once Argon2id is used\n")
+	}
+	if err := u.Authenticate("incorrect"); err == nil {
+		t.Errorf("an incorrect password should not authenticate\n")
+	}
+	if err := u.Authenticate("password"); err != nil {
+		t.Fatalf("error authenticating with the old hash: %v\n", err)
+	}
+	passHash, err := fastArgon2.Hash("password")
+	if err != nil {
+		t.Fatalf("error rehashing: %v\n", err)
+	}
+	u.PassHash = passHash
+	if !fastArgon2.Handles(u.PassHash) || fastArgon2.NeedsRehash(u.PassHash) {
+		t.Errorf("the new hash should be an Argon2id hash: %s\n", u.PassHash)
+	}
+	if err := u.Authenticate("password"); err != nil {
+		t.Errorf("error authenticating with the new hash: %v\n", err)
+	}
+
+	u.PassHash = []byte("plaintext")
+	if err := u.Authenticate("plaintext"); err != ErrUnknownHashFormat {
+		t.Errorf("expected ErrUnknownHashFormat but got %v\n", err)
+	}
+}
+
+func TestSetPasswordError(t *testing.T) {
+	u := &User{}
+	if err := u.SetPassword(&BcryptHasher{Cost: 4}, strings.Repeat("x", MaxPasswordBytes+1)); err == nil {
+		t.Errorf("expected an error hashing a password bcrypt can't hash\n")
+	}
+	nu := &NewUser{Email: "test@test.com", UserName: "test", Password: strings.Repeat("x", MaxPasswordBytes+1), Hasher: &BcryptHasher{Cost: 4}}
+	if _, err := nu.ToUser(); err == nil {
+		t.Errorf("expected ToUser to return the hashing error\n")
+	}
+}
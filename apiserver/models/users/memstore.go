@@ -4,32 +4,120 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 )
 
 //MemStore is an implementation of UserStore
 //backed by an in-memory slice. This should only
-//be used for automated testing. This is not
-//safe for concurrent access
+//be used for automated testing. The store itself is
+//safe for concurrent access, but the users it returns
+//are shared, so callers shouldn't change them
 type MemStore struct {
 	entries []*User
+	//index is a prefix tree of the searchable fields of every user
+	index *trie
+	//recoveryCodes are the hashes of each user's unused recovery codes
+	recoveryCodes map[UserID][]string
+	//attempts are each user's recent attempts to give their second factor
+	attempts map[UserID]*secondFactorAttempts
+	mx       sync.RWMutex
+}
+
+//secondFactorAttempts counts a user's attempts
+//to give their second factor since `since`
+type secondFactorAttempts struct {
+	count int
+	since time.Time
 }
 
 //NewMemStore returns a new MemStore
 func NewMemStore() *MemStore {
 	return &MemStore{
-		entries: []*User{},
+		entries:       []*User{},
+		index:         newTrie(),
+		recoveryCodes: map[UserID][]string{},
+		attempts:      map[UserID]*secondFactorAttempts{},
 	}
 }
 
 //GetAll returns all users
 func (mus *MemStore) GetAll() ([]*User, error) {
+	mus.mx.RLock()
+	defer mus.mx.RUnlock()
 	users := make([]*User, len(mus.entries))
 	copy(users, mus.entries)
 	return users, nil
 }
 
+//List returns up to `limit` users matching `filter`
+//ordered by ID, starting after `after`
+func (mus *MemStore) List(filter *Filter, after UserID, limit int) ([]*User, error) {
+	mus.mx.RLock()
+	defer mus.mx.RUnlock()
+	sorted := []*User{}
+	for _, u := range mus.entries {
+		if filter.matches(u) {
+			sorted = append(sorted, u)
+		}
+	}
+	//MemStore IDs are always strings
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID.(string) < sorted[j].ID.(string)
+	})
+	start := 0
+	if after != nil {
+		afterID, ok := after.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid user ID %v", after)
+		}
+		start = sort.Search(len(sorted), func(i int) bool {
+			return sorted[i].ID.(string) > afterID
+		})
+	}
+	end := start + limit
+	if end > len(sorted) {
+		end = len(sorted)
+	}
+	return sorted[start:end], nil
+}
+
+//Search returns up to `limit` users with a user name, first name or
+//last name starting with `prefix`, ordered by rank and user name
+func (mus *MemStore) Search(prefix string, after *SearchPosition, limit int) ([]*SearchResult, error) {
+	mus.mx.RLock()
+	defer mus.mx.RUnlock()
+	results := []*SearchResult{}
+	if len(normalizeSearch(prefix)) == 0 {
+		return results, nil
+	}
+	for u, rank := range mus.index.find(prefix) {
+		if u.DeletedAt != nil {
+			continue
+		}
+		result := &SearchResult{User: u, Rank: rank}
+		if after == nil || !result.before(after) && *result.Position() != *after {
+			results = append(results, result)
+		}
+	}
+	sortResults(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
 //GetByID returns the User with the given ID
 func (mus *MemStore) GetByID(id UserID) (*User, error) {
+	mus.mx.RLock()
+	defer mus.mx.RUnlock()
+	return mus.getByID(id)
+}
+
+//getByID returns the User with the given ID.
+//The caller must hold the lock
+func (mus *MemStore) getByID(id UserID) (*User, error) {
 	for _, u := range mus.entries {
 		if u.ID == id {
 			return u, nil
@@ -38,8 +126,14 @@ func (mus *MemStore) GetByID(id UserID) (*User, error) {
 	return nil, ErrUserNotFound
 }
 
-//GetByEmail returns the User with the given email
+//GetByEmail returns the User with the given email, however it's written
 func (mus *MemStore) GetByEmail(email string) (*User, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	mus.mx.RLock()
+	defer mus.mx.RUnlock()
 	for _, u := range mus.entries {
 		if u.Email == email {
 			return u, nil
@@ -48,8 +142,11 @@ func (mus *MemStore) GetByEmail(email string) (*User, error) {
 	return nil, ErrUserNotFound
 }
 
-//GetByUserName returns the User with the given user name
+//GetByUserName returns the User with the user name `name`
 func (mus *MemStore) GetByUserName(name string) (*User, error) {
+	name = NormalizeUserName(name)
+	mus.mx.RLock()
+	defer mus.mx.RUnlock()
 	for _, u := range mus.entries {
 		if u.UserName == name {
 			return u, nil
@@ -58,6 +155,25 @@ func (mus *MemStore) GetByUserName(name string) (*User, error) {
 	return nil, ErrUserNotFound
 }
 
+//UserNameTaken reports whether a user has a user name that looks like `name`
+func (mus *MemStore) UserNameTaken(name string) (bool, error) {
+	mus.mx.RLock()
+	defer mus.mx.RUnlock()
+	return mus.userNameTaken(name), nil
+}
+
+//userNameTaken reports whether a user has a user name that
+//looks like `name`. The caller must hold the lock
+func (mus *MemStore) userNameTaken(name string) bool {
+	key := UserNameKey(name)
+	for _, u := range mus.entries {
+		if UserNameKey(u.UserName) == key {
+			return true
+		}
+	}
+	return false
+}
+
 //Insert inserts a new NewUser into the database
 //and return a User with new ID, or an error
 func (mus *MemStore) Insert(newUser *NewUser) (*User, error) {
@@ -74,21 +190,245 @@ func (mus *MemStore) Insert(newUser *NewUser) (*User, error) {
 		return nil, err
 	}
 	u.ID = id
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	if mus.userNameTaken(u.UserName) {
+		return nil, ErrUserNameTaken
+	}
 	mus.entries = append(mus.entries, u)
+	mus.index.add(u.UserName, u, RankUserName)
+	mus.index.add(u.FirstName, u, RankFirstName)
+	mus.index.add(u.LastName, u, RankLastName)
 	return u, nil
 }
 
 //Update applies UserUpdates to the currentUser
 func (mus *MemStore) Update(updates *UserUpdates, currentuser *User) error {
-	u, err := mus.GetByID(currentuser.ID)
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	u, err := mus.getByID(currentuser.ID)
 	if err != nil {
 		return err
 	}
+	mus.index.remove(u.FirstName, u, RankFirstName)
+	mus.index.remove(u.LastName, u, RankLastName)
 	u.FirstName = updates.FirstName
 	u.LastName = updates.LastName
+	if updates.MobilePhone != nil {
+		u.MobilePhone = *updates.MobilePhone
+	}
+	mus.index.add(u.FirstName, u, RankFirstName)
+	mus.index.add(u.LastName, u, RankLastName)
+	return nil
+}
+
+//SetRole changes the role of the user with the ID `id`
+func (mus *MemStore) SetRole(id UserID, role Role) error {
+	if err := role.Validate(); err != nil {
+		return err
+	}
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	u, err := mus.getByID(id)
+	if err != nil {
+		return err
+	}
+	u.Role = role
+	return nil
+}
+
+//SetDisabled disables or re-enables the user with the ID `id`
+func (mus *MemStore) SetDisabled(id UserID, disabled bool) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	u, err := mus.getByID(id)
+	if err != nil {
+		return err
+	}
+	u.Disabled = disabled
+	return nil
+}
+
+//SetPassHash replaces the password hash of the user with the ID `id`
+func (mus *MemStore) SetPassHash(id UserID, hash []byte) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	u, err := mus.getByID(id)
+	if err != nil {
+		return err
+	}
+	u.PassHash = hash
+	return nil
+}
+
+//RevokeSessions invalidates the sessions the user began before `at`
+func (mus *MemStore) RevokeSessions(id UserID, at time.Time) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	u, err := mus.getByID(id)
+	if err != nil {
+		return err
+	}
+	u.SessionsRevokedAt = at
+	return nil
+}
+
+//VerifyEmail marks the email address of the user
+//with the ID `id` as verified
+func (mus *MemStore) VerifyEmail(id UserID) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	u, err := mus.getByID(id)
+	if err != nil {
+		return err
+	}
+	u.EmailVerified = true
+	return nil
+}
+
+//MarkVerificationSent records that the user with the ID `id` was
+//sent a link to verify their email address at `at`
+func (mus *MemStore) MarkVerificationSent(id UserID, at time.Time) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	u, err := mus.getByID(id)
+	if err != nil {
+		return err
+	}
+	u.VerificationSentAt = at
+	return nil
+}
+
+//SetTwoFactor replaces the TOTP secret of the user with the ID `id`
+//and sets whether two-factor authentication is enabled
+func (mus *MemStore) SetTwoFactor(id UserID, secret string, enabled bool) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	u, err := mus.getByID(id)
+	if err != nil {
+		return err
+	}
+	u.TwoFactor = TwoFactor{Secret: secret, Enabled: enabled && len(secret) > 0}
+	return nil
+}
+
+//UseTOTPStep records that the user with the ID `id`
+//used the code for the time step `step`
+func (mus *MemStore) UseTOTPStep(id UserID, step int64) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	u, err := mus.getByID(id)
+	if err != nil {
+		return err
+	}
+	if step <= u.TwoFactor.LastStep {
+		return ErrCodeUsed
+	}
+	u.TwoFactor.LastStep = step
+	return nil
+}
+
+//SetRecoveryCodes replaces the recovery codes of the user with the ID `id`
+func (mus *MemStore) SetRecoveryCodes(id UserID, hashes []string) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	if _, err := mus.getByID(id); err != nil {
+		return err
+	}
+	mus.recoveryCodes[id] = append([]string{}, hashes...)
+	return nil
+}
+
+//UseRecoveryCode uses up the recovery code with the hash `hash`
+//of the user with the ID `id`
+func (mus *MemStore) UseRecoveryCode(id UserID, hash string) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	codes := mus.recoveryCodes[id]
+	for i, h := range codes {
+		if h == hash {
+			mus.recoveryCodes[id] = append(codes[:i:i], codes[i+1:]...)
+			return nil
+		}
+	}
+	return ErrCodeUsed
+}
+
+//AddSecondFactorAttempt records an attempt by the user with the ID `id`
+//to give their second factor, returning how many they've made since `since`
+func (mus *MemStore) AddSecondFactorAttempt(id UserID, since time.Time) (int, error) {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	if _, err := mus.getByID(id); err != nil {
+		return 0, err
+	}
+	a := mus.attempts[id]
+	if a == nil || a.since.Before(since) {
+		a = &secondFactorAttempts{since: time.Now()}
+		mus.attempts[id] = a
+	}
+	a.count++
+	return a.count, nil
+}
+
+//ResetSecondFactorAttempts forgets the attempts the user
+//with the ID `id` has made to give their second factor
+func (mus *MemStore) ResetSecondFactorAttempts(id UserID) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	if _, err := mus.getByID(id); err != nil {
+		return err
+	}
+	delete(mus.attempts, id)
 	return nil
 }
 
+//Delete marks the user with the ID `id` as deleted at `at`
+func (mus *MemStore) Delete(id UserID, at time.Time) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	u, err := mus.getByID(id)
+	if err != nil {
+		return err
+	}
+	u.DeletedAt = &at
+	return nil
+}
+
+//Restore undoes Delete for a user that hasn't been purged yet
+func (mus *MemStore) Restore(id UserID) error {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	u, err := mus.getByID(id)
+	if err != nil {
+		return err
+	}
+	u.DeletedAt = nil
+	return nil
+}
+
+//Purge permanently removes the users deleted before `before`
+func (mus *MemStore) Purge(before time.Time) (int, error) {
+	mus.mx.Lock()
+	defer mus.mx.Unlock()
+	kept := []*User{}
+	purged := 0
+	for _, u := range mus.entries {
+		if u.DeletedAt == nil || !u.DeletedAt.Before(before) {
+			kept = append(kept, u)
+			continue
+		}
+		mus.index.remove(u.UserName, u, RankUserName)
+		mus.index.remove(u.FirstName, u, RankFirstName)
+		mus.index.remove(u.LastName, u, RankLastName)
+		delete(mus.recoveryCodes, u.ID)
+		delete(mus.attempts, u.ID)
+		purged++
+	}
+	mus.entries = kept
+	return purged, nil
+}
+
 func (mus *MemStore) newID() (UserID, error) {
 	buf := make([]byte, 32)
 	if _, err := rand.Read(buf); nil != err {
@@ -1,6 +1,10 @@
 package users
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestMemStore(t *testing.T) {
 	store := NewMemStore()
@@ -63,9 +67,11 @@ func TestMemStore(t *testing.T) {
 		t.Errorf("ID of user fetched by all didn't match: expected %s but got %s\n", u.ID, u2.ID)
 	}
 
+	phone := "206-555-0199"
 	upd := &UserUpdates{
-		FirstName: "UPDATED Test",
-		LastName:  "UPDATED Tester",
+		FirstName:   "UPDATED Test",
+		LastName:    "UPDATED Tester",
+		MobilePhone: &phone,
 	}
 	if err := store.Update(upd, u); err != nil {
 		t.Errorf("error updating user: %v\n", err)
@@ -76,4 +82,257 @@ func TestMemStore(t *testing.T) {
 	if u.LastName != "UPDATED Tester" {
 		t.Errorf("FirstName field not updated: expected `UPDATED Tester` but got `%s`\n", u.LastName)
 	}
+	if u.MobilePhone != phone {
+		t.Errorf("MobilePhone field not updated: expected `%s` but got `%s`\n", phone, u.MobilePhone)
+	}
+}
+
+func TestMemStoreList(t *testing.T) {
+	store := NewMemStore()
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		_, err := store.Insert(&NewUser{
+			Email:        name + "@test.com",
+			UserName:     name,
+			Password:     "password",
+			PasswordConf: "password",
+		})
+		if err != nil {
+			t.Fatalf("error inserting user: %v\n", err)
+		}
+	}
+
+	seen := make(map[UserID]bool)
+	var after UserID
+	pages := 0
+	for {
+		page, err := store.List(nil, after, 2)
+		if err != nil {
+			t.Fatalf("error listing users: %v\n", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		pages++
+		for _, u := range page {
+			if seen[u.ID] {
+				t.Errorf("user %s was listed twice\n", u.UserName)
+			}
+			seen[u.ID] = true
+			if after != nil && u.ID.(string) <= after.(string) {
+				t.Errorf("users are not in ID order\n")
+			}
+		}
+		after = page[len(page)-1].ID
+	}
+	if len(seen) != 5 || pages != 3 {
+		t.Errorf("expected 5 users in 3 pages but got %d in %d\n", len(seen), pages)
+	}
+}
+
+func TestMemStoreSearch(t *testing.T) {
+	store := NewMemStore()
+	people := []struct {
+		userName, firstName, lastName string
+	}{
+		{"annie", "Ann", "Smith"},
+		{"bob", "Annabel", "Jones"},
+		{"carl", "Carl", "Annan"},
+		{"dave", "Dave", "Davis"},
+		{"Anders", "Anders", "Ant"},
+	}
+	for _, p := range people {
+		_, err := store.Insert(&NewUser{
+			Email:        p.userName + "@test.com",
+			UserName:     p.userName,
+			FirstName:    p.firstName,
+			LastName:     p.lastName,
+			Password:     "password",
+			PasswordConf: "password",
+		})
+		if err != nil {
+			t.Fatalf("error inserting user: %v\n", err)
+		}
+	}
+
+	names := func(results []*SearchResult) []string {
+		n := []string{}
+		for _, r := range results {
+			n = append(n, r.User.UserName)
+		}
+		return n
+	}
+
+	results, err := store.Search("AN", nil, 10)
+	if err != nil {
+		t.Fatalf("error searching: %v\n", err)
+	}
+	expected := []string{"Anders", "annie", "bob", "carl"}
+	if got := names(results); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("incorrect results: expected %v but got %v\n", expected, got)
+	}
+	if results[0].Rank != RankUserName || results[2].Rank != RankFirstName || results[3].Rank != RankLastName {
+		t.Errorf("incorrect ranks: %d %d %d\n", results[0].Rank, results[2].Rank, results[3].Rank)
+	}
+
+	//pages pick up right after the last result of the previous page
+	first, _ := store.Search("an", nil, 2)
+	second, _ := store.Search("an", first[len(first)-1].Position(), 2)
+	if got := names(append(first, second...)); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("incorrect paged results: expected %v but got %v\n", expected, got)
+	}
+
+	if results, _ := store.Search("zzz", nil, 10); len(results) != 0 {
+		t.Errorf("expected no results but got %v\n", names(results))
+	}
+	if results, _ := store.Search("  ", nil, 10); len(results) != 0 {
+		t.Errorf("expected no results for a blank search but got %v\n", names(results))
+	}
+
+	//updated names are reindexed
+	dave, _ := store.GetByUserName("dave")
+	if err := store.Update(&UserUpdates{FirstName: "Andy", LastName: "Davis"}, dave); err != nil {
+		t.Fatalf("error updating user: %v\n", err)
+	}
+	if results, _ := store.Search("andy", nil, 10); len(results) != 1 || results[0].User != dave {
+		t.Errorf("updated first name was not found: got %v\n", names(results))
+	}
+	if results, _ := store.Search("dave", nil, 10); len(results) != 1 || results[0].Rank != RankUserName {
+		t.Errorf("user name match was lost after the update: got %v\n", names(results))
+	}
+}
+
+func TestMemStoreRoles(t *testing.T) {
+	store := NewMemStore()
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := store.Insert(&NewUser{
+			Email:        name + "@test.com",
+			UserName:     name,
+			Password:     "password",
+			PasswordConf: "password",
+		})
+		if err != nil {
+			t.Fatalf("error inserting user: %v\n", err)
+		}
+	}
+	a, _ := store.GetByUserName("a")
+	b, _ := store.GetByUserName("b")
+	if a.Role != RoleUser {
+		t.Errorf("new users should have the role %s but got %s\n", RoleUser, a.Role)
+	}
+	if err := store.SetRole(a.ID, RoleAdmin); err != nil {
+		t.Fatalf("error setting role: %v\n", err)
+	}
+	if err := store.SetRole(a.ID, "superuser"); err != ErrInvalidRole {
+		t.Errorf("expected ErrInvalidRole but got %v\n", err)
+	}
+	if err := store.SetDisabled(b.ID, true); err != nil {
+		t.Fatalf("error disabling user: %v\n", err)
+	}
+	if err := store.SetDisabled("nobody", true); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound but got %v\n", err)
+	}
+
+	disabled, enabled := true, false
+	cases := []struct {
+		filter   *Filter
+		expected int
+	}{
+		{nil, 3},
+		{&Filter{Role: RoleAdmin}, 1},
+		{&Filter{Role: RoleUser}, 2},
+		{&Filter{Disabled: &disabled}, 1},
+		{&Filter{Role: RoleUser, Disabled: &enabled}, 1},
+	}
+	for _, c := range cases {
+		found, err := store.List(c.filter, nil, 10)
+		if err != nil {
+			t.Fatalf("error listing users: %v\n", err)
+		}
+		if len(found) != c.expected {
+			t.Errorf("filter %+v: expected %d users but got %d\n", c.filter, c.expected, len(found))
+		}
+	}
+}
+
+func TestMemStoreDelete(t *testing.T) {
+	store := NewMemStore()
+	u, err := store.Insert(&NewUser{
+		Email:        "gone@test.com",
+		UserName:     "gone",
+		Password:     "password",
+		PasswordConf: "password",
+	})
+	if err != nil {
+		t.Fatalf("error inserting user: %v\n", err)
+	}
+
+	deletedAt := time.Now().Add(-time.Hour)
+	if err := store.Delete(u.ID, deletedAt); err != nil {
+		t.Fatalf("error deleting user: %v\n", err)
+	}
+	if results, _ := store.Search("gone", nil, 10); len(results) != 0 {
+		t.Errorf("deleted users should not be found by searches\n")
+	}
+	deleted := true
+	if found, _ := store.List(&Filter{Deleted: &deleted}, nil, 10); len(found) != 1 {
+		t.Errorf("expected 1 deleted user but got %d\n", len(found))
+	}
+
+	//restored users are found again
+	if err := store.Restore(u.ID); err != nil {
+		t.Fatalf("error restoring user: %v\n", err)
+	}
+	if results, _ := store.Search("gone", nil, 10); len(results) != 1 {
+		t.Errorf("restored users should be found by searches\n")
+	}
+
+	//users are only purged once their grace period is over
+	store.Delete(u.ID, deletedAt)
+	store.AddSecondFactorAttempt(u.ID, deletedAt)
+	if n, err := store.Purge(deletedAt); err != nil || n != 0 {
+		t.Errorf("expected nothing to be purged but purged %d: %v\n", n, err)
+	}
+	purger := NewPurger(store, time.Minute, time.Hour)
+	defer purger.Close()
+	if n, err := purger.Purge(); err != nil || n != 1 {
+		t.Errorf("expected 1 user to be purged but purged %d: %v\n", n, err)
+	}
+	if _, err := store.GetByID(u.ID); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound for a purged user but got %v\n", err)
+	}
+	if _, found := store.attempts[u.ID]; found {
+		t.Errorf("the purged user's second factor attempts should be deleted\n")
+	}
+	if err := store.Restore(u.ID); err != ErrUserNotFound {
+		t.Errorf("purged users can't be restored, but got %v\n", err)
+	}
+}
+
+func TestMemStoreVerifyEmail(t *testing.T) {
+	store := NewMemStore()
+	u, err := store.Insert(&NewUser{
+		Email:        "new@test.com",
+		UserName:     "new",
+		Password:     "password",
+		PasswordConf: "password",
+	})
+	if err != nil {
+		t.Fatalf("error inserting user: %v\n", err)
+	}
+	if u.EmailVerified {
+		t.Errorf("new users should not have a verified email address\n")
+	}
+	sentAt := time.Now()
+	if err := store.MarkVerificationSent(u.ID, sentAt); err != nil {
+		t.Fatalf("error marking verification sent: %v\n", err)
+	}
+	if err := store.VerifyEmail(u.ID); err != nil {
+		t.Fatalf("error verifying email: %v\n", err)
+	}
+	if !u.EmailVerified || !u.VerificationSentAt.Equal(sentAt) {
+		t.Errorf("email verification was not saved\n")
+	}
+	if err := store.VerifyEmail("nobody"); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound but got %v\n", err)
+	}
 }
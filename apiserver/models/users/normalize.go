@@ -0,0 +1,119 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+//ErrInvalidEmail is returned when an email address can't be normalized
+var ErrInvalidEmail = errors.New("invalid email address")
+
+//ReservedUserNames can't be signed up with, nor can anything that
+//looks like them. They're compared by their UserNameKey
+var ReservedUserNames = []string{
+	"abuse", "admin", "administrator", "anonymous", "api", "everyone",
+	"help", "here", "hostmaster", "mod", "moderator", "me", "noreply",
+	"null", "postmaster", "root", "security", "staff", "support",
+	"system", "undefined", "webmaster", "www",
+}
+
+//confusables maps the letters of other scripts to the Latin letters
+//they're easily mistaken for, after case folding, like the skeletons of
+//Unicode TR39. Digits and letters of the same script that look alike,
+//like 1 and l or rn and m, are left alone, as they'd make too many
+//ordinary names collide
+var confusables = strings.NewReplacer(
+	//Cyrillic
+	"а", "a", "в", "b", "е", "e", "ё", "e", "һ", "h", "і", "i", "ї", "i",
+	"ј", "j", "к", "k", "ӏ", "l", "м", "m", "н", "h", "о", "o", "р", "p",
+	"с", "c", "т", "t", "у", "y", "х", "x", "ѕ", "s", "ԁ", "d", "ԛ", "q",
+	"ԝ", "w", "ь", "b",
+	//Greek
+	"α", "a", "β", "b", "ε", "e", "η", "n", "ι", "i", "κ", "k", "ν", "v",
+	"ο", "o", "ρ", "p", "τ", "t", "υ", "u", "χ", "x", "γ", "y",
+)
+
+//NormalizeEmail returns the form email addresses are stored and looked up
+//in. The local part is case folded, and the domain is encoded as ASCII
+//with IDNA, so addresses that differ only in case are the same address
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrInvalidEmail
+	}
+	domain, err := idna.Lookup.ToASCII(email[at+1:])
+	if err != nil {
+		return "", ErrInvalidEmail
+	}
+	return cases.Fold().String(norm.NFC.String(email[:at])) + "@" + domain, nil
+}
+
+//NormalizeUserName returns the form user names are stored in, which is
+//their Unicode NFKC form, so compatibility characters like full-width
+//letters become the characters they stand for
+func NormalizeUserName(name string) string {
+	return strings.TrimSpace(norm.NFKC.String(name))
+}
+
+//UserNameKey returns the key that keeps user names unique. Names with
+//the same key look alike, so only one user can have each key, but users
+//are looked up by their NormalizeUserName form. Keys are case folded,
+//and letters of other scripts are replaced with the Latin letters they
+//look like
+func UserNameKey(name string) string {
+	key := cases.Fold().String(NormalizeUserName(name))
+	//folding can undo NFKC, so normalize again once it's done
+	return norm.NFKC.String(confusables.Replace(norm.NFKC.String(key)))
+}
+
+//CheckUserName returns what's wrong with the user name `name`, if anything
+func CheckUserName(name string) []string {
+	problems := []string{}
+	name = NormalizeUserName(name)
+	for _, r := range name {
+		if !unicode.IsGraphic(r) {
+			problems = append(problems, "must only contain printable characters")
+			break
+		}
+	}
+	if len(scripts(name)) > 1 {
+		problems = append(problems, "must not mix letters from different scripts")
+	}
+	key := UserNameKey(name)
+	for _, reserved := range ReservedUserNames {
+		if key == UserNameKey(reserved) {
+			problems = append(problems, "is reserved")
+			break
+		}
+	}
+	return problems
+}
+
+//scripts returns the scripts of the letters in `s`. The scripts used
+//together to write Chinese, Japanese and Korean are counted as one
+func scripts(s string) map[string]bool {
+	found := map[string]bool{}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for name, table := range unicode.Scripts {
+			if name == "Common" || name == "Inherited" || !unicode.Is(table, r) {
+				continue
+			}
+			switch name {
+			case "Hiragana", "Katakana", "Hangul", "Bopomofo":
+				name = "Han"
+			}
+			found[name] = true
+			break
+		}
+	}
+	return found
+}
@@ -0,0 +1,129 @@
+package users
+
+import "testing"
+
+func TestNormalizeEmail(t *testing.T) {
+	cases := map[string]string{
+		"bob@example.com":           "bob@example.com",
+		" Bob@Example.COM ":         "bob@example.com",
+		"STRASSE@example.com":       "strasse@example.com",
+		"straße@example.com":        "strasse@example.com",
+		"bob@Bücher.example":        "bob@xn--bcher-kva.example",
+		"bob@xn--bcher-kva.example": "bob@xn--bcher-kva.example",
+	}
+	for email, expected := range cases {
+		normalized, err := NormalizeEmail(email)
+		if err != nil || normalized != expected {
+			t.Errorf("%q: expected %q but got %q %v\n", email, expected, normalized, err)
+		}
+	}
+	for _, email := range []string{"", "bob", "@example.com", "bob@", "bob@exa mple.com"} {
+		if _, err := NormalizeEmail(email); err != ErrInvalidEmail {
+			t.Errorf("%q: expected ErrInvalidEmail but got %v\n", email, err)
+		}
+	}
+}
+
+func TestUserNameKey(t *testing.T) {
+	if NormalizeUserName("ｂｏｂ") != "bob" {
+		t.Errorf("full-width letters should be normalized but got %q\n", NormalizeUserName("ｂｏｂ"))
+	}
+	alike := []string{"bob", "Bob", "BOB", "ｂｏｂ", "bоb", "βob"}
+	for _, name := range alike {
+		if UserNameKey(name) != UserNameKey("bob") {
+			t.Errorf("%q should look like bob, but its key is %q\n", name, UserNameKey(name))
+		}
+	}
+	for _, name := range []string{"bobby", "rob", "bób", "b0b"} {
+		if UserNameKey(name) == UserNameKey("bob") {
+			t.Errorf("%q should not look like bob\n", name)
+		}
+	}
+	//only letters of other scripts are confusable, so
+	//ordinary names that look a little alike can both be used
+	for a, b := range map[string]string{"bob1": "bobl", "arnold": "amold", "vvill": "will"} {
+		if UserNameKey(a) == UserNameKey(b) {
+			t.Errorf("%q and %q should have different keys\n", a, b)
+		}
+	}
+}
+
+func TestCheckUserName(t *testing.T) {
+	cases := map[string]int{
+		"alice":     0,
+		"Алиса":     0,
+		"たなか田中":     0,
+		"аlice":     1,
+		"admin":     1,
+		"ADMIN":     1,
+		"аdmin":     2,
+		"adrnin":    0,
+		"adm1n":     0,
+		"ali\x00ce": 1,
+	}
+	for name, expected := range cases {
+		if problems := CheckUserName(name); len(problems) != expected {
+			t.Errorf("%q: expected %d problems but got %v\n", name, expected, problems)
+		}
+	}
+}
+
+func TestValidateNormalizes(t *testing.T) {
+	nu := &NewUser{
+		Email:        "Bob@Example.COM",
+		Password:     "password",
+		PasswordConf: "password",
+		UserName:     "ｂｏｂ",
+	}
+	if err := nu.Validate(); err != nil {
+		t.Fatalf("error validating: %v\n", err)
+	}
+	u, err := nu.ToUser()
+	if err != nil {
+		t.Fatalf("error converting to user: %v\n", err)
+	}
+	if u.Email != "bob@example.com" || u.UserName != "bob" {
+		t.Errorf("expected a normalized email and user name but got %q and %q\n", u.Email, u.UserName)
+	}
+
+	nu.UserName = "Administrator"
+	errs, ok := nu.Validate().(FieldErrors)
+	if !ok || len(errs["userName"]) != 1 {
+		t.Errorf("expected a reserved user name error but got %v\n", errs)
+	}
+}
+
+func TestMemStoreLookupNormalized(t *testing.T) {
+	store := NewMemStore()
+	if _, err := store.Insert(&NewUser{Email: "Bob@Example.com", Password: "password", UserName: "Bob"}); err != nil {
+		t.Fatalf("error inserting user: %v\n", err)
+	}
+	for _, email := range []string{"bob@example.com", "BOB@EXAMPLE.COM"} {
+		if _, err := store.GetByEmail(email); err != nil {
+			t.Errorf("%q: error getting user: %v\n", email, err)
+		}
+	}
+	for _, name := range []string{"Bob", "Ｂｏｂ"} {
+		if _, err := store.GetByUserName(name); err != nil {
+			t.Errorf("%q: error getting user: %v\n", name, err)
+		}
+	}
+	//names that only look alike are taken, but aren't the same name
+	for _, name := range []string{"bob", "Bоb"} {
+		if _, err := store.GetByUserName(name); err != ErrUserNotFound {
+			t.Errorf("%q: expected ErrUserNotFound but got %v\n", name, err)
+		}
+		if taken, _ := store.UserNameTaken(name); !taken {
+			t.Errorf("%q: should be taken\n", name)
+		}
+	}
+	if _, err := store.Insert(&NewUser{Email: "other@example.com", Password: "password", UserName: "Bоb"}); err != ErrUserNameTaken {
+		t.Errorf("expected ErrUserNameTaken but got %v\n", err)
+	}
+	if taken, _ := store.UserNameTaken("bob1"); taken {
+		t.Errorf("bob1 should not be taken\n")
+	}
+	if _, err := store.GetByEmail("not an email"); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound but got %v\n", err)
+	}
+}
@@ -0,0 +1,217 @@
+package users
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//MaxPasswordBytes is the longest a password can be with bcrypt, and
+//the default for PasswordPolicy.MaxLength. bcrypt ignores everything
+//after its first 72 bytes, so longer passwords would only seem
+//stronger than they are
+const MaxPasswordBytes = 72
+
+//breachPrefixLength is the length of the hash prefixes breached passwords
+//are looked up by. Only the prefix of a password's hash is ever given to
+//a BreachRanges, so the password can't be learned from the lookup
+const breachPrefixLength = 5
+
+//minContainedLength is the shortest user name or email address
+//that passwords aren't allowed to contain
+const minContainedLength = 3
+
+//DefaultPasswordPolicy is the policy used when none is configured.
+//It only checks the length of passwords
+var DefaultPasswordPolicy = &PasswordPolicy{MinLength: 6}
+
+//FieldErrors maps the JSON names of invalid fields to what's wrong with them
+type FieldErrors map[string][]string
+
+//Add adds an error message for the field `field`
+func (fe FieldErrors) Add(field string, message string) {
+	fe[field] = append(fe[field], message)
+}
+
+//Error returns every message, prefixed with its field, in field order
+func (fe FieldErrors) Error() string {
+	fields := make([]string, 0, len(fe))
+	for field := range fe {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	msgs := []string{}
+	for _, field := range fields {
+		for _, msg := range fe[field] {
+			msgs = append(msgs, field+": "+msg)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+//BreachRanges looks up breached passwords by the first five hex
+//characters of their uppercase SHA-1 hash, returning the rest of the
+//hashes with that prefix, like the Pwned Passwords range API
+type BreachRanges interface {
+	Range(prefix string) ([]string, error)
+}
+
+//PasswordPolicy decides which passwords users can choose
+type PasswordPolicy struct {
+	//MinLength is the fewest characters a password can have
+	MinLength int
+	//MaxLength is the most bytes a password can have, and defaults
+	//to MaxPasswordBytes. It can only be longer with Argon2id, as
+	//bcrypt can't hash longer passwords
+	MaxLength int
+	//MinClasses is how many of lowercase letters, uppercase
+	//letters, digits and symbols a password must have
+	MinClasses int
+	//MinEntropy is the fewest bits of entropy a password can have,
+	//estimated from its length and the classes of characters in it
+	MinEntropy float64
+	//Breached, if set, is checked for passwords that have been breached
+	Breached BreachRanges
+}
+
+//Check checks `password` for the user with the user name `userName`
+//and email address `email`, returning what's wrong with it, if anything
+func (pp *PasswordPolicy) Check(password string, userName string, email string) ([]string, error) {
+	problems := []string{}
+	maxLength := pp.MaxLength
+	if maxLength <= 0 {
+		maxLength = MaxPasswordBytes
+	}
+	if utf8.RuneCountInString(password) < pp.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", pp.MinLength))
+	}
+	if len(password) > maxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes", maxLength))
+	}
+	classes, pool := characterClasses(password)
+	if classes < pp.MinClasses {
+		problems = append(problems, fmt.Sprintf("must have at least %d of lowercase letters, uppercase letters, digits and symbols", pp.MinClasses))
+	}
+	if pp.MinEntropy > 0 && float64(utf8.RuneCountInString(password))*math.Log2(float64(pool)) < pp.MinEntropy {
+		problems = append(problems, "is too easy to guess")
+	}
+	lower := strings.ToLower(password)
+	if len(userName) >= minContainedLength && strings.Contains(lower, strings.ToLower(userName)) {
+		problems = append(problems, "must not contain your user name")
+	}
+	local := email
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		local = email[:at]
+	}
+	if len(local) >= minContainedLength && strings.Contains(lower, strings.ToLower(local)) {
+		problems = append(problems, "must not contain your email address")
+	}
+	if pp.Breached != nil {
+		breached, err := isBreached(pp.Breached, password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			problems = append(problems, "has appeared in a data breach, so it isn't safe to use")
+		}
+	}
+	return problems, nil
+}
+
+//characterClasses returns how many classes of characters `password` has,
+//and the size of the pool of characters in those classes, counting
+//everything that isn't a cased letter or a digit as a symbol
+func characterClasses(password string) (int, int) {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes, pool := 0, 0
+	for _, c := range []struct {
+		has  bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}} {
+		if c.has {
+			classes++
+			pool += c.size
+		}
+	}
+	if pool == 0 {
+		pool = 1
+	}
+	return classes, pool
+}
+
+//isBreached looks up `password` in `ranges` by the prefix of its hash
+func isBreached(ranges BreachRanges, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := ranges.Range(hash[:breachPrefixLength])
+	if err != nil {
+		return false, err
+	}
+	for _, suffix := range suffixes {
+		if suffix == hash[breachPrefixLength:] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//BreachList is a BreachRanges loaded from a local file
+type BreachList struct {
+	ranges map[string][]string
+}
+
+//LoadBreachList loads the breached passwords in the file at `path`. Each
+//line is the hex SHA-1 hash of a password, optionally followed by a colon
+//and how many times it was seen, like the Pwned Passwords downloads
+func LoadBreachList(path string) (*BreachList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	bl := &BreachList{ranges: map[string][]string{}}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		hash := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(hash, ":"); i >= 0 {
+			hash = hash[:i]
+		}
+		if len(hash) == 0 {
+			continue
+		}
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 2*sha1.Size {
+			return nil, fmt.Errorf("line %d of %s isn't a SHA-1 hash", line, path)
+		}
+		hash = strings.ToUpper(hash)
+		prefix := hash[:breachPrefixLength]
+		bl.ranges[prefix] = append(bl.ranges[prefix], hash[breachPrefixLength:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return bl, nil
+}
+
+//Range returns the rest of the hashes that begin with `prefix`
+func (bl *BreachList) Range(prefix string) ([]string, error) {
+	return bl.ranges[strings.ToUpper(prefix)], nil
+}
@@ -0,0 +1,93 @@
+package users
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "breached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sum := sha1.Sum([]byte("Tr0ub4dor&3"))
+	path := filepath.Join(dir, "breached.txt")
+	list := strings.ToLower(hex.EncodeToString(sum[:])) + ":42\n\n" + strings.Repeat("A", 40) + "\n"
+	if err := ioutil.WriteFile(path, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	breached, err := LoadBreachList(path)
+	if err != nil {
+		t.Fatalf("error loading breach list: %v\n", err)
+	}
+
+	policy := &PasswordPolicy{MinLength: 10, MinClasses: 3, MinEntropy: 50, Breached: breached}
+	cases := []struct {
+		password string
+		problems int
+	}{
+		{"correct Horse battery", 0},
+		{"Short1!", 2},
+		{"alllowercaseletters", 1},
+		{"Aa1!Aa1!Aa", 0},
+		{"aa1aa1aa1a", 1},
+		{strings.Repeat("Aa1!", 19), 1},
+		{"Tr0ub4dor&3", 1},
+		{"MyNameIsAlice1", 1},
+		{"alice.smith@Home1", 2},
+	}
+	for _, c := range cases {
+		problems, err := policy.Check(c.password, "Alice", "alice.smith@example.com")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v\n", c.password, err)
+		}
+		if len(problems) != c.problems {
+			t.Errorf("%s: expected %d problems but got %v\n", c.password, c.problems, problems)
+		}
+	}
+
+	//the max length can be raised for hashers that aren't bcrypt
+	long := strings.Repeat("Aa1!", 19)
+	if problems, _ := (&PasswordPolicy{MaxLength: 128}).Check(long, "", ""); len(problems) != 0 {
+		t.Errorf("expected no problems with a higher max length but got %v\n", problems)
+	}
+	if problems, _ := (&PasswordPolicy{MaxLength: 16}).Check(long, "", ""); len(problems) != 1 {
+		t.Errorf("expected a problem with a lower max length but got %v\n", problems)
+	}
+
+	//short user names aren't checked, or every password would contain them
+	if problems, _ := DefaultPasswordPolicy.Check("passwordjo", "jo", "jo@test.com"); len(problems) != 0 {
+		t.Errorf("expected no problems but got %v\n", problems)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("not a hash\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBreachList(path); err == nil {
+		t.Errorf("expected an error loading an invalid breach list\n")
+	}
+}
+
+func TestNewUserFieldErrors(t *testing.T) {
+	nu := createNewUser()
+	nu.Email = "invalid"
+	nu.Password = "mrtester1"
+	nu.PasswordConf = "other"
+	err := nu.ValidateWith(&PasswordPolicy{MinLength: 12})
+	errs, ok := err.(FieldErrors)
+	if !ok {
+		t.Fatalf("expected FieldErrors but got %v\n", err)
+	}
+	if len(errs["email"]) != 1 || len(errs["password"]) != 2 || len(errs["passwordConf"]) != 1 || len(errs["userName"]) != 0 {
+		t.Errorf("incorrect field errors: %v\n", errs)
+	}
+	if !strings.HasPrefix(errs.Error(), "email: ") {
+		t.Errorf("incorrect error message: %s\n", errs.Error())
+	}
+}
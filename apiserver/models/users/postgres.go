@@ -3,19 +3,52 @@ package users
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+//userNameKeyIndex is the unique index on UserNameKey, which
+//keeps two users from having names that look alike
+const userNameKeyIndex = "users_username_key"
+
 //PGStore store stucture
 type PGStore struct {
 	DB *sql.DB
 }
 
+//userColumns are the columns scanned by scanUser, in order
+const userColumns = `ID, Email, FirstName, LastName, PassHash, PhotoURL, MobilePhone, UserName, Role, Disabled, EmailVerified, VerificationSentAt, TOTPSecret, TwoFactorEnabled, TOTPLastStep, SessionsRevokedAt, DeletedAt`
+
+//scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+//scanUser scans the userColumns of a row into a new User,
+//followed by any `extra` columns
+func scanUser(row scanner, extra ...interface{}) (*User, error) {
+	user := &User{}
+	//MobilePhone is nullable, and a missing phone is an empty one
+	var phone sql.NullString
+	dest := append([]interface{}{&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.PassHash, &user.PhotoURL, &phone, &user.UserName, &user.Role, &user.Disabled, &user.EmailVerified, &user.VerificationSentAt, &user.TwoFactor.Secret, &user.TwoFactor.Enabled, &user.TwoFactor.LastStep, &user.SessionsRevokedAt, &user.DeletedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	user.MobilePhone = phone.String
+	return user, nil
+}
+
 //GetAll returns all users
 func (ps *PGStore) GetAll() ([]*User, error) {
 	var users []*User
 
 	//Query the database to return multiple rows
-	rows, err := ps.DB.Query(`SELECT ID, Email, FirstName, LastName, PassHash, PhotoURL, UserName FROM users`)
+	rows, err := ps.DB.Query(`SELECT ` + userColumns + ` FROM users`)
 	if err != nil {
 		return nil, err
 	}
@@ -23,9 +56,9 @@ func (ps *PGStore) GetAll() ([]*User, error) {
 	//Next refers to the first row initially
 	//returns false once EOF
 	for rows.Next() {
-		var user = &User{}
 		//scans values into User struct; error returned if scan unsuccessful
-		if err := rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.PassHash, &user.PhotoURL, &user.UserName); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
 		//adds to array
@@ -39,35 +72,118 @@ func (ps *PGStore) GetAll() ([]*User, error) {
 	return users, nil
 }
 
+//List returns up to `limit` users matching `filter` ordered by ID,
+//starting after `after`. Since this seeks to `after` using the primary
+//key index, rather than skipping an offset, later pages are just as
+//fast as the first
+func (ps *PGStore) List(filter *Filter, after UserID, limit int) ([]*User, error) {
+	where := []string{"true"}
+	args := []interface{}{}
+	//add adds a condition with the next placeholder
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(condition, len(args)))
+	}
+	if after != nil {
+		add("ID > $%d", after)
+	}
+	if filter != nil && len(filter.Role) > 0 {
+		add("Role = $%d", string(filter.Role))
+	}
+	if filter != nil && filter.Disabled != nil {
+		add("Disabled = $%d", *filter.Disabled)
+	}
+	if filter != nil && filter.Deleted != nil {
+		add("(DeletedAt IS NOT NULL) = $%d", *filter.Deleted)
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf(`SELECT %s FROM users WHERE %s ORDER BY ID LIMIT $%d`, userColumns, strings.Join(where, " AND "), len(args))
+	rows, err := ps.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []*User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+//likeEscaper escapes the LIKE wildcards in search prefixes
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+//Search returns up to `limit` users with a user name, first name or
+//last name starting with `prefix`, ordered by rank and user name.
+//The prefix matches use the lower(...) text_pattern_ops indexes, and
+//the ranks in the CASE must match RankUserName, RankFirstName and
+//RankLastName. User names are compared with the "C" collation so
+//that the order matches the positions MemStore and clients see
+func (ps *PGStore) Search(prefix string, after *SearchPosition, limit int) ([]*SearchResult, error) {
+	results := []*SearchResult{}
+	prefix = normalizeSearch(prefix)
+	if len(prefix) == 0 {
+		return results, nil
+	}
+	pattern := likeEscaper.Replace(prefix) + "%"
+	rank, userName := -1, ""
+	if after != nil {
+		rank, userName = after.Rank, after.UserName
+	}
+	rows, err := ps.DB.Query(`SELECT `+userColumns+`, Rank FROM (
+		SELECT `+userColumns+`,
+			CASE WHEN lower(UserName) LIKE $1 THEN 0 WHEN lower(FirstName) LIKE $1 THEN 1 ELSE 2 END AS Rank
+		FROM users
+		WHERE (lower(UserName) LIKE $1 OR lower(FirstName) LIKE $1 OR lower(LastName) LIKE $1) AND DeletedAt IS NULL
+	) AS matches
+	WHERE (Rank, UserName COLLATE "C") > ($2, $3)
+	ORDER BY Rank, UserName COLLATE "C"
+	LIMIT $4`, pattern, rank, userName, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		result := &SearchResult{}
+		user, err := scanUser(rows, &result.Rank)
+		if err != nil {
+			return nil, err
+		}
+		result.User = user
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
 //GetByID returns the User with the given ID
 func (ps *PGStore) GetByID(id UserID) (*User, error) {
-	var user = &User{}
 	//Queries and then scans; error returned if the scan unsuccessful
-	err := ps.DB.QueryRow(`SELECT ID, Email, FirstName, LastName, PassHash, PhotoURL, UserName FROM users WHERE ID = $1`, id).Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.PassHash, &user.PhotoURL, &user.UserName)
-	if err == sql.ErrNoRows || err != nil {
-		return nil, err
-	}
-	return user, nil
+	return scanUser(ps.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE ID = $1`, id))
 }
 
-//GetByEmail returns the User with the given email
+//GetByEmail returns the User with the given email, however it's written
 func (ps *PGStore) GetByEmail(email string) (*User, error) {
-	var user = &User{}
-	err := ps.DB.QueryRow(`SELECT ID, Email, FirstName, LastName, PassHash, PhotoURL, UserName FROM users WHERE Email = $1`, email).Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.PassHash, &user.PhotoURL, &user.UserName)
-	if err == sql.ErrNoRows || err != nil {
-		return nil, err
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, ErrUserNotFound
 	}
-	return user, nil
+	return scanUser(ps.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE Email = $1`, email))
 }
 
-//GetByUserName returns the User with the given user name
+//GetByUserName returns the User with the user name `name`
 func (ps *PGStore) GetByUserName(name string) (*User, error) {
-	var user = &User{}
-	err := ps.DB.QueryRow(`SELECT ID, Email, FirstName, LastName, PassHash, PhotoURL, UserName FROM users WHERE UserName = $1`, name).Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.PassHash, &user.PhotoURL, &user.UserName)
-	if err == sql.ErrNoRows || err != nil {
-		return nil, err
-	}
-	return user, nil
+	return scanUser(ps.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE UserName = $1`, NormalizeUserName(name)))
+}
+
+//UserNameTaken reports whether a user has a user name that looks like `name`
+func (ps *PGStore) UserNameTaken(name string) (bool, error) {
+	var taken bool
+	err := ps.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE UserNameKey = $1)`, UserNameKey(name)).Scan(&taken)
+	return taken, err
 }
 
 //Insert inserts a new NewUser into the store
@@ -88,14 +204,17 @@ func (ps *PGStore) Insert(newUser *NewUser) (*User, error) {
 	if err != nil {
 		return nil, err
 	}
-	sql := `INSERT INTO users (email, passhash, username, firstname, lastname, photourl, mobilephone) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	sql := `INSERT INTO users (email, passhash, username, usernamekey, firstname, lastname, photourl, mobilephone, role) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
 	//Receives ONE row from the database
-	row := tx.QueryRow(sql, u.Email, u.PassHash, u.UserName, u.FirstName, u.LastName, u.PhotoURL, u.MobilePhone)
+	row := tx.QueryRow(sql, u.Email, u.PassHash, u.UserName, UserNameKey(u.UserName), u.FirstName, u.LastName, u.PhotoURL, u.MobilePhone, string(u.Role))
 	//scans the value of ID returned from query INTO the user
 	err = row.Scan(&u.ID)
 	//err if cant scan -- rollback transaction
 	if err != nil {
 		tx.Rollback()
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == userNameKeyIndex {
+			return nil, ErrUserNameTaken
+		}
 		return nil, err
 	}
 	//commits the transaction-- connection no longer reserved
@@ -110,9 +229,10 @@ func (ps *PGStore) Update(updates *UserUpdates, currentuser *User) error {
 	if err != nil {
 		return err
 	}
-	sql := `UPDATE users SET FirstName = $1, LastName = $2 WHERE id = $3`
+	//the phone is only changed if it was given
+	sql := `UPDATE users SET FirstName = $1, LastName = $2, MobilePhone = COALESCE($3, MobilePhone) WHERE id = $4`
 	//executes the sql query
-	_, err = tx.Exec(sql, updates.FirstName, updates.LastName, currentuser.ID)
+	_, err = tx.Exec(sql, updates.FirstName, updates.LastName, updates.MobilePhone, currentuser.ID)
 	//err if could not exec, rollback transaction
 	if err != nil {
 		tx.Rollback()
@@ -122,3 +242,180 @@ func (ps *PGStore) Update(updates *UserUpdates, currentuser *User) error {
 	tx.Commit()
 	return nil
 }
+
+//SetRole changes the role of the user with the ID `id`
+func (ps *PGStore) SetRole(id UserID, role Role) error {
+	if err := role.Validate(); err != nil {
+		return err
+	}
+	return ps.exec(`UPDATE users SET Role = $1 WHERE ID = $2`, string(role), id)
+}
+
+//SetDisabled disables or re-enables the user with the ID `id`
+func (ps *PGStore) SetDisabled(id UserID, disabled bool) error {
+	return ps.exec(`UPDATE users SET Disabled = $1 WHERE ID = $2`, disabled, id)
+}
+
+//SetPassHash replaces the password hash of the user with the ID `id`
+func (ps *PGStore) SetPassHash(id UserID, hash []byte) error {
+	return ps.exec(`UPDATE users SET PassHash = $1 WHERE ID = $2`, hash, id)
+}
+
+//RevokeSessions invalidates the sessions the user began before `at`
+func (ps *PGStore) RevokeSessions(id UserID, at time.Time) error {
+	return ps.exec(`UPDATE users SET SessionsRevokedAt = $1 WHERE ID = $2`, at, id)
+}
+
+//VerifyEmail marks the email address of the user
+//with the ID `id` as verified
+func (ps *PGStore) VerifyEmail(id UserID) error {
+	return ps.exec(`UPDATE users SET EmailVerified = true WHERE ID = $1`, id)
+}
+
+//MarkVerificationSent records that the user with the ID `id` was
+//sent a link to verify their email address at `at`
+func (ps *PGStore) MarkVerificationSent(id UserID, at time.Time) error {
+	return ps.exec(`UPDATE users SET VerificationSentAt = $1 WHERE ID = $2`, at, id)
+}
+
+//SetTwoFactor replaces the TOTP secret of the user with the ID `id`
+//and sets whether two-factor authentication is enabled
+func (ps *PGStore) SetTwoFactor(id UserID, secret string, enabled bool) error {
+	return ps.exec(`UPDATE users SET TOTPSecret = $1, TwoFactorEnabled = $2, TOTPLastStep = 0 WHERE ID = $3`,
+		secret, enabled && len(secret) > 0, id)
+}
+
+//UseTOTPStep records that the user with the ID `id` used the code
+//for the time step `step`. The step is only moved forward, so of
+//two requests using the same code at once, only one succeeds
+func (ps *PGStore) UseTOTPStep(id UserID, step int64) error {
+	res, err := ps.DB.Exec(`UPDATE users SET TOTPLastStep = $1 WHERE ID = $2 AND TOTPLastStep < $1`, step, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := ps.GetByID(id); err != nil {
+			return err
+		}
+		return ErrCodeUsed
+	}
+	return nil
+}
+
+//SetRecoveryCodes replaces the recovery codes of the user with the ID `id`
+func (ps *PGStore) SetRecoveryCodes(id UserID, hashes []string) error {
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE UserID = $1`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (UserID, Hash) VALUES ($1, $2)`, id, hash); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//UseRecoveryCode uses up the recovery code with the hash `hash`
+//of the user with the ID `id`
+func (ps *PGStore) UseRecoveryCode(id UserID, hash string) error {
+	res, err := ps.DB.Exec(`DELETE FROM recovery_codes WHERE UserID = $1 AND Hash = $2`, id, hash)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCodeUsed
+	}
+	return nil
+}
+
+//AddSecondFactorAttempt records an attempt by the user with the ID `id`
+//to give their second factor, returning how many they've made since `since`.
+//The count is incremented in a single statement, so attempts made at
+//once are all counted
+func (ps *PGStore) AddSecondFactorAttempt(id UserID, since time.Time) (int, error) {
+	var count int
+	err := ps.DB.QueryRow(`UPDATE users SET
+		SecondFactorAttempts = CASE WHEN SecondFactorAttemptsSince < $2 THEN 1 ELSE SecondFactorAttempts + 1 END,
+		SecondFactorAttemptsSince = CASE WHEN SecondFactorAttemptsSince < $2 THEN $3 ELSE SecondFactorAttemptsSince END
+		WHERE ID = $1 RETURNING SecondFactorAttempts`, id, since, time.Now()).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, ErrUserNotFound
+	}
+	return count, err
+}
+
+//ResetSecondFactorAttempts forgets the attempts the user
+//with the ID `id` has made to give their second factor
+func (ps *PGStore) ResetSecondFactorAttempts(id UserID) error {
+	return ps.exec(`UPDATE users SET SecondFactorAttempts = 0, SecondFactorAttemptsSince = 'epoch' WHERE ID = $1`, id)
+}
+
+//Delete marks the user with the ID `id` as deleted at `at`
+func (ps *PGStore) Delete(id UserID, at time.Time) error {
+	return ps.exec(`UPDATE users SET DeletedAt = $1 WHERE ID = $2`, at, id)
+}
+
+//Restore undoes Delete for a user that hasn't been purged yet
+func (ps *PGStore) Restore(id UserID) error {
+	return ps.exec(`UPDATE users SET DeletedAt = NULL WHERE ID = $1`, id)
+}
+
+//Purge permanently removes the users deleted before `before`. Their
+//messages, their link previews and their channel memberships go with them,
+//while the channels they created and the audit log entries about them are kept
+func (ps *PGStore) Purge(before time.Time) (int, error) {
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	//previews are keyed by "message:" and the message ID rather than
+	//referencing the message, so they aren't deleted by the cascade
+	_, err = tx.Exec(`DELETE FROM previews WHERE Owner IN (
+		SELECT 'message:' || m.ID FROM messages m JOIN users u ON m.CreatorID = u.ID WHERE u.DeletedAt < $1)`, before)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	res, err := tx.Exec(`DELETE FROM users WHERE DeletedAt < $1`, before)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+//exec runs an update of a single user,
+//returning ErrUserNotFound if there's no such user
+func (ps *PGStore) exec(query string, args ...interface{}) error {
+	res, err := ps.DB.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -2,7 +2,9 @@ package users
 
 import (
 	"database/sql"
+	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -31,6 +33,7 @@ func TestPostgresStore(t *testing.T) {
 		UserName:     "mrtester",
 		FirstName:    "test",
 		LastName:     "tester",
+		MobilePhone:  "206-555-0100",
 	}
 
 	//reset the auto increment counter and clears previous test users in the DB
@@ -58,6 +61,9 @@ func TestPostgresStore(t *testing.T) {
 	if user.ID != user2.ID {
 		t.Errorf("ID of user retrieved by ID does not match: expected %s but got %s\n", user.ID, user2.ID)
 	}
+	if user2.MobilePhone != newUser.MobilePhone {
+		t.Errorf("MobilePhone of user retrieved by ID does not match: expected %s but got %s\n", newUser.MobilePhone, user2.MobilePhone)
+	}
 	//getting any user with the given email
 	user2, err = store.GetByEmail(newUser.Email)
 	if err != nil {
@@ -75,9 +81,11 @@ func TestPostgresStore(t *testing.T) {
 		t.Errorf("ID of user retrieved by UserName does not match: expected %s but got %s\n", user.ID, user2.ID)
 	}
 
+	phone := "206-555-0199"
 	update := &UserUpdates{
-		FirstName: "UPDATED Test",
-		LastName:  "UPDATED Tester",
+		FirstName:   "UPDATED Test",
+		LastName:    "UPDATED Tester",
+		MobilePhone: &phone,
 	}
 	//updates the store with fields in update
 	if err = store.Update(update, user); err != nil {
@@ -96,6 +104,16 @@ func TestPostgresStore(t *testing.T) {
 	if user.LastName != update.LastName {
 		t.Errorf("LastName field not updated: expected `%s` but got `%s`\n", update.LastName, user.LastName)
 	}
+	if user.MobilePhone != phone {
+		t.Errorf("MobilePhone field not updated: expected `%s` but got `%s`\n", phone, user.MobilePhone)
+	}
+	//leaving the phone out keeps it
+	if err = store.Update(&UserUpdates{FirstName: "test", LastName: "tester"}, user); err != nil {
+		t.Errorf("Error updating user: %v\n", err)
+	}
+	if user, _ = store.GetByID(user.ID); user == nil || user.MobilePhone != phone {
+		t.Errorf("MobilePhone field should be kept when it isn't updated\n")
+	}
 
 	//gets all users in an array
 	all, err := store.GetAll()
@@ -108,5 +126,67 @@ func TestPostgresStore(t *testing.T) {
 	if all[0].ID != user.ID {
 		t.Errorf("ID of user retrieved by all does not match: expected %s but got %s\n", user.ID, all[0].ID)
 	}
+
+	//lists users a page at a time
+	page, err := store.List(nil, nil, 10)
+	if err != nil {
+		t.Errorf("error listing users: %v\n", err)
+	}
+	if len(page) != 1 || page[0].ID != user.ID {
+		t.Errorf("incorrect first page of users: %v\n", page)
+	}
+	page, err = store.List(nil, user.ID, 10)
+	if err != nil {
+		t.Errorf("error listing users: %v\n", err)
+	}
+	if len(page) != 0 {
+		t.Errorf("expected an empty page after the last user but got %d users\n", len(page))
+	}
+
+	//searches by prefix, ignoring case
+	results, err := store.Search(strings.ToUpper(user.UserName[:2]), nil, 10)
+	if err != nil {
+		t.Errorf("error searching users: %v\n", err)
+	}
+	if len(results) != 1 || results[0].User.ID != user.ID || results[0].Rank != RankUserName {
+		t.Errorf("incorrect search results: %v\n", results)
+	}
+	results, err = store.Search("%", nil, 10)
+	if err != nil {
+		t.Errorf("error searching users: %v\n", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("LIKE wildcards should be matched literally, but got %d results\n", len(results))
+	}
+
+	//new users start out unverified
+	if user.EmailVerified {
+		t.Errorf("new users should not have a verified email address\n")
+	}
+	sentAt := time.Now().Truncate(time.Second)
+	if err := store.MarkVerificationSent(user.ID, sentAt); err != nil {
+		t.Errorf("error marking verification sent: %v\n", err)
+	}
+	if err := store.VerifyEmail(user.ID); err != nil {
+		t.Errorf("error verifying email: %v\n", err)
+	}
+	if verified, err := store.GetByID(user.ID); err != nil || !verified.EmailVerified || !verified.VerificationSentAt.Equal(sentAt) {
+		t.Errorf("email verification was not saved: %v\n", err)
+	}
+
+	//deleted users are kept until they're purged
+	deletedAt := time.Now().Add(-time.Hour)
+	if err := store.Delete(user.ID, deletedAt); err != nil {
+		t.Errorf("error deleting user: %v\n", err)
+	}
+	if deleted, err := store.GetByID(user.ID); err != nil || deleted.DeletedAt == nil {
+		t.Errorf("deleted user should be kept with its deletion time: %v\n", err)
+	}
+	if n, err := store.Purge(deletedAt); err != nil || n != 0 {
+		t.Errorf("expected nothing to be purged but purged %d: %v\n", n, err)
+	}
+	if n, err := store.Purge(time.Now()); err != nil || n != 1 {
+		t.Errorf("expected 1 user to be purged but purged %d: %v\n", n, err)
+	}
 	_, err = psdb.Exec("DELETE FROM users")
 }
@@ -0,0 +1,72 @@
+package users
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	//DefaultGracePeriod is how long deleted accounts are kept, so
+	//that they can still be restored, before they are purged
+	DefaultGracePeriod = 30 * 24 * time.Hour
+	//DefaultPurgeInterval is how often the Purger looks for accounts to purge
+	DefaultPurgeInterval = time.Hour
+)
+
+//Purger periodically purges the accounts that were
+//deleted more than a grace period ago
+type Purger struct {
+	store       Store
+	gracePeriod time.Duration
+	done        chan struct{}
+	wg          sync.WaitGroup
+	closeOnce   sync.Once
+}
+
+//NewPurger starts purging the accounts in `store` deleted more
+//than `gracePeriod` ago, checking for them every `interval`
+func NewPurger(store Store, gracePeriod time.Duration, interval time.Duration) *Purger {
+	p := &Purger{
+		store:       store,
+		gracePeriod: gracePeriod,
+		done:        make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.run(interval)
+	return p
+}
+
+//Purge purges the accounts whose grace period is over now,
+//returning how many were purged
+func (p *Purger) Purge() (int, error) {
+	return p.store.Purge(time.Now().Add(-p.gracePeriod))
+}
+
+//Close stops the Purger, waiting for a purge in progress to finish
+func (p *Purger) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	p.wg.Wait()
+}
+
+//run purges accounts every `interval` until the Purger is closed
+func (p *Purger) run(interval time.Duration) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			n, err := p.Purge()
+			if err != nil {
+				log.Printf("error purging deleted users: %v", err)
+			} else if n > 0 {
+				log.Printf("purged %d deleted users", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package users
+
+import "errors"
+
+//Role is what a user is allowed to do
+type Role string
+
+//roles, from least to most privileged
+const (
+	//RoleUser is the role of ordinary users
+	RoleUser Role = "user"
+	//RoleModerator is the role of users who can disable and
+	//sign out ordinary users
+	RoleModerator Role = "moderator"
+	//RoleAdmin is the role of users who can do anything,
+	//including changing the roles of other users
+	RoleAdmin Role = "admin"
+)
+
+//ErrInvalidRole is returned for roles that don't exist
+var ErrInvalidRole = errors.New("role must be one of user, moderator or admin")
+
+//roleRanks orders the roles from least to most privileged
+var roleRanks = map[Role]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+//Validate returns an error if the role doesn't exist
+func (r Role) Validate() error {
+	if _, ok := roleRanks[r]; !ok {
+		return ErrInvalidRole
+	}
+	return nil
+}
+
+//AtLeast reports whether the role is as privileged as `other`.
+//Unknown roles, including the empty role of users created before
+//roles existed, are treated as RoleUser
+func (r Role) AtLeast(other Role) bool {
+	return roleRanks[r] >= roleRanks[other]
+}
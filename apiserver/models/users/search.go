@@ -0,0 +1,58 @@
+package users
+
+import (
+	"sort"
+	"strings"
+)
+
+//ranks of search matches, from best to worst. A user matching
+//on more than one field gets the best rank of those fields
+const (
+	//RankUserName is the rank of a match on the user name
+	RankUserName = iota
+	//RankFirstName is the rank of a match on the first name
+	RankFirstName
+	//RankLastName is the rank of a match on the last name
+	RankLastName
+)
+
+//SearchResult is a user that matched a search
+type SearchResult struct {
+	User *User
+	//Rank is how well the user matched, with lower being better
+	Rank int
+}
+
+//SearchPosition is the position of a search result. Results are
+//ordered by rank and then user name, and a page of results can be
+//started right after a given position
+type SearchPosition struct {
+	Rank     int    `json:"rank"`
+	UserName string `json:"userName"`
+}
+
+//Position returns the position of the search result
+func (sr *SearchResult) Position() *SearchPosition {
+	return &SearchPosition{Rank: sr.Rank, UserName: sr.User.UserName}
+}
+
+//before reports whether the result comes before the position `p`
+func (sr *SearchResult) before(p *SearchPosition) bool {
+	if sr.Rank != p.Rank {
+		return sr.Rank < p.Rank
+	}
+	return sr.User.UserName < p.UserName
+}
+
+//normalizeSearch normalizes a search prefix or a field being
+//searched, so that searches are case-insensitive
+func normalizeSearch(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+//sortResults sorts search results by rank and then user name
+func sortResults(results []*SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].before(results[j].Position())
+	})
+}
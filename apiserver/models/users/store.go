@@ -1,10 +1,17 @@
 package users
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 //ErrUserNotFound is returned when the requested user is not found in the store
 var ErrUserNotFound = errors.New("user not found")
 
+//ErrUserNameTaken is returned when inserting a user whose
+//user name looks like one another user already has
+var ErrUserNameTaken = errors.New("user name is already taken")
+
 //Store represents an abstract store for model.User objects.
 //This interface is used by the HTTP handlers to insert new users,
 //get users, and update users. This interface can be implemented
@@ -13,19 +20,126 @@ type Store interface {
 	//GetAll returns all users
 	GetAll() ([]*User, error)
 
+	//List returns up to `limit` users matching `filter` ordered by ID,
+	//starting after the user with the ID `after`, or from the first user
+	//if `after` is nil. A nil `filter` matches every user
+	List(filter *Filter, after UserID, limit int) ([]*User, error)
+
+	//Search returns up to `limit` users whose user name, first name or
+	//last name starts with `prefix`, ignoring case. Results are ordered
+	//by rank and then user name, starting after the position `after`,
+	//or from the best match if `after` is nil
+	Search(prefix string, after *SearchPosition, limit int) ([]*SearchResult, error)
+
 	//GetByID returns the User with the given ID
 	GetByID(id UserID) (*User, error)
 
-	//GetByEmail returns the User with the given email
+	//GetByEmail returns the User with the given email,
+	//comparing the emails' normalized forms
 	GetByEmail(email string) (*User, error)
 
-	//GetByUserName returns the User with the given user name
+	//GetByUserName returns the User with the given user name,
+	//comparing the names' normalized forms
 	GetByUserName(name string) (*User, error)
 
-	//Insert inserts a new NewUser into the store
-	//and returns a User with a newly-assigned ID
+	//UserNameTaken reports whether a user has a user name that looks
+	//like `name`, comparing the names' UserNameKeys
+	UserNameTaken(name string) (bool, error)
+
+	//Insert inserts a new NewUser into the store and returns a User with
+	//a newly-assigned ID, or ErrUserNameTaken if their user name is taken
 	Insert(newUser *NewUser) (*User, error)
 
 	//Update applies UserUpdates to the currentUser
 	Update(updates *UserUpdates, currentuser *User) error
+
+	//SetRole changes the role of the user with the ID `id`
+	SetRole(id UserID, role Role) error
+
+	//SetDisabled disables or re-enables the user with the ID `id`
+	SetDisabled(id UserID, disabled bool) error
+
+	//SetPassHash replaces the password hash of the user with the ID `id`
+	SetPassHash(id UserID, hash []byte) error
+
+	//RevokeSessions invalidates every session the user with
+	//the ID `id` began before `at`
+	RevokeSessions(id UserID, at time.Time) error
+
+	//VerifyEmail marks the email address of the user
+	//with the ID `id` as verified
+	VerifyEmail(id UserID) error
+
+	//MarkVerificationSent records that the user with the ID `id` was
+	//sent a link to verify their email address at `at`
+	MarkVerificationSent(id UserID, at time.Time) error
+
+	//SetTwoFactor replaces the TOTP secret of the user with the ID `id`
+	//and sets whether two-factor authentication is enabled, forgetting
+	//the last code used. An empty secret turns two-factor authentication off
+	SetTwoFactor(id UserID, secret string, enabled bool) error
+
+	//UseTOTPStep records that the user with the ID `id` used the code for
+	//the time step `step`, returning ErrCodeUsed if they've already used
+	//the code for this or a later step
+	UseTOTPStep(id UserID, step int64) error
+
+	//SetRecoveryCodes replaces the recovery codes of the user
+	//with the ID `id` with the codes with the hashes `hashes`
+	SetRecoveryCodes(id UserID, hashes []string) error
+
+	//UseRecoveryCode uses up the recovery code with the hash `hash`
+	//of the user with the ID `id`, returning ErrCodeUsed if they
+	//don't have that code, or have already used it
+	UseRecoveryCode(id UserID, hash string) error
+
+	//AddSecondFactorAttempt records an attempt by the user with the ID `id`
+	//to give their second factor, returning how many attempts they've made
+	//since `since`, counting this one. Attempts made before `since` are
+	//forgotten. The count is kept per user rather than per session, so
+	//signing in again doesn't reset it
+	AddSecondFactorAttempt(id UserID, since time.Time) (int, error)
+
+	//ResetSecondFactorAttempts forgets the attempts the user with the ID
+	//`id` has made to give their second factor
+	ResetSecondFactorAttempts(id UserID) error
+
+	//Delete marks the user with the ID `id` as deleted at `at`. Deleted
+	//users are left out of searches, and are kept until they're purged,
+	//so that they can be restored until then
+	Delete(id UserID, at time.Time) error
+
+	//Restore undoes Delete for a user that hasn't been purged yet
+	Restore(id UserID) error
+
+	//Purge permanently removes the users deleted before `before`,
+	//returning how many were purged
+	Purge(before time.Time) (int, error)
+}
+
+//Filter limits the users returned by Store.List
+type Filter struct {
+	//Role only includes users with this role, if it's set
+	Role Role
+	//Disabled only includes disabled or enabled users, if it's set
+	Disabled *bool
+	//Deleted only includes deleted or undeleted users, if it's set
+	Deleted *bool
+}
+
+//matches reports whether the user `u` passes the filter
+func (f *Filter) matches(u *User) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Role) > 0 && u.Role != f.Role {
+		return false
+	}
+	if f.Disabled != nil && u.Disabled != *f.Disabled {
+		return false
+	}
+	if f.Deleted != nil && (u.DeletedAt != nil) != *f.Deleted {
+		return false
+	}
+	return true
 }
@@ -0,0 +1,152 @@
+package users
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//TOTP parameters, as in RFC 6238. These are the defaults of every
+//authenticator app, so they're left out of otpauth URIs
+const (
+	//TOTPPeriod is how long each code is valid for
+	TOTPPeriod = 30 * time.Second
+	//TOTPDigits is the number of digits in each code
+	TOTPDigits = 6
+	//totpSkew is how many periods either side of the current one
+	//are accepted, to allow for clock drift and slow typists
+	totpSkew = 1
+	//totpSecretSize is the size of TOTP secrets in bytes,
+	//which RFC 4226 recommends be 160 bits
+	totpSecretSize = 20
+
+	//RecoveryCodeCount is how many recovery codes users are given
+	RecoveryCodeCount = 10
+	//recoveryCodeSize is the size of recovery codes in bytes
+	recoveryCodeSize = 5
+)
+
+//ErrCodeUsed is returned when a TOTP or recovery code has already been used
+var ErrCodeUsed = errors.New("code has already been used")
+
+//base32NoPadding is the encoding of TOTP secrets
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//TwoFactor is a user's two-factor authentication set-up. A user who has
+//started enrolling has a Secret, but two-factor authentication isn't
+//Enabled until they've confirmed it with a code from their app
+type TwoFactor struct {
+	//Secret is the base32 encoded TOTP secret
+	Secret  string `json:"-"`
+	Enabled bool   `json:"enabled"`
+	//LastStep is the time step of the last code used, so that
+	//codes can't be used more than once
+	LastStep int64 `json:"-"`
+}
+
+//NewTOTPSecret returns a new random base32 encoded TOTP secret
+func NewTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(buf), nil
+}
+
+//TOTPURI returns the otpauth URI for a TOTP secret, which authenticator
+//apps can be set up with, usually by scanning it as a QR code. `issuer`
+//names the service and `account` the user's account on it
+func TOTPURI(issuer string, account string, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+//TOTPStep returns the RFC 6238 time step at `at`
+func TOTPStep(at time.Time) int64 {
+	return at.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+//TOTPCode returns the code for the time step `step` of the secret
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	h := hmac.New(sha1.New, key)
+	h.Write(msg)
+	sum := h.Sum(nil)
+	//dynamic truncation, as in RFC 4226
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod), nil
+}
+
+//MatchTOTP returns the time step of the secret's code `code`
+//around `at`, or false if `code` isn't one of them
+func MatchTOTP(secret string, code string, at time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+	now := TOTPStep(at)
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+//NewRecoveryCodes returns a new set of random recovery codes to show
+//to the user, and the hashes of them to store. Recovery codes are
+//random enough that a fast hash is all they need
+func NewRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(buf))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+//HashRecoveryCode returns the hash of a recovery code,
+//ignoring case, spaces and dashes
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
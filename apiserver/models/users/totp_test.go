@@ -0,0 +1,87 @@
+package users
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	//the SHA1 test vectors from RFC 6238, truncated to six digits,
+	//with the secret "12345678901234567890" in base32
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		at := time.Unix(c.unix, 0)
+		code, err := TOTPCode(secret, TOTPStep(at))
+		if err != nil {
+			t.Fatalf("error generating code: %v\n", err)
+		}
+		if code != c.code {
+			t.Errorf("at %d: expected code %s but got %s\n", c.unix, c.code, code)
+		}
+		if step, ok := MatchTOTP(secret, c.code, at.Add(TOTPPeriod)); !ok || step != TOTPStep(at) {
+			t.Errorf("at %d: code from the previous period should match\n", c.unix)
+		}
+		if _, ok := MatchTOTP(secret, c.code, at.Add(3*TOTPPeriod)); ok {
+			t.Errorf("at %d: code from three periods ago should not match\n", c.unix)
+		}
+	}
+
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("error generating secret: %v\n", err)
+	}
+	uri := TOTPURI("Chat App", "alice@test.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Chat%20App:alice@test.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("incorrect otpauth URI: %s\n", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("error generating recovery codes: %v\n", err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("expected %d codes but got %d\n", RecoveryCodeCount, len(codes))
+	}
+	if HashRecoveryCode(strings.ToUpper(strings.Replace(codes[0], "-", " ", -1))) != hashes[0] {
+		t.Errorf("hashes should ignore case, spaces and dashes\n")
+	}
+
+	store := NewMemStore()
+	u, err := store.Insert(&NewUser{
+		Email:        "tfa@test.com",
+		UserName:     "tfa",
+		Password:     "password",
+		PasswordConf: "password",
+	})
+	if err != nil {
+		t.Fatalf("error inserting user: %v\n", err)
+	}
+	if err := store.SetRecoveryCodes(u.ID, hashes); err != nil {
+		t.Fatalf("error setting recovery codes: %v\n", err)
+	}
+	if err := store.UseRecoveryCode(u.ID, hashes[3]); err != nil {
+		t.Errorf("error using recovery code: %v\n", err)
+	}
+	if err := store.UseRecoveryCode(u.ID, hashes[3]); err != ErrCodeUsed {
+		t.Errorf("recovery codes should only be usable once, but got %v\n", err)
+	}
+	if err := store.UseTOTPStep(u.ID, 10); err != nil {
+		t.Errorf("error using TOTP step: %v\n", err)
+	}
+	if err := store.UseTOTPStep(u.ID, 10); err != ErrCodeUsed {
+		t.Errorf("TOTP steps should only be usable once, but got %v\n", err)
+	}
+}
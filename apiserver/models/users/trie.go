@@ -0,0 +1,109 @@
+package users
+
+//trie is a prefix tree of users, keyed by the normalized
+//fields that can be searched
+type trie struct {
+	root *trieNode
+}
+
+//trieNode is a node in a trie
+type trieNode struct {
+	children map[rune]*trieNode
+	//entries are the users with a field that ends at this node
+	entries map[trieEntry]bool
+}
+
+//trieEntry is a user and the rank of the field they were added by.
+//The same user can be at the same node more than once, such as when
+//their first and last names are the same
+type trieEntry struct {
+	user *User
+	rank int
+}
+
+//newTrie constructs an empty trie
+func newTrie() *trie {
+	return &trie{root: newTrieNode()}
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{
+		children: map[rune]*trieNode{},
+		entries:  map[trieEntry]bool{},
+	}
+}
+
+//add adds the user `u` under `key` with the rank `rank`
+func (t *trie) add(key string, u *User, rank int) {
+	key = normalizeSearch(key)
+	if len(key) == 0 {
+		return
+	}
+	node := t.root
+	for _, r := range key {
+		child, ok := node.children[r]
+		if !ok {
+			child = newTrieNode()
+			node.children[r] = child
+		}
+		node = child
+	}
+	node.entries[trieEntry{u, rank}] = true
+}
+
+//remove removes the user `u` added under `key` with the rank `rank`,
+//pruning any nodes that are left empty
+func (t *trie) remove(key string, u *User, rank int) {
+	key = normalizeSearch(key)
+	if len(key) == 0 {
+		return
+	}
+	path := []*trieNode{t.root}
+	node := t.root
+	for _, r := range key {
+		child, ok := node.children[r]
+		if !ok {
+			return
+		}
+		node = child
+		path = append(path, node)
+	}
+	delete(node.entries, trieEntry{u, rank})
+
+	runes := []rune(key)
+	for i := len(path) - 1; i > 0; i-- {
+		n := path[i]
+		if len(n.entries) > 0 || len(n.children) > 0 {
+			break
+		}
+		delete(path[i-1].children, runes[i-1])
+	}
+}
+
+//find returns every user with a field starting with `prefix`,
+//along with the best rank of the fields that matched
+func (t *trie) find(prefix string) map[*User]int {
+	found := map[*User]int{}
+	node := t.root
+	for _, r := range normalizeSearch(prefix) {
+		child, ok := node.children[r]
+		if !ok {
+			return found
+		}
+		node = child
+	}
+	node.collect(found)
+	return found
+}
+
+//collect adds the entries at and below this node to `found`
+func (n *trieNode) collect(found map[*User]int) {
+	for e := range n.entries {
+		if rank, ok := found[e.user]; !ok || e.rank < rank {
+			found[e.user] = e.rank
+		}
+	}
+	for _, child := range n.children {
+		child.collect(found)
+	}
+}
@@ -5,14 +5,11 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net/mail"
-	"os"
-
-	"golang.org/x/crypto/bcrypt"
+	"time"
 )
 
 //gravatarBasePhotoURL is the base URL for Gravatar profile photos
 const gravatarBasePhotoURL = "https://www.gravatar.com/avatar/"
-const cost = 10
 
 //UserID defines the type for user IDs
 type UserID interface{}
@@ -27,6 +24,21 @@ type User struct {
 	LastName    string `json:"lastName"`
 	PhotoURL    string `json:"photoURL"`
 	MobilePhone string `json:"mobilePhone"`
+	Role        Role   `json:"role"`
+	Disabled    bool   `json:"disabled"`
+	//EmailVerified is whether the user has proven that they own Email
+	EmailVerified bool `json:"emailVerified"`
+	//VerificationSentAt is when the user was last sent
+	//a link to verify their email address
+	VerificationSentAt time.Time `json:"-"`
+	//TwoFactor is the user's two-factor authentication set-up
+	TwoFactor TwoFactor `json:"twoFactor"`
+	//SessionsRevokedAt is when the user was last signed out everywhere.
+	//Sessions that began before this are no longer valid
+	SessionsRevokedAt time.Time `json:"-"`
+	//DeletedAt is when the user deleted their account, if they have.
+	//The account is purged once the grace period after this is over
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
 }
 
 //Credentials represents user sign-in credentials
@@ -44,55 +56,81 @@ type NewUser struct {
 	FirstName    string `json:"firstName"`
 	LastName     string `json:"lastName"`
 	MobilePhone  string `json:"mobilePhone"`
+	//Hasher hashes the password, and defaults to bcrypt
+	Hasher PasswordHasher `json:"-"`
 }
 
 //UserUpdates represents updates one can make to a user
 type UserUpdates struct {
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
+	//MobilePhone is left as it is if it's nil
+	MobilePhone *string `json:"mobilePhone,omitempty"`
 }
 
-//Validate validates the new user
+//Validate validates the new user, checking their
+//password against the DefaultPasswordPolicy
 func (nu *NewUser) Validate() error {
-	//ensure Email field is a valid Email
-	//HINT: use mail.ParseAddress()
-	//https://golang.org/pkg/net/mail/#ParseAddress
+	return nu.ValidateWith(DefaultPasswordPolicy)
+}
 
-	_, err := mail.ParseAddress(nu.Email)
-	if err != nil {
-		return err
+//ValidateWith validates the new user, checking their password against
+//`policy`. What's wrong with each field is returned as FieldErrors, but
+//other errors are returned if breached passwords couldn't be looked up
+func (nu *NewUser) ValidateWith(policy *PasswordPolicy) error {
+	errs := FieldErrors{}
+
+	//ensure Email field is a valid Email that can be normalized
+	_, parseErr := mail.ParseAddress(nu.Email)
+	if _, err := NormalizeEmail(nu.Email); parseErr != nil || err != nil {
+		errs.Add("email", "must be a valid email address")
 	}
 
-	//ensure Password is at least 6 chars
+	//ensure UserName has non-zero length, and isn't
+	//reserved or made to look like another name
+	if len(NormalizeUserName(nu.UserName)) <= 0 {
+		errs.Add("userName", "is required")
+	} else {
+		for _, problem := range CheckUserName(nu.UserName) {
+			errs.Add("userName", problem)
+		}
+	}
 
-	if len(nu.Password) < 6 {
-		return fmt.Errorf("password should be at least 6 characters")
+	//ensure Password follows the policy
+	problems, err := policy.Check(nu.Password, nu.UserName, nu.Email)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		errs.Add("password", problem)
 	}
 
 	//ensure Password and PasswordConf match
-
 	if nu.Password != nu.PasswordConf {
-		return fmt.Errorf("passwords do not match")
+		errs.Add("passwordConf", "does not match the password")
 	}
 
-	//ensure UserName has non-zero length
-
-	if len(nu.UserName) <= 0 {
-		return fmt.Errorf("missing username")
+	if len(errs) > 0 {
+		return errs
 	}
-
-	//if you made here, it's valid, so return nil
 	return nil
 }
 
 //ToUser converts the NewUser to a User
 func (nu *NewUser) ToUser() (*User, error) {
+	//emails and user names are stored normalized, so they can be
+	//looked up however they're written
+	email, err := NormalizeEmail(nu.Email)
+	if err != nil {
+		return nil, err
+	}
+
 	//build the Gravatar photo URL by creating an MD5
 	//hash of the new user's email address, converting
 	//that to a hex string, and appending it to their base URL:
 	//https://www.gravatar.com/avatar/ + hex-encoded md5 has of email
 	hash := md5.New()
-	emailByte := []byte(nu.Email)
+	emailByte := []byte(email)
 	hash.Write(emailByte)
 	md5Email := hex.EncodeToString(hash.Sum(nil))
 
@@ -104,11 +142,19 @@ func (nu *NewUser) ToUser() (*User, error) {
 
 	usr := &User{}
 	usr.PhotoURL = gravURL
+	usr.Role = RoleUser
 	userSetting(usr, nu)
+	usr.Email = email
+	usr.UserName = NormalizeUserName(nu.UserName)
 	//call the User's SetPassword() method to set the password,
 	//which will hash the plaintext password
-	usr.SetPassword(nu.Password)
-	//return the User and nil
+	hasher := nu.Hasher
+	if hasher == nil {
+		hasher = &BcryptHasher{}
+	}
+	if err := usr.SetPassword(hasher, nu.Password); err != nil {
+		return nil, err
+	}
 	return usr, nil
 }
 
@@ -122,18 +168,12 @@ func userSetting(u *User, nu *NewUser) {
 	u.MobilePhone = nu.MobilePhone
 }
 
-//SetPassword hashes the password and stores it in the PassHash field
-func (u *User) SetPassword(password string) error {
-	//hash the plaintext password using an adaptive
-	//crytographic hashing algorithm like bcrypt
-	//https://godoc.org/golang.org/x/crypto/bcrypt
-
-	//converting password to byte
-	bytePass := []byte(password)
-	passHash, err := bcrypt.GenerateFromPassword(bytePass, cost)
+//SetPassword hashes the password with `hasher`
+//and stores it in the PassHash field
+func (u *User) SetPassword(hasher PasswordHasher, password string) error {
+	passHash, err := hasher.Hash(password)
 	if err != nil {
-		fmt.Printf("error hashing password: %v", err)
-		os.Exit(1)
+		return fmt.Errorf("error hashing password: %v", err)
 	}
 	//set the User's PassHash field to the resulting hash
 	u.PassHash = passHash
@@ -141,10 +181,12 @@ func (u *User) SetPassword(password string) error {
 }
 
 //Authenticate compares the plaintext password against the stored hash
-//and returns an error if they don't match, or nil if they do
+//and returns an error if they don't match, or nil if they do. The hasher
+//is chosen by the format of the hash
 func (u *User) Authenticate(password string) error {
-	//compare the plaintext password with the PassHash field
-	//using the same hashing algorithm you used in SetPassword
-	bytePass := []byte(password)
-	return bcrypt.CompareHashAndPassword(u.PassHash, bytePass)
+	hasher, err := hasherFor(u.PassHash)
+	if err != nil {
+		return err
+	}
+	return hasher.Compare(u.PassHash, password)
 }
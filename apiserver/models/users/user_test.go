@@ -68,7 +68,7 @@ func TestNewUserToUser(t *testing.T) {
 
 func TestSetPassword(t *testing.T) {
 	u := &User{}
-	if err := u.SetPassword("password"); err != nil {
+	if err := u.SetPassword(&BcryptHasher{}, "password"); err != nil {
 		t.Errorf("error setting password: %s\n", err.Error())
 	}
 	if len(u.PassHash) == 0 {
@@ -81,7 +81,7 @@ func TestSetPassword(t *testing.T) {
 
 func TestAuthenticate(t *testing.T) {
 	u := &User{}
-	if err := u.SetPassword("password"); err != nil {
+	if err := u.SetPassword(&BcryptHasher{}, "password"); err != nil {
 		t.Errorf("error setting password: %s\n", err.Error())
 	}
 	if err := u.Authenticate("password"); err != nil {
@@ -94,7 +94,7 @@ func TestAuthenticate(t *testing.T) {
 
 func TestNoPassHashInJSON(t *testing.T) {
 	u := &User{}
-	if err := u.SetPassword("password"); err != nil {
+	if err := u.SetPassword(&BcryptHasher{}, "password"); err != nil {
 		t.Errorf("error setting password: %s\n", err.Error())
 	}
 	j, err := json.Marshal(u)
@@ -106,3 +106,30 @@ func TestNoPassHashInJSON(t *testing.T) {
 		t.Errorf("PassHash field was encoded into JSON; should not be present in encoded JSON\n")
 	}
 }
+
+func TestRoles(t *testing.T) {
+	cases := []struct {
+		role    Role
+		other   Role
+		atLeast bool
+	}{
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleModerator, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{"", RoleUser, true},
+		{"", RoleModerator, false},
+	}
+	for _, c := range cases {
+		if got := c.role.AtLeast(c.other); got != c.atLeast {
+			t.Errorf("%q.AtLeast(%q): expected %t but got %t\n", c.role, c.other, c.atLeast, got)
+		}
+	}
+	if err := Role("superuser").Validate(); err != ErrInvalidRole {
+		t.Errorf("expected ErrInvalidRole for an unknown role but got %v\n", err)
+	}
+	if err := RoleModerator.Validate(); err != nil {
+		t.Errorf("unexpected error validating a role: %v\n", err)
+	}
+}
@@ -0,0 +1,32 @@
+package users
+
+import "fmt"
+
+//PublicUser is the view of a user that anyone can see. It leaves out
+//contact details like the email address and mobile phone number, which
+//only the user themselves can see in the full User
+type PublicUser struct {
+	ID        UserID `json:"id"`
+	UserName  string `json:"userName"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	PhotoURL  string `json:"photoURL"`
+}
+
+//Public returns the public view of the user
+func (u *User) Public() *PublicUser {
+	return &PublicUser{
+		ID:        u.ID,
+		UserName:  u.UserName,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		PhotoURL:  u.PhotoURL,
+	}
+}
+
+//IsSelf reports whether `other` is the same user as `u`. IDs are
+//compared loosely, since an ID that has been through JSON can have
+//a different type than the one from the store
+func (u *User) IsSelf(other *User) bool {
+	return u != nil && other != nil && fmt.Sprint(u.ID) == fmt.Sprint(other.ID)
+}
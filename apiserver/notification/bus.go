@@ -0,0 +1,62 @@
+package notification
+
+import "sync"
+
+//Bus delivers the events published on any apiserver instance to the
+//subscribers on every instance, so that clients connected to one
+//instance are notified of things that happened on the others
+type Bus interface {
+	//Publish publishes the event to the subscribers on every instance
+	Publish(event *Event) error
+
+	//Subscribe adds a function that is called with each event published.
+	//Calls to `handler` are never concurrent with each other
+	Subscribe(handler func(*Event))
+
+	//Close stops delivering events and releases the bus's resources
+	Close() error
+}
+
+//subscribers is the list of subscribed handlers, shared by the Bus implementations
+type subscribers struct {
+	handlers []func(*Event)
+	mx       sync.Mutex
+}
+
+//Subscribe adds a handler
+func (s *subscribers) Subscribe(handler func(*Event)) {
+	s.mx.Lock()
+	s.handlers = append(s.handlers, handler)
+	s.mx.Unlock()
+}
+
+//deliver calls each handler with the event, one event at a time
+func (s *subscribers) deliver(event *Event) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for _, handler := range s.handlers {
+		handler(event)
+	}
+}
+
+//LocalBus is a Bus that only delivers events within this process,
+//for when only one apiserver instance is running
+type LocalBus struct {
+	subscribers
+}
+
+//NewLocalBus constructs a new LocalBus
+func NewLocalBus() *LocalBus {
+	return &LocalBus{}
+}
+
+//Publish delivers the event to the subscribers before returning
+func (lb *LocalBus) Publish(event *Event) error {
+	lb.deliver(event)
+	return nil
+}
+
+//Close does nothing, since a LocalBus holds no resources
+func (lb *LocalBus) Close() error {
+	return nil
+}
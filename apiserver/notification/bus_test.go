@@ -0,0 +1,134 @@
+package notification
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	redis "gopkg.in/redis.v5"
+)
+
+//fakeSubscription is a subscription that returns its messages and then
+//either fails, as if the connection was lost, or blocks until closed
+type fakeSubscription struct {
+	messages []*redis.Message
+	fail     bool
+	closed   chan struct{}
+}
+
+func newFakeSubscription(fail bool, payloads ...string) *fakeSubscription {
+	fs := &fakeSubscription{fail: fail, closed: make(chan struct{})}
+	for _, p := range payloads {
+		fs.messages = append(fs.messages, &redis.Message{Channel: DefaultRedisChannel, Payload: p})
+	}
+	return fs
+}
+
+func (fs *fakeSubscription) ReceiveMessage() (*redis.Message, error) {
+	if len(fs.messages) > 0 {
+		msg := fs.messages[0]
+		fs.messages = fs.messages[1:]
+		return msg, nil
+	}
+	if !fs.fail {
+		<-fs.closed
+	}
+	return nil, errors.New("connection lost")
+}
+
+func (fs *fakeSubscription) Close() error {
+	select {
+	case <-fs.closed:
+	default:
+		close(fs.closed)
+	}
+	return nil
+}
+
+//collect subscribes to the bus and returns the channel events are delivered to
+func collect(bus Bus) chan *Event {
+	events := make(chan *Event, 10)
+	bus.Subscribe(func(e *Event) {
+		events <- e
+	})
+	return events
+}
+
+//expectEvent waits for an event of the given type
+func expectEvent(t *testing.T, events chan *Event, eventType string) {
+	select {
+	case e := <-events:
+		if e.Type != eventType {
+			t.Errorf("expected a %s event but got %s\n", eventType, e.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for a %s event\n", eventType)
+	}
+}
+
+func TestLocalBus(t *testing.T) {
+	bus := NewLocalBus()
+	events := collect(bus)
+	event, _ := NewEvent(EventUserNew, nil)
+	if err := bus.Publish(event); err != nil {
+		t.Fatalf("error publishing: %v\n", err)
+	}
+	expectEvent(t, events, EventUserNew)
+}
+
+func TestRedisBusResubscribes(t *testing.T) {
+	subs := []*fakeSubscription{
+		newFakeSubscription(true, `{"type":"user-new","payload":null}`, `not json`),
+		newFakeSubscription(false, `{"type":"message-new","payload":{}}`),
+	}
+	subscribed := 0
+	rb := &RedisBus{
+		channel: DefaultRedisChannel,
+		subscribe: func(channel string) (subscription, error) {
+			if subscribed == len(subs) {
+				return nil, errors.New("no more subscriptions")
+			}
+			subscribed++
+			return subs[subscribed-1], nil
+		},
+	}
+	events := collect(rb)
+	rb.start()
+
+	expectEvent(t, events, EventUserNew)
+	//the invalid message is skipped, then the lost connection is resubscribed
+	expectEvent(t, events, EventMessageNew)
+	if err := rb.Close(); err != nil {
+		t.Errorf("error closing: %v\n", err)
+	}
+	if subscribed != 2 {
+		t.Errorf("expected 2 subscriptions but got %d\n", subscribed)
+	}
+}
+
+//TestRedisBus uses the REDISADDR environment variable for the
+//redis server address, or a local instance of redis if not defined
+func TestRedisBus(t *testing.T) {
+	redisAddr := os.Getenv("REDISADDR")
+	if len(redisAddr) == 0 {
+		redisAddr = "127.0.0.1:6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: redisAddr})
+	defer client.Close()
+
+	//two buses on the same channel, as if on two instances
+	publisher := NewRedisBus(client, DefaultRedisChannel)
+	defer publisher.Close()
+	subscriber := NewRedisBus(client, DefaultRedisChannel)
+	defer subscriber.Close()
+	events := collect(subscriber)
+	//give the subscriptions time to be set up
+	time.Sleep(100 * time.Millisecond)
+
+	event, _ := NewEvent(EventMessageDelete, map[string]string{"id": "1"})
+	if err := publisher.Publish(event); err != nil {
+		t.Fatalf("error publishing: %v\n", err)
+	}
+	expectEvent(t, events, EventMessageDelete)
+}
@@ -0,0 +1,63 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//Event types sent to clients
+const (
+	//EventUserNew is sent when a new user signs up
+	EventUserNew = "user-new"
+	//EventMessageNew is sent when a message is posted
+	EventMessageNew = "message-new"
+	//EventMessageUpdate is sent when a message is edited
+	EventMessageUpdate = "message-update"
+	//EventMessageDelete is sent when a message is deleted
+	EventMessageDelete = "message-delete"
+	//EventDisconnect is never sent to clients. It tells every Notifier to
+	//disconnect its recipients, such as users who were signed out everywhere
+	EventDisconnect = "disconnect"
+	//EventTokenDenied is never sent to clients. It tells every instance
+	//about an access token that was put on the denylist
+	EventTokenDenied = "token-denied"
+)
+
+//Event is a notification sent to clients, such as a new message.
+//The payload is whatever the event is about, already encoded as JSON
+type Event struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	//Recipients are the IDs of the only users the event is sent to,
+	//such as the members of a private channel. If empty, the event
+	//is sent to everyone. Recipients are never sent to clients
+	Recipients []string `json:"recipients,omitempty"`
+}
+
+//clientEvent is the part of an Event that is sent to clients
+type clientEvent struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+//NewEvent constructs a new Event of the given type,
+//encoding `payload` as its JSON payload
+func NewEvent(eventType string, payload interface{}) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{Type: eventType, Payload: data}, nil
+}
+
+//AddRecipient limits the event to the given user, along with any other
+//recipients already added
+func (e *Event) AddRecipient(userID interface{}) {
+	e.Recipients = append(e.Recipients, recipientKey(userID))
+}
+
+//recipientKey returns the form of a user ID used in Recipients. User IDs
+//can be strings or numbers, so they are compared as strings
+func recipientKey(userID interface{}) string {
+	return fmt.Sprint(userID)
+}
@@ -0,0 +1,195 @@
+package notification
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	//sendQueueSize is how many events can be waiting to be written to
+	//one client. A client that falls this far behind is disconnected
+	sendQueueSize = 64
+	//writeWait is how long we wait for a write to a client to complete
+	writeWait = 10 * time.Second
+	//pongWait is how long we wait to hear from a client before giving up
+	pongWait = 60 * time.Second
+	//pingPeriod is how often we ping clients, which must be less than pongWait
+	pingPeriod = pongWait * 9 / 10
+	//maxReadSize is the largest message we read from clients. Clients
+	//don't send us anything but control messages, so this is small
+	maxReadSize = 512
+)
+
+//Notifier fans out events to all of the connected WebSocket clients.
+//Each client has its own buffered queue of events and its own goroutine
+//writing them, so one slow client never holds up the others. Clients that
+//stop reading, and so let their queue fill up, are disconnected
+type Notifier struct {
+	clients map[*client]bool
+	mx      sync.RWMutex
+}
+
+//client is one connected WebSocket client
+type client struct {
+	conn *websocket.Conn
+	//userID is the recipientKey of the signed-in user
+	userID string
+	//send is the client's queue of encoded events waiting to be written
+	send chan []byte
+	//closeOnce ensures the send queue is only closed once
+	closeOnce sync.Once
+}
+
+//NewNotifier constructs a new Notifier
+func NewNotifier() *Notifier {
+	return &Notifier{
+		clients: make(map[*client]bool),
+	}
+}
+
+//AddClient adds a new client connection for the signed-in user to the
+//notifier, and starts the goroutines that write events and pings to it
+//and read its pongs. The connection is closed and removed when the client
+//disconnects or falls behind
+func (n *Notifier) AddClient(conn *websocket.Conn, userID interface{}) {
+	c := &client{
+		conn:   conn,
+		userID: recipientKey(userID),
+		send:   make(chan []byte, sendQueueSize),
+	}
+	n.mx.Lock()
+	n.clients[c] = true
+	n.mx.Unlock()
+
+	go n.writePump(c)
+	go n.readPump(c)
+}
+
+//ClientCount returns the number of connected clients
+func (n *Notifier) ClientCount() int {
+	n.mx.RLock()
+	defer n.mx.RUnlock()
+	return len(n.clients)
+}
+
+//Notify queues the event to be sent to every connected client of its
+//recipients, or to every client if it has none. It never blocks
+//waiting for a client
+func (n *Notifier) Notify(event *Event) error {
+	if event.Type == EventDisconnect {
+		for _, userID := range event.Recipients {
+			n.Disconnect(userID)
+		}
+		return nil
+	}
+	if event.Type == EventTokenDenied {
+		return nil
+	}
+	data, err := json.Marshal(&clientEvent{Type: event.Type, Payload: event.Payload})
+	if err != nil {
+		return err
+	}
+	var recipients map[string]bool
+	if len(event.Recipients) > 0 {
+		recipients = make(map[string]bool, len(event.Recipients))
+		for _, r := range event.Recipients {
+			recipients[r] = true
+		}
+	}
+	var slow []*client
+	n.mx.RLock()
+	for c := range n.clients {
+		if recipients != nil && !recipients[c.userID] {
+			continue
+		}
+		select {
+		case c.send <- data:
+		default:
+			slow = append(slow, c)
+		}
+	}
+	n.mx.RUnlock()
+	for _, c := range slow {
+		n.removeClient(c)
+	}
+	return nil
+}
+
+//Disconnect closes every connection of the user with the ID `userID`,
+//such as when their account is disabled or deleted
+func (n *Notifier) Disconnect(userID interface{}) {
+	key := recipientKey(userID)
+	var found []*client
+	n.mx.RLock()
+	for c := range n.clients {
+		if c.userID == key {
+			found = append(found, c)
+		}
+	}
+	n.mx.RUnlock()
+	for _, c := range found {
+		n.removeClient(c)
+	}
+}
+
+//removeClient removes the client and closes its send queue,
+//which tells its writePump to close the connection
+func (n *Notifier) removeClient(c *client) {
+	n.mx.Lock()
+	delete(n.clients, c)
+	n.mx.Unlock()
+	c.closeOnce.Do(func() {
+		close(c.send)
+	})
+}
+
+//writePump writes the events queued for the client, and pings the
+//client periodically, until the queue is closed or a write fails
+func (n *Notifier) writePump(c *client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				//we closed the queue, so say goodbye
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				n.removeClient(c)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				n.removeClient(c)
+				return
+			}
+		}
+	}
+}
+
+//readPump reads from the client so that pongs and close messages are
+//processed, and removes the client once it stops responding or disconnects
+func (n *Notifier) readPump(c *client) {
+	defer n.removeClient(c)
+	c.conn.SetReadLimit(maxReadSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
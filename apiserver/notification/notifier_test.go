@@ -0,0 +1,168 @@
+package notification
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//newTestServer starts a server that upgrades connections and passes them to `add`
+func newTestServer(t *testing.T, add func(*websocket.Conn)) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("error upgrading: %v\n", err)
+			return
+		}
+		add(conn)
+	}))
+}
+
+//dial connects a WebSocket client to the test server
+func dial(t *testing.T, server *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("error dialing: %v\n", err)
+	}
+	return conn
+}
+
+//waitForClients waits for the notifier to have `count` clients
+func waitForClients(t *testing.T, n *Notifier, count int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for n.ClientCount() != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d clients but have %d\n", count, n.ClientCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	n := NewNotifier()
+	userIDs := make(chan int, 3)
+	server := newTestServer(t, func(conn *websocket.Conn) {
+		n.AddClient(conn, <-userIDs)
+	})
+	defer server.Close()
+
+	userIDs <- 1
+	userIDs <- 2
+	conns := []*websocket.Conn{dial(t, server), dial(t, server)}
+	waitForClients(t, n, 2)
+
+	event, err := NewEvent(EventMessageNew, map[string]string{"body": "hello"})
+	if err != nil {
+		t.Fatalf("error creating event: %v\n", err)
+	}
+	if err := n.Notify(event); err != nil {
+		t.Fatalf("error notifying: %v\n", err)
+	}
+	for i, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		received := &Event{}
+		if err := conn.ReadJSON(received); err != nil {
+			t.Fatalf("client %d: error reading event: %v\n", i, err)
+		}
+		if received.Type != EventMessageNew || string(received.Payload) != `{"body":"hello"}` {
+			t.Errorf("client %d: incorrect event: %s %s\n", i, received.Type, received.Payload)
+		}
+	}
+
+	//events with recipients only go to those users' clients
+	private, _ := NewEvent(EventMessageNew, map[string]string{"body": "psst"})
+	private.AddRecipient(2)
+	//denied tokens are for other instances, not clients
+	n.Notify(&Event{Type: EventTokenDenied, Payload: []byte(`{}`)})
+	n.Notify(private)
+	n.Notify(event)
+	for i, expected := range []string{`{"body":"hello"}`, `{"body":"psst"}`} {
+		conns[i].SetReadDeadline(time.Now().Add(5 * time.Second))
+		received := &Event{}
+		if err := conns[i].ReadJSON(received); err != nil {
+			t.Fatalf("client %d: error reading event: %v\n", i, err)
+		}
+		if string(received.Payload) != expected {
+			t.Errorf("client %d: expected %s but got %s\n", i, expected, received.Payload)
+		}
+		if len(received.Recipients) > 0 {
+			t.Errorf("client %d: recipients were sent to the client\n", i)
+		}
+	}
+
+	//clients that disconnect are removed
+	conns[0].Close()
+	waitForClients(t, n, 1)
+	conns[1].Close()
+	waitForClients(t, n, 0)
+}
+
+func TestSlowClientEvicted(t *testing.T) {
+	n := NewNotifier()
+	serverConns := make(chan *websocket.Conn, 1)
+	server := newTestServer(t, func(conn *websocket.Conn) {
+		serverConns <- conn
+	})
+	defer server.Close()
+	clientConn := dial(t, server)
+	defer clientConn.Close()
+
+	//a client whose queue is never written out, as if its writes were stuck
+	c := &client{
+		conn: <-serverConns,
+		send: make(chan []byte, sendQueueSize),
+	}
+	n.clients[c] = true
+
+	event, _ := NewEvent(EventUserNew, nil)
+	for i := 0; i <= sendQueueSize; i++ {
+		n.Notify(event)
+	}
+	if n.ClientCount() != 0 {
+		t.Errorf("slow client was not evicted\n")
+	}
+	//the queue is closed once the queued events are drained
+	for range c.send {
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	n := NewNotifier()
+	userIDs := make(chan int, 3)
+	server := newTestServer(t, func(conn *websocket.Conn) {
+		n.AddClient(conn, <-userIDs)
+	})
+	defer server.Close()
+
+	userIDs <- 1
+	userIDs <- 1
+	userIDs <- 2
+	conns := []*websocket.Conn{dial(t, server), dial(t, server), dial(t, server)}
+	for _, conn := range conns {
+		defer conn.Close()
+	}
+	waitForClients(t, n, 3)
+
+	//a disconnect event with no recipients disconnects no one
+	n.Notify(&Event{Type: EventDisconnect})
+	if n.ClientCount() != 3 {
+		t.Errorf("expected 3 clients but have %d\n", n.ClientCount())
+	}
+	event := &Event{Type: EventDisconnect}
+	event.AddRecipient(1)
+	n.Notify(event)
+	waitForClients(t, n, 1)
+
+	//both of user 1's connections are closed
+	for i, conn := range conns[:2] {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNoStatusReceived, websocket.CloseNormalClosure) {
+			t.Errorf("client %d: expected the connection to be closed but got %v\n", i, err)
+		}
+	}
+}
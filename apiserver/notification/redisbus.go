@@ -0,0 +1,146 @@
+package notification
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	redis "gopkg.in/redis.v5"
+)
+
+const (
+	//DefaultRedisChannel is the redis channel events are published to
+	DefaultRedisChannel = "apiserver:events"
+	//minResubscribeWait is how long we wait before the first attempt
+	//to resubscribe after losing the connection to redis
+	minResubscribeWait = 100 * time.Millisecond
+	//maxResubscribeWait is the longest we wait between attempts to resubscribe
+	maxResubscribeWait = 10 * time.Second
+)
+
+//subscription is the part of a *redis.PubSub the RedisBus uses
+type subscription interface {
+	ReceiveMessage() (*redis.Message, error)
+	Close() error
+}
+
+//RedisBus is a Bus that publishes events to a redis pub/sub channel,
+//which every instance subscribes to. Events published by an instance
+//reach its own subscribers through redis too, just like everyone else's.
+//If the subscription fails, for example because redis restarted, the
+//RedisBus resubscribes, waiting a little longer after each failed attempt
+type RedisBus struct {
+	subscribers
+	client  *redis.Client
+	channel string
+	//subscribe subscribes to the redis channel, and is replaced in tests
+	subscribe func(channel string) (subscription, error)
+
+	mx     sync.Mutex
+	sub    subscription
+	closed bool
+	done   chan struct{}
+}
+
+//NewRedisBus constructs a new RedisBus that publishes to and
+//subscribes to the given redis channel, and starts receiving events
+func NewRedisBus(client *redis.Client, channel string) *RedisBus {
+	rb := &RedisBus{
+		client:  client,
+		channel: channel,
+		subscribe: func(channel string) (subscription, error) {
+			return client.Subscribe(channel)
+		},
+	}
+	rb.start()
+	return rb
+}
+
+//start starts the goroutine that receives events
+func (rb *RedisBus) start() {
+	rb.done = make(chan struct{})
+	go rb.receive()
+}
+
+//Publish publishes the event to the redis channel
+func (rb *RedisBus) Publish(event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return rb.client.Publish(rb.channel, string(data)).Err()
+}
+
+//Close stops receiving events and waits for the receiving goroutine to finish
+func (rb *RedisBus) Close() error {
+	rb.mx.Lock()
+	rb.closed = true
+	var err error
+	if rb.sub != nil {
+		//unblocks ReceiveMessage
+		err = rb.sub.Close()
+	}
+	rb.mx.Unlock()
+	<-rb.done
+	return err
+}
+
+//isClosed reports whether Close has been called
+func (rb *RedisBus) isClosed() bool {
+	rb.mx.Lock()
+	defer rb.mx.Unlock()
+	return rb.closed
+}
+
+//receive subscribes to the redis channel and delivers the events received,
+//resubscribing whenever the subscription fails, until the bus is closed
+func (rb *RedisBus) receive() {
+	defer close(rb.done)
+	wait := minResubscribeWait
+	for {
+		sub, err := rb.subscribe(rb.channel)
+		if err == nil {
+			rb.mx.Lock()
+			if rb.closed {
+				rb.mx.Unlock()
+				sub.Close()
+				return
+			}
+			rb.sub = sub
+			rb.mx.Unlock()
+			if rb.receiveFrom(sub) {
+				//messages were received, so start over with short waits
+				wait = minResubscribeWait
+			}
+			sub.Close()
+		}
+		if rb.isClosed() {
+			return
+		}
+		log.Printf("lost redis subscription to %s, resubscribing in %v", rb.channel, wait)
+		time.Sleep(wait)
+		if wait *= 2; wait > maxResubscribeWait {
+			wait = maxResubscribeWait
+		}
+	}
+}
+
+//receiveFrom delivers the events received from the subscription until it
+//fails, and reports whether any messages were received
+func (rb *RedisBus) receiveFrom(sub subscription) bool {
+	received := false
+	for {
+		msg, err := sub.ReceiveMessage()
+		if err != nil {
+			return received
+		}
+		received = true
+		event := &Event{}
+		if err := json.Unmarshal([]byte(msg.Payload), event); err != nil {
+			log.Printf("ignoring invalid event on %s: %v", rb.channel, err)
+			continue
+		}
+		rb.deliver(event)
+	}
+}
@@ -0,0 +1,16 @@
+/*
+Package oidc signs users in with external OpenID Connect identity
+providers, as a relying party using the authorization code flow with PKCE.
+
+A Provider is created from a Config with NewProvider, which looks up the
+provider's endpoints with OpenID Connect discovery. AuthCodeURL returns the
+address to send users to, Exchange trades the code they come back with for
+tokens, and VerifyIDToken checks the ID token against the provider's
+published keys, returning the claims it makes about the user. Keeping track
+of the state, nonce and PKCE verifier between the two requests is up to
+the caller.
+
+Only ID tokens signed with RS256 or ES256 are accepted. The oidctest
+package has a mock provider for tests.
+*/
+package oidc
@@ -0,0 +1,158 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+//clockSkew is how far the provider's clock is allowed to be off from ours
+const clockSkew = time.Minute
+
+//ErrInvalidToken is returned for ID tokens that can't be trusted
+var ErrInvalidToken = errors.New("invalid ID token")
+
+//Claims are the claims an ID token makes about a user
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	AuthorizedBy  string   `json:"azp"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+	GivenName     string   `json:"given_name"`
+	FamilyName    string   `json:"family_name"`
+	UserName      string   `json:"preferred_username"`
+	Picture       string   `json:"picture"`
+}
+
+//audience is the `aud` claim, which can be a string or an array of strings
+type audience []string
+
+//UnmarshalJSON decodes a string or array of strings
+func (a *audience) UnmarshalJSON(buf []byte) error {
+	var s string
+	if err := json.Unmarshal(buf, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(buf, &ss); err != nil {
+		return err
+	}
+	*a = audience(ss)
+	return nil
+}
+
+//contains reports whether `clientID` is one of the audiences
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+//header is the JOSE header of an ID token
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+//VerifyIDToken verifies the signature of an ID token against the
+//provider's keys, checks that it was issued by the provider for us, hasn't
+//expired, and has the nonce `nonce`, and returns the claims it makes
+func (p *Provider) VerifyIDToken(raw string, nonce string) (*Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	h := &header{}
+	if err := decodeSegment(parts[0], h); err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, err := p.keys.key(h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(h.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	now := time.Now()
+	switch {
+	case claims.Issuer != p.endpoints.Issuer:
+		return nil, fmt.Errorf("%v: issued by %q", ErrInvalidToken, claims.Issuer)
+	case !claims.Audience.contains(p.config.ClientID):
+		return nil, fmt.Errorf("%v: not issued for us", ErrInvalidToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedBy != p.config.ClientID:
+		return nil, fmt.Errorf("%v: not authorized for us", ErrInvalidToken)
+	case now.Add(-clockSkew).Unix() > claims.Expiry:
+		return nil, fmt.Errorf("%v: expired", ErrInvalidToken)
+	case claims.IssuedAt > now.Add(clockSkew).Unix():
+		return nil, fmt.Errorf("%v: issued in the future", ErrInvalidToken)
+	case len(claims.Subject) == 0:
+		return nil, fmt.Errorf("%v: no subject", ErrInvalidToken)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%v: wrong nonce", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+//verifySignature verifies the signature of `signed` with the algorithm
+//`alg`. Only RS256 and ES256 are accepted, and the key must match the
+//algorithm, so that a token can't choose a weaker way to be checked
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	sum := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) != nil {
+			return ErrInvalidToken
+		}
+		return nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return ErrInvalidToken
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, sum[:], r, s) {
+			return ErrInvalidToken
+		}
+		return nil
+	}
+	return fmt.Errorf("%v: unsupported algorithm %q", ErrInvalidToken, alg)
+}
+
+//decodeSegment decodes a base64url encoded JSON segment of a token
+func decodeSegment(seg string, v interface{}) error {
+	buf, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
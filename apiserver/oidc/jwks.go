@@ -0,0 +1,140 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+)
+
+//minKeyRefresh is the least time between fetches of a provider's keys,
+//so that tokens with made-up key IDs can't make us hammer the provider
+const minKeyRefresh = time.Minute
+
+//errUnknownKey is returned for tokens signed with a key the provider
+//doesn't publish
+var errUnknownKey = errors.New("token was signed with an unknown key")
+
+//jwk is a JSON Web Key, as published in a JWKS document
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+//jwks is a JWKS document
+type jwks struct {
+	Keys []*jwk `json:"keys"`
+}
+
+//keySet caches the signing keys a provider publishes. Providers rotate
+//their keys, so the keys are fetched again when a token is signed with
+//one we haven't seen
+type keySet struct {
+	uri       string
+	get       func(u string, v interface{}) error
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	mx        sync.Mutex
+}
+
+//newKeySet returns a keySet that fetches keys from `uri` with `get`
+func newKeySet(uri string, get func(u string, v interface{}) error) *keySet {
+	return &keySet{uri: uri, get: get}
+}
+
+//key returns the key with the ID `kid`
+func (ks *keySet) key(kid string) (crypto.PublicKey, error) {
+	ks.mx.Lock()
+	defer ks.mx.Unlock()
+	if key, ok := ks.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(ks.fetchedAt) < minKeyRefresh {
+		return nil, errUnknownKey
+	}
+	if err := ks.fetch(); err != nil {
+		return nil, err
+	}
+	if key, ok := ks.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errUnknownKey
+}
+
+//fetch replaces the cached keys with the ones the provider publishes.
+//Keys that aren't for signing, or that we can't use, are skipped.
+//The caller must hold the lock
+func (ks *keySet) fetch() error {
+	ks.fetchedAt = time.Now()
+	doc := &jwks{}
+	if err := ks.get(ks.uri, doc); err != nil {
+		return err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range doc.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	ks.keys = keys
+	return nil
+}
+
+//publicKey returns the RSA or P-256 key a JWK holds
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, errors.New("unsupported curve " + k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("EC key is not on its curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, errors.New("unsupported key type " + k.Kty)
+}
+
+//decodeBigInt decodes a base64url encoded big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) == 0 {
+		return nil, errors.New("empty integer")
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
@@ -0,0 +1,254 @@
+/*
+Package oidctest has a mock OpenID Connect provider for testing relying
+parties, like the handlers that sign users in with the oidc package.
+*/
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+//grant is an authorization code that hasn't been exchanged yet
+type grant struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+//Server is a mock provider that signs everyone in as the user described
+//with SetUser, without asking. It runs on a local httptest.Server, which
+//should be closed when the test is done
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	//Key signs the ID tokens, and is published with the ID KeyID
+	Key   *rsa.PrivateKey
+	KeyID string
+
+	claims map[string]interface{}
+	codes  map[string]*grant
+	mx     sync.Mutex
+}
+
+//NewServer starts a mock provider for the client `clientID`
+func NewServer(clientID string, clientSecret string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Key:          key,
+		KeyID:        "test-key",
+		claims:       map[string]interface{}{},
+		codes:        map[string]*grant{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discoveryHandler)
+	mux.HandleFunc("/authorize", s.authorizeHandler)
+	mux.HandleFunc("/token", s.tokenHandler)
+	mux.HandleFunc("/jwks", s.jwksHandler)
+	s.Server = httptest.NewServer(mux)
+	return s, nil
+}
+
+//Issuer returns the provider's issuer URL
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+//SetUser sets who the provider signs people in as. `email` is
+//reported as verified, and `extra` claims are added to the ID tokens
+func (s *Server) SetUser(subject string, email string, extra map[string]interface{}) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.claims = map[string]interface{}{
+		"sub":            subject,
+		"email":          email,
+		"email_verified": true,
+	}
+	for k, v := range extra {
+		s.claims[k] = v
+	}
+}
+
+//Authorize follows an authorization URL the way a user's browser would,
+//returning the redirect URL the provider sends them back to
+func (s *Server) Authorize(authURL string) (*url.URL, error) {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("authorization failed with status %d", resp.StatusCode)
+	}
+	return resp.Location()
+}
+
+//SignIDToken signs an ID token with the provider's key. The claims are
+//used as they are, so this can also make tokens that should be rejected
+func (s *Server) SignIDToken(claims map[string]interface{}) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": s.KeyID, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+//IDTokenClaims returns the claims of a valid ID token
+//for the current user with the nonce `nonce`
+func (s *Server) IDTokenClaims(nonce string) map[string]interface{} {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   s.Issuer(),
+		"aud":   s.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+	for k, v := range s.claims {
+		claims[k] = v
+	}
+	return claims
+}
+
+func (s *Server) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.Issuer(),
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != s.ClientID || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" || len(q.Get("code_challenge")) == 0 {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirect.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	code, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mx.Lock()
+	s.codes[code] = &grant{
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+	}
+	s.mx.Unlock()
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Server) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.FormValue("client_id"), r.FormValue("client_secret")
+	}
+	if id != s.ClientID || secret != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.FormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	//codes can only be exchanged once
+	s.mx.Lock()
+	g := s.codes[r.FormValue("code")]
+	delete(s.codes, r.FormValue("code"))
+	s.mx.Unlock()
+	if g == nil || g.redirectURI != r.FormValue("redirect_uri") || g.challenge != challenge(r.FormValue("code_verifier")) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	idToken, err := s.SignIDToken(s.IDTokenClaims(g.nonce))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-" + r.FormValue("code"),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	pub := s.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": s.KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+//challenge returns the S256 PKCE challenge for a verifier
+func challenge(verifier string) string {
+	if len(verifier) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.New("error generating code")
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
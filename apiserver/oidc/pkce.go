@@ -0,0 +1,29 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+//RandomString returns a random URL-safe string with `size` bytes of
+//entropy, for use as a state, nonce or PKCE verifier
+func RandomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+//NewVerifier returns a new random PKCE code verifier
+func NewVerifier() (string, error) {
+	//32 bytes is 43 characters, the shortest verifier RFC 7636 allows
+	return RandomString(32)
+}
+
+//Challenge returns the S256 PKCE code challenge for a code verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
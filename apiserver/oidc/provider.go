@@ -0,0 +1,187 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+//DefaultTimeout is how long requests to providers can take
+const DefaultTimeout = 10 * time.Second
+
+//discoveryPath is where providers publish their configuration
+const discoveryPath = "/.well-known/openid-configuration"
+
+//Config configures a Provider
+type Config struct {
+	//Name identifies the provider in the API, like "google"
+	Name string `json:"name"`
+	//Issuer is the provider's issuer URL, which its configuration is
+	//discovered from and which must be the issuer of its ID tokens
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret"`
+	//RedirectURL is where the provider sends users back to
+	RedirectURL string `json:"redirectURL"`
+	//Scopes are requested on top of "openid", and default to email and profile
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+//discovery is the part of a provider's configuration we use
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+//Provider is an OpenID Connect identity provider
+type Provider struct {
+	config    Config
+	endpoints discovery
+	client    *http.Client
+	keys      *keySet
+}
+
+//Token is the response from a provider's token endpoint
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+//tokenError is the error response from a provider's token endpoint
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+//configsFile is the JSON format read by LoadConfigs
+type configsFile struct {
+	Providers []*Config `json:"providers"`
+}
+
+//LoadConfigs reads the provider configs in the JSON file at `path`,
+//which has a `providers` array of configs
+func LoadConfigs(path string) ([]*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cf := &configsFile{}
+	if err := json.NewDecoder(f).Decode(cf); err != nil {
+		return nil, fmt.Errorf("error decoding identity providers: %v", err)
+	}
+	return cf.Providers, nil
+}
+
+//NewProvider discovers the configuration of the provider at `config.Issuer`.
+//If `client` is nil, a client with DefaultTimeout is used
+func NewProvider(config *Config, client *http.Client) (*Provider, error) {
+	if len(config.Name) == 0 || len(config.Issuer) == 0 || len(config.ClientID) == 0 || len(config.RedirectURL) == 0 {
+		return nil, errors.New("identity providers need a name, issuer, client ID and redirect URL")
+	}
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	p := &Provider{config: *config, client: client}
+	issuer := strings.TrimSuffix(config.Issuer, "/")
+	if err := p.getJSON(issuer+discoveryPath, &p.endpoints); err != nil {
+		return nil, fmt.Errorf("error discovering %s: %v", config.Name, err)
+	}
+	//the issuer must match exactly, or ID tokens could come from anyone
+	if p.endpoints.Issuer != config.Issuer {
+		return nil, fmt.Errorf("%s has the issuer %q but was configured with %q", config.Name, p.endpoints.Issuer, config.Issuer)
+	}
+	if len(p.endpoints.AuthorizationEndpoint) == 0 || len(p.endpoints.TokenEndpoint) == 0 || len(p.endpoints.JWKSURI) == 0 {
+		return nil, fmt.Errorf("%s is missing endpoints in its configuration", config.Name)
+	}
+	p.keys = newKeySet(p.endpoints.JWKSURI, p.getJSON)
+	return p, nil
+}
+
+//Name returns the name the provider was configured with
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+//AuthCodeURL returns the address to send users to so that they can sign
+//in with the provider. The provider sends them back to the RedirectURL
+//with `state`, and puts `nonce` in the ID token. `challenge` is the
+//PKCE challenge for the verifier later given to Exchange
+func (p *Provider) AuthCodeURL(state string, nonce string, challenge string) string {
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURL)
+	q.Set("scope", strings.Join(append([]string{"openid"}, scopes...), " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(p.endpoints.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.endpoints.AuthorizationEndpoint + sep + q.Encode()
+}
+
+//Exchange trades the authorization code users come back with
+//for tokens, proving that we began the flow with `verifier`
+func (p *Provider) Exchange(code string, verifier string) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequest("POST", p.endpoints.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body := io.LimitReader(resp.Body, 1<<20)
+	if resp.StatusCode != http.StatusOK {
+		te := &tokenError{}
+		json.NewDecoder(body).Decode(te)
+		return nil, fmt.Errorf("token request failed with status %d: %s %s", resp.StatusCode, te.Error, te.Description)
+	}
+	token := &Token{}
+	if err := json.NewDecoder(body).Decode(token); err != nil {
+		return nil, fmt.Errorf("error decoding token response: %v", err)
+	}
+	if len(token.IDToken) == 0 {
+		return nil, errors.New("token response has no ID token")
+	}
+	return token, nil
+}
+
+//getJSON gets and decodes the JSON at `u`
+func (p *Provider) getJSON(u string, v interface{}) error {
+	resp, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s failed with status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
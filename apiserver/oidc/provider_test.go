@@ -0,0 +1,138 @@
+package oidc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/oidc/oidctest"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	server, err := oidctest.NewServer("client", "secret")
+	if err != nil {
+		t.Fatalf("error starting mock provider: %v\n", err)
+	}
+	p, err := NewProvider(&Config{
+		Name:         "mock",
+		Issuer:       server.Issuer(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/callback",
+	}, nil)
+	if err != nil {
+		server.Close()
+		t.Fatalf("error creating provider: %v\n", err)
+	}
+	return p, server
+}
+
+func TestProvider(t *testing.T) {
+	p, server := newTestProvider(t)
+	defer server.Close()
+	server.SetUser("subject-1", "alice@test.com", map[string]interface{}{"name": "Alice"})
+
+	verifier, _ := NewVerifier()
+	callback, err := server.Authorize(p.AuthCodeURL("the-state", "the-nonce", Challenge(verifier)))
+	if err != nil {
+		t.Fatalf("error authorizing: %v\n", err)
+	}
+	if callback.Query().Get("state") != "the-state" {
+		t.Errorf("state was not returned: %s\n", callback)
+	}
+	code := callback.Query().Get("code")
+
+	//the code can only be exchanged with the verifier
+	if _, err := p.Exchange(code, "wrong-verifier"); err == nil {
+		t.Errorf("expected an error exchanging with the wrong verifier\n")
+	}
+	callback, _ = server.Authorize(p.AuthCodeURL("the-state", "the-nonce", Challenge(verifier)))
+	token, err := p.Exchange(callback.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("error exchanging code: %v\n", err)
+	}
+	claims, err := p.VerifyIDToken(token.IDToken, "the-nonce")
+	if err != nil {
+		t.Fatalf("error verifying ID token: %v\n", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "alice@test.com" || !claims.EmailVerified || claims.Name != "Alice" {
+		t.Errorf("incorrect claims: %+v\n", claims)
+	}
+	if _, err := p.VerifyIDToken(token.IDToken, "another-nonce"); err == nil {
+		t.Errorf("expected an error for the wrong nonce\n")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	p, server := newTestProvider(t)
+	defer server.Close()
+	server.SetUser("subject-1", "alice@test.com", nil)
+
+	cases := []struct {
+		name    string
+		change  func(claims map[string]interface{})
+		tamper  func(token string) string
+		invalid bool
+	}{
+		{name: "valid"},
+		{name: "audience list", change: func(c map[string]interface{}) {
+			c["aud"] = []string{"client", "other"}
+			c["azp"] = "client"
+		}},
+		{name: "other audience", invalid: true, change: func(c map[string]interface{}) { c["aud"] = "other" }},
+		{name: "unauthorized party", invalid: true, change: func(c map[string]interface{}) { c["aud"] = []string{"client", "other"} }},
+		{name: "other issuer", invalid: true, change: func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }},
+		{name: "expired", invalid: true, change: func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "future", invalid: true, change: func(c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{name: "no subject", invalid: true, change: func(c map[string]interface{}) { delete(c, "sub") }},
+		{name: "tampered", invalid: true, tamper: func(token string) string {
+			parts := strings.Split(token, ".")
+			parts[1] = parts[1][:len(parts[1])-2] + "AA"
+			return strings.Join(parts, ".")
+		}},
+		{name: "unsigned", invalid: true, tamper: func(token string) string {
+			//"alg": "none"
+			parts := strings.Split(token, ".")
+			return "eyJhbGciOiJub25lIiwia2lkIjoidGVzdC1rZXkifQ." + parts[1] + "."
+		}},
+		{name: "garbage", invalid: true, tamper: func(string) string { return "not.a.token" }},
+	}
+	for _, c := range cases {
+		claims := server.IDTokenClaims("nonce")
+		if c.change != nil {
+			c.change(claims)
+		}
+		token, err := server.SignIDToken(claims)
+		if err != nil {
+			t.Fatalf("error signing token: %v\n", err)
+		}
+		if c.tamper != nil {
+			token = c.tamper(token)
+		}
+		_, err = p.VerifyIDToken(token, "nonce")
+		if c.invalid && err == nil {
+			t.Errorf("%s: expected an error\n", c.name)
+		}
+		if !c.invalid && err != nil {
+			t.Errorf("%s: unexpected error: %v\n", c.name, err)
+		}
+	}
+}
+
+func TestNewProviderErrors(t *testing.T) {
+	server, err := oidctest.NewServer("client", "secret")
+	if err != nil {
+		t.Fatalf("error starting mock provider: %v\n", err)
+	}
+	defer server.Close()
+	configs := []*Config{
+		{Name: "missing", ClientID: "client", RedirectURL: "http://localhost/callback"},
+		{Name: "wrong issuer", Issuer: server.Issuer() + "/", ClientID: "client", RedirectURL: "http://localhost/callback"},
+		{Name: "not found", Issuer: server.Issuer() + "/nothing", ClientID: "client", RedirectURL: "http://localhost/callback"},
+	}
+	for _, c := range configs {
+		if _, err := NewProvider(c, nil); err == nil {
+			t.Errorf("%s: expected an error\n", c.Name)
+		}
+	}
+}
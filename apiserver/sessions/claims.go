@@ -0,0 +1,12 @@
+package sessions
+
+//ClaimStore is a Store that can also claim keys atomically, so that
+//when several requests race to use something only once, like a
+//refresh token, exactly one of them wins
+type ClaimStore interface {
+	Store
+
+	//Claim claims `key`, returning false if it was already claimed.
+	//Claims expire along with the state in the store
+	Claim(key string) (bool, error)
+}
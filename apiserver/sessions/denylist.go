@@ -0,0 +1,178 @@
+package sessions
+
+import (
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"gopkg.in/redis.v5"
+)
+
+//redisDenyKeyPrefix is the prefix for the keys of denied token IDs
+const redisDenyKeyPrefix = "deny:"
+
+//Denylist keeps track of access tokens that were revoked before they
+//expired. Tokens only need to be kept on the list until they expire,
+//since expired tokens are turned away anyway
+type Denylist interface {
+	//Deny adds the token ID `jti` to the denylist until `until`
+	Deny(jti string, until time.Time) error
+
+	//Denied reports whether the token ID `jti` is on the denylist
+	Denied(jti string) (bool, error)
+}
+
+//MemDenylist is an in-memory Denylist. Like the MemStore, it should
+//only be used for testing or by a single instance of the server
+type MemDenylist struct {
+	entries *cache.Cache
+}
+
+//NewMemDenylist constructs and returns a new MemDenylist
+func NewMemDenylist() *MemDenylist {
+	return &MemDenylist{
+		entries: cache.New(cache.NoExpiration, time.Minute),
+	}
+}
+
+//Deny adds the token ID `jti` to the denylist until `until`
+func (md *MemDenylist) Deny(jti string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	md.entries.Set(jti, true, ttl)
+	return nil
+}
+
+//Denied reports whether the token ID `jti` is on the denylist
+func (md *MemDenylist) Denied(jti string) (bool, error) {
+	_, found := md.entries.Get(jti)
+	return found, nil
+}
+
+//Entries returns every token ID on the denylist, along with when it expires
+func (md *MemDenylist) Entries() (map[string]time.Time, error) {
+	entries := map[string]time.Time{}
+	for jti, item := range md.entries.Items() {
+		entries[jti] = time.Unix(0, item.Expiration)
+	}
+	return entries, nil
+}
+
+//RedisDenylist is a Denylist backed by redis, which is shared by every
+//instance of the server. Checking it is an EXISTS command, so rather
+//than checking it for every request, wrap it in a CachedDenylist
+type RedisDenylist struct {
+	Client *redis.Client
+}
+
+//NewRedisDenylist constructs a new RedisDenylist using the provided client
+func NewRedisDenylist(client *redis.Client) *RedisDenylist {
+	return &RedisDenylist{Client: client}
+}
+
+//Deny adds the token ID `jti` to the denylist until `until`
+func (rd *RedisDenylist) Deny(jti string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return rd.Client.Set(redisDenyKeyPrefix+jti, 1, ttl).Err()
+}
+
+//Denied reports whether the token ID `jti` is on the denylist
+func (rd *RedisDenylist) Denied(jti string) (bool, error) {
+	return rd.Client.Exists(redisDenyKeyPrefix + jti).Result()
+}
+
+//Entries returns every token ID on the denylist, along with when it expires
+func (rd *RedisDenylist) Entries() (map[string]time.Time, error) {
+	entries := map[string]time.Time{}
+	var cursor uint64
+	for {
+		keys, next, err := rd.Client.Scan(cursor, redisDenyKeyPrefix+"*", 100).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			ttl, err := rd.Client.TTL(key).Result()
+			if err != nil {
+				return nil, err
+			}
+			//keys that expired since the scan have a negative TTL
+			if ttl > 0 {
+				entries[strings.TrimPrefix(key, redisDenyKeyPrefix)] = time.Now().Add(ttl)
+			}
+		}
+		if cursor = next; cursor == 0 {
+			return entries, nil
+		}
+	}
+}
+
+//entryLister is a Denylist that can list its entries
+type entryLister interface {
+	Entries() (map[string]time.Time, error)
+}
+
+//CachedDenylist keeps an in-process copy of a shared Denylist, so that
+//checking a token doesn't cost a round trip for every request. Denials
+//are written to the shared Denylist, for instances that start later, and
+//passed to Announce, which should deliver them to every running instance
+//so they can Add them to their copies, for example over the notification bus
+type CachedDenylist struct {
+	shared Denylist
+	local  *MemDenylist
+	//Announce, if set, tells the other instances about a denial
+	Announce func(jti string, until time.Time) error
+}
+
+//NewCachedDenylist constructs a new CachedDenylist in front of `shared`.
+//Call Load once the CachedDenylist is receiving announced denials
+func NewCachedDenylist(shared Denylist) *CachedDenylist {
+	return &CachedDenylist{
+		shared: shared,
+		local:  NewMemDenylist(),
+	}
+}
+
+//Load copies the entries already on the shared Denylist, if it can list them
+func (cd *CachedDenylist) Load() error {
+	lister, ok := cd.shared.(entryLister)
+	if !ok {
+		return nil
+	}
+	entries, err := lister.Entries()
+	if err != nil {
+		return err
+	}
+	for jti, until := range entries {
+		cd.local.Deny(jti, until)
+	}
+	return nil
+}
+
+//Deny adds the token ID `jti` to the denylist until `until`,
+//and announces it to the other instances
+func (cd *CachedDenylist) Deny(jti string, until time.Time) error {
+	cd.local.Deny(jti, until)
+	if err := cd.shared.Deny(jti, until); err != nil {
+		return err
+	}
+	if cd.Announce != nil {
+		return cd.Announce(jti, until)
+	}
+	return nil
+}
+
+//Add adds a denial announced by another instance to the in-process copy
+func (cd *CachedDenylist) Add(jti string, until time.Time) {
+	cd.local.Deny(jti, until)
+}
+
+//Denied reports whether the token ID `jti` is on the in-process copy
+//of the denylist, without checking the shared one
+func (cd *CachedDenylist) Denied(jti string) (bool, error) {
+	return cd.local.Denied(jti)
+}
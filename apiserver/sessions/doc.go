@@ -13,5 +13,9 @@ It also includes a few package-level functions for beginning
 a new session, getting the SessionID and session state from
 an *http.Request, and ending a session. These functions use
 the Authorization HTTP header for transmitting the SessionID.
+
+For stateless sessions, a TokenIssuer issues short-lived JWT access
+tokens, which are sent in the same header, along with opaque refresh
+tokens that are kept in a Store and renew them.
 */
 package sessions
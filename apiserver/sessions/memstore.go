@@ -2,16 +2,26 @@ package sessions
 
 import (
 	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
 )
 
+//memClaimKeyPrefix keeps claimed keys apart from session IDs
+const memClaimKeyPrefix = "used:"
+
 //MemStore represents an in-memory session store.
 //This should be used only for testing and prototyping.
 //Production systems should use a shared server store like redis
 type MemStore struct {
 	entries *cache.Cache
+	//owners are the session IDs that belong to each owner
+	owners map[string][]SessionID
+	//ownerOf is the owner of each session in owners, so sessions can
+	//be removed from owners when they expire or are deleted
+	ownerOf map[SessionID]string
+	mx      sync.Mutex
 }
 
 //NewMemStore constructs and returns a new MemStore
@@ -19,9 +29,13 @@ func NewMemStore(sessionDuration time.Duration) *MemStore {
 	if sessionDuration < 0 {
 		sessionDuration = DefaultSessionDuration
 	}
-	return &MemStore{
+	ms := &MemStore{
 		entries: cache.New(sessionDuration, time.Minute),
+		owners:  map[string][]SessionID{},
+		ownerOf: map[SessionID]string{},
 	}
+	ms.entries.OnEvicted(ms.removeOwner)
+	return ms
 }
 
 //Store interface implementation
@@ -52,3 +66,62 @@ func (ms *MemStore) Delete(sid SessionID) error {
 	ms.entries.Delete(sid.String())
 	return nil
 }
+
+//ClaimStore interface implementation
+
+//Claim claims `key`, returning false if it was already claimed
+func (ms *MemStore) Claim(key string) (bool, error) {
+	//Add fails if the key is already there, and is atomic
+	return ms.entries.Add(memClaimKeyPrefix+key, true, cache.DefaultExpiration) == nil, nil
+}
+
+//OwnerStore interface implementation
+
+//AddOwner records that the session `sid` belongs to `owner`
+func (ms *MemStore) AddOwner(sid SessionID, owner string) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	ms.owners[owner] = append(ms.owners[owner], sid)
+	ms.ownerOf[sid] = owner
+	return nil
+}
+
+//DeleteOwner deletes the state of every session that belongs to `owner`
+func (ms *MemStore) DeleteOwner(owner string) error {
+	ms.mx.Lock()
+	sids := ms.owners[owner]
+	delete(ms.owners, owner)
+	for _, sid := range sids {
+		delete(ms.ownerOf, sid)
+	}
+	ms.mx.Unlock()
+	//deleting calls removeOwner, which takes the lock
+	for _, sid := range sids {
+		ms.entries.Delete(sid.String())
+	}
+	return nil
+}
+
+//removeOwner removes a session that expired or was deleted from owners
+func (ms *MemStore) removeOwner(key string, _ interface{}) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	sid := SessionID(key)
+	owner, found := ms.ownerOf[sid]
+	if !found {
+		return
+	}
+	delete(ms.ownerOf, sid)
+	sids := ms.owners[owner]
+	for i, s := range sids {
+		if s == sid {
+			sids = append(sids[:i], sids[i+1:]...)
+			break
+		}
+	}
+	if len(sids) == 0 {
+		delete(ms.owners, owner)
+	} else {
+		ms.owners[owner] = sids
+	}
+}
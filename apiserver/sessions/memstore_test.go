@@ -48,3 +48,54 @@ func TestMemStore(t *testing.T) {
 		t.Errorf("found deleted session data in store:\n got %v", state3)
 	}
 }
+
+func TestMemStoreOwners(t *testing.T) {
+	memstore := NewMemStore(30 * time.Minute)
+	var store OwnerStore = memstore
+	newSession := func(owner string) SessionID {
+		sid, err := NewSessionID(testSigningKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Save(sid, owner); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddOwner(sid, owner); err != nil {
+			t.Fatal(err)
+		}
+		return sid
+	}
+	first := newSession("alice")
+	second := newSession("alice")
+	other := newSession("bob")
+
+	if err := store.DeleteOwner("alice"); err != nil {
+		t.Fatal(err)
+	}
+	var owner string
+	for _, sid := range []SessionID{first, second} {
+		if err := store.Get(sid, &owner); err != ErrStateNotFound {
+			t.Errorf("expected the owner's sessions to be deleted but got %v\n", err)
+		}
+	}
+	if err := store.Get(other, &owner); err != nil || owner != "bob" {
+		t.Errorf("other owners' sessions should be kept: got %q %v\n", owner, err)
+	}
+
+	//sessions that are deleted or expire are removed from their owners
+	third := newSession("carol")
+	fourth := newSession("carol")
+	store.Delete(third)
+	if sids := memstore.owners["carol"]; len(sids) != 1 || sids[0] != fourth {
+		t.Errorf("expected only the remaining session but got %v\n", sids)
+	}
+	memstore.entries.Set(fourth.String(), []byte(`"carol"`), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	memstore.entries.DeleteExpired()
+	if _, found := memstore.owners["carol"]; found {
+		t.Errorf("owners of expired sessions should be removed\n")
+	}
+	if len(memstore.owners) != 1 || len(memstore.ownerOf) != 1 {
+		t.Errorf("expected only bob's session to be left but got %v %v\n", memstore.owners, memstore.ownerOf)
+	}
+}
@@ -0,0 +1,14 @@
+package sessions
+
+//OwnerStore is a Store that also keeps track of which sessions belong to
+//which owner, such as a user, so that every session an owner has can be
+//ended at once, like when they are signed out everywhere
+type OwnerStore interface {
+	Store
+
+	//AddOwner records that the session `sid` belongs to `owner`
+	AddOwner(sid SessionID, owner string) error
+
+	//DeleteOwner deletes the state of every session that belongs to `owner`
+	DeleteOwner(owner string) error
+}
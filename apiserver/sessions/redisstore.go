@@ -14,6 +14,13 @@ import (
 //namespace.
 const redisKeyPrefix = "sid:"
 
+//redisOwnerKeyPrefix is the prefix for the keys of the
+//sets of session IDs that belong to each owner
+const redisOwnerKeyPrefix = "owner:"
+
+//redisClaimKeyPrefix is the prefix for the keys that have been claimed
+const redisClaimKeyPrefix = "used:"
+
 //RedisStore represents a session.Store backed by redis.
 type RedisStore struct {
 	//Redis client used to talk to redis server.
@@ -131,6 +138,43 @@ func (rs *RedisStore) Delete(sid SessionID) error {
 	return nil
 }
 
+//ClaimStore implementation
+
+//Claim claims `key` with SETNX, so only one client can claim
+//each key, returning false if it was already claimed
+func (rs *RedisStore) Claim(key string) (bool, error) {
+	return rs.Client.SetNX(redisClaimKeyPrefix+key, 1, rs.SessionDuration).Result()
+}
+
+//OwnerStore implementation
+
+//AddOwner records that the session `sid` belongs to `owner`. The set of
+//the owner's sessions expires along with their newest session, so this
+//can miss sessions that are kept alive for longer than that. Callers that
+//need to be sure an owner's sessions are all gone shouldn't rely on this
+//alone to end them
+func (rs *RedisStore) AddOwner(sid SessionID, owner string) error {
+	_, err := rs.Client.Pipelined(func(pipe *redis.Pipeline) error {
+		pipe.SAdd(redisOwnerKeyPrefix+owner, sid.String())
+		pipe.Expire(redisOwnerKeyPrefix+owner, rs.SessionDuration)
+		return nil
+	})
+	return err
+}
+
+//DeleteOwner deletes the state of every session that belongs to `owner`
+func (rs *RedisStore) DeleteOwner(owner string) error {
+	sids, err := rs.Client.SMembers(redisOwnerKeyPrefix + owner).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{redisOwnerKeyPrefix + owner}
+	for _, sid := range sids {
+		keys = append(keys, SessionID(sid).getRedisKey())
+	}
+	return rs.Client.Del(keys...).Err()
+}
+
 //returns the key to use in redis
 func (sid SessionID) getRedisKey() string {
 	return redisKeyPrefix + sid.String()
@@ -59,4 +59,17 @@ func TestRedisStore(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	//deleting an owner deletes each of their sessions
+	if err := redisStore.Save(sid, state1); err != nil {
+		t.Fatal(err)
+	}
+	if err := redisStore.AddOwner(sid, "test owner"); err != nil {
+		t.Fatal(err)
+	}
+	if err := redisStore.DeleteOwner("test owner"); err != nil {
+		t.Fatal(err)
+	}
+	if err := redisStore.Get(sid, state3); err != ErrStateNotFound {
+		t.Fatalf("expected the owner's session to be deleted but got %v", err)
+	}
 }
@@ -8,6 +8,7 @@ import (
 
 const headerAuthorization = "Authorization"
 const schemeBearer = "Bearer "
+const schemeAPIKey = "ApiKey "
 
 //ErrNoSessionID is used when no session ID was found in the Authorization header
 var ErrNoSessionID = errors.New("no session ID found in " + headerAuthorization + " header")
@@ -64,6 +65,24 @@ func GetSessionID(r *http.Request, signingKey string) (SessionID, error) {
 	return valid, nil
 }
 
+//GetAPIKey extracts the API key from the Authorization header, which
+//is sent with the "ApiKey" scheme instead of "Bearer" like session IDs
+func GetAPIKey(r *http.Request) (string, error) {
+	auth := r.Header.Get(headerAuthorization)
+	if len(auth) == 0 {
+		return "", ErrNoSessionID
+	}
+	if !strings.HasPrefix(auth, schemeAPIKey) {
+		return "", ErrInvalidScheme
+	}
+	return strings.TrimPrefix(auth, schemeAPIKey), nil
+}
+
+//HasAPIKey reports whether the request's Authorization header has an API key
+func HasAPIKey(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get(headerAuthorization), schemeAPIKey)
+}
+
 //GetState extracts the SessionID from the request,
 //and gets the associated state from the provided store
 func GetState(r *http.Request, signingKey string, store Store, state interface{}) (SessionID, error) {
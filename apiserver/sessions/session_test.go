@@ -87,3 +87,18 @@ func TestGetSessionID(t *testing.T) {
 		t.Errorf("session IDs were different: expected %s but got %s\n", sid.String(), sid2.String())
 	}
 }
+
+func TestGetAPIKey(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	if _, err := GetAPIKey(r); err != ErrNoSessionID {
+		t.Errorf("expected ErrNoSessionID but got %v\n", err)
+	}
+	r.Header.Set(headerAuthorization, "Bearer abc")
+	if _, err := GetAPIKey(r); err != ErrInvalidScheme || HasAPIKey(r) {
+		t.Errorf("expected ErrInvalidScheme for a session ID but got %v\n", err)
+	}
+	r.Header.Set(headerAuthorization, "ApiKey abc.def")
+	if key, err := GetAPIKey(r); err != nil || key != "abc.def" || !HasAPIKey(r) {
+		t.Errorf("expected the API key but got %q %v\n", key, err)
+	}
+}
@@ -0,0 +1,496 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	//SigningHS256 signs access tokens with HMAC-SHA256 and a shared secret
+	SigningHS256 = "HS256"
+	//SigningEdDSA signs access tokens with an Ed25519 private key
+	SigningEdDSA = "EdDSA"
+)
+
+const (
+	//DefaultAccessTokenTTL is how long access tokens can be used for
+	DefaultAccessTokenTTL = 15 * time.Minute
+	//DefaultRefreshTokenTTL is how long a refresh token can go unused
+	//before the user has to sign in again
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+//HeaderRefreshToken is the response header BeginSession adds the refresh token to
+const HeaderRefreshToken = "X-Refresh-Token"
+
+//tokenIDSize is the number of random bytes in an access token's ID
+const tokenIDSize = 16
+
+//ErrInvalidToken is returned for tokens that weren't issued by us
+var ErrInvalidToken = errors.New("invalid token")
+
+//ErrTokenExpired is returned for tokens that have expired
+var ErrTokenExpired = errors.New("your token has expired")
+
+//ErrTokenRevoked is returned for tokens that were revoked before they expired
+var ErrTokenRevoked = errors.New("your token has been revoked")
+
+//ErrTokenReused is returned when a refresh token is used a second time.
+//Only one of the two users of the token can be the real user, so every
+//token the session has is revoked
+var ErrTokenReused = errors.New("refresh token was already used")
+
+//TokenConfig configures a TokenIssuer
+type TokenConfig struct {
+	//Method is SigningHS256 or SigningEdDSA
+	Method string
+	//Key is the secret for HS256, or the Ed25519 private key, or its
+	//seed, for EdDSA
+	Key []byte
+	//SigningKey signs the refresh tokens, which are session IDs
+	SigningKey string
+	//AccessTTL defaults to DefaultAccessTokenTTL
+	AccessTTL time.Duration
+	//RefreshTTL defaults to DefaultRefreshTokenTTL
+	RefreshTTL time.Duration
+}
+
+//Claims are what an access token says about its session
+type Claims struct {
+	//Subject is the ID of the signed-in user
+	Subject string `json:"sub"`
+	Role    string `json:"role,omitempty"`
+	//ID identifies the token on the Denylist
+	ID string `json:"jti"`
+	//Family is the ID of the chain of refresh tokens the token was issued with
+	Family   string `json:"sid"`
+	IssuedAt int64  `json:"iat"`
+	Expiry   int64  `json:"exp"`
+	//AuthTime is when the user signed in, with fractions of a second
+	//so that it can be compared to when their sessions were revoked
+	AuthTime float64 `json:"auth_time"`
+}
+
+//AuthenticatedAt returns when the user signed in
+func (c *Claims) AuthenticatedAt() time.Time {
+	return time.Unix(0, int64(c.AuthTime*float64(time.Second)))
+}
+
+//TokenPair is an access token and the refresh token that renews it
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	//ExpiresIn is the number of seconds the access token can be used for
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+//refreshState is the state saved in the store for each refresh token.
+//Tokens are claimed in the store when they're exchanged for new ones,
+//so that they can only be used once, even by requests made at once
+type refreshState struct {
+	Family    SessionID
+	ExpiresAt time.Time
+}
+
+//familyState is the state saved in the store for each chain of refresh
+//tokens, which begins when the user signs in
+type familyState struct {
+	Subject  string
+	AuthTime time.Time
+	//Current is the refresh token that can be used next
+	Current SessionID
+	//AccessID and AccessExpiry are those of the last access token
+	AccessID     string
+	AccessExpiry time.Time
+}
+
+//jwtHeader is the JOSE header of an access token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+//TokenIssuer begins stateless sessions, which are a short-lived JWT
+//access token that can be checked without looking anything up, and an
+//opaque refresh token that's kept in a Store. Refresh tokens can only be
+//used once: each refresh returns a new one, and reusing an old one
+//revokes the session. Revoked access tokens are kept on a Denylist until
+//they expire
+type TokenIssuer struct {
+	method     string
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+	signingKey string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	store      ClaimStore
+	denylist   Denylist
+}
+
+//NewTokenIssuer constructs a new TokenIssuer, which keeps refresh tokens
+//in `store` and revoked access tokens in `denylist`. If `store` is an
+//OwnerStore, each session is added to the user's
+func NewTokenIssuer(config *TokenConfig, store ClaimStore, denylist Denylist) (*TokenIssuer, error) {
+	if len(config.SigningKey) == 0 {
+		return nil, errors.New("tokens need a signing key")
+	}
+	ti := &TokenIssuer{
+		method:     config.Method,
+		signingKey: config.SigningKey,
+		accessTTL:  config.AccessTTL,
+		refreshTTL: config.RefreshTTL,
+		store:      store,
+		denylist:   denylist,
+	}
+	if ti.accessTTL <= 0 {
+		ti.accessTTL = DefaultAccessTokenTTL
+	}
+	if ti.refreshTTL <= 0 {
+		ti.refreshTTL = DefaultRefreshTokenTTL
+	}
+	switch config.Method {
+	case SigningHS256:
+		if len(config.Key) < sha256.Size {
+			return nil, fmt.Errorf("HS256 keys must be at least %d bytes", sha256.Size)
+		}
+		ti.secret = config.Key
+	case SigningEdDSA:
+		switch len(config.Key) {
+		case ed25519.SeedSize:
+			ti.privateKey = ed25519.NewKeyFromSeed(config.Key)
+		case ed25519.PrivateKeySize:
+			ti.privateKey = ed25519.PrivateKey(config.Key)
+		default:
+			return nil, fmt.Errorf("EdDSA keys must be %d or %d bytes", ed25519.SeedSize, ed25519.PrivateKeySize)
+		}
+		ti.publicKey = ti.privateKey.Public().(ed25519.PublicKey)
+	default:
+		return nil, fmt.Errorf("unsupported signing method %q", config.Method)
+	}
+	return ti, nil
+}
+
+//BeginSession issues a token pair for the user with the ID `subject` and
+//the role `role`, who signed in at `authTime`. The access token is added
+//to the response's Authorization header, like a session ID, and the
+//refresh token is added to the HeaderRefreshToken header
+func (ti *TokenIssuer) BeginSession(subject string, role string, authTime time.Time, w http.ResponseWriter) (*TokenPair, error) {
+	family, err := NewSessionID(ti.signingKey)
+	if err != nil {
+		return nil, err
+	}
+	fs := &familyState{Subject: subject, AuthTime: authTime}
+	pair, err := ti.issue(family, fs, role)
+	if err != nil {
+		return nil, err
+	}
+	if owners, ok := ti.store.(OwnerStore); ok {
+		if err := owners.AddOwner(family, subject); err != nil {
+			return nil, err
+		}
+	}
+	w.Header().Set(headerAuthorization, schemeBearer+pair.AccessToken)
+	w.Header().Set(HeaderRefreshToken, pair.RefreshToken)
+	return pair, nil
+}
+
+//Refresh exchanges a refresh token for a new token pair in the same
+//session. `check` is given the subject and when they signed in, and
+//returns their current role, or an error if they may no longer have
+//a session, which revokes it
+func (ti *TokenIssuer) Refresh(refreshToken string, check func(subject string, authTime time.Time) (string, error)) (*TokenPair, error) {
+	sid, err := ValidateID(refreshToken, ti.signingKey)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	rs := &refreshState{}
+	if err := ti.store.Get(sid, rs); err != nil {
+		if err == ErrStateNotFound {
+			return nil, ErrTokenRevoked
+		}
+		return nil, err
+	}
+	fs := &familyState{}
+	if err := ti.store.Get(rs.Family, fs); err != nil {
+		if err == ErrStateNotFound {
+			return nil, ErrTokenRevoked
+		}
+		return nil, err
+	}
+	if fs.Current != sid {
+		ti.revokeFamily(rs.Family, fs)
+		return nil, ErrTokenReused
+	}
+	if time.Now().After(rs.ExpiresAt) {
+		ti.revokeFamily(rs.Family, fs)
+		return nil, ErrTokenExpired
+	}
+	//of two refreshes with the same token, only one can claim it,
+	//and the other is treated like any other reuse
+	claimed, err := ti.store.Claim(sid.String())
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		ti.revokeFamily(rs.Family, fs)
+		return nil, ErrTokenReused
+	}
+	role, err := check(fs.Subject, fs.AuthTime)
+	if err != nil {
+		ti.revokeFamily(rs.Family, fs)
+		return nil, err
+	}
+	pair, err := ti.issue(rs.Family, fs, role)
+	if err != nil {
+		return nil, err
+	}
+	//the family may have been revoked while the pair was being
+	//issued, by a refresh that lost the race for the token
+	revoked, err := ti.revoked(rs.Family)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		ti.revokeFamily(rs.Family, fs)
+		return nil, ErrTokenReused
+	}
+	return pair, nil
+}
+
+//GetClaims extracts and verifies the access token from the request headers
+func (ti *TokenIssuer) GetClaims(r *http.Request) (*Claims, error) {
+	token, err := getBearer(r)
+	if err != nil {
+		return nil, err
+	}
+	return ti.Verify(token)
+}
+
+//Verify checks the signature and expiry of an access token,
+//and that it hasn't been revoked, returning its claims
+func (ti *TokenIssuer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	h := &jwtHeader{}
+	if err := decodeTokenSegment(parts[0], h); err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	//only our own method is accepted, so that a token
+	//can't choose a weaker way to be checked
+	if h.Alg != ti.method || !ti.verify(parts[0]+"."+parts[1], sig) {
+		return nil, ErrInvalidToken
+	}
+	claims := &Claims{}
+	if err := decodeTokenSegment(parts[1], claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if len(claims.Subject) == 0 || len(claims.ID) == 0 {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.Expiry {
+		return nil, ErrTokenExpired
+	}
+	if ti.denylist != nil {
+		denied, err := ti.denylist.Denied(claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if denied {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+//EndSession revokes the access token in the request
+//and the refresh token of its session
+func (ti *TokenIssuer) EndSession(r *http.Request) (*Claims, error) {
+	claims, err := ti.GetClaims(r)
+	if err != nil {
+		return nil, err
+	}
+	return claims, ti.Revoke(claims)
+}
+
+//Revoke puts the access token with `claims` on the denylist,
+//and revokes the refresh token of its session
+func (ti *TokenIssuer) Revoke(claims *Claims) error {
+	if ti.denylist != nil {
+		if err := ti.denylist.Deny(claims.ID, time.Unix(claims.Expiry, 0)); err != nil {
+			return err
+		}
+	}
+	fs := &familyState{}
+	if err := ti.store.Get(SessionID(claims.Family), fs); err != nil {
+		if err == ErrStateNotFound {
+			return nil
+		}
+		return err
+	}
+	return ti.revokeFamily(SessionID(claims.Family), fs)
+}
+
+//HasAccessToken reports whether the request's Authorization header has
+//an access token, rather than a session ID, which can't contain dots
+func HasAccessToken(r *http.Request) bool {
+	token, err := getBearer(r)
+	return err == nil && strings.Count(token, ".") == 2
+}
+
+//issue issues a new token pair in the chain of refresh tokens `family`
+//with the state `fs`, replacing its current refresh token
+func (ti *TokenIssuer) issue(family SessionID, fs *familyState, role string) (*TokenPair, error) {
+	refresh, err := NewSessionID(ti.signingKey)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	id := make([]byte, tokenIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	claims := &Claims{
+		Subject:  fs.Subject,
+		Role:     role,
+		ID:       base64.RawURLEncoding.EncodeToString(id),
+		Family:   family.String(),
+		IssuedAt: now.Unix(),
+		Expiry:   now.Add(ti.accessTTL).Unix(),
+		AuthTime: float64(fs.AuthTime.UnixNano()) / float64(time.Second),
+	}
+	access, err := ti.sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	if err := ti.store.Save(refresh, &refreshState{Family: family, ExpiresAt: now.Add(ti.refreshTTL)}); err != nil {
+		return nil, err
+	}
+	fs.Current = refresh
+	fs.AccessID = claims.ID
+	fs.AccessExpiry = time.Unix(claims.Expiry, 0)
+	if err := ti.store.Save(family, fs); err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh.String(),
+		ExpiresIn:    int64(ti.accessTTL / time.Second),
+	}, nil
+}
+
+//revokeFamily revokes the chain of refresh tokens `family` with the
+//state `fs`, along with the last access token issued in it. The family
+//is marked revoked before its state is read again, so a refresh issuing
+//a new pair in it at the same time either sees the mark, or has saved
+//the new pair before it's read here
+func (ti *TokenIssuer) revokeFamily(family SessionID, fs *familyState) error {
+	if err := ti.store.Save(revokedFamilyID(family), true); err != nil {
+		return err
+	}
+	latest := &familyState{}
+	if err := ti.store.Get(family, latest); err != nil && err != ErrStateNotFound {
+		return err
+	}
+	for _, state := range []*familyState{fs, latest} {
+		if ti.denylist != nil && len(state.AccessID) > 0 {
+			if err := ti.denylist.Deny(state.AccessID, state.AccessExpiry); err != nil {
+				return err
+			}
+		}
+		if len(state.Current) > 0 {
+			if err := ti.store.Delete(state.Current); err != nil {
+				return err
+			}
+		}
+	}
+	return ti.store.Delete(family)
+}
+
+//revoked reports whether the chain of refresh tokens `family` was revoked
+func (ti *TokenIssuer) revoked(family SessionID) (bool, error) {
+	var revoked bool
+	err := ti.store.Get(revokedFamilyID(family), &revoked)
+	if err == ErrStateNotFound {
+		return false, nil
+	}
+	return revoked, err
+}
+
+//revokedFamilyID returns the ID revoked families are marked with
+func revokedFamilyID(family SessionID) SessionID {
+	return SessionID("revoked:" + family.String())
+}
+
+//sign encodes the claims as a JWT signed with the issuer's method
+func (ti *TokenIssuer) sign(claims *Claims) (string, error) {
+	h, err := json.Marshal(&jwtHeader{Alg: ti.method, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	var sig []byte
+	if ti.method == SigningEdDSA {
+		sig = ed25519.Sign(ti.privateKey, []byte(signed))
+	} else {
+		sig = ti.mac(signed)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+//verify checks the signature `sig` of `signed`
+func (ti *TokenIssuer) verify(signed string, sig []byte) bool {
+	if ti.method == SigningEdDSA {
+		return ed25519.Verify(ti.publicKey, []byte(signed), sig)
+	}
+	return subtle.ConstantTimeCompare(ti.mac(signed), sig) == 1
+}
+
+//mac returns the HMAC-SHA256 of `signed` with the issuer's secret
+func (ti *TokenIssuer) mac(signed string) []byte {
+	h := hmac.New(sha256.New, ti.secret)
+	h.Write([]byte(signed))
+	return h.Sum(nil)
+}
+
+//getBearer returns the credentials after "Bearer " in the Authorization header
+func getBearer(r *http.Request) (string, error) {
+	auth := r.Header.Get(headerAuthorization)
+	if len(auth) == 0 {
+		return "", ErrNoSessionID
+	}
+	if !strings.HasPrefix(auth, schemeBearer) {
+		return "", ErrInvalidScheme
+	}
+	return strings.TrimPrefix(auth, schemeBearer), nil
+}
+
+//decodeTokenSegment decodes a base64url encoded JSON segment of a token
+func decodeTokenSegment(seg string, v interface{}) error {
+	buf, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
@@ -0,0 +1,289 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testHMACKey = []byte("0123456789abcdef0123456789abcdef")
+
+//allowAll is a Refresh check that lets every subject keep their session
+func allowAll(subject string, authTime time.Time) (string, error) {
+	return "user", nil
+}
+
+func newTestIssuer(t *testing.T, method string, key []byte) *TokenIssuer {
+	ti, err := NewTokenIssuer(&TokenConfig{Method: method, Key: key, SigningKey: testSigningKey}, NewMemStore(-1), NewMemDenylist())
+	if err != nil {
+		t.Fatalf("error creating issuer: %v\n", err)
+	}
+	return ti
+}
+
+//bearer returns a request with the access token in its Authorization header
+func bearer(token string) *http.Request {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set(headerAuthorization, schemeBearer+token)
+	return r
+}
+
+func TestTokenCycle(t *testing.T) {
+	seed := make([]byte, 32)
+	for _, ti := range []*TokenIssuer{
+		newTestIssuer(t, SigningHS256, testHMACKey),
+		newTestIssuer(t, SigningEdDSA, seed),
+	} {
+		authTime := time.Now()
+		respRec := httptest.NewRecorder()
+		pair, err := ti.BeginSession("user-1", "admin", authTime, respRec)
+		if err != nil {
+			t.Fatalf("%s: error beginning session: %v\n", ti.method, err)
+		}
+		if respRec.Header().Get(headerAuthorization) != schemeBearer+pair.AccessToken || respRec.Header().Get(HeaderRefreshToken) != pair.RefreshToken {
+			t.Errorf("%s: tokens were not added to the response headers\n", ti.method)
+		}
+		r := bearer(pair.AccessToken)
+		if !HasAccessToken(r) {
+			t.Errorf("%s: HasAccessToken should be true\n", ti.method)
+		}
+		claims, err := ti.GetClaims(r)
+		if err != nil {
+			t.Fatalf("%s: error getting claims: %v\n", ti.method, err)
+		}
+		if claims.Subject != "user-1" || claims.Role != "admin" || claims.AuthenticatedAt().Sub(authTime) > time.Microsecond || authTime.Sub(claims.AuthenticatedAt()) > time.Microsecond {
+			t.Errorf("%s: incorrect claims: %+v\n", ti.method, claims)
+		}
+
+		//refreshing keeps the subject and when they signed in
+		var checked string
+		next, err := ti.Refresh(pair.RefreshToken, func(subject string, at time.Time) (string, error) {
+			checked = subject
+			if !at.Equal(authTime) {
+				return "", errors.New("wrong auth time")
+			}
+			return "user", nil
+		})
+		if err != nil {
+			t.Fatalf("%s: error refreshing: %v\n", ti.method, err)
+		}
+		claims, err = ti.Verify(next.AccessToken)
+		if err != nil || checked != "user-1" || claims.Role != "user" {
+			t.Errorf("%s: incorrect refreshed claims: %+v %v\n", ti.method, claims, err)
+		}
+
+		//ending the session revokes both tokens
+		if _, err := ti.EndSession(bearer(next.AccessToken)); err != nil {
+			t.Fatalf("%s: error ending session: %v\n", ti.method, err)
+		}
+		if _, err := ti.Verify(next.AccessToken); err != ErrTokenRevoked {
+			t.Errorf("%s: expected ErrTokenRevoked for the access token but got %v\n", ti.method, err)
+		}
+		if _, err := ti.Refresh(next.RefreshToken, allowAll); err != ErrTokenRevoked {
+			t.Errorf("%s: expected ErrTokenRevoked for the refresh token but got %v\n", ti.method, err)
+		}
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	ti := newTestIssuer(t, SigningHS256, testHMACKey)
+	first, err := ti.BeginSession("user-1", "user", time.Now(), httptest.NewRecorder())
+	if err != nil {
+		t.Fatalf("error beginning session: %v\n", err)
+	}
+	second, err := ti.Refresh(first.RefreshToken, allowAll)
+	if err != nil {
+		t.Fatalf("error refreshing: %v\n", err)
+	}
+
+	//using the first refresh token again ends the whole session
+	if _, err := ti.Refresh(first.RefreshToken, allowAll); err != ErrTokenReused {
+		t.Errorf("expected ErrTokenReused but got %v\n", err)
+	}
+	if _, err := ti.Refresh(second.RefreshToken, allowAll); err != ErrTokenRevoked {
+		t.Errorf("expected ErrTokenRevoked for the latest refresh token but got %v\n", err)
+	}
+	if _, err := ti.Verify(second.AccessToken); err != ErrTokenRevoked {
+		t.Errorf("expected ErrTokenRevoked for the latest access token but got %v\n", err)
+	}
+
+	//a failed check also ends the session
+	third, _ := ti.BeginSession("user-2", "user", time.Now(), httptest.NewRecorder())
+	denied := errors.New("denied")
+	if _, err := ti.Refresh(third.RefreshToken, func(string, time.Time) (string, error) { return "", denied }); err != denied {
+		t.Errorf("expected the check's error but got %v\n", err)
+	}
+	if _, err := ti.Verify(third.AccessToken); err != ErrTokenRevoked {
+		t.Errorf("expected ErrTokenRevoked after a failed check but got %v\n", err)
+	}
+	if _, err := ti.Refresh("forged", allowAll); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for a forged refresh token but got %v\n", err)
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	ti := newTestIssuer(t, SigningHS256, testHMACKey)
+	first, err := ti.BeginSession("user-1", "user", time.Now(), httptest.NewRecorder())
+	if err != nil {
+		t.Fatalf("error beginning session: %v\n", err)
+	}
+
+	//only one of the refreshes can win, and the others revoke the session
+	const n = 10
+	pairs := make(chan *TokenPair, n)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pair, err := ti.Refresh(first.RefreshToken, allowAll)
+			if err != nil {
+				errs <- err
+				return
+			}
+			pairs <- pair
+		}()
+	}
+	wg.Wait()
+	close(pairs)
+	close(errs)
+	if len(pairs) > 1 {
+		t.Fatalf("expected at most one refresh to succeed but %d did\n", len(pairs))
+	}
+	for err := range errs {
+		if err != ErrTokenReused && err != ErrTokenRevoked {
+			t.Errorf("expected ErrTokenReused or ErrTokenRevoked but got %v\n", err)
+		}
+	}
+	for pair := range pairs {
+		if _, err := ti.Refresh(pair.RefreshToken, allowAll); err != ErrTokenRevoked {
+			t.Errorf("expected ErrTokenRevoked for the winner's refresh token but got %v\n", err)
+		}
+		if _, err := ti.Verify(pair.AccessToken); err != ErrTokenRevoked {
+			t.Errorf("expected ErrTokenRevoked for the winner's access token but got %v\n", err)
+		}
+	}
+}
+
+func TestMemStoreClaim(t *testing.T) {
+	ms := NewMemStore(-1)
+	if claimed, err := ms.Claim("key"); !claimed || err != nil {
+		t.Errorf("expected to claim a new key but got %v %v\n", claimed, err)
+	}
+	if claimed, _ := ms.Claim("key"); claimed {
+		t.Errorf("a key should only be claimed once\n")
+	}
+	//claims are kept apart from session state
+	if err := ms.Get(SessionID("key"), new(bool)); err != ErrStateNotFound {
+		t.Errorf("expected ErrStateNotFound but got %v\n", err)
+	}
+}
+
+func TestVerifyAccessToken(t *testing.T) {
+	ti := newTestIssuer(t, SigningHS256, testHMACKey)
+	other := newTestIssuer(t, SigningHS256, []byte(strings.Repeat("x", 32)))
+	eddsa := newTestIssuer(t, SigningEdDSA, make([]byte, 32))
+	pair, _ := ti.BeginSession("user-1", "user", time.Now(), httptest.NewRecorder())
+	parts := strings.Split(pair.AccessToken, ".")
+	otherPair, _ := other.BeginSession("user-1", "user", time.Now(), httptest.NewRecorder())
+	eddsaPair, _ := eddsa.BeginSession("user-1", "user", time.Now(), httptest.NewRecorder())
+	expired := mustSign(t, ti, &Claims{Subject: "user-1", ID: "id", Expiry: time.Now().Add(-time.Minute).Unix()})
+
+	cases := map[string]string{
+		"tampered":       parts[0] + "." + parts[1][:len(parts[1])-2] + "AA." + parts[2],
+		"unsigned":       "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + ".",
+		"other key":      otherPair.AccessToken,
+		"other method":   eddsaPair.AccessToken,
+		"garbage":        "not.a.token",
+		"session ID":     pair.RefreshToken,
+		"missing fields": mustSign(t, ti, &Claims{Expiry: time.Now().Add(time.Minute).Unix()}),
+	}
+	for name, token := range cases {
+		if _, err := ti.Verify(token); err != ErrInvalidToken {
+			t.Errorf("%s: expected ErrInvalidToken but got %v\n", name, err)
+		}
+	}
+	if _, err := ti.Verify(expired); err != ErrTokenExpired {
+		t.Errorf("expected ErrTokenExpired but got %v\n", err)
+	}
+	if HasAccessToken(bearer(pair.RefreshToken)) {
+		t.Errorf("HasAccessToken should be false for session IDs\n")
+	}
+}
+
+func TestNewTokenIssuerErrors(t *testing.T) {
+	configs := []*TokenConfig{
+		{Method: SigningHS256, Key: []byte("short"), SigningKey: testSigningKey},
+		{Method: SigningEdDSA, Key: []byte("short"), SigningKey: testSigningKey},
+		{Method: "none", Key: testHMACKey, SigningKey: testSigningKey},
+		{Method: SigningHS256, Key: testHMACKey},
+	}
+	for _, c := range configs {
+		if _, err := NewTokenIssuer(c, NewMemStore(-1), nil); err == nil {
+			t.Errorf("expected an error for %+v\n", c)
+		}
+	}
+}
+
+func TestMemDenylist(t *testing.T) {
+	dl := NewMemDenylist()
+	dl.Deny("a", time.Now().Add(time.Minute))
+	dl.Deny("b", time.Now().Add(-time.Minute))
+	if denied, _ := dl.Denied("a"); !denied {
+		t.Errorf("a should be denied\n")
+	}
+	if denied, _ := dl.Denied("b"); denied {
+		t.Errorf("b has already expired, so it shouldn't be denied\n")
+	}
+}
+
+func TestCachedDenylist(t *testing.T) {
+	shared := NewMemDenylist()
+	shared.Deny("a", time.Now().Add(time.Minute))
+	cd := NewCachedDenylist(shared)
+	var announced []string
+	cd.Announce = func(jti string, until time.Time) error {
+		announced = append(announced, jti)
+		return nil
+	}
+	if err := cd.Load(); err != nil {
+		t.Fatalf("error loading: %v\n", err)
+	}
+	if denied, _ := cd.Denied("a"); !denied {
+		t.Errorf("a was on the shared denylist, so it should be denied\n")
+	}
+
+	//only the in-process copy is checked
+	shared.Deny("b", time.Now().Add(time.Minute))
+	if denied, _ := cd.Denied("b"); denied {
+		t.Errorf("b hasn't been announced, so it shouldn't be denied yet\n")
+	}
+	cd.Add("b", time.Now().Add(time.Minute))
+	if denied, _ := cd.Denied("b"); !denied {
+		t.Errorf("b was announced, so it should be denied\n")
+	}
+
+	cd.Deny("c", time.Now().Add(time.Minute))
+	if denied, _ := cd.Denied("c"); !denied {
+		t.Errorf("c should be denied\n")
+	}
+	if denied, _ := shared.Denied("c"); !denied {
+		t.Errorf("c should be on the shared denylist\n")
+	}
+	if len(announced) != 1 || announced[0] != "c" {
+		t.Errorf("expected c to be announced but got %v\n", announced)
+	}
+}
+
+func mustSign(t *testing.T, ti *TokenIssuer, claims *Claims) string {
+	token, err := ti.sign(claims)
+	if err != nil {
+		t.Fatalf("error signing token: %v\n", err)
+	}
+	return token
+}
@@ -0,0 +1,345 @@
+package summary
+
+import (
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	//wordsPerMinute is the average adult reading speed used for reading time
+	wordsPerMinute = 200
+	//maxExcerptLength is the most characters in an article excerpt
+	maxExcerptLength = 300
+	//minParagraphLength is the shortest text a paragraph needs to count
+	//towards the score of the block it is in
+	minParagraphLength = 25
+	//classWeight is added or taken away for promising or unlikely class names
+	classWeight = 25
+)
+
+//Article is the main text content of a page
+type Article struct {
+	//Excerpt is the start of the article's text, cut at a word boundary
+	Excerpt string `json:"excerpt"`
+	//WordCount is the number of words in the article's text
+	WordCount int `json:"wordCount"`
+	//ReadingTime is the estimated time to read the article, in minutes
+	ReadingTime int `json:"readingTime"`
+	//Lang is the language of the page, as a language tag such as "en"
+	Lang string `json:"lang,omitempty"`
+	//Text is the article's full text, with paragraphs separated by blank lines
+	Text string `json:"-"`
+}
+
+var (
+	//positiveNames are class and id names likely to hold the article
+	positiveNames = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|text|blog|story`)
+	//negativeNames are class and id names unlikely to hold the article
+	negativeNames = regexp.MustCompile(`(?i)comment|meta|footer|footnote|sidebar|sponsor|banner|share|social|related|nav|menu|promo|widget|popup|cookie`)
+)
+
+//unlikelyElements are elements that never hold article text
+var unlikelyElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Nav:      true,
+	atom.Header:   true,
+	atom.Footer:   true,
+	atom.Aside:    true,
+	atom.Form:     true,
+	atom.Iframe:   true,
+	atom.Svg:      true,
+	atom.Button:   true,
+}
+
+//textElements are the elements whose text makes up the article
+var textElements = map[atom.Atom]bool{
+	atom.P:          true,
+	atom.Pre:        true,
+	atom.Blockquote: true,
+	atom.Li:         true,
+	atom.H2:         true,
+	atom.H3:         true,
+	atom.H4:         true,
+	atom.H5:         true,
+	atom.H6:         true,
+}
+
+//extractArticle parses the whole page and finds its main text, in the spirit
+//of Readability: every paragraph adds to the score of its parent and (half as
+//much) its grandparent, the scores are adjusted by the blocks' class names and
+//how much of their text is links, and the best scoring block is the article
+func extractArticle(r io.Reader) (*Article, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	lang := documentLang(doc)
+	removeUnlikely(doc)
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, found := scores[n]; !found {
+			scores[n] = nameWeight(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+	walk(doc, func(n *html.Node) {
+		if n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td {
+			return
+		}
+		text := nodeText(n)
+		if len(text) < minParagraphLength {
+			return
+		}
+		//one point for the paragraph, one per comma,
+		//and one per 100 characters, up to 3
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text)/100), 3)
+		addScore(n.Parent, score)
+		if n.Parent != nil {
+			addScore(n.Parent.Parent, score/2)
+		}
+	})
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, n := range candidates {
+		//blocks that are mostly links are navigation, not content
+		score := scores[n] * (1 - linkDensity(n))
+		if best == nil || score > bestScore {
+			best = n
+			bestScore = score
+		}
+	}
+
+	art := &Article{Lang: lang}
+	if best == nil {
+		//no paragraphs at all, so just use whatever text the body has
+		art.Text = collapseSpace(nodeText(doc))
+	} else {
+		art.Text = blockText(best)
+	}
+	if len(art.Lang) == 0 {
+		art.Lang = detectLang(art.Text)
+	}
+	art.WordCount = len(strings.Fields(art.Text))
+	art.ReadingTime = int(math.Ceil(float64(art.WordCount) / wordsPerMinute))
+	art.Excerpt = excerpt(art.Text, maxExcerptLength)
+	return art, nil
+}
+
+//walk calls `fn` for `n` and all of its descendants, in document order
+func walk(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+//removeUnlikely removes the elements that never hold article text, as well
+//as blocks whose class or id say they're not content
+func removeUnlikely(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode ||
+			(c.Type == html.ElementNode && (unlikelyElements[c.DataAtom] || isUnlikelyBlock(c))) {
+			n.RemoveChild(c)
+		} else {
+			removeUnlikely(c)
+		}
+		c = next
+	}
+}
+
+//isUnlikelyBlock reports whether the element's class and id say it is
+//something like a sidebar or comments, and nothing says it is content
+func isUnlikelyBlock(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		return false
+	}
+	names := attrVal(n, "class") + " " + attrVal(n, "id")
+	return negativeNames.MatchString(names) && !positiveNames.MatchString(names)
+}
+
+//nameWeight scores an element by its class and id names
+func nameWeight(n *html.Node) float64 {
+	weight := 0.0
+	for _, name := range []string{attrVal(n, "class"), attrVal(n, "id")} {
+		if len(name) == 0 {
+			continue
+		}
+		if positiveNames.MatchString(name) {
+			weight += classWeight
+		}
+		if negativeNames.MatchString(name) {
+			weight -= classWeight
+		}
+	}
+	if n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		weight += classWeight
+	}
+	return weight
+}
+
+//attrVal returns the value of the node's attribute named `key`
+func attrVal(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+//nodeText returns all of the text inside `n`
+func nodeText(n *html.Node) string {
+	buf := &strings.Builder{}
+	walk(n, func(c *html.Node) {
+		if c.Type == html.TextNode {
+			buf.WriteString(c.Data)
+			buf.WriteString(" ")
+		}
+	})
+	return strings.TrimSpace(buf.String())
+}
+
+//linkDensity returns the fraction of the node's text that is inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	walk(n, func(c *html.Node) {
+		if c.DataAtom == atom.A {
+			links += len(nodeText(c))
+		}
+	})
+	return math.Min(float64(links)/float64(total), 1)
+}
+
+//blockText returns the cleaned text of the paragraphs, headings and list
+//items in `n`, separated by blank lines. Blocks with no such elements
+//return all of their text
+func blockText(n *html.Node) string {
+	var paras []string
+	var collect func(*html.Node)
+	collect = func(c *html.Node) {
+		if c.Type == html.ElementNode && textElements[c.DataAtom] {
+			if text := collapseSpace(nodeText(c)); len(text) > 0 {
+				paras = append(paras, text)
+			}
+			return
+		}
+		for cc := c.FirstChild; cc != nil; cc = cc.NextSibling {
+			collect(cc)
+		}
+	}
+	collect(n)
+	if len(paras) == 0 {
+		return collapseSpace(nodeText(n))
+	}
+	return strings.Join(paras, "\n\n")
+}
+
+//collapseSpace replaces each run of whitespace with a single space
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+//excerpt returns the start of `text` up to `max` characters, cut at a word
+//boundary and ending in an ellipsis if anything was cut off
+func excerpt(text string, max int) string {
+	text = collapseSpace(text)
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	cut := max
+	for cut > 0 && !unicode.IsSpace(runes[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		cut = max
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsPunct) + "…"
+}
+
+//documentLang returns the language declared by the page, from the lang
+//attribute of <html> or a Content-Language <meta>, normalized to the
+//primary language subtag (so en-US becomes en)
+func documentLang(doc *html.Node) string {
+	lang := ""
+	walk(doc, func(n *html.Node) {
+		if len(lang) > 0 || n.Type != html.ElementNode {
+			return
+		}
+		switch n.DataAtom {
+		case atom.Html:
+			lang = attrVal(n, "lang")
+		case atom.Meta:
+			if strings.EqualFold(attrVal(n, "http-equiv"), "content-language") {
+				lang = attrVal(n, "content")
+			}
+		}
+	})
+	lang = strings.TrimSpace(strings.SplitN(lang, ",", 2)[0])
+	lang = strings.SplitN(strings.Replace(lang, "_", "-", -1), "-", 2)[0]
+	return strings.ToLower(lang)
+}
+
+//stopWords are very common words in each language we can detect
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "was", "for", "with", "are", "this"},
+	"es": {"el", "la", "de", "que", "y", "en", "los", "se", "del", "las", "por", "una", "es"},
+	"fr": {"le", "la", "de", "et", "les", "des", "est", "que", "une", "du", "dans", "pour", "pas"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "ein", "zu", "von", "sich", "auch"},
+	"it": {"il", "di", "che", "e", "la", "per", "un", "non", "una", "sono", "della", "con", "gli"},
+	"pt": {"o", "de", "que", "e", "do", "da", "em", "um", "para", "não", "uma", "os", "com"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "voor", "met"},
+}
+
+//detectLang guesses the language of `text` by counting stop words, and
+//returns "" if there isn't enough text or no language stands out
+func detectLang(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) < 20 {
+		return ""
+	}
+	counts := make(map[string]int)
+	for _, w := range words {
+		counts[w]++
+	}
+	best, bestCount, second := "", 0, 0
+	for lang, stops := range stopWords {
+		count := 0
+		for _, s := range stops {
+			count += counts[s]
+		}
+		if count > bestCount || (count == bestCount && lang < best) {
+			best, bestCount, second = lang, count, bestCount
+		} else if count > second {
+			second = count
+		}
+	}
+	//at least 5% of the words should be stop words, clearly ahead of the next language
+	if bestCount*20 < len(words) || bestCount == second {
+		return ""
+	}
+	return best
+}
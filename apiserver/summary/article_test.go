@@ -0,0 +1,128 @@
+package summary
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExtractArticle(t *testing.T) {
+	cases := []struct {
+		fixture     string
+		lang        string
+		excerpt     string
+		contains    []string
+		notContains []string
+	}{
+		{
+			fixture:     "testdata/article-en.html",
+			lang:        "en",
+			excerpt:     "Walk into a great concert hall and clap your hands once.",
+			contains:    []string{"Materials and surfaces", "the air itself."},
+			notContains: []string{"Popular", "Great article", "Copyright", "window.analytics", "Reviews"},
+		},
+		{
+			fixture:     "testdata/article-fr.html",
+			lang:        "fr",
+			excerpt:     "La nouvelle salle de concert de la ville",
+			contains:    []string{"concerts gratuits"},
+			notContains: []string{"Accueil"},
+		},
+	}
+	for _, c := range cases {
+		f, err := os.Open(c.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		art, err := extractArticle(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: error extracting article: %v\n", c.fixture, err)
+		}
+		if art.Lang != c.lang {
+			t.Errorf("%s: incorrect language: expected `%s` but got `%s`\n", c.fixture, c.lang, art.Lang)
+		}
+		if !strings.HasPrefix(art.Excerpt, c.excerpt) {
+			t.Errorf("%s: incorrect excerpt: expected it to start with `%s` but got `%s`\n", c.fixture, c.excerpt, art.Excerpt)
+		}
+		if len([]rune(art.Excerpt)) > maxExcerptLength+1 {
+			t.Errorf("%s: excerpt is too long: %d characters\n", c.fixture, len([]rune(art.Excerpt)))
+		}
+		for _, s := range c.contains {
+			if !strings.Contains(art.Text, s) {
+				t.Errorf("%s: article text is missing `%s`\n", c.fixture, s)
+			}
+		}
+		for _, s := range c.notContains {
+			if strings.Contains(art.Text, s) {
+				t.Errorf("%s: article text should not contain `%s`\n", c.fixture, s)
+			}
+		}
+		if art.WordCount != len(strings.Fields(art.Text)) {
+			t.Errorf("%s: incorrect word count: %d\n", c.fixture, art.WordCount)
+		}
+		if art.ReadingTime != 1 {
+			t.Errorf("%s: incorrect reading time: expected 1 but got %d\n", c.fixture, art.ReadingTime)
+		}
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	cases := []struct {
+		text     string
+		max      int
+		expected string
+	}{
+		{"short text", 20, "short text"},
+		{"one two three four", 10, "one two…"},
+		{"one two,   three four", 9, "one two…"},
+		{"unbreakable", 5, "unbre…"},
+	}
+	for _, c := range cases {
+		if actual := excerpt(c.text, c.max); actual != c.expected {
+			t.Errorf("excerpt(%q, %d): expected `%s` but got `%s`\n", c.text, c.max, c.expected, actual)
+		}
+	}
+}
+
+func TestArticleMode(t *testing.T) {
+	page, err := ioutil.ReadFile("testdata/article-en.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	}))
+	defer server.Close()
+	s := NewSummarizer(NewHTTPFetcher(server.Client()), nil)
+
+	summary, err := s.Summarize(context.Background(), server.URL, nil)
+	if err != nil {
+		t.Fatalf("error getting summary: %v\n", err)
+	}
+	if summary.Article != nil {
+		t.Errorf("article was extracted without article mode\n")
+	}
+	if _, ok := summary.Props["description"]; ok {
+		t.Errorf("page has no description, but got one without article mode\n")
+	}
+
+	summary, err = s.Summarize(context.Background(), server.URL, &Options{Article: true})
+	if err != nil {
+		t.Fatalf("error getting summary: %v\n", err)
+	}
+	if summary.Article == nil {
+		t.Fatalf("no article extracted in article mode\n")
+	}
+	if summary.Props["description"] != summary.Article.Excerpt {
+		t.Errorf("description should fall back to the excerpt: got `%s`\n", summary.Props["description"])
+	}
+	if summary.Props["title"] != "Why Concert Halls Sound the Way They Do" {
+		t.Errorf("incorrect title in article mode: got `%s`\n", summary.Props["title"])
+	}
+}
@@ -0,0 +1,120 @@
+package summary
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//MaxBatchURLs is the most URLs that can be summarized in one batch
+	MaxBatchURLs = 50
+	//batchWorkers is how many URLs in a batch are fetched at once
+	batchWorkers = 8
+	//batchURLTimeout is how long we wait for any one URL in a batch
+	batchURLTimeout = 10 * time.Second
+)
+
+//Result is the summary of one URL in a batch,
+//or the error that occurred while summarizing it
+type Result struct {
+	URL     string   `json:"url"`
+	Summary *Summary `json:"summary,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+//SummarizeBatch summarizes each of the `urls` using a pool of workers,
+//and returns the results in the same order as `urls`. URLs that are
+//listed more than once are only fetched once, and share a Summary. If
+//`onResult` is non-nil, it is called once for each distinct URL as soon
+//as its result is ready. Calls to `onResult` are never concurrent
+func (s *Summarizer) SummarizeBatch(ctx context.Context, urls []string, opts *Options, onResult func(*Result)) []*Result {
+	results := make([]*Result, len(urls))
+	//indexes of the urls that normalize to the same thing,
+	//so that each distinct URL is only fetched once
+	dupes := make(map[string][]int)
+	var jobs []string
+	for i, u := range urls {
+		key, err := normalizeBatchURL(u)
+		if err != nil {
+			results[i] = &Result{URL: u, Error: err.Error()}
+			if onResult != nil {
+				onResult(results[i])
+			}
+			continue
+		}
+		if _, found := dupes[key]; !found {
+			jobs = append(jobs, key)
+		}
+		dupes[key] = append(dupes[key], i)
+	}
+
+	jobCh := make(chan string)
+	resCh := make(chan *Result)
+	workers := batchWorkers
+	if len(jobs) < workers {
+		workers = len(jobs)
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range jobCh {
+				resCh <- s.summarizeOne(ctx, u, opts)
+			}
+		}()
+	}
+	go func() {
+		for _, u := range jobs {
+			jobCh <- u
+		}
+		close(jobCh)
+		wg.Wait()
+		close(resCh)
+	}()
+
+	for res := range resCh {
+		//each result keeps the URL exactly as it was passed in
+		for _, i := range dupes[res.URL] {
+			results[i] = &Result{
+				URL:     urls[i],
+				Summary: res.Summary,
+				Error:   res.Error,
+			}
+		}
+		if onResult != nil {
+			onResult(res)
+		}
+	}
+	return results
+}
+
+//summarizeOne summarizes a single URL, giving up after batchURLTimeout
+func (s *Summarizer) summarizeOne(ctx context.Context, u string, opts *Options) *Result {
+	ctx, cancel := context.WithTimeout(ctx, batchURLTimeout)
+	defer cancel()
+	summary, err := s.Summarize(ctx, u, opts)
+	if err != nil {
+		return &Result{URL: u, Error: err.Error()}
+	}
+	return &Result{URL: u, Summary: summary}
+}
+
+//normalizeBatchURL returns the URL in a form that lets us detect
+//duplicates: scheme and host lower-cased, and without the fragment,
+//since the fragment is never sent to the server
+func normalizeBatchURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", ErrUnsupportedScheme
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return u.String(), nil
+}
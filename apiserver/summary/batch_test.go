@@ -0,0 +1,58 @@
+package summary
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSummarizeBatch(t *testing.T) {
+	hits := make(map[string]int)
+	mx := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		hits[r.URL.Path]++
+		mx.Unlock()
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>` + r.URL.Path + `</title></head></html>`))
+	}))
+	defer server.Close()
+	s := NewSummarizer(NewHTTPFetcher(server.Client()), nil)
+
+	urls := []string{
+		server.URL + "/one",
+		server.URL + "/two",
+		server.URL + "/one#fragment",
+		server.URL + "/missing",
+		"ftp://example.com/file",
+	}
+	results := s.SummarizeBatch(context.Background(), urls, nil, nil)
+	if len(results) != len(urls) {
+		t.Fatalf("incorrect number of results: expected %d but got %d\n", len(urls), len(results))
+	}
+	for i, res := range results {
+		if res.URL != urls[i] {
+			t.Errorf("result %d is out of order: expected `%s` but got `%s`\n", i, urls[i], res.URL)
+		}
+	}
+	for _, i := range []int{0, 2} {
+		if results[i].Summary == nil || results[i].Summary.Props["title"] != "/one" {
+			t.Errorf("incorrect summary for %s: %v\n", urls[i], results[i])
+		}
+	}
+	if results[1].Summary == nil || results[1].Summary.Props["title"] != "/two" {
+		t.Errorf("incorrect summary for %s: %v\n", urls[1], results[1])
+	}
+	if len(results[3].Error) == 0 || len(results[4].Error) == 0 {
+		t.Errorf("expected errors for missing and non-http URLs\n")
+	}
+	if hits["/one"] != 1 {
+		t.Errorf("duplicate URL was fetched %d times; expected 1\n", hits["/one"])
+	}
+}
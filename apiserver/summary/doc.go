@@ -0,0 +1,19 @@
+/*
+Package summary is a reusable library for summarizing web pages,
+extracted from the API server's summary handlers so that the same
+engine can be used by other programs, such as the summarize command.
+
+A Summarizer fetches a page and extracts its Open Graph properties,
+falling back to standard HTML elements for pages that don't use them.
+It resolves relative URLs against the page's final URL and <base> element,
+picks the best icon for a requested size from the page's icon links and
+web app manifest, and can optionally extract the page's main article text.
+Sites that don't have usable meta tags can be summarized by providers,
+which use the site's oEmbed endpoint or site-specific HTML rules instead.
+
+All fetching goes through the Fetcher interface. Servers should use the
+fetcher returned by NewSafeFetcher, which refuses to connect to private
+and loopback addresses. Pages that have already been fetched, or that were
+saved to files, can be summarized with SummarizeReader without any fetching.
+*/
+package summary
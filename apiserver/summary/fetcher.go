@@ -0,0 +1,164 @@
+package summary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+//DefaultFetchTimeout is how long the safe fetcher waits for a whole response
+const DefaultFetchTimeout = 10 * time.Second
+
+//defaultMaxFetchBytes is the most an HTTPFetcher will read of a response body
+const defaultMaxFetchBytes = 5 << 20
+
+//maxRedirects is how many redirects an HTTPFetcher will follow
+const maxRedirects = 10
+
+//ErrNonPublicAddress is returned when a fetch would connect to a loopback,
+//private, link-local or otherwise non-public address
+var ErrNonPublicAddress = errors.New("refusing to connect to a non-public address")
+
+//ErrUnsupportedScheme is returned when asked to fetch something other than http(s)
+var ErrUnsupportedScheme = errors.New("only http and https URLs can be fetched")
+
+//Fetcher fetches remote resources for the summarizer
+type Fetcher interface {
+	//Fetch sends a request with the given method to `rawURL`. The request
+	//is abandoned if `ctx` is canceled or times out
+	Fetch(ctx context.Context, method string, rawURL string) (*http.Response, error)
+}
+
+//HTTPFetcher is a Fetcher that fetches http(s) URLs with an http.Client,
+//limiting the number of redirects and the size of response bodies
+type HTTPFetcher struct {
+	client *http.Client
+	//maxBytes limits how much of each response body can be read
+	maxBytes int64
+}
+
+//NewSafeFetcher constructs a fetcher that only connects to public addresses.
+//Since the URLs we summarize come from clients, this is the fetcher servers
+//should use, so that clients can't make us connect to addresses inside our
+//own network. The address is checked after DNS resolution, so that a public
+//name can't resolve to a private address
+func NewSafeFetcher(timeout time.Duration) *HTTPFetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: checkPublicAddress,
+	}
+	transport := &http.Transport{
+		//never go through a proxy, since the proxy would do the dialing
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return NewHTTPFetcher(&http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	})
+}
+
+//NewHTTPFetcher constructs a fetcher around an existing client, which can
+//connect to any address the client can. Use this for trusted URLs only,
+//such as from the command line or to local test servers
+func NewHTTPFetcher(client *http.Client) *HTTPFetcher {
+	c := *client
+	c.CheckRedirect = checkRedirect
+	return &HTTPFetcher{
+		client:   &c,
+		maxBytes: defaultMaxFetchBytes,
+	}
+}
+
+//Fetch sends a request with the given method to `rawURL`, returning
+//the response with a body that stops after the fetcher's maxBytes
+func (f *HTTPFetcher) Fetch(ctx context.Context, method string, rawURL string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, ErrUnsupportedScheme
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &limitedBody{
+		Reader: io.LimitReader(resp.Body, f.maxBytes),
+		Closer: resp.Body,
+	}
+	return resp, nil
+}
+
+//get fetches `rawURL` with a GET request
+func get(ctx context.Context, f Fetcher, rawURL string) (*http.Response, error) {
+	if f == nil {
+		return nil, fmt.Errorf("no fetcher to get %s", rawURL)
+	}
+	return f.Fetch(ctx, "GET", rawURL)
+}
+
+//limitedBody is a response body that can only be read up to a limit
+type limitedBody struct {
+	io.Reader
+	io.Closer
+}
+
+//checkRedirect limits the number of redirects and refuses to
+//follow redirects to anything but http(s)
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return ErrUnsupportedScheme
+	}
+	return nil
+}
+
+//checkPublicAddress is used as the net.Dialer Control function, which is
+//called with the resolved address just before connecting
+func checkPublicAddress(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return ErrNonPublicAddress
+	}
+	return nil
+}
+
+//sharedAddressSpace is the carrier-grade NAT range (RFC 6598),
+//which net.IP.IsPrivate doesn't include
+var sharedAddressSpace = &net.IPNet{
+	IP:   net.IPv4(100, 64, 0, 0),
+	Mask: net.CIDRMask(10, 32),
+}
+
+//isPublicIP reports whether `ip` is a globally routable address
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip))
+}
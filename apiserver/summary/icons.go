@@ -0,0 +1,238 @@
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+//DefaultIconSize is the icon size in pixels used when none is requested
+const DefaultIconSize = 32
+
+//maxManifestBytes is the most we will read of a web app manifest
+const maxManifestBytes = 512 << 10
+
+//rel values describing where an icon was found
+const (
+	relIcon           = "icon"
+	relAppleTouchIcon = "apple-touch-icon"
+	relManifest       = "manifest"
+	relDefault        = "default"
+)
+
+//appleTouchIconSize is the size iOS uses when an apple-touch-icon gives no sizes
+const appleTouchIconSize = 180
+
+//Icon represents an icon a page advertises for itself
+type Icon struct {
+	URL string `json:"url"`
+	//Rel says where the icon was found: a <link rel="icon">, an apple-touch-icon,
+	//the web app manifest, or the /favicon.ico default
+	Rel   string `json:"rel"`
+	Type  string `json:"type,omitempty"`
+	Sizes string `json:"sizes,omitempty"`
+}
+
+//manifest represents the parts of a web app manifest we care about
+type manifest struct {
+	Icons []struct {
+		Src   string `json:"src"`
+		Sizes string `json:"sizes"`
+		Type  string `json:"type"`
+	} `json:"icons"`
+}
+
+//iconFromLink returns the icon described by a <link> token, or nil if
+//the link isn't an icon. This covers rel="icon", the legacy
+//rel="shortcut icon" and apple-touch-icon(-precomposed)
+func iconFromLink(token html.Token) *Icon {
+	href, ok := getAttr(token, "href")
+	if !ok {
+		return nil
+	}
+	ic := &Icon{URL: href}
+	switch {
+	case hasRel(token, "icon"):
+		ic.Rel = relIcon
+	case hasRel(token, "apple-touch-icon"), hasRel(token, "apple-touch-icon-precomposed"):
+		ic.Rel = relAppleTouchIcon
+	default:
+		return nil
+	}
+	ic.Type, _ = getAttr(token, "type")
+	ic.Sizes, _ = getAttr(token, "sizes")
+	return ic
+}
+
+//manifestIcons fetches the web app manifest at `manifestURL` with the
+//fetcher and returns its icons, resolved against the manifest's URL
+func manifestIcons(ctx context.Context, f Fetcher, manifestURL *url.URL) []*Icon {
+	resp, err := get(ctx, f, manifestURL.String())
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil
+	}
+	m := &manifest{}
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxManifestBytes))
+	if err := decoder.Decode(m); err != nil {
+		return nil
+	}
+	var icons []*Icon
+	for _, mi := range m.Icons {
+		u, ok := resolveURL(resp.Request.URL, mi.Src)
+		if !ok {
+			continue
+		}
+		icons = append(icons, &Icon{
+			URL:   u.String(),
+			Rel:   relManifest,
+			Type:  mi.Type,
+			Sizes: mi.Sizes,
+		})
+	}
+	return icons
+}
+
+//defaultIcon returns the /favicon.ico icon browsers try for every site
+func defaultIcon(pageURL *url.URL) *Icon {
+	u := &url.URL{
+		Scheme: pageURL.Scheme,
+		Host:   pageURL.Host,
+		Path:   "/favicon.ico",
+	}
+	return &Icon{
+		URL: u.String(),
+		Rel: relDefault,
+	}
+}
+
+//sizes returns the pixel sizes of the icon, and whether it is scalable
+//(sizes="any", or an SVG). Sizes are given like "16x16 32x32", and as
+//icons are square we only keep the width. Icons that don't say what
+//size they are return no sizes
+func (ic *Icon) sizes() ([]int, bool) {
+	var sizes []int
+	for _, s := range strings.Fields(strings.ToLower(ic.Sizes)) {
+		if s == "any" {
+			return nil, true
+		}
+		dims := strings.SplitN(s, "x", 2)
+		w, err := strconv.Atoi(dims[0])
+		if err != nil || w <= 0 {
+			continue
+		}
+		sizes = append(sizes, w)
+	}
+	mediaType, _, _ := mime.ParseMediaType(ic.Type)
+	if mediaType == "image/svg+xml" || strings.HasSuffix(strings.ToLower(ic.URL), ".svg") {
+		return sizes, true
+	}
+	if len(sizes) == 0 && ic.Rel == relAppleTouchIcon {
+		sizes = append(sizes, appleTouchIconSize)
+	}
+	return sizes, false
+}
+
+//fit returns the size of the icon that best fits `size`: the smallest
+//at least as big as `size`, or the largest smaller one. Scalable icons
+//fit any size exactly, and icons of unknown size return 0
+func (ic *Icon) fit(size int) int {
+	sizes, scalable := ic.sizes()
+	if scalable {
+		return size
+	}
+	best := 0
+	for _, s := range sizes {
+		if betterSize(s, best, size) {
+			best = s
+		}
+	}
+	return best
+}
+
+//betterSize reports whether an icon of size `a` is a better fit
+//for `size` than one of size `b`
+func betterSize(a int, b int, size int) bool {
+	switch {
+	case a >= size && b >= size:
+		return a < b
+	case a >= size:
+		return true
+	case b >= size:
+		return false
+	default:
+		return a > b
+	}
+}
+
+//rankIcons returns the icons ordered from best to worst fit for `size`.
+//Icons that fit equally well keep the order they were found in, so
+//icons declared on the page win over the manifest and the default
+func rankIcons(icons []*Icon, size int) []*Icon {
+	ranked := make([]*Icon, len(icons))
+	copy(ranked, icons)
+	fits := make(map[*Icon]int, len(icons))
+	for _, ic := range icons {
+		fits[ic] = ic.fit(size)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return betterSize(fits[ranked[i]], fits[ranked[j]], size)
+	})
+	return ranked
+}
+
+//bestIcon returns the URL of the icon that best fits `size`. If `verify`
+//is true, each candidate is requested through the fetcher and the best
+//one that actually responds with an image is returned
+func bestIcon(ctx context.Context, f Fetcher, icons []*Icon, size int, verify bool) (string, bool) {
+	for _, ic := range rankIcons(icons, size) {
+		if !verify || iconReachable(ctx, f, ic.URL) {
+			return ic.URL, true
+		}
+	}
+	return "", false
+}
+
+//iconReachable reports whether the icon can be fetched and is an image
+func iconReachable(ctx context.Context, f Fetcher, iconURL string) bool {
+	cType, ok := fetchIconType(ctx, f, iconURL)
+	//some servers send favicons without a content type at all
+	return ok && (len(cType) == 0 || strings.HasPrefix(cType, "image/"))
+}
+
+//iconIsImage reports whether the icon at `iconURL` responds with a
+//content type that says it's an image. It's stricter than iconReachable,
+//for icons the page never said it had
+func iconIsImage(ctx context.Context, f Fetcher, iconURL string) bool {
+	cType, ok := fetchIconType(ctx, f, iconURL)
+	return ok && strings.HasPrefix(cType, "image/")
+}
+
+//fetchIconType requests the icon at `iconURL`, returning its content
+//type, and false if it couldn't be fetched or responded with an error
+func fetchIconType(ctx context.Context, f Fetcher, iconURL string) (string, bool) {
+	resp, err := f.Fetch(ctx, "HEAD", iconURL)
+	if err == nil && resp.StatusCode == 405 {
+		//some servers don't allow HEAD, so try a GET instead
+		resp.Body.Close()
+		resp, err = get(ctx, f, iconURL)
+	}
+	if err != nil {
+		return "", false
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", false
+	}
+	return resp.Header.Get("Content-Type"), true
+}
@@ -0,0 +1,314 @@
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+//provider types that can be used in provider configs
+const (
+	providerTypeOEmbed = "oembed"
+	providerTypeHTML   = "html"
+)
+
+//extractText is the ProviderRule.Extract value for an element's text
+const extractText = "text"
+
+//maxOEmbedBytes is the most we will read of an oEmbed response
+const maxOEmbedBytes = 512 << 10
+
+//ProviderConfig describes a summary provider: a way of summarizing URLs
+//matching its patterns for sites whose pages don't have usable meta tags
+type ProviderConfig struct {
+	//Name is the provider's name, which is added to the summaries it makes
+	Name string `json:"name"`
+	//Type is either "oembed" or "html"
+	Type string `json:"type"`
+	//Patterns are the URLs the provider handles, where * matches anything,
+	//such as https://www.youtube.com/watch*
+	Patterns []string `json:"patterns"`
+	//Endpoint is the oEmbed endpoint for oembed providers
+	Endpoint string `json:"endpoint,omitempty"`
+	//Rules say which elements hold the summary properties for html providers
+	Rules []*ProviderRule `json:"rules,omitempty"`
+}
+
+//ProviderRule finds a summary property in a page: the first `Element`
+//whose `Attr` attribute equals `Value` (or any `Element`, if `Attr`
+//is empty) gives the property's value from its `Extract` attribute,
+//or from its text if `Extract` is "text"
+type ProviderRule struct {
+	Prop    string `json:"prop"`
+	Element string `json:"element"`
+	Attr    string `json:"attr,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Extract string `json:"extract"`
+}
+
+//providersFile is the format of a provider config file
+type providersFile struct {
+	Providers []*ProviderConfig `json:"providers"`
+}
+
+//provider is a ProviderConfig ready to match URLs
+type provider struct {
+	*ProviderConfig
+	patterns []*regexp.Regexp
+}
+
+//ProviderRegistry holds the summary providers, and picks the one
+//to use for a given URL
+type ProviderRegistry struct {
+	providers []*provider
+}
+
+//builtinProviders are the providers every registry starts with
+var builtinProviders = []*ProviderConfig{
+	{
+		Name:     "YouTube",
+		Type:     providerTypeOEmbed,
+		Patterns: []string{"https://www.youtube.com/watch*", "https://youtube.com/watch*", "https://youtu.be/*"},
+		Endpoint: "https://www.youtube.com/oembed",
+	},
+	{
+		Name:     "Vimeo",
+		Type:     providerTypeOEmbed,
+		Patterns: []string{"https://vimeo.com/*", "https://player.vimeo.com/video/*"},
+		Endpoint: "https://vimeo.com/api/oembed.json",
+	},
+	{
+		Name:     "Twitter",
+		Type:     providerTypeOEmbed,
+		Patterns: []string{"https://twitter.com/*/status/*", "https://x.com/*/status/*"},
+		Endpoint: "https://publish.twitter.com/oembed",
+	},
+	{
+		Name:     "GitHub",
+		Type:     providerTypeHTML,
+		Patterns: []string{"https://github.com/*"},
+		Rules: []*ProviderRule{
+			{Prop: "title", Element: "meta", Attr: "name", Value: "twitter:title", Extract: "content"},
+			{Prop: "description", Element: "meta", Attr: "name", Value: "twitter:description", Extract: "content"},
+			{Prop: "image", Element: "meta", Attr: "name", Value: "twitter:image:src", Extract: "content"},
+		},
+	},
+}
+
+//NewProviderRegistry constructs a registry with the built-in providers
+func NewProviderRegistry() *ProviderRegistry {
+	reg := &ProviderRegistry{}
+	for _, pc := range builtinProviders {
+		//the built-in configs are known to be valid
+		reg.Add(pc)
+	}
+	return reg
+}
+
+//Add adds a provider to the registry. Providers added later take
+//precedence over those added earlier, so that providers loaded from
+//a config file can replace the built-in ones
+func (reg *ProviderRegistry) Add(pc *ProviderConfig) error {
+	if len(pc.Name) == 0 {
+		return fmt.Errorf("provider has no name")
+	}
+	if len(pc.Patterns) == 0 {
+		return fmt.Errorf("provider %s has no URL patterns", pc.Name)
+	}
+	switch pc.Type {
+	case providerTypeOEmbed:
+		if len(pc.Endpoint) == 0 {
+			return fmt.Errorf("oembed provider %s has no endpoint", pc.Name)
+		}
+	case providerTypeHTML:
+		if len(pc.Rules) == 0 {
+			return fmt.Errorf("html provider %s has no rules", pc.Name)
+		}
+	default:
+		return fmt.Errorf("provider %s has unknown type %q", pc.Name, pc.Type)
+	}
+	p := &provider{ProviderConfig: pc}
+	for _, pattern := range pc.Patterns {
+		p.patterns = append(p.patterns, compilePattern(pattern))
+	}
+	reg.providers = append([]*provider{p}, reg.providers...)
+	return nil
+}
+
+//LoadFile adds the providers in the JSON config file at `path`, which
+//looks like {"providers": [{"name": ..., "type": ..., ...}]}
+func (reg *ProviderRegistry) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return reg.Load(f)
+}
+
+//Load adds the providers in the JSON config read from `r`
+func (reg *ProviderRegistry) Load(r io.Reader) error {
+	pf := &providersFile{}
+	if err := json.NewDecoder(r).Decode(pf); err != nil {
+		return fmt.Errorf("error decoding providers: %v", err)
+	}
+	for _, pc := range pf.Providers {
+		if err := reg.Add(pc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//compilePattern turns a URL pattern where * matches anything into a regexp
+func compilePattern(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+//lookup returns the provider for `pageURL`, or nil if none match
+func (reg *ProviderRegistry) lookup(pageURL string) *provider {
+	if reg == nil {
+		return nil
+	}
+	for _, p := range reg.providers {
+		for _, re := range p.patterns {
+			if re.MatchString(pageURL) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+//summarize produces a summary of `pageURL` using the provider
+func (p *provider) summarize(ctx context.Context, f Fetcher, pageURL string) (*Summary, error) {
+	var summary *Summary
+	var err error
+	if p.Type == providerTypeOEmbed {
+		summary, err = p.summarizeOEmbed(ctx, f, pageURL)
+	} else {
+		summary, err = p.summarizeHTML(ctx, f, pageURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(summary.Props["title"]) == 0 {
+		return nil, fmt.Errorf("provider %s found no title", p.Name)
+	}
+	summary.Props["provider"] = p.Name
+	return summary, nil
+}
+
+//oEmbedResponse holds the oEmbed response fields we use.
+//See https://oembed.com/#section2.3
+type oEmbedResponse struct {
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+//summarizeOEmbed asks the provider's oEmbed endpoint about `pageURL`
+func (p *provider) summarizeOEmbed(ctx context.Context, f Fetcher, pageURL string) (*Summary, error) {
+	endpoint, err := url.Parse(p.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	q := endpoint.Query()
+	q.Set("url", pageURL)
+	q.Set("format", "json")
+	endpoint.RawQuery = q.Encode()
+
+	resp, err := get(ctx, f, endpoint.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("oembed response status was %s", resp.Status)
+	}
+	oembed := &oEmbedResponse{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOEmbedBytes)).Decode(oembed); err != nil {
+		return nil, fmt.Errorf("error decoding oembed response: %v", err)
+	}
+
+	props := Props{
+		"url":   pageURL,
+		"title": oembed.Title,
+		"type":  oembed.Type,
+	}
+	if len(oembed.ThumbnailURL) > 0 {
+		props["image"] = oembed.ThumbnailURL
+	}
+	if len(oembed.AuthorName) > 0 {
+		props["author"] = oembed.AuthorName
+	}
+	base, _ := url.Parse(pageURL)
+	resolveURLProps(props, base)
+	return &Summary{Props: props, base: base}, nil
+}
+
+//summarizeHTML fetches `pageURL` and applies the provider's rules to it
+func (p *provider) summarizeHTML(ctx context.Context, f Fetcher, pageURL string) (*Summary, error) {
+	resp, err := get(ctx, f, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("response status was %s", resp.Status)
+	}
+
+	props := make(Props)
+	tokenizer := html.NewTokenizer(resp.Body)
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+		token := tokenizer.Token()
+		for _, rule := range p.Rules {
+			if _, found := props[rule.Prop]; found || !rule.matches(token) {
+				continue
+			}
+			if rule.Extract == extractText {
+				if tokenizer.Next() == html.TextToken {
+					props[rule.Prop] = collapseSpace(tokenizer.Token().Data)
+				}
+				break
+			}
+			if val, ok := getAttr(token, rule.Extract); ok {
+				props[rule.Prop] = val
+			}
+		}
+	}
+	resolveURLProps(props, resp.Request.URL)
+	return &Summary{Props: props, base: resp.Request.URL}, nil
+}
+
+//matches reports whether the token is the element the rule looks for
+func (rule *ProviderRule) matches(token html.Token) bool {
+	if token.Data != rule.Element {
+		return false
+	}
+	if len(rule.Attr) == 0 {
+		return true
+	}
+	val, ok := getAttr(token, rule.Attr)
+	return ok && val == rule.Value
+}
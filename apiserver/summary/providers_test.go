@@ -0,0 +1,147 @@
+package summary
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProviderLookup(t *testing.T) {
+	reg := NewProviderRegistry()
+	cases := map[string]string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ":  "YouTube",
+		"https://youtu.be/dQw4w9WgXcQ":                 "YouTube",
+		"https://vimeo.com/76979871":                   "Vimeo",
+		"https://twitter.com/golang/status/1234567890": "Twitter",
+		"https://github.com/golang/go":                 "GitHub",
+		"https://www.youtube.com/channel/whatever":     "",
+		"http://ogp.me/":                               "",
+	}
+	for u, expected := range cases {
+		p := reg.lookup(u)
+		actual := ""
+		if p != nil {
+			actual = p.Name
+		}
+		if actual != expected {
+			t.Errorf("incorrect provider for %s: expected `%s` but got `%s`\n", u, expected, actual)
+		}
+	}
+
+	var nilReg *ProviderRegistry
+	if nilReg.lookup("https://youtu.be/dQw4w9WgXcQ") != nil {
+		t.Errorf("nil registry should never match\n")
+	}
+}
+
+func TestProviderLoad(t *testing.T) {
+	invalid := []string{
+		`not json`,
+		`{"providers": [{"name": "NoPatterns", "type": "oembed", "endpoint": "https://example.com/oembed"}]}`,
+		`{"providers": [{"name": "NoEndpoint", "type": "oembed", "patterns": ["https://example.com/*"]}]}`,
+		`{"providers": [{"name": "NoRules", "type": "html", "patterns": ["https://example.com/*"]}]}`,
+		`{"providers": [{"name": "BadType", "type": "magic", "patterns": ["https://example.com/*"]}]}`,
+	}
+	for _, config := range invalid {
+		if err := NewProviderRegistry().Load(strings.NewReader(config)); err == nil {
+			t.Errorf("no error loading invalid config %s\n", config)
+		}
+	}
+
+	//loaded providers take precedence over the built-in ones
+	reg := NewProviderRegistry()
+	config := `{"providers": [{"name": "MyTube", "type": "oembed", "patterns": ["https://youtu.be/*"], "endpoint": "https://example.com/oembed"}]}`
+	if err := reg.Load(strings.NewReader(config)); err != nil {
+		t.Fatalf("error loading config: %v\n", err)
+	}
+	if p := reg.lookup("https://youtu.be/dQw4w9WgXcQ"); p == nil || p.Name != "MyTube" {
+		t.Errorf("loaded provider did not replace the built-in one\n")
+	}
+}
+
+func TestProviderSummaries(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oembed", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("format") != "json" || !strings.HasSuffix(r.FormValue("url"), "/videos/42") {
+			http.Error(w, "bad oembed request", http.StatusNotFound)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"type": "video", "title": "A Video", "author_name": "Someone",
+			"thumbnail_url": "/thumbs/42.jpg", "html": "<iframe></iframe>"}`))
+	})
+	mux.HandleFunc("/videos/", func(w http.ResponseWriter, r *http.Request) {
+		//a JS-only shell, like the sites providers are for
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>Loading...</title></head><body><div id="app"></div></body></html>`))
+	})
+	mux.HandleFunc("/code/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head>
+			<meta name="twitter:title" content="A Repository">
+			<meta name="twitter:image" content="/avatars/1.png">
+			</head><body><h2 class="about">Source code for the thing</h2></body></html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	reg := &ProviderRegistry{}
+	config := `{"providers": [
+		{"name": "Videos", "type": "oembed", "patterns": ["` + server.URL + `/videos/*"], "endpoint": "` + server.URL + `/oembed"},
+		{"name": "Code", "type": "html", "patterns": ["` + server.URL + `/code/*"], "rules": [
+			{"prop": "title", "element": "meta", "attr": "name", "value": "twitter:title", "extract": "content"},
+			{"prop": "image", "element": "meta", "attr": "name", "value": "twitter:image", "extract": "content"},
+			{"prop": "description", "element": "h2", "attr": "class", "value": "about", "extract": "text"}
+		]}
+	]}`
+	if err := reg.Load(strings.NewReader(config)); err != nil {
+		t.Fatalf("error loading config: %v\n", err)
+	}
+	s := NewSummarizer(NewHTTPFetcher(server.Client()), reg)
+
+	cases := []struct {
+		url      string
+		expected map[string]string
+	}{
+		{
+			url: server.URL + "/videos/42",
+			expected: map[string]string{
+				"title":    "A Video",
+				"type":     "video",
+				"author":   "Someone",
+				"image":    server.URL + "/thumbs/42.jpg",
+				"provider": "Videos",
+			},
+		},
+		{
+			url: server.URL + "/code/repo",
+			expected: map[string]string{
+				"title":       "A Repository",
+				"description": "Source code for the thing",
+				"image":       server.URL + "/avatars/1.png",
+				"provider":    "Code",
+			},
+		},
+		{
+			//the oembed endpoint doesn't know this one, so the generic extractor is used
+			url: server.URL + "/videos/43",
+			expected: map[string]string{
+				"title":    "Loading...",
+				"provider": "",
+			},
+		},
+	}
+	for _, c := range cases {
+		summary, err := s.Summarize(context.Background(), c.url, nil)
+		if err != nil {
+			t.Fatalf("error summarizing %s: %v\n", c.url, err)
+		}
+		for k, v := range c.expected {
+			if summary.Props[k] != v {
+				t.Errorf("%s: incorrect %s: expected `%s` but got `%s`\n", c.url, k, v, summary.Props[k])
+			}
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package summary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+//openGraphPrefix is the prefix used for Open Graph meta properties
+const openGraphPrefix = "og:"
+
+//ErrNoProperties is returned when a page has no properties to summarize
+var ErrNoProperties = errors.New("No opengraph properties")
+
+//Props represents a map of open graph property names and values
+type Props map[string]string
+
+//urlProps are the property names whose values are URLs. These are
+//resolved against the page's base URL once the whole page has been read,
+//since a <base> element or a redirect changes what relative URLs point to
+var urlProps = []string{"url", "image", "video", "canonical"}
+
+//Summary is the summary of a page: its open graph properties,
+//all of the icons it advertises, and optionally its main text
+type Summary struct {
+	Props Props
+	Icons []*Icon
+	//Article is the page's main text, when article extraction was requested
+	Article *Article
+	//base is the URL relative URLs on the page are resolved against
+	base *url.URL
+	//manifest is the URL of the page's web app manifest, if it has one
+	manifest *url.URL
+}
+
+//MarshalJSON encodes the summary as a single object with the open
+//graph properties, an `icons` array and an `article` object
+func (s *Summary) MarshalJSON() ([]byte, error) {
+	obj := make(map[string]interface{}, len(s.Props)+2)
+	for k, v := range s.Props {
+		obj[k] = v
+	}
+	if len(s.Icons) > 0 {
+		obj["icons"] = s.Icons
+	}
+	if s.Article != nil {
+		obj["article"] = s.Article
+	}
+	return json.Marshal(obj)
+}
+
+//Clone returns a copy of the summary whose properties and icons can be
+//changed without changing the original, such as when rewriting image URLs
+//of a summary that is shared or cached
+func (s *Summary) Clone() *Summary {
+	c := *s
+	c.Props = make(Props, len(s.Props))
+	for k, v := range s.Props {
+		c.Props[k] = v
+	}
+	c.Icons = make([]*Icon, len(s.Icons))
+	for i, ic := range s.Icons {
+		icon := *ic
+		c.Icons[i] = &icon
+	}
+	return &c
+}
+
+//UnmarshalJSON decodes a summary encoded by MarshalJSON, so that
+//summaries can be stored and read back. Every key other than `icons`
+//and `article` is an open graph property
+func (s *Summary) UnmarshalJSON(data []byte) error {
+	obj := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	s.Props = make(Props, len(obj))
+	for k, v := range obj {
+		var err error
+		switch k {
+		case "icons":
+			err = json.Unmarshal(v, &s.Icons)
+		case "article":
+			err = json.Unmarshal(v, &s.Article)
+		default:
+			var prop string
+			err = json.Unmarshal(v, &prop)
+			s.Props[k] = prop
+		}
+		if err != nil {
+			return fmt.Errorf("error decoding summary %s: %v", k, err)
+		}
+	}
+	return nil
+}
+
+//Options are the options for summarizing a page
+type Options struct {
+	//IconSize is the size in pixels the `icon` property should best fit.
+	//If zero, DefaultIconSize is used
+	IconSize int
+	//VerifyIcon requests that the chosen icon be checked for reachability
+	VerifyIcon bool
+	//Article requests that the page's main text be extracted too
+	Article bool
+}
+
+//Summarizer extracts summaries from pages
+type Summarizer struct {
+	//Fetcher fetches pages, manifests, icons and oEmbed responses
+	Fetcher Fetcher
+	//Providers are the providers for sites without usable meta tags.
+	//If nil, every page is summarized by the generic extractor
+	Providers *ProviderRegistry
+}
+
+//NewSummarizer constructs a new Summarizer
+func NewSummarizer(fetcher Fetcher, providers *ProviderRegistry) *Summarizer {
+	return &Summarizer{
+		Fetcher:   fetcher,
+		Providers: providers,
+	}
+}
+
+//Summarize fetches the page at `pageURL` and summarizes it, using the
+//matching provider if there is one, and falling back to the generic
+//extractor if there isn't or the provider can't produce a summary
+func (s *Summarizer) Summarize(ctx context.Context, pageURL string, opts *Options) (*Summary, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if p := s.Providers.lookup(pageURL); p != nil {
+		summary, err := p.summarize(ctx, s.Fetcher, pageURL)
+		if err == nil {
+			return summary, nil
+		}
+	}
+
+	//Get the URL
+	//If there was an error, return it
+
+	resp, err := get(ctx, s.Fetcher, pageURL)
+
+	if err != nil {
+		return nil, fmt.Errorf("error fetching the URL: %v", err)
+	}
+
+	//ensure that the response body stream is closed eventually
+	//HINTS: https://gobyexample.com/defer
+	//https://golang.org/pkg/net/http/#Response
+
+	defer resp.Body.Close()
+
+	//if the response StatusCode is >= 400
+	//return an error, using the response's .Status
+	//property as the error message
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("response status was %s", resp.Status)
+	}
+
+	//if the response's Content-Type header does not
+	//start with "text/html", return an error noting
+	//what the content type was and that you were
+	//expecting HTML
+
+	cType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(cType, "text/html") {
+		return nil, fmt.Errorf("response content type was %s and not text/html", cType)
+	}
+
+	//the response's Request is the last request the client made,
+	//so its URL is the final URL after any redirects were followed
+	return s.summarizeReader(ctx, resp.Body, resp.Request.URL, opts, s.Fetcher)
+}
+
+//SummarizeReader summarizes the HTML page read from `r`, resolving relative
+//URLs against `pageURL`. Nothing is fetched, so the page's web app manifest
+//isn't read, /favicon.ico isn't tried, and icons aren't verified even if
+//requested. This is what lets
+//pages saved to files be summarized without any network access
+func (s *Summarizer) SummarizeReader(r io.Reader, pageURL *url.URL, opts *Options) (*Summary, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	return s.summarizeReader(context.Background(), r, pageURL, opts, nil)
+}
+
+//summarizeReader summarizes the page read from `r`, using `f` to fetch
+//the manifest and verify icons, unless `f` is nil
+func (s *Summarizer) summarizeReader(ctx context.Context, r io.Reader, pageURL *url.URL, opts *Options, f Fetcher) (*Summary, error) {
+	//article mode parses the page twice, so read it all into memory
+	var page []byte
+	if opts.Article {
+		var err error
+		page, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the page: %v", err)
+		}
+		r = bytes.NewReader(page)
+	}
+
+	summary, err := extractSummary(r, pageURL)
+	if err != nil && !opts.Article {
+		return nil, err
+	}
+	if opts.Article {
+		if summary == nil {
+			//pages with no properties at all can still have an article
+			summary = &Summary{Props: make(Props), base: pageURL}
+		}
+		summary.Article, err = extractArticle(bytes.NewReader(page))
+		if err != nil {
+			return nil, fmt.Errorf("error extracting article: %v", err)
+		}
+		//pages without a description get the start of the article instead
+		if _, ok := summary.Props["description"]; !ok && len(summary.Article.Excerpt) > 0 {
+			summary.Props["description"] = summary.Article.Excerpt
+		}
+	}
+
+	if summary.manifest != nil && f != nil {
+		summary.Icons = append(summary.Icons, manifestIcons(ctx, f, summary.manifest)...)
+	}
+	//browsers try /favicon.ico when a page doesn't say otherwise,
+	//but plenty of sites don't have one, so it's only used once
+	//it's been fetched and found to be an image
+	if len(summary.Icons) == 0 && f != nil && (pageURL.Scheme == "http" || pageURL.Scheme == "https") {
+		if def := defaultIcon(pageURL); iconIsImage(ctx, f, def.URL) {
+			summary.Icons = append(summary.Icons, def)
+		}
+	}
+
+	iconSize := opts.IconSize
+	if iconSize <= 0 {
+		iconSize = DefaultIconSize
+	}
+	if best, ok := bestIcon(ctx, f, summary.Icons, iconSize, opts.VerifyIcon && f != nil); ok {
+		summary.Props["icon"] = best
+	}
+	return summary, nil
+}
+
+//hasIcon reports whether `icons` already contains an icon at `iconURL`
+func hasIcon(icons []*Icon, iconURL string) bool {
+	for _, ic := range icons {
+		if ic.URL == iconURL {
+			return true
+		}
+	}
+	return false
+}
+
+//extractSummary tokenizes the HTML read from `r` and extracts the open graph
+//properties (and fallbacks) from it. Relative URLs are resolved against
+//`pageURL` or, if the page has one, the href of its <base> element
+func extractSummary(r io.Reader, pageURL *url.URL) (*Summary, error) {
+	//create a new Props map instance to hold
+	//the Open Graph properties you find
+	//(see type definition above)
+
+	ogpMap := make(Props)
+	base := pageURL
+	var icons []*Icon
+	var manifestHref string
+
+	//tokenize the response body's HTML and extract
+	//any Open Graph properties you find into the map,
+	//using the Open Graph property name as the key, and the
+	//corresponding content as the value.
+	//strip the openGraphPrefix from the property name before
+	//you add it as a new key, so that the key is just `title`
+	//and not `og:title` (for example).
+
+	//HINTS: https://info344-s17.github.io/tutorials/tokenizing/
+	//https://godoc.org/golang.org/x/net/html
+
+	tokenizer := html.NewTokenizer(r)
+	baseFound := false
+	for {
+		tokenType := tokenizer.Next()
+		//done iterating over the url and can leave the loop
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		//meta props begin with start tag or they are self closing
+		if tokenType == html.StartTagToken || tokenType == html.SelfClosingTagToken {
+			//this gets the whole tag
+			token := tokenizer.Token()
+			//only the first <base> with an href counts, and its href
+			//is itself relative to the page URL
+			if "base" == token.Data && !baseFound {
+				if href, ok := getAttr(token, "href"); ok {
+					if u, ok := resolveURL(pageURL, href); ok {
+						base = u
+						baseFound = true
+					}
+				}
+			}
+			if "link" == token.Data {
+				if ic := iconFromLink(token); ic != nil {
+					icons = append(icons, ic)
+				}
+				if hasRel(token, relManifest) && len(manifestHref) == 0 {
+					manifestHref, _ = getAttr(token, "href")
+				}
+			}
+			ogPropHelper(token, ogpMap)
+			fallbackChecker(token, tokenizer, ogpMap)
+		}
+	}
+
+	resolveURLProps(ogpMap, base)
+
+	if len(ogpMap) == 0 && len(icons) == 0 {
+		//no props
+		return nil, ErrNoProperties
+	}
+
+	summary := &Summary{
+		Props: ogpMap,
+		base:  base,
+	}
+	for _, ic := range icons {
+		if u, ok := resolveURL(base, ic.URL); ok {
+			ic.URL = u.String()
+			summary.Icons = append(summary.Icons, ic)
+		}
+	}
+	if len(manifestHref) > 0 {
+		summary.manifest, _ = resolveURL(base, manifestHref)
+	}
+	return summary, nil
+}
+
+//getAttr returns the value of the attribute named `key` on the token,
+//and whether the attribute was present at all
+func getAttr(token html.Token, key string) (string, bool) {
+	for _, attr := range token.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+//hasRel reports whether the space-separated rel attribute of the token
+//contains `rel`, ignoring case
+func hasRel(token html.Token, rel string) bool {
+	val, _ := getAttr(token, "rel")
+	for _, r := range strings.Fields(val) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+//resolveURL resolves the possibly-relative reference `ref` against `base`
+//as described in RFC 3986, keeping its query string and fragment
+func resolveURL(base *url.URL, ref string) (*url.URL, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return nil, false
+	}
+	return base.ResolveReference(u), true
+}
+
+//resolveURLProps replaces every URL-valued property with its absolute form,
+//dropping any that can't be parsed
+func resolveURLProps(ogpProps Props, base *url.URL) {
+	for _, prop := range urlProps {
+		val, ok := ogpProps[prop]
+		if !ok {
+			continue
+		}
+		u, ok := resolveURL(base, val)
+		if !ok {
+			delete(ogpProps, prop)
+			continue
+		}
+		ogpProps[prop] = u.String()
+	}
+}
+
+//helper for finding the opengraph properties -- adds the url, title, description, image
+//and video into a opengraph map
+func ogPropHelper(token html.Token, ogpProps Props) {
+	if "meta" == token.Data {
+		property, ok := getAttr(token, "property")
+		if !ok {
+			return
+		}
+		content, ok := getAttr(token, "content")
+		if !ok {
+			return
+		}
+		//gets the meta prop and the value of it
+		prop := strings.Split(property, ":")
+		//ensures that og:image:width is not received
+		if "og" == prop[0] && len(prop) == 2 {
+			//sees the property after the open graph abbr.
+			switch prop[1] {
+			case
+				"url",
+				"title",
+				"description",
+				"image",
+				"video":
+				//relative urls are resolved once the base url is known
+				ogpProps[prop[1]] = content
+			}
+		}
+	}
+}
+
+//helper for the fallback tags if there are sans open graph tags
+func fallbackChecker(token html.Token, tokenizer *html.Tokenizer, body Props) {
+	switch token.Data {
+	case "title":
+		title := tokenizer.Next()
+		if title == html.TextToken {
+			//checks to see if title is already in the map
+			_, ok := body["title"]
+			if !ok {
+				body["title"] = tokenizer.Token().Data
+			}
+		}
+	case "link":
+		href, ok := getAttr(token, "href")
+		if ok && hasRel(token, "canonical") {
+			body["canonical"] = href
+		}
+	case "meta":
+		name, _ := getAttr(token, "name")
+		if "description" == name {
+			//checks to see if description already there
+			_, ok := body["description"]
+			content, hasContent := getAttr(token, "content")
+			if !ok && hasContent {
+				body["description"] = content
+			}
+		}
+	}
+}
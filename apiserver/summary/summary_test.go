@@ -0,0 +1,247 @@
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRelativeURLResolution(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old/page", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/articles/2017/page.html", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/articles/2017/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head>
+			<title>Fallback Title</title>
+			<meta property="og:image" content="img/cover.png?size=large">
+			<meta property="og:video" content="//videos.example.com/clip.mp4">
+			<meta property="og:url" content="../2017/page.html#top">
+			<link rel="canonical" href="/canonical/page">
+			<link rel="shortcut icon" href="favicon.ico">
+			</head><body></body></html>`))
+	})
+	mux.HandleFunc("/based", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head>
+			<meta property="og:image" content="cover.png">
+			<base href="/static/">
+			<base href="/ignored/">
+			</head><body></body></html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := NewSummarizer(NewHTTPFetcher(server.Client()), nil)
+	summary, err := s.Summarize(context.Background(), server.URL+"/old/page", nil)
+	if err != nil {
+		t.Fatalf("error getting summary: %v", err)
+	}
+	props := summary.Props
+	expected := map[string]string{
+		"title":     "Fallback Title",
+		"image":     server.URL + "/articles/2017/img/cover.png?size=large",
+		"video":     "http://videos.example.com/clip.mp4",
+		"url":       server.URL + "/articles/2017/page.html#top",
+		"canonical": server.URL + "/canonical/page",
+		"icon":      server.URL + "/articles/2017/favicon.ico",
+	}
+	for k, v := range expected {
+		if props[k] != v {
+			t.Errorf("incorrect %s: expected `%s` but got `%s`\n", k, v, props[k])
+		}
+	}
+
+	summary, err = s.Summarize(context.Background(), server.URL+"/based", nil)
+	if err != nil {
+		t.Fatalf("error getting summary: %v", err)
+	}
+	props = summary.Props
+	if props["image"] != server.URL+"/static/cover.png" {
+		t.Errorf("incorrect image with base element: expected `%s` but got `%s`\n", server.URL+"/static/cover.png", props["image"])
+	}
+}
+
+func TestIconSelection(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head>
+			<link rel="icon" href="/icons/16.png" sizes="16x16" type="image/png">
+			<link rel="icon" href="/icons/multi.ico" sizes="32x32 48x48">
+			<link rel="apple-touch-icon" href="/icons/touch.png">
+			<link rel="manifest" href="/app/manifest.json">
+			</head><body></body></html>`))
+	})
+	mux.HandleFunc("/app/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/manifest+json")
+		w.Write([]byte(`{"icons": [
+			{"src": "icon-512.png", "sizes": "512x512", "type": "image/png"},
+			{"src": "icon-96.png", "sizes": "96x96", "type": "image/png"}
+		]}`))
+	})
+	mux.HandleFunc("/icons/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/icons/multi.ico" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Add("Content-Type", "image/png")
+	})
+	mux.HandleFunc("/app/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "image/png")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	s := NewSummarizer(NewHTTPFetcher(server.Client()), nil)
+
+	cases := []struct {
+		size     int
+		verify   bool
+		expected string
+	}{
+		{16, false, "/icons/16.png"},
+		{32, false, "/icons/multi.ico"},
+		{40, false, "/icons/multi.ico"},
+		{64, false, "/app/icon-96.png"},
+		{150, false, "/icons/touch.png"},
+		{300, false, "/app/icon-512.png"},
+		{1024, false, "/app/icon-512.png"},
+		//multi.ico is missing, so the next best icon is used
+		{32, true, "/app/icon-96.png"},
+	}
+	for _, c := range cases {
+		summary, err := s.Summarize(context.Background(), server.URL, &Options{IconSize: c.size, VerifyIcon: c.verify})
+		if err != nil {
+			t.Fatalf("error getting summary: %v", err)
+		}
+		if summary.Props["icon"] != server.URL+c.expected {
+			t.Errorf("incorrect icon for size %d: expected `%s` but got `%s`\n", c.size, server.URL+c.expected, summary.Props["icon"])
+		}
+		//the 3 declared and 2 from the manifest, but not /favicon.ico
+		//since the page has icons of its own
+		if len(summary.Icons) != 5 {
+			t.Errorf("incorrect number of icon candidates: expected 5 but got %d\n", len(summary.Icons))
+		}
+	}
+}
+
+func TestDefaultIcon(t *testing.T) {
+	favicon := http.NotFound
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>No Icons</title></head><body></body></html>`))
+	})
+	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+		favicon(w, r)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	s := NewSummarizer(NewHTTPFetcher(server.Client()), nil)
+
+	//a missing /favicon.ico isn't used
+	summary, err := s.Summarize(context.Background(), server.URL, nil)
+	if err != nil {
+		t.Fatalf("error getting summary: %v", err)
+	}
+	if icon, ok := summary.Props["icon"]; ok || len(summary.Icons) != 0 {
+		t.Errorf("expected no icon but got `%s`\n", icon)
+	}
+
+	//neither is one that isn't an image
+	favicon = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "text/html")
+	}
+	if summary, _ := s.Summarize(context.Background(), server.URL, nil); len(summary.Icons) != 0 {
+		t.Errorf("expected no icon for a page that isn't an image but got %v\n", summary.Props["icon"])
+	}
+
+	//one that is an image is the icon, but never the image
+	favicon = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "image/x-icon")
+	}
+	summary, err = s.Summarize(context.Background(), server.URL, nil)
+	if err != nil {
+		t.Fatalf("error getting summary: %v", err)
+	}
+	if summary.Props["icon"] != server.URL+"/favicon.ico" {
+		t.Errorf("incorrect icon: expected `%s` but got `%s`\n", server.URL+"/favicon.ico", summary.Props["icon"])
+	}
+	if image, ok := summary.Props["image"]; ok {
+		t.Errorf("the icon should not be used as the image, but got `%s`\n", image)
+	}
+}
+
+func TestSafeFetcherRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("safe fetcher connected to a loopback address")
+	}))
+	defer server.Close()
+
+	f := NewSafeFetcher(DefaultFetchTimeout)
+	if _, err := get(context.Background(), f, server.URL); err == nil || !strings.Contains(err.Error(), ErrNonPublicAddress.Error()) {
+		t.Errorf("no error fetching a loopback address\n")
+	}
+	if _, err := get(context.Background(), f, "file:///etc/passwd"); err != ErrUnsupportedScheme {
+		t.Errorf("no error fetching a file URL\n")
+	}
+}
+
+func TestSummarizeReader(t *testing.T) {
+	page := `<html><head>
+		<title>Local Page</title>
+		<meta property="og:image" content="images/cover.png">
+		</head><body></body></html>`
+	pageURL, _ := url.Parse("http://example.com/posts/local.html")
+	s := NewSummarizer(nil, nil)
+	summary, err := s.SummarizeReader(strings.NewReader(page), pageURL, nil)
+	if err != nil {
+		t.Fatalf("error getting summary: %v", err)
+	}
+	expected := map[string]string{
+		"title": "Local Page",
+		"image": "http://example.com/posts/images/cover.png",
+	}
+	for k, v := range expected {
+		if summary.Props[k] != v {
+			t.Errorf("incorrect %s: expected `%s` but got `%s`\n", k, v, summary.Props[k])
+		}
+	}
+	//nothing is fetched, so /favicon.ico isn't tried
+	if icon, ok := summary.Props["icon"]; ok {
+		t.Errorf("expected no icon but got `%s`\n", icon)
+	}
+}
+
+func TestSummaryJSONRoundTrip(t *testing.T) {
+	sum := &Summary{
+		Props: Props{
+			"title": "Title",
+			"image": "http://example.com/image.png",
+		},
+		Icons:   []*Icon{{URL: "http://example.com/favicon.ico", Rel: relDefault}},
+		Article: &Article{Excerpt: "Some text", WordCount: 2, Lang: "en"},
+	}
+	data, err := json.Marshal(sum)
+	if err != nil {
+		t.Fatalf("error encoding summary: %v", err)
+	}
+	decoded := &Summary{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("error decoding summary: %v", err)
+	}
+	if len(decoded.Props) != 2 || decoded.Props["title"] != "Title" || decoded.Props["image"] != sum.Props["image"] {
+		t.Errorf("incorrect props after decoding: %v\n", decoded.Props)
+	}
+	if len(decoded.Icons) != 1 || decoded.Icons[0].URL != sum.Icons[0].URL {
+		t.Errorf("incorrect icons after decoding: %v\n", decoded.Icons)
+	}
+	if decoded.Article == nil || decoded.Article.Excerpt != "Some text" {
+		t.Errorf("incorrect article after decoding: %v\n", decoded.Article)
+	}
+}
@@ -0,0 +1,13 @@
+/*
+Package unfurl attaches link previews to user-submitted content.
+
+The Service scans text for http(s) links and summarizes them in the
+background using the summary package, so that writes of the content
+itself are never slowed down by remote sites. The previews are saved
+to a Store against the ID of the record that owns the text, such as a
+message, and read back when that record is sent to clients.
+
+There are two implementations of Store: MemStore, backed by an in-memory
+map, and PGStore, backed by a PostgreSQL database.
+*/
+package unfurl
@@ -0,0 +1,58 @@
+package unfurl
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+//MaxLinks is the most links in one text that are unfurled
+const MaxLinks = 5
+
+//linkPattern matches the http(s) URLs in some text. Links end at
+//whitespace, or at characters that are rarely part of a URL but
+//often wrap one in text, such as angle brackets and quotes
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'` + "`" + `]+`)
+
+//trailingPunctuation is punctuation that usually ends the sentence
+//rather than the link, such as the period in "see http://example.com."
+const trailingPunctuation = ".,;:!?"
+
+//FindLinks returns the distinct http(s) links in `text`, in the order
+//they first appear, up to MaxLinks of them
+func FindLinks(text string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, match := range linkPattern.FindAllString(text, -1) {
+		link := trimLink(match)
+		u, err := url.Parse(link)
+		if err != nil || len(u.Host) == 0 || seen[link] {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+		if len(links) == MaxLinks {
+			break
+		}
+	}
+	return links
+}
+
+//trimLink removes the punctuation that ends a sentence or closes a
+//parenthetical from the end of the link. Closing parens are kept if
+//the link has a matching opening paren, as in Wikipedia URLs
+func trimLink(link string) string {
+	for len(link) > 0 {
+		last := link[len(link)-1]
+		if strings.IndexByte(trailingPunctuation, last) >= 0 {
+			link = link[:len(link)-1]
+			continue
+		}
+		if last == ')' && strings.Count(link, "(") < strings.Count(link, ")") {
+			link = link[:len(link)-1]
+			continue
+		}
+		break
+	}
+	return link
+}
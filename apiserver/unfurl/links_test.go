@@ -0,0 +1,35 @@
+package unfurl
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestFindLinks(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected []string
+	}{
+		{"no links here", nil},
+		{"see http://example.com.", []string{"http://example.com"}},
+		{"(details at https://example.com/a?b=c)", []string{"https://example.com/a?b=c"}},
+		{"https://en.wikipedia.org/wiki/Go_(programming_language), neat", []string{"https://en.wikipedia.org/wiki/Go_(programming_language)"}},
+		{`<a href="http://example.com/x">`, []string{"http://example.com/x"}},
+		{"HTTP://EXAMPLE.COM and ftp://example.com and http://", []string{"HTTP://EXAMPLE.COM"}},
+		{"http://a.com http://b.com http://a.com", []string{"http://a.com", "http://b.com"}},
+	}
+	for _, c := range cases {
+		if links := FindLinks(c.text); !reflect.DeepEqual(links, c.expected) {
+			t.Errorf("incorrect links in %q: expected %v but got %v\n", c.text, c.expected, links)
+		}
+	}
+
+	many := "http://example.com/page"
+	for i := 0; i <= MaxLinks; i++ {
+		many += " http://example.com/" + strconv.Itoa(i)
+	}
+	if links := FindLinks(many); len(links) != MaxLinks {
+		t.Errorf("expected at most %d links but got %d\n", MaxLinks, len(links))
+	}
+}
@@ -0,0 +1,45 @@
+package unfurl
+
+import "sync"
+
+//MemStore is an implementation of Store backed by an in-memory map.
+//It is safe for concurrent access, since previews are saved by the
+//Service's workers while handlers read them
+type MemStore struct {
+	entries map[string][]*Preview
+	mx      sync.RWMutex
+}
+
+//NewMemStore returns a new MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		entries: make(map[string][]*Preview),
+	}
+}
+
+//Save replaces the previews saved for `owner`
+func (ms *MemStore) Save(owner string, previews []*Preview) error {
+	saved := make([]*Preview, len(previews))
+	copy(saved, previews)
+	ms.mx.Lock()
+	ms.entries[owner] = saved
+	ms.mx.Unlock()
+	return nil
+}
+
+//Get returns the previews saved for `owner`
+func (ms *MemStore) Get(owner string) ([]*Preview, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	previews := make([]*Preview, len(ms.entries[owner]))
+	copy(previews, ms.entries[owner])
+	return previews, nil
+}
+
+//Delete deletes the previews saved for `owner`
+func (ms *MemStore) Delete(owner string) error {
+	ms.mx.Lock()
+	delete(ms.entries, owner)
+	ms.mx.Unlock()
+	return nil
+}
@@ -0,0 +1,65 @@
+package unfurl
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+//PGStore is an implementation of Store backed by a PostgreSQL
+//database, using the previews table. Each summary is stored as JSON
+type PGStore struct {
+	DB *sql.DB
+}
+
+//Save replaces the previews saved for `owner`
+func (ps *PGStore) Save(owner string, previews []*Preview) error {
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM previews WHERE Owner = $1`, owner); err != nil {
+		tx.Rollback()
+		return err
+	}
+	sql := `INSERT INTO previews (Owner, Position, URL, Summary) VALUES ($1, $2, $3, $4)`
+	for i, p := range previews {
+		summaryJSON, err := json.Marshal(p.Summary)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(sql, owner, i, p.URL, summaryJSON); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//Get returns the previews saved for `owner`
+func (ps *PGStore) Get(owner string) ([]*Preview, error) {
+	rows, err := ps.DB.Query(`SELECT URL, Summary FROM previews WHERE Owner = $1 ORDER BY Position`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	previews := []*Preview{}
+	for rows.Next() {
+		p := &Preview{}
+		var summaryJSON []byte
+		if err := rows.Scan(&p.URL, &summaryJSON); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(summaryJSON, &p.Summary); err != nil {
+			return nil, err
+		}
+		previews = append(previews, p)
+	}
+	return previews, rows.Err()
+}
+
+//Delete deletes the previews saved for `owner`
+func (ps *PGStore) Delete(owner string) error {
+	_, err := ps.DB.Exec(`DELETE FROM previews WHERE Owner = $1`, owner)
+	return err
+}
@@ -0,0 +1,207 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/summary"
+)
+
+const (
+	//DefaultWorkers is the default number of texts unfurled at once
+	DefaultWorkers = 4
+	//DefaultQueueSize is the default number of texts that can be waiting
+	DefaultQueueSize = 1000
+	//unfurlTimeout is how long we wait for all the links in one text
+	unfurlTimeout = 30 * time.Second
+	//writeLocks is how many locks the owners' store writes are spread over
+	writeLocks = 64
+)
+
+//ErrQueueFull is returned when there are too many texts waiting to be unfurled
+var ErrQueueFull = errors.New("unfurl queue is full")
+
+//ErrClosed is returned when the Service has been closed
+var ErrClosed = errors.New("unfurl service is closed")
+
+//job is a request to unfurl the links in one record's text
+type job struct {
+	owner string
+	links []string
+	//version identifies this job, so that a job for text that
+	//has since been edited or deleted doesn't save its previews
+	version uint64
+}
+
+//Service unfurls the links in text using a pool of background workers
+type Service struct {
+	summarizer *summary.Summarizer
+	store      Store
+	//OnUnfurled, if set, is called by a worker after it saves the previews
+	//for an owner, so that clients can be told about them. It must be set
+	//before any text is unfurled
+	OnUnfurled func(owner string, previews []*Preview)
+
+	jobs   chan *job
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	//writes serialize the store writes for each owner, so that a stale
+	//job can't overwrite newer previews, nor save previews after they've
+	//been deleted. mx is never held while writing to the store
+	writes   [writeLocks]sync.Mutex
+	mx       sync.Mutex
+	closed   bool
+	versions map[string]uint64
+	version  uint64
+}
+
+//NewService constructs a new Service that summarizes links with
+//`summarizer` and saves the previews to `store`. It starts `workers`
+//background workers, and allows `queueSize` texts to be waiting for them
+func NewService(summarizer *summary.Summarizer, store Store, workers int, queueSize int) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	svc := &Service{
+		summarizer: summarizer,
+		store:      store,
+		jobs:       make(chan *job, queueSize),
+		ctx:        ctx,
+		cancel:     cancel,
+		versions:   make(map[string]uint64),
+	}
+	for i := 0; i < workers; i++ {
+		svc.wg.Add(1)
+		go svc.work()
+	}
+	return svc
+}
+
+//Unfurl queues the links in `text` to be summarized and saved as the
+//previews of `owner`, replacing any it already has. It never waits for
+//the links to be fetched, and returns ErrQueueFull rather than waiting
+//for room in the queue. Text without links removes the owner's previews
+func (svc *Service) Unfurl(owner string, text string) error {
+	links := FindLinks(text)
+	if len(links) == 0 {
+		return svc.Forget(owner)
+	}
+
+	svc.mx.Lock()
+	defer svc.mx.Unlock()
+	if svc.closed {
+		return ErrClosed
+	}
+	svc.version++
+	j := &job{owner: owner, links: links, version: svc.version}
+	select {
+	case svc.jobs <- j:
+		svc.versions[owner] = j.version
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+//Forget deletes the previews of `owner`, and stops any queued or
+//running unfurl for it from saving previews. Call this when the
+//owning record is deleted
+func (svc *Service) Forget(owner string) error {
+	svc.mx.Lock()
+	delete(svc.versions, owner)
+	svc.mx.Unlock()
+
+	//a job already saving its previews is let finish, so they're deleted
+	wl := svc.writeLock(owner)
+	wl.Lock()
+	defer wl.Unlock()
+	return svc.store.Delete(owner)
+}
+
+//writeLock returns the lock for writing the previews of `owner`
+func (svc *Service) writeLock(owner string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(owner))
+	return &svc.writes[h.Sum32()%writeLocks]
+}
+
+//current reports whether `j` is the latest job for its owner
+func (svc *Service) current(j *job) bool {
+	svc.mx.Lock()
+	defer svc.mx.Unlock()
+	return svc.versions[j.owner] == j.version
+}
+
+//Previews returns the saved previews of `owner`
+func (svc *Service) Previews(owner string) ([]*Preview, error) {
+	return svc.store.Get(owner)
+}
+
+//Close stops the workers, abandoning any unfurls that are still
+//queued or running, and waits for the workers to finish
+func (svc *Service) Close() {
+	svc.mx.Lock()
+	if !svc.closed {
+		svc.closed = true
+		svc.cancel()
+		close(svc.jobs)
+	}
+	svc.mx.Unlock()
+	svc.wg.Wait()
+}
+
+//work unfurls queued jobs until the jobs channel is closed
+func (svc *Service) work() {
+	defer svc.wg.Done()
+	for j := range svc.jobs {
+		if svc.ctx.Err() != nil {
+			continue
+		}
+		previews := svc.unfurl(j)
+		if previews == nil {
+			continue
+		}
+		if svc.OnUnfurled != nil {
+			svc.OnUnfurled(j.owner, previews)
+		}
+	}
+}
+
+//unfurl summarizes the links of the job and saves the previews, returning
+//the previews saved, or nil if the job was stale or they couldn't be saved
+func (svc *Service) unfurl(j *job) []*Preview {
+	ctx, cancel := context.WithTimeout(svc.ctx, unfurlTimeout)
+	defer cancel()
+	results := svc.summarizer.SummarizeBatch(ctx, j.links, nil, nil)
+	//links that couldn't be summarized are left out
+	previews := []*Preview{}
+	for _, res := range results {
+		if res.Summary != nil {
+			previews = append(previews, &Preview{URL: res.URL, Summary: res.Summary})
+		}
+	}
+
+	//the text may have been edited or deleted while the links were
+	//fetched, so check the job is still current once nothing else can
+	//write the owner's previews
+	wl := svc.writeLock(j.owner)
+	wl.Lock()
+	defer wl.Unlock()
+	if !svc.current(j) {
+		return nil
+	}
+	if err := svc.store.Save(j.owner, previews); err != nil {
+		log.Printf("error saving previews for %s: %v", j.owner, err)
+		return nil
+	}
+	//newer jobs are left to save their own previews
+	svc.mx.Lock()
+	if svc.versions[j.owner] == j.version {
+		delete(svc.versions, j.owner)
+	}
+	svc.mx.Unlock()
+	return previews
+}
@@ -0,0 +1,160 @@
+package unfurl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/info344-s17/challenges-leedann/apiserver/summary"
+)
+
+func TestService(t *testing.T) {
+	//release lets the test decide when slow pages are served
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>` + r.URL.Path + `</title></head></html>`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	s := summary.NewSummarizer(summary.NewHTTPFetcher(server.Client()), nil)
+	store := NewMemStore()
+	svc := NewService(s, store, 2, 10)
+	defer svc.Close()
+	unfurled := make(chan string, 10)
+	svc.OnUnfurled = func(owner string, previews []*Preview) {
+		unfurled <- owner
+	}
+	wait := func(owner string) {
+		select {
+		case o := <-unfurled:
+			if o != owner {
+				t.Fatalf("expected %s to be unfurled but got %s\n", owner, o)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s to be unfurled\n", owner)
+		}
+	}
+
+	text := "look at " + server.URL + "/one and " + server.URL + "/missing, and " + server.URL + "/two."
+	if err := svc.Unfurl("message:1", text); err != nil {
+		t.Fatalf("error unfurling: %v\n", err)
+	}
+	wait("message:1")
+	previews, err := svc.Previews("message:1")
+	if err != nil {
+		t.Fatalf("error getting previews: %v\n", err)
+	}
+	if len(previews) != 2 {
+		t.Fatalf("expected 2 previews but got %d\n", len(previews))
+	}
+	for i, title := range []string{"/one", "/two"} {
+		if previews[i].Summary.Props["title"] != title {
+			t.Errorf("incorrect preview %d: expected title %s but got %s\n", i, title, previews[i].Summary.Props["title"])
+		}
+	}
+
+	//an edit made while the original text is still being unfurled wins
+	if err := svc.Unfurl("message:2", server.URL+"/slow"); err != nil {
+		t.Fatalf("error unfurling: %v\n", err)
+	}
+	if err := svc.Unfurl("message:2", server.URL+"/edited"); err != nil {
+		t.Fatalf("error unfurling: %v\n", err)
+	}
+	wait("message:2")
+	release <- struct{}{}
+	previews, _ = svc.Previews("message:2")
+	if len(previews) != 1 || previews[0].URL != server.URL+"/edited" {
+		t.Errorf("expected only the edited link to be previewed but got %v\n", previews)
+	}
+
+	//editing the links out removes the previews
+	if err := svc.Unfurl("message:1", "no more links"); err != nil {
+		t.Fatalf("error unfurling: %v\n", err)
+	}
+	if previews, _ := svc.Previews("message:1"); len(previews) != 0 {
+		t.Errorf("expected no previews after removing the links but got %d\n", len(previews))
+	}
+}
+
+func TestServiceQueueFull(t *testing.T) {
+	s := summary.NewSummarizer(summary.NewHTTPFetcher(http.DefaultClient), nil)
+	//no workers, so nothing is taken off the queue
+	svc := NewService(s, NewMemStore(), 0, 1)
+	if err := svc.Unfurl("a", "http://example.com/a"); err != nil {
+		t.Fatalf("error unfurling: %v\n", err)
+	}
+	if err := svc.Unfurl("b", "http://example.com/b"); err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull but got %v\n", err)
+	}
+	svc.Close()
+	if err := svc.Unfurl("c", "http://example.com/c"); err != ErrClosed {
+		t.Errorf("expected ErrClosed but got %v\n", err)
+	}
+}
+
+//slowStore is a Store whose saves wait until they're released
+type slowStore struct {
+	*MemStore
+	saving  chan string
+	release chan struct{}
+}
+
+func (ss *slowStore) Save(owner string, previews []*Preview) error {
+	ss.saving <- owner
+	<-ss.release
+	return ss.MemStore.Save(owner, previews)
+}
+
+func TestServiceSlowStore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>page</title></head></html>`))
+	}))
+	defer server.Close()
+
+	s := summary.NewSummarizer(summary.NewHTTPFetcher(server.Client()), nil)
+	store := &slowStore{MemStore: NewMemStore(), saving: make(chan string, 10), release: make(chan struct{})}
+	svc := NewService(s, store, 1, 10)
+	defer svc.Close()
+	if err := svc.Unfurl("message:1", server.URL+"/page"); err != nil {
+		t.Fatalf("error unfurling: %v\n", err)
+	}
+	select {
+	case <-store.saving:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the previews to be saved\n")
+	}
+
+	//other text can be queued while the store is slow
+	queued := make(chan error, 1)
+	go func() { queued <- svc.Unfurl("message:2", server.URL+"/page") }()
+	select {
+	case err := <-queued:
+		if err != nil {
+			t.Fatalf("error unfurling: %v\n", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("queueing text waited for the store\n")
+	}
+
+	//deleting the text while its previews are being saved deletes them
+	forgotten := make(chan error, 1)
+	go func() { forgotten <- svc.Forget("message:1") }()
+	close(store.release)
+	if err := <-forgotten; err != nil {
+		t.Fatalf("error forgetting: %v\n", err)
+	}
+	if previews, _ := svc.Previews("message:1"); len(previews) != 0 {
+		t.Errorf("expected the previews to be deleted but got %d\n", len(previews))
+	}
+}
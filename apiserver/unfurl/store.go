@@ -0,0 +1,24 @@
+package unfurl
+
+import "github.com/info344-s17/challenges-leedann/apiserver/summary"
+
+//Preview is the summary of one link in some content
+type Preview struct {
+	URL     string           `json:"url"`
+	Summary *summary.Summary `json:"summary"`
+}
+
+//Store represents an abstract store for the previews of
+//each record's links, keyed by the ID of the owning record
+type Store interface {
+	//Save replaces the previews saved for `owner`
+	Save(owner string, previews []*Preview) error
+
+	//Get returns the previews saved for `owner`, in the order the links
+	//appear in its text. It returns no previews and no error when none
+	//have been saved
+	Get(owner string) ([]*Preview, error)
+
+	//Delete deletes the previews saved for `owner`
+	Delete(owner string) error
+}